@@ -17,6 +17,9 @@ const (
 	Google          = Provider("GOOGLE")
 	EmailAndPass    = Provider("EMAIL_AND_PASS")
 	Facebook        = Provider("FACEBOOK")
+	// OIDC is whichever OpenID Connect issuer the server is configured with,
+	// see the oidcauth package.
+	OIDC = Provider("OIDC")
 )
 
 // Token is a representation of a user's auth token, which contains
@@ -28,7 +31,10 @@ type Token struct {
 
 // UserInfo contains basic information relevant for authentication.
 type UserInfo struct {
-	UserID       UserID   `json:"user_id"` // The Auth-provider's UserId
-	Email        string   `json:"email"`
-	AuthProvider Provider `json:"auth_provider"`
+	UserID UserID `json:"user_id"` // The Auth-provider's UserId
+	Email  string `json:"email"`
+	// EmailVerified is whether the auth provider has confirmed that the user
+	// owns Email.
+	EmailVerified bool     `json:"email_verified"`
+	AuthProvider  Provider `json:"auth_provider"`
 }
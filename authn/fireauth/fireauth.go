@@ -89,10 +89,15 @@ func userInfoFromToken(tkn *firebaseauth.Token) (*authn.UserInfo, error) {
 		return nil, fmt.Errorf("email identity of type %T, expected string", emails[0])
 	}
 
+	// email_verified is a standard claim that Firebase sets for every
+	// provider, a missing or malformed one is treated as unverified.
+	emailVerified, _ := tkn.Claims["email_verified"].(bool)
+
 	return &authn.UserInfo{
-		UserID:       authn.UserID(tkn.UID),
-		Email:        email,
-		AuthProvider: provider,
+		UserID:        authn.UserID(tkn.UID),
+		Email:         email,
+		EmailVerified: emailVerified,
+		AuthProvider:  provider,
 	}, nil
 }
 
@@ -127,6 +132,17 @@ func (c *Client) SessionCookie(ctx context.Context, idToken string, expiresIn ti
 	return c.client.SessionCookie(ctx, idToken, expiresIn)
 }
 
+// ManagesProvider reports whether identities from the provider are Firebase
+// users, which are the providers that toAuthProvider knows.
+func (c *Client) ManagesProvider(p authn.Provider) bool {
+	switch p {
+	case authn.Google, authn.EmailAndPass, authn.Facebook:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *Client) RevokeRefreshTokens(ctx context.Context, uID authn.UserID) error {
 	return c.client.RevokeRefreshTokens(ctx, string(uID))
 }
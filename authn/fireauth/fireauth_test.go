@@ -86,6 +86,27 @@ func TestUserInfoFromToken(t *testing.T) {
 				Email:        "test-email@example.com",
 			},
 		},
+		{
+			desc: "verified email",
+			in: &firebaseauth.Token{
+				UID:    "user-id",
+				Claims: map[string]interface{}{"email_verified": true},
+				Firebase: firebaseauth.FirebaseInfo{
+					SignInProvider: "password",
+					Identities: map[string]interface{}{
+						"email": []interface{}{
+							"test-email@example.com",
+						},
+					},
+				},
+			},
+			want: &authn.UserInfo{
+				UserID:        "user-id",
+				AuthProvider:  authn.EmailAndPass,
+				Email:         "test-email@example.com",
+				EmailVerified: true,
+			},
+		},
 		{
 			desc: "invalid provider",
 			in: &firebaseauth.Token{
@@ -0,0 +1,227 @@
+package oidcauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxKeyAge is how long the issuer's keys are cached for before they're
+	// fetched again, which is how keys the issuer stopped publishing expire.
+	maxKeyAge = time.Hour
+	// minRefreshInterval is how often the keys can be fetched because of a
+	// token signed by a key we haven't seen, so that a flood of bad tokens
+	// can't make us flood the issuer.
+	minRefreshInterval = time.Minute
+	// maxResponseSize bounds what we'll read from the issuer.
+	maxResponseSize = 1 << 20
+)
+
+// providerMetadata is the part of the issuer's discovery document that we use,
+// see https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type providerMetadata struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+func discover(ctx context.Context, client *http.Client, issuer string) (*providerMetadata, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	var md providerMetadata
+	if err := getJSON(ctx, client, wellKnown, &md); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	// The spec requires them to match exactly, which stops one issuer from
+	// impersonating another.
+	if md.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document was for issuer %q, wanted %q", md.Issuer, issuer)
+	}
+	if md.JWKSURI == "" {
+		return nil, errors.New("discovery document had no jwks_uri")
+	}
+	return &md, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to GET %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// keySet caches the keys the issuer signs ID tokens with. Issuers rotate keys
+// by publishing a new key before they start signing with it, so a token signed
+// by a key we haven't seen makes us fetch the keys again.
+type keySet struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	// mu is held while fetching, so that concurrent requests for a new key
+	// only fetch the keys once.
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+	// fetchedAt is when keys were last fetched, and attemptedAt is when we
+	// last tried to, successfully or not.
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func newKeySet(url string, client *http.Client, now func() time.Time) *keySet {
+	return &keySet{url: url, client: client, now: now}
+}
+
+// key returns the key with the given ID. Tokens without a key ID can be used
+// with issuers that only publish one key.
+func (ks *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := ks.now()
+	k, ok := ks.lookup(kid)
+	stale := now.Sub(ks.fetchedAt) > maxKeyAge
+	if ok && !stale {
+		return k, nil
+	}
+	if !ks.attemptedAt.IsZero() && now.Sub(ks.attemptedAt) < minRefreshInterval {
+		if ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("no signing key with ID %q", kid)
+	}
+
+	ks.attemptedAt = now
+	if err := ks.refresh(ctx); err != nil {
+		// If the issuer is briefly unavailable, we keep using the keys we have.
+		if ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("failed to refresh signing keys: %w", err)
+	}
+	ks.fetchedAt = now
+	if k, ok := ks.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no signing key with ID %q", kid)
+}
+
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+func (ks *keySet) refresh(ctx context.Context) error {
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, ks.client, ks.url, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Issuers can publish keys of types we don't support, which
+			// tokens we accept won't be signed with anyway.
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("issuer published no usable signing keys")
+	}
+	ks.keys = keys
+	return nil
+}
+
+// jwk is a public key in JSON Web Key form, see
+// https://www.rfc-editor.org/rfc/rfc7517 and
+// https://www.rfc-editor.org/rfc/rfc7518#section-6
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X and Y are the curve and point of EC keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode modulus: %w", err)
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode exponent: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 || exp.Int64() < 3 {
+			return nil, fmt.Errorf("invalid exponent %v", exp)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode x: %w", err)
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode y: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point isn't on the curve")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
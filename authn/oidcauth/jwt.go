@@ -0,0 +1,233 @@
+package oidcauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // Registers SHA-384 and SHA-512 for RS384, RS512 and ES384.
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// b64 is the encoding of each part of a JWT.
+var b64 = base64.RawURLEncoding
+
+// jwt is a JSON Web Token in compact form, split into its parts. Parsing one
+// doesn't check its signature, see verify and verifyHMAC.
+type jwt struct {
+	header jwtHeader
+	// claims is the JSON-encoded payload.
+	claims []byte
+	// signed is the part of the token that the signature covers.
+	signed    []byte
+	signature []byte
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+func parseJWT(s string) (*jwt, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token had %d parts, wanted 3", len(parts))
+	}
+	header, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	claims, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+	t := &jwt{
+		claims:    claims,
+		signed:    []byte(parts[0] + "." + parts[1]),
+		signature: sig,
+	}
+	if err := json.Unmarshal(header, &t.header); err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+	return t, nil
+}
+
+// signingAlg is an asymmetric algorithm that ID tokens can be signed with.
+type signingAlg struct {
+	hash crypto.Hash
+	// curve is the curve of ECDSA algorithms, and nil for RSA ones.
+	curve elliptic.Curve
+}
+
+// signingAlgs are the algorithms we accept ID tokens signed with. Notably, it
+// leaves out "none", and the HMAC algorithms, which an attacker could use to
+// sign a token with the issuer's public key as the secret.
+var signingAlgs = map[string]signingAlg{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, curve: elliptic.P384()},
+}
+
+// verify checks that the token was signed by the given public key.
+func (t *jwt) verify(key crypto.PublicKey) error {
+	alg, ok := signingAlgs[t.header.Alg]
+	if !ok {
+		return fmt.Errorf("unsupported signing algorithm %q", t.header.Alg)
+	}
+	h := alg.hash.New()
+	h.Write(t.signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg.curve != nil {
+			return fmt.Errorf("algorithm %q can't be used with an RSA key", t.header.Alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, alg.hash, digest, t.signature); err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg.curve != k.Curve {
+			return fmt.Errorf("algorithm %q can't be used with a key on curve %s", t.header.Alg, k.Curve.Params().Name)
+		}
+		// JWS signatures are r and s concatenated, each padded to the size of
+		// the curve, rather than ASN.1.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return fmt.Errorf("signature was %d bytes, wanted %d", len(t.signature), 2*size)
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// signHMAC returns a token with the given claims, signed with HS256.
+func signHMAC(key []byte, claims interface{}) (string, error) {
+	header, err := json.Marshal(&jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode header: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode claims: %w", err)
+	}
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + b64.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyHMAC checks that the token was signed with HS256 and the given key.
+func (t *jwt) verifyHMAC(key []byte) error {
+	if t.header.Alg != "HS256" {
+		return fmt.Errorf("unexpected signing algorithm %q", t.header.Alg)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(t.signed)
+	if !hmac.Equal(mac.Sum(nil), t.signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// numericDate is a JWT timestamp, in seconds since the epoch. The spec allows
+// fractional seconds, which are dropped.
+type numericDate int64
+
+func newNumericDate(t time.Time) numericDate {
+	return numericDate(t.Unix())
+}
+
+func (d numericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+func (d *numericDate) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s: %w", b, err)
+	}
+	*d = numericDate(f)
+	return nil
+}
+
+// audience is the "aud" claim, which is either a single string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return fmt.Errorf("audience was neither a string nor a list of strings: %w", err)
+	}
+	*a = ss
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lenientBool is a boolean claim, which some issuers send as the string "true"
+// or "false" instead.
+type lenientBool bool
+
+func (lb *lenientBool) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		// Missing, which is the same as false.
+	case bool:
+		*lb = lenientBool(v)
+	case string:
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q: %w", v, err)
+		}
+		*lb = lenientBool(parsed)
+	default:
+		return fmt.Errorf("boolean was of type %T", v)
+	}
+	return nil
+}
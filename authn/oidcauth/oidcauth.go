@@ -0,0 +1,279 @@
+// Package oidcauth verifies ID tokens from any OpenID Connect issuer, and mints
+// and verifies our own session cookies from them, as an alternative to
+// Firebase auth. See https://openid.net/specs/openid-connect-core-1_0.html for
+// more info.
+//
+// The issuer's configuration is found through discovery, and its signing keys
+// are cached and refetched as the issuer rotates them. Session cookies are
+// JWTs signed with a key that only the server has, and revoking them is
+// recorded in the database, so that it applies to every server.
+package oidcauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+)
+
+const (
+	// clockSkew is how far our clock and the issuer's can disagree.
+	clockSkew = time.Minute
+	// minSessionKeySize is the smallest session key we accept, which is the
+	// size of the HS256 hash.
+	minSessionKeySize = 32
+)
+
+// DB stores when each identity's sessions were last revoked.
+type DB interface {
+	NoTxn(context.Context) db.Tx
+	RevokeSessions(db.Tx, authn.Provider, authn.UserID, time.Time) error
+	SessionsRevokedAt(db.Tx, authn.Provider, authn.UserID) (time.Time, error)
+}
+
+type Config struct {
+	// IssuerURL identifies the OpenID Connect issuer, and is where its
+	// discovery document is found, e.g. https://accounts.google.com
+	IssuerURL string
+	// ClientID is the ID the issuer assigned to our app, which ID tokens must
+	// be issued to.
+	ClientID string
+	// SessionKey signs session cookies, and must be at least 32 random bytes.
+	// All servers that share cookies must use the same key.
+	SessionKey []byte
+	// DB is where session revocations are stored.
+	DB DB
+
+	// HTTPClient fetches the discovery document and signing keys, and defaults
+	// to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (c *Config) validate() error {
+	if c.IssuerURL == "" {
+		return errors.New("no issuer URL was given")
+	}
+	if c.ClientID == "" {
+		return errors.New("no client ID was given")
+	}
+	if len(c.SessionKey) < minSessionKeySize {
+		return fmt.Errorf("session key was %d bytes, wanted at least %d", len(c.SessionKey), minSessionKeySize)
+	}
+	if c.DB == nil {
+		return errors.New("no DB was given")
+	}
+	return nil
+}
+
+type Client struct {
+	issuer     string
+	clientID   string
+	sessionKey []byte
+	keys       *keySet
+	db         DB
+	now        func() time.Time
+}
+
+// New fetches the issuer's discovery document, so a misconfigured issuer is
+// caught at startup rather than at the first sign in.
+func New(ctx context.Context, cfg *Config) (*Client, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	md, err := discover(ctx, httpClient, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer %q: %w", cfg.IssuerURL, err)
+	}
+	c := &Client{
+		issuer:     md.Issuer,
+		clientID:   cfg.ClientID,
+		sessionKey: cfg.SessionKey,
+		db:         cfg.DB,
+		now:        time.Now,
+	}
+	c.keys = newKeySet(md.JWKSURI, httpClient, func() time.Time { return c.now() })
+	return c, nil
+}
+
+// idTokenClaims are the claims we use from an ID token, see
+// https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type idTokenClaims struct {
+	Issuer          string      `json:"iss"`
+	Subject         string      `json:"sub"`
+	Audience        audience    `json:"aud"`
+	AuthorizedParty string      `json:"azp"`
+	ExpiresAt       numericDate `json:"exp"`
+	IssuedAt        numericDate `json:"iat"`
+	AuthTime        numericDate `json:"auth_time"`
+	Email           string      `json:"email"`
+	EmailVerified   lenientBool `json:"email_verified"`
+}
+
+func (c *Client) VerifyIDToken(ctx context.Context, idToken string) (*authn.Token, error) {
+	t, err := parseJWT(idToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	if _, ok := signingAlgs[t.header.Alg]; !ok {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", t.header.Alg)
+	}
+	key, err := c.keys.key(ctx, t.header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing key: %w", err)
+	}
+	if err := t.verify(key); err != nil {
+		return nil, fmt.Errorf("failed to verify token: %w", err)
+	}
+
+	var claims idTokenClaims
+	if err := unmarshalClaims(t, &claims); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != c.issuer {
+		return nil, fmt.Errorf("token was issued by %q, wanted %q", claims.Issuer, c.issuer)
+	}
+	if !claims.Audience.contains(c.clientID) {
+		return nil, fmt.Errorf("token wasn't issued to client %q", c.clientID)
+	}
+	// A token with several audiences must say which of them it was issued to.
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.clientID {
+		return nil, fmt.Errorf("token was authorized for %q, wanted %q", claims.AuthorizedParty, c.clientID)
+	}
+	if err := c.checkTimes(claims.IssuedAt, claims.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token had no subject")
+	}
+
+	// auth_time is only required when the client asks for it, and otherwise
+	// the token was issued when the user signed in.
+	authTime := claims.AuthTime
+	if authTime == 0 {
+		authTime = claims.IssuedAt
+	}
+	return &authn.Token{
+		UserInfo: &authn.UserInfo{
+			UserID:        authn.UserID(claims.Subject),
+			Email:         claims.Email,
+			EmailVerified: bool(claims.EmailVerified),
+			AuthProvider:  authn.OIDC,
+		},
+		AuthTime: authTime.Time(),
+	}, nil
+}
+
+// sessionClaims are the claims of our session cookies, which carry over what
+// the ID token told us about the user.
+type sessionClaims struct {
+	Subject       string      `json:"sub"`
+	Email         string      `json:"email"`
+	EmailVerified lenientBool `json:"email_verified"`
+	AuthTime      numericDate `json:"auth_time"`
+	IssuedAt      numericDate `json:"iat"`
+	ExpiresAt     numericDate `json:"exp"`
+}
+
+func (c *Client) SessionCookie(ctx context.Context, idToken string, expiresIn time.Duration) (string, error) {
+	tkn, err := c.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify ID token: %w", err)
+	}
+	now := c.now()
+	cookie, err := signHMAC(c.sessionKey, &sessionClaims{
+		Subject:       string(tkn.UserInfo.UserID),
+		Email:         tkn.UserInfo.Email,
+		EmailVerified: lenientBool(tkn.UserInfo.EmailVerified),
+		AuthTime:      newNumericDate(tkn.AuthTime),
+		IssuedAt:      newNumericDate(now),
+		ExpiresAt:     newNumericDate(now.Add(expiresIn)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign session cookie: %w", err)
+	}
+	return cookie, nil
+}
+
+func (c *Client) VerifySessionCookie(ctx context.Context, sessionCookie string) (*authn.Token, error) {
+	t, err := parseJWT(sessionCookie)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse session cookie: %w", err)
+	}
+	if err := t.verifyHMAC(c.sessionKey); err != nil {
+		return nil, fmt.Errorf("failed to verify session cookie: %w", err)
+	}
+	var claims sessionClaims
+	if err := unmarshalClaims(t, &claims); err != nil {
+		return nil, err
+	}
+	if err := c.checkTimes(claims.IssuedAt, claims.ExpiresAt); err != nil {
+		return nil, err
+	}
+	uID := authn.UserID(claims.Subject)
+	revokedAt, err := c.db.SessionsRevokedAt(c.db.NoTxn(ctx), authn.OIDC, uID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for session revocation: %w", err)
+	}
+	// Timestamps are in whole seconds, so a cookie issued in the same second
+	// as the revocation is treated as revoked.
+	if !revokedAt.IsZero() && int64(claims.IssuedAt) <= revokedAt.Unix() {
+		return nil, errors.New("session was revoked")
+	}
+	return &authn.Token{
+		UserInfo: &authn.UserInfo{
+			UserID:        uID,
+			Email:         claims.Email,
+			EmailVerified: bool(claims.EmailVerified),
+			AuthProvider:  authn.OIDC,
+		},
+		AuthTime: claims.AuthTime.Time(),
+	}, nil
+}
+
+// RevokeRefreshTokens invalidates the user's existing session cookies. Unlike
+// Firebase, the issuer's own sessions are untouched.
+func (c *Client) RevokeRefreshTokens(ctx context.Context, uID authn.UserID) error {
+	if err := c.db.RevokeSessions(c.db.NoTxn(ctx), authn.OIDC, uID, c.now()); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// ManagesProvider reports whether identities from the provider are from our
+// issuer, which are the only ones we have sessions for.
+func (c *Client) ManagesProvider(p authn.Provider) bool {
+	return p == authn.OIDC
+}
+
+func (c *Client) checkTimes(issuedAt, expiresAt numericDate) error {
+	now := c.now()
+	if expiresAt == 0 {
+		return errors.New("token had no expiry")
+	}
+	if now.After(expiresAt.Time().Add(clockSkew)) {
+		return fmt.Errorf("token expired at %v", expiresAt.Time())
+	}
+	if issuedAt == 0 {
+		return errors.New("token had no issue time")
+	}
+	if issuedAt.Time().After(now.Add(clockSkew)) {
+		return fmt.Errorf("token was issued in the future at %v", issuedAt.Time())
+	}
+	return nil
+}
+
+func unmarshalClaims(t *jwt, v interface{}) error {
+	if err := json.Unmarshal(t.claims, v); err != nil {
+		return fmt.Errorf("failed to parse claims: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,580 @@
+package oidcauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/testing/testdb"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testClientID = "test-client"
+
+var testSessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestVerifyIDToken(t *testing.T) {
+	iss := newStubIssuer(t)
+	c, now := newClientForTest(t, iss)
+
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":            iss.URL(),
+			"sub":            "user-123",
+			"aud":            testClientID,
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"auth_time":      now.Add(-time.Minute).Unix(),
+			"email":          "user@example.com",
+			"email_verified": true,
+		}
+	}
+	edit := func(fn func(map[string]interface{})) map[string]interface{} {
+		c := claims()
+		fn(c)
+		return c
+	}
+	with := func(k string, v interface{}) map[string]interface{} {
+		return edit(func(c map[string]interface{}) { c[k] = v })
+	}
+	without := func(k string) map[string]interface{} {
+		return edit(func(c map[string]interface{}) { delete(c, k) })
+	}
+	valid := &authn.Token{
+		UserInfo: &authn.UserInfo{
+			UserID:        "user-123",
+			Email:         "user@example.com",
+			EmailVerified: true,
+			AuthProvider:  authn.OIDC,
+		},
+		AuthTime: now.Add(-time.Minute),
+	}
+
+	tests := []struct {
+		desc    string
+		token   string
+		want    *authn.Token
+		wantErr bool
+	}{
+		{
+			desc:  "valid RSA token",
+			token: iss.sign(t, "rsa-1", claims()),
+			want:  valid,
+		},
+		{
+			desc:  "valid EC token",
+			token: iss.sign(t, "ec-1", claims()),
+			want:  valid,
+		},
+		{
+			desc: "no auth_time, unverified email as a string",
+			token: iss.sign(t, "rsa-1", edit(func(c map[string]interface{}) {
+				delete(c, "auth_time")
+				c["iat"] = now.Add(-time.Minute).Unix()
+				c["email_verified"] = "false"
+			})),
+			want: &authn.Token{
+				UserInfo: &authn.UserInfo{
+					UserID:       "user-123",
+					Email:        "user@example.com",
+					AuthProvider: authn.OIDC,
+				},
+				AuthTime: now.Add(-time.Minute),
+			},
+		},
+		{
+			desc: "several audiences with us as the authorized party",
+			token: iss.sign(t, "rsa-1", edit(func(c map[string]interface{}) {
+				c["aud"] = []string{"other-client", testClientID}
+				c["azp"] = testClientID
+			})),
+			want: valid,
+		},
+		{
+			desc:    "several audiences without an authorized party",
+			token:   iss.sign(t, "rsa-1", with("aud", []string{"other-client", testClientID})),
+			wantErr: true,
+		},
+		{
+			desc:    "wrong audience",
+			token:   iss.sign(t, "rsa-1", with("aud", "other-client")),
+			wantErr: true,
+		},
+		{
+			desc:    "wrong issuer",
+			token:   iss.sign(t, "rsa-1", with("iss", "https://evil.example.com")),
+			wantErr: true,
+		},
+		{
+			desc:    "expired",
+			token:   iss.sign(t, "rsa-1", with("exp", now.Add(-time.Hour).Unix())),
+			wantErr: true,
+		},
+		{
+			desc:    "issued in the future",
+			token:   iss.sign(t, "rsa-1", with("iat", now.Add(time.Hour).Unix())),
+			wantErr: true,
+		},
+		{
+			desc:    "no subject",
+			token:   iss.sign(t, "rsa-1", without("sub")),
+			wantErr: true,
+		},
+		{
+			desc:    "unknown key",
+			token:   iss.sign(t, "rsa-unpublished", claims()),
+			wantErr: true,
+		},
+		{
+			desc:    "tampered claims",
+			token:   tamper(t, iss.sign(t, "rsa-1", claims()), with("sub", "someone-else")),
+			wantErr: true,
+		},
+		{
+			desc:    "unsigned",
+			token:   unsigned(t, "none", claims()),
+			wantErr: true,
+		},
+		{
+			desc:    "signed with HMAC",
+			token:   hmacSigned(t, testSessionKey, claims()),
+			wantErr: true,
+		},
+		{
+			desc:    "not a JWT",
+			token:   "not-a-jwt",
+			wantErr: true,
+		},
+	}
+	ctx := context.Background()
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := c.VerifyIDToken(ctx, test.token)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("no error was returned, but one was expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyIDToken: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected token (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	iss := newStubIssuer(t)
+	c, now := newClientForTest(t, iss)
+	ctx := context.Background()
+
+	token := func(kid string) string {
+		return iss.sign(t, kid, map[string]interface{}{
+			"iss": iss.URL(),
+			"sub": "user-123",
+			"aud": testClientID,
+			"iat": c.now().Unix(),
+			"exp": c.now().Add(time.Hour).Unix(),
+		})
+	}
+
+	if _, err := c.VerifyIDToken(ctx, token("rsa-1")); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if got := iss.keyFetches(); got != 1 {
+		t.Errorf("keys were fetched %d times, wanted 1", got)
+	}
+
+	// The issuer starts publishing a new key, and later signing with it.
+	iss.addKey(t, "rsa-2")
+	c.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if _, err := c.VerifyIDToken(ctx, token("rsa-2")); err != nil {
+		t.Fatalf("VerifyIDToken with rotated key: %v", err)
+	}
+	if got := iss.keyFetches(); got != 2 {
+		t.Errorf("keys were fetched %d times, wanted 2", got)
+	}
+
+	// Unknown keys don't make us fetch the keys again until a minute has
+	// passed.
+	for i := 0; i < 3; i++ {
+		if _, err := c.VerifyIDToken(ctx, token("rsa-unpublished")); err == nil {
+			t.Fatal("token signed with an unknown key was accepted")
+		}
+	}
+	if got := iss.keyFetches(); got != 2 {
+		t.Errorf("keys were fetched %d times, wanted 2", got)
+	}
+
+	// Keys the issuer stops publishing stop working once the cache expires.
+	iss.removeKey("rsa-1")
+	c.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, err := c.VerifyIDToken(ctx, token("rsa-1")); err == nil {
+		t.Fatal("token signed with a removed key was accepted")
+	}
+	if _, err := c.VerifyIDToken(ctx, token("rsa-2")); err != nil {
+		t.Fatalf("VerifyIDToken after keys expired: %v", err)
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	iss := newStubIssuer(t)
+	c, now := newClientForTest(t, iss)
+	ctx := context.Background()
+
+	idToken := iss.sign(t, "rsa-1", map[string]interface{}{
+		"iss":            iss.URL(),
+		"sub":            "user-123",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          "user@example.com",
+		"email_verified": true,
+	})
+
+	cookie, err := c.SessionCookie(ctx, idToken, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("SessionCookie: %v", err)
+	}
+	got, err := c.VerifySessionCookie(ctx, cookie)
+	if err != nil {
+		t.Fatalf("VerifySessionCookie: %v", err)
+	}
+	want := &authn.Token{
+		UserInfo: &authn.UserInfo{
+			UserID:        "user-123",
+			Email:         "user@example.com",
+			EmailVerified: true,
+			AuthProvider:  authn.OIDC,
+		},
+		AuthTime: now,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected token (-want +got)\n%s", diff)
+	}
+
+	// ID tokens aren't session cookies, nor the other way around.
+	if _, err := c.VerifySessionCookie(ctx, idToken); err == nil {
+		t.Error("ID token was accepted as a session cookie")
+	}
+	if _, err := c.VerifyIDToken(ctx, cookie); err == nil {
+		t.Error("session cookie was accepted as an ID token")
+	}
+	if _, err := c.SessionCookie(ctx, "not-a-jwt", time.Hour); err == nil {
+		t.Error("session cookie was created from an invalid ID token")
+	}
+
+	other, _ := newClientForTest(t, iss)
+	other.sessionKey = []byte("a-different-key-that-is-32-bytes")
+	if _, err := other.VerifySessionCookie(ctx, cookie); err == nil {
+		t.Error("session cookie was accepted with a different key")
+	}
+	if _, err := c.VerifySessionCookie(ctx, tamper(t, cookie, map[string]interface{}{
+		"sub": "someone-else",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	})); err == nil {
+		t.Error("tampered session cookie was accepted")
+	}
+
+	c.now = func() time.Time { return now.Add(25 * time.Hour) }
+	if _, err := c.VerifySessionCookie(ctx, cookie); err == nil {
+		t.Error("expired session cookie was accepted")
+	}
+}
+
+func TestRevokeRefreshTokens(t *testing.T) {
+	iss := newStubIssuer(t)
+	d := testdb.New()
+	c, now := newClientWithDB(t, iss, d)
+	// other is another server, or this one after a restart.
+	other, _ := newClientWithDB(t, iss, d)
+	ctx := context.Background()
+
+	cookieFor := func(sub string) string {
+		idToken := iss.sign(t, "rsa-1", map[string]interface{}{
+			"iss": iss.URL(),
+			"sub": sub,
+			"aud": testClientID,
+			"iat": c.now().Unix(),
+			"exp": c.now().Add(time.Hour).Unix(),
+		})
+		cookie, err := c.SessionCookie(ctx, idToken, time.Hour)
+		if err != nil {
+			t.Fatalf("SessionCookie: %v", err)
+		}
+		return cookie
+	}
+
+	revoked, kept := cookieFor("user-1"), cookieFor("user-2")
+	c.now = func() time.Time { return now.Add(time.Second) }
+	if err := c.RevokeRefreshTokens(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeRefreshTokens: %v", err)
+	}
+	for _, s := range []*Client{c, other} {
+		if _, err := s.VerifySessionCookie(ctx, revoked); err == nil {
+			t.Error("revoked session cookie was accepted")
+		}
+		if _, err := s.VerifySessionCookie(ctx, kept); err != nil {
+			t.Errorf("other user's session cookie was rejected: %v", err)
+		}
+	}
+
+	// Signing in again after revocation works.
+	c.now = func() time.Time { return now.Add(2 * time.Second) }
+	if _, err := c.VerifySessionCookie(ctx, cookieFor("user-1")); err != nil {
+		t.Errorf("new session cookie was rejected: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	iss := newStubIssuer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		desc string
+		cfg  *Config
+	}{
+		{
+			desc: "no client ID",
+			cfg:  &Config{IssuerURL: iss.URL(), SessionKey: testSessionKey, DB: testdb.New()},
+		},
+		{
+			desc: "short session key",
+			cfg:  &Config{IssuerURL: iss.URL(), ClientID: testClientID, SessionKey: []byte("too short"), DB: testdb.New()},
+		},
+		{
+			desc: "no DB",
+			cfg:  &Config{IssuerURL: iss.URL(), ClientID: testClientID, SessionKey: testSessionKey},
+		},
+		{
+			desc: "issuer doesn't match discovery",
+			cfg:  &Config{IssuerURL: iss.URL() + "/", ClientID: testClientID, SessionKey: testSessionKey, DB: testdb.New()},
+		},
+		{
+			desc: "no discovery document",
+			cfg:  &Config{IssuerURL: iss.URL() + "/missing", ClientID: testClientID, SessionKey: testSessionKey, DB: testdb.New()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.cfg.HTTPClient = iss.srv.Client()
+			if _, err := New(ctx, test.cfg); err == nil {
+				t.Fatal("no error was returned, but one was expected")
+			}
+		})
+	}
+}
+
+func newClientForTest(t *testing.T, iss *stubIssuer) (*Client, time.Time) {
+	t.Helper()
+	return newClientWithDB(t, iss, testdb.New())
+}
+
+func newClientWithDB(t *testing.T, iss *stubIssuer, d DB) (*Client, time.Time) {
+	t.Helper()
+	c, err := New(context.Background(), &Config{
+		IssuerURL:  iss.URL(),
+		ClientID:   testClientID,
+		SessionKey: testSessionKey,
+		DB:         d,
+		HTTPClient: iss.srv.Client(),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	c.now = func() time.Time { return now }
+	return c, now
+}
+
+// stubIssuer is an OpenID Connect issuer that serves discovery and signing
+// keys, and signs whatever claims a test asks it to.
+type stubIssuer struct {
+	srv *httptest.Server
+
+	mu sync.Mutex
+	// keys are all the keys the issuer can sign with, and published are the
+	// IDs of the ones it serves.
+	keys      map[string]crypto.Signer
+	published map[string]bool
+	fetches   int
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	t.Helper()
+	iss := &stubIssuer{
+		keys:      make(map[string]crypto.Signer),
+		published: make(map[string]bool),
+	}
+	iss.addKey(t, "rsa-1")
+	iss.addKey(t, "ec-1")
+	// Tokens signed with this key fail, since it's never published.
+	iss.keys["rsa-unpublished"] = iss.keys["rsa-1"]
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]string{
+			"issuer":   iss.URL(),
+			"jwks_uri": iss.URL() + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.fetches++
+		keys := []interface{}{
+			// Keys we don't support are skipped.
+			map[string]string{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+		}
+		for kid := range iss.published {
+			keys = append(keys, toJWK(kid, iss.keys[kid].Public()))
+		}
+		writeJSON(t, w, map[string]interface{}{"keys": keys})
+	})
+	iss.srv = httptest.NewServer(mux)
+	t.Cleanup(iss.srv.Close)
+	return iss
+}
+
+func (iss *stubIssuer) URL() string {
+	return iss.srv.URL
+}
+
+func (iss *stubIssuer) keyFetches() int {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return iss.fetches
+}
+
+func (iss *stubIssuer) addKey(t *testing.T, kid string) {
+	t.Helper()
+	var (
+		k   crypto.Signer
+		err error
+	)
+	if strings.HasPrefix(kid, "ec-") {
+		k, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	} else {
+		k, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys[kid] = k
+	iss.published[kid] = true
+}
+
+func (iss *stubIssuer) removeKey(kid string) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	delete(iss.published, kid)
+}
+
+func (iss *stubIssuer) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	iss.mu.Lock()
+	k := iss.keys[kid]
+	iss.mu.Unlock()
+
+	alg := "RS256"
+	if _, ok := k.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	signed := encodeForTest(t, &jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"}) + "." + encodeForTest(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		s, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		sig = s
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func toJWK(kid string, pub crypto.PublicKey) map[string]string {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   b64.EncodeToString(pub.N.Bytes()),
+			"e":   b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		return map[string]string{
+			"kty": "EC",
+			"kid": kid,
+			"crv": "P-256",
+			"x":   b64.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			"y":   b64.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		}
+	default:
+		panic("unsupported key type")
+	}
+}
+
+// tamper replaces the claims of a token, leaving its signature as is.
+func tamper(t *testing.T, token string, claims map[string]interface{}) string {
+	parts := strings.Split(token, ".")
+	parts[1] = encodeForTest(t, claims)
+	return strings.Join(parts, ".")
+}
+
+func unsigned(t *testing.T, alg string, claims map[string]interface{}) string {
+	return encodeForTest(t, &jwtHeader{Alg: alg}) + "." + encodeForTest(t, claims) + "."
+}
+
+func hmacSigned(t *testing.T, key []byte, claims map[string]interface{}) string {
+	tkn, err := signHMAC(key, claims)
+	if err != nil {
+		t.Fatalf("signHMAC: %v", err)
+	}
+	return tkn
+}
+
+func encodeForTest(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return b64.EncodeToString(b)
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Errorf("failed to write response: %v", err)
+	}
+}
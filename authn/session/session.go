@@ -29,13 +29,15 @@ type Auth interface {
 // DB represents a storage system for storing information about users, and creating
 // a use-case specific UserID, rather than using the Authorization system's UserID.
 // This storage system is responsible only to have transactional semantics and the
-// ability to create a user, and retrieve back that same user when requested via the
-// same input Authorization IDs.
+// ability to create a user, and retrieve back that same user when requested via
+// any of the Authorization IDs linked to them.
 type DB interface {
 	Transactional(context.Context, func(tx db.Tx) error) error
 	NoTxn(context.Context) db.Tx
 	UserByAuthnProvider(tx db.Tx, provider authn.Provider, userID authn.UserID) (*todo.User, error)
+	UsersByVerifiedEmail(tx db.Tx, email string) ([]*todo.User, error)
 	CreateUser(tx db.Tx, provider authn.Provider, authID authn.UserID, name, email string) (todo.UserID, error)
+	LinkAuthIdentity(tx db.Tx, a *todo.AuthIdentity) error
 }
 
 type Client struct {
@@ -92,16 +94,22 @@ func (c *Client) LoginHandler() http.Handler {
 		expiresIn := time.Hour * 24 * 14
 
 		err = c.db.Transactional(r.Context(), func(tx db.Tx) error {
-			_, err := c.db.UserByAuthnProvider(tx, tkn.UserInfo.AuthProvider, tkn.UserInfo.UserID)
-			if db.IsNotFound(err) {
-				// Since the user isn't found, create the account.
-				_, err := c.db.CreateUser(tx, tkn.UserInfo.AuthProvider, tkn.UserInfo.UserID, req.Name, tkn.UserInfo.Email)
-				if err != nil {
-					return fmt.Errorf("failed to create user (provider id %q): %w", tkn.UserInfo.UserID, err)
-				}
-			} else if err != nil {
+			userID, err := c.userForLogin(tx, ui, req.Name)
+			if err != nil {
 				return fmt.Errorf("failed to get or create user: %w", err)
 			}
+			// Record what the provider told us about the email this time, so that
+			// whether it's verified stays current for linking other identities.
+			err = c.db.LinkAuthIdentity(tx, &todo.AuthIdentity{
+				UserID:         userID,
+				Provider:       ui.AuthProvider,
+				ProviderUserID: ui.UserID,
+				Email:          ui.Email,
+				EmailVerified:  ui.EmailVerified,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update auth identity: %w", err)
+			}
 			return nil
 		})
 		if err != nil {
@@ -147,6 +155,45 @@ func (c *Client) LoginHandler() http.Handler {
 	})
 }
 
+// userForLogin returns the user signing in with the given identity, creating
+// one if this is their first sign-in.
+//
+// The first time someone signs in with an identity, it's linked to an existing
+// account if the provider verified their email, and an identity already linked
+// to that account has the same email, also verified. Requiring both to be
+// verified stops anyone from getting into an account, or luring its owner into
+// theirs, by signing up with an email they don't own. If there are several such
+// accounts, from before identities could be linked, the oldest is used.
+func (c *Client) userForLogin(tx db.Tx, ui *authn.UserInfo, name string) (todo.UserID, error) {
+	u, err := c.db.UserByAuthnProvider(tx, ui.AuthProvider, ui.UserID)
+	if err == nil {
+		return u.ID, nil
+	} else if !db.IsNotFound(err) {
+		return "", fmt.Errorf("failed to load user by auth provider: %w", err)
+	}
+
+	if ui.EmailVerified && ui.Email != "" {
+		us, err := c.db.UsersByVerifiedEmail(tx, ui.Email)
+		if err != nil {
+			return "", fmt.Errorf("failed to load users by email: %w", err)
+		}
+		if len(us) > 0 {
+			c.logger.Info("linking new auth identity to existing user by verified email",
+				zap.String("user_id", string(us[0].ID)),
+				zap.String("auth_provider", string(ui.AuthProvider)),
+				zap.Int("candidate_users", len(us)))
+			return us[0].ID, nil
+		}
+	}
+
+	// Since the user isn't found, create the account.
+	userID, err := c.db.CreateUser(tx, ui.AuthProvider, ui.UserID, name, ui.Email)
+	if err != nil {
+		return "", fmt.Errorf("failed to create user (provider id %q): %w", ui.UserID, err)
+	}
+	return userID, nil
+}
+
 func (c *Client) LogoutHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -218,7 +265,15 @@ func (c *Client) WithAuthorization(next http.Handler, loginHandlerPath string) h
 		ctx := context.WithValue(r.Context(), userInfoKey{}, userInfo)
 
 		user, err := c.db.UserByAuthnProvider(c.db.NoTxn(ctx), userInfo.AuthProvider, userInfo.UserID)
-		if err != nil {
+		if db.IsNotFound(err) {
+			// The identity was unlinked, or its user deleted, since the session
+			// began, so the session no longer belongs to anyone.
+			c.logger.Warn("session cookie's auth identity isn't linked to a user",
+				zap.String("user_id", string(userInfo.UserID)),
+				zap.String("auth_provider", string(userInfo.AuthProvider)))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		} else if err != nil {
 			c.logger.Error("failed to load user by auth provider, user had valid session cookie",
 				zap.Error(err),
 				zap.String("user_id", string(userInfo.UserID)),
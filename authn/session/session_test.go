@@ -14,6 +14,7 @@ import (
 
 	"github.com/Silicon-Ally/silicon-starter/authn"
 	"github.com/Silicon-Ally/silicon-starter/testing/testdb"
+	"github.com/Silicon-Ally/silicon-starter/todo"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"go.uber.org/zap/zaptest"
@@ -121,6 +122,7 @@ func TestLoginHandler(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			fAuth := &fakeAuth{}
 			tdb := testdb.New()
+			t.Cleanup(func() { tdb.CheckAllTransactionsCommitted(t) })
 			sess := New(
 				fAuth,
 				tdb,
@@ -152,6 +154,107 @@ func TestLoginHandler(t *testing.T) {
 	}
 }
 
+func TestLoginLinksIdentityByVerifiedEmail(t *testing.T) {
+	now := time.Unix(123456789, 0)
+	tests := []struct {
+		desc             string
+		existingVerified bool
+		loginEmail       string
+		loginVerified    bool
+		wantLinked       bool
+	}{
+		{
+			desc:             "both verified",
+			existingVerified: true,
+			loginEmail:       "ALICE@example.com",
+			loginVerified:    true,
+			wantLinked:       true,
+		},
+		{
+			desc:             "login unverified",
+			existingVerified: true,
+			loginEmail:       "alice@example.com",
+			loginVerified:    false,
+		},
+		{
+			desc:             "existing unverified",
+			existingVerified: false,
+			loginEmail:       "alice@example.com",
+			loginVerified:    true,
+		},
+		{
+			desc:             "different email",
+			existingVerified: true,
+			loginEmail:       "bob@example.com",
+			loginVerified:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			tdb := testdb.New()
+			t.Cleanup(func() { tdb.CheckAllTransactionsCommitted(t) })
+			tx := tdb.NoTxn(context.Background())
+			alice, err := tdb.CreateUser(tx, authn.Google, "google-alice", "Alice", "alice@example.com")
+			if err != nil {
+				t.Fatalf("creating user: %v", err)
+			}
+			err = tdb.LinkAuthIdentity(tx, &todo.AuthIdentity{
+				UserID:         alice,
+				Provider:       authn.Google,
+				ProviderUserID: "google-alice",
+				Email:          "alice@example.com",
+				EmailVerified:  test.existingVerified,
+			})
+			if err != nil {
+				t.Fatalf("updating identity: %v", err)
+			}
+
+			sess := New(&fakeAuth{}, tdb, zaptest.NewLogger(t))
+			sess.since = func(t time.Time) time.Duration { return now.Sub(t) }
+			tkn := &authn.Token{
+				UserInfo: &authn.UserInfo{
+					UserID:        "password-alice",
+					Email:         test.loginEmail,
+					EmailVerified: test.loginVerified,
+					AuthProvider:  authn.EmailAndPass,
+				},
+				AuthTime: now.Add(-5 * time.Second),
+			}
+			body := strings.NewReader(encodeLoginRequest(t, &LoginRequest{IDToken: encodeAuthToken(t, tkn)}))
+			w := httptest.NewRecorder()
+			sess.LoginHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", body))
+			if w.Code != http.StatusOK {
+				t.Fatalf("login response code was %d, want %d", w.Code, http.StatusOK)
+			}
+
+			u, err := tdb.UserByAuthnProvider(tx, authn.EmailAndPass, "password-alice")
+			if err != nil {
+				t.Fatalf("reading user that logged in: %v", err)
+			}
+			if linked := u.ID == alice; linked != test.wantLinked {
+				t.Errorf("login was linked to the existing user: %t, want %t", linked, test.wantLinked)
+			}
+			ids, err := tdb.AuthIdentities(tx, u.ID)
+			if err != nil {
+				t.Fatalf("reading identities: %v", err)
+			}
+			found := false
+			for _, a := range ids {
+				if a.ProviderUserID == "password-alice" {
+					found = true
+					if a.EmailVerified != test.loginVerified {
+						t.Errorf("identity's email verified = %t, want %t", a.EmailVerified, test.loginVerified)
+					}
+				}
+			}
+			if !found {
+				t.Error("user didn't have the identity they logged in with")
+			}
+		})
+	}
+}
+
 func cookieDiffOpts() cmp.Option {
 	return cmp.Options{
 		// Ignore the 'Raw' parameter of cookies, because it's just noise and
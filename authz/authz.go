@@ -0,0 +1,181 @@
+// Package authz contains the authorization policies for the domain types in
+// package todo. Policies only answer the question "is this user allowed to do
+// this thing?", they don't load any data themselves, which means they can be
+// reused from GraphQL resolvers, HTTP handlers, background jobs, etc.
+package authz
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+// Action is an operation that a user is attempting to perform on an entity.
+type Action string
+
+const (
+	Read   = Action("READ")
+	Edit   = Action("EDIT")
+	Delete = Action("DELETE")
+	// Share covers changing who a task is shared with, and their roles.
+	Share = Action("SHARE")
+	// Move covers moving a task into or out of a list. Lists are private to
+	// their creator, so only owners can move a task.
+	Move = Action("MOVE")
+)
+
+// requiredTaskRoles is the minimum role needed to perform each action on a
+// task.
+var requiredTaskRoles = map[Action]todo.TaskRole{
+	Read:   todo.TaskRoleViewer,
+	Edit:   todo.TaskRoleEditor,
+	Delete: todo.TaskRoleOwner,
+	Share:  todo.TaskRoleOwner,
+	Move:   todo.TaskRoleOwner,
+}
+
+type errPermissionDenied struct {
+	// userID is the user that attempted the action, if known.
+	userID todo.UserID
+	// action is what the user was trying to do.
+	action Action
+	// id is the ID of the entity that the action was attempted on.
+	id string
+	// entityType is the type of the entity the action was attempted on.
+	entityType string
+	// hidden is set when the user has no access to the entity at all, so
+	// that the error is reported as not found, which doesn't reveal that
+	// the entity exists.
+	hidden bool
+}
+
+func (e *errPermissionDenied) Error() string {
+	return fmt.Sprintf("user %q may not %s entity of type %q with ID %q", e.userID, e.action, e.entityType, e.id)
+}
+
+func (e *errPermissionDenied) Is(target error) bool {
+	_, ok := target.(*errPermissionDenied)
+	return ok
+}
+
+func (e *errPermissionDenied) Kind() errkind.Kind {
+	if e.hidden {
+		return errkind.NotFound
+	}
+	return errkind.PermissionDenied
+}
+
+func PermissionDenied[T ~string](userID todo.UserID, action Action, id T, entityType string) error {
+	return &errPermissionDenied{
+		userID:     userID,
+		action:     action,
+		id:         string(id),
+		entityType: entityType,
+	}
+}
+
+func IsPermissionDenied(err error) bool {
+	return errors.Is(err, &errPermissionDenied{})
+}
+
+// TaskRole returns the role that the given user has on the task, given everyone
+// the task has been shared with. It returns the empty role if the user has no
+// access to the task.
+func TaskRole(userID todo.UserID, task *todo.Task, collaborators []*todo.TaskCollaborator) todo.TaskRole {
+	if userID == "" {
+		return ""
+	}
+	if task.CreatedBy == userID {
+		return todo.TaskRoleOwner
+	}
+	for _, c := range collaborators {
+		if c.UserID == userID {
+			return c.Role
+		}
+	}
+	return ""
+}
+
+// CheckTask returns nil if the given user may perform the given action on the
+// task, and a permission denied error otherwise. If the user has no role on the
+// task, the error's kind is NotFound, so that users can't find out which task
+// IDs exist.
+func CheckTask(userID todo.UserID, task *todo.Task, collaborators []*todo.TaskCollaborator, action Action) error {
+	if task == nil {
+		return errors.New("no task was given to check access against")
+	}
+	required, ok := requiredTaskRoles[action]
+	if !ok {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	role := TaskRole(userID, task, collaborators)
+	if !role.AtLeast(required) {
+		return &errPermissionDenied{
+			userID:     userID,
+			action:     action,
+			id:         string(task.ID),
+			entityType: "task",
+			hidden:     role == "",
+		}
+	}
+	return nil
+}
+
+// CheckUnshareTask returns nil if the given user may remove the collaborator
+// from the task, and a permission denied error otherwise. Owners may remove
+// anyone, and anyone may remove themselves.
+func CheckUnshareTask(userID todo.UserID, task *todo.Task, collaborators []*todo.TaskCollaborator, collaboratorID todo.UserID) error {
+	if userID != "" && userID == collaboratorID {
+		return nil
+	}
+	return CheckTask(userID, task, collaborators, Share)
+}
+
+// CheckTasksByCreator returns nil if the given user may list the tasks created
+// by the given creator, and a permission denied error otherwise.
+func CheckTasksByCreator(userID, creatorID todo.UserID) error {
+	if userID == "" || userID != creatorID {
+		return PermissionDenied(userID, Read, creatorID, "tasks by creator")
+	}
+	return nil
+}
+
+// CheckListUsers returns nil if the given user may list every user, and a
+// permission denied error otherwise. Only admins may.
+func CheckListUsers(user *todo.User) error {
+	if user == nil {
+		return errors.New("no user was given to check access for")
+	}
+	if !user.Admin {
+		return PermissionDenied(user.ID, Read, "", "user directory")
+	}
+	return nil
+}
+
+// CheckUserPrivateFields returns nil if the given viewer may read the private
+// fields of the subject's profile, like their email, and a permission denied
+// error otherwise. Users may read their own, and admins may read anyone's.
+func CheckUserPrivateFields(viewer *todo.User, subjectID todo.UserID) error {
+	if viewer == nil {
+		return errors.New("no user was given to check access for")
+	}
+	if viewer.ID != subjectID && !viewer.Admin {
+		return PermissionDenied(viewer.ID, Read, subjectID, "user private fields")
+	}
+	return nil
+}
+
+// CheckList returns nil if the given user may perform the given action on the
+// list, and a permission denied error otherwise. Lists aren't shared, so only
+// their creator may do anything with them.
+func CheckList(userID todo.UserID, list *todo.List, action Action) error {
+	if list == nil {
+		return errors.New("no list was given to check access against")
+	}
+	if userID == "" || userID != list.CreatedBy {
+		return PermissionDenied(userID, action, list.ID, "list")
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+func TestCheckTask(t *testing.T) {
+	task := &todo.Task{
+		ID:        "task.1",
+		CreatedBy: "user.owner",
+	}
+	collaborators := []*todo.TaskCollaborator{
+		{TaskID: "task.1", UserID: "user.viewer", Role: todo.TaskRoleViewer},
+		{TaskID: "task.1", UserID: "user.editor", Role: todo.TaskRoleEditor},
+		{TaskID: "task.1", UserID: "user.coowner", Role: todo.TaskRoleOwner},
+	}
+	tests := []struct {
+		desc           string
+		userID         todo.UserID
+		action         Action
+		wantPermDenied bool
+		// wantNotFound is set when the user has no role on the task.
+		wantNotFound bool
+	}{
+		{
+			desc:   "owner can read",
+			userID: "user.owner",
+			action: Read,
+		},
+		{
+			desc:   "owner can edit",
+			userID: "user.owner",
+			action: Edit,
+		},
+		{
+			desc:   "owner can delete",
+			userID: "user.owner",
+			action: Delete,
+		},
+		{
+			desc:   "owner can share",
+			userID: "user.owner",
+			action: Share,
+		},
+		{
+			desc:   "owner can move",
+			userID: "user.owner",
+			action: Move,
+		},
+		{
+			desc:   "viewer can read",
+			userID: "user.viewer",
+			action: Read,
+		},
+		{
+			desc:           "viewer cannot edit",
+			userID:         "user.viewer",
+			action:         Edit,
+			wantPermDenied: true,
+		},
+		{
+			desc:   "editor can edit",
+			userID: "user.editor",
+			action: Edit,
+		},
+		{
+			desc:           "editor cannot delete",
+			userID:         "user.editor",
+			action:         Delete,
+			wantPermDenied: true,
+		},
+		{
+			desc:           "editor cannot share",
+			userID:         "user.editor",
+			action:         Share,
+			wantPermDenied: true,
+		},
+		{
+			desc:           "editor cannot move",
+			userID:         "user.editor",
+			action:         Move,
+			wantPermDenied: true,
+		},
+		{
+			desc:   "co-owner can delete",
+			userID: "user.coowner",
+			action: Delete,
+		},
+		{
+			desc:   "co-owner can share",
+			userID: "user.coowner",
+			action: Share,
+		},
+		{
+			desc:           "other user cannot read",
+			userID:         "user.other",
+			action:         Read,
+			wantPermDenied: true,
+			wantNotFound:   true,
+		},
+		{
+			desc:           "other user cannot delete",
+			userID:         "user.other",
+			action:         Delete,
+			wantPermDenied: true,
+			wantNotFound:   true,
+		},
+		{
+			desc:           "anonymous user cannot read",
+			userID:         "",
+			action:         Read,
+			wantPermDenied: true,
+			wantNotFound:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := CheckTask(test.userID, task, collaborators, test.action)
+			if got := IsPermissionDenied(err); got != test.wantPermDenied {
+				t.Errorf("IsPermissionDenied(CheckTask(...)) = %t, want %t (err: %v)", got, test.wantPermDenied, err)
+			}
+			if !test.wantPermDenied && err != nil {
+				t.Errorf("CheckTask: %v", err)
+			}
+			// Users without access to the task aren't told that it exists.
+			if test.wantPermDenied {
+				wantKind := errkind.PermissionDenied
+				if test.wantNotFound {
+					wantKind = errkind.NotFound
+				}
+				if got := errkind.Of(err); got != wantKind {
+					t.Errorf("errkind.Of(CheckTask(...)) = %q, want %q", got, wantKind)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckUnshareTask(t *testing.T) {
+	task := &todo.Task{
+		ID:        "task.1",
+		CreatedBy: "user.owner",
+	}
+	collaborators := []*todo.TaskCollaborator{
+		{TaskID: "task.1", UserID: "user.viewer", Role: todo.TaskRoleViewer},
+		{TaskID: "task.1", UserID: "user.editor", Role: todo.TaskRoleEditor},
+	}
+
+	if err := CheckUnshareTask("user.owner", task, collaborators, "user.editor"); err != nil {
+		t.Errorf("owner removing editor: %v", err)
+	}
+	if err := CheckUnshareTask("user.viewer", task, collaborators, "user.viewer"); err != nil {
+		t.Errorf("viewer removing themselves: %v", err)
+	}
+	if err := CheckUnshareTask("user.editor", task, collaborators, "user.viewer"); !IsPermissionDenied(err) {
+		t.Errorf("editor removing viewer returned %v, want permission denied", err)
+	}
+}
+
+func TestCheckTasksByCreator(t *testing.T) {
+	if err := CheckTasksByCreator("user.a", "user.a"); err != nil {
+		t.Errorf("CheckTasksByCreator for own tasks: %v", err)
+	}
+	if err := CheckTasksByCreator("user.a", "user.b"); !IsPermissionDenied(err) {
+		t.Errorf("CheckTasksByCreator for another user's tasks returned %v, want permission denied", err)
+	}
+}
+
+func TestCheckListUsers(t *testing.T) {
+	if err := CheckListUsers(&todo.User{ID: "user.admin", Admin: true}); err != nil {
+		t.Errorf("CheckListUsers for admin: %v", err)
+	}
+	if err := CheckListUsers(&todo.User{ID: "user.a"}); !IsPermissionDenied(err) {
+		t.Errorf("CheckListUsers for non-admin returned %v, want permission denied", err)
+	}
+}
+
+func TestCheckUserPrivateFields(t *testing.T) {
+	if err := CheckUserPrivateFields(&todo.User{ID: "user.a"}, "user.a"); err != nil {
+		t.Errorf("CheckUserPrivateFields for own profile: %v", err)
+	}
+	if err := CheckUserPrivateFields(&todo.User{ID: "user.admin", Admin: true}, "user.a"); err != nil {
+		t.Errorf("CheckUserPrivateFields for admin: %v", err)
+	}
+	if err := CheckUserPrivateFields(&todo.User{ID: "user.b"}, "user.a"); !IsPermissionDenied(err) {
+		t.Errorf("CheckUserPrivateFields for another user's profile returned %v, want permission denied", err)
+	}
+}
+
+func TestCheckList(t *testing.T) {
+	list := &todo.List{
+		ID:        "list.1",
+		CreatedBy: "user.a",
+	}
+	if err := CheckList("user.a", list, Edit); err != nil {
+		t.Errorf("CheckList for own list: %v", err)
+	}
+	if err := CheckList("user.b", list, Read); !IsPermissionDenied(err) {
+		t.Errorf("CheckList for another user's list returned %v, want permission denied", err)
+	}
+	if err := CheckList("", list, Read); !IsPermissionDenied(err) {
+		t.Errorf("CheckList for anonymous user returned %v, want permission denied", err)
+	}
+}
+
+func TestIsPermissionDenied(t *testing.T) {
+	if IsPermissionDenied(nil) {
+		t.Error("IsPermissionDenied(nil) = true, want false")
+	}
+	if IsPermissionDenied(errors.New("some other error")) {
+		t.Error("IsPermissionDenied(other error) = true, want false")
+	}
+	wrapped := fmt.Errorf("wrapped: %w", PermissionDenied("user.a", Edit, "task.1", "task"))
+	if !IsPermissionDenied(wrapped) {
+		t.Error("IsPermissionDenied(wrapped) = false, want true")
+	}
+}
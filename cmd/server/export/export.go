@@ -0,0 +1,499 @@
+// Package export serves a download of everything the logged-in user has stored
+// with us, so that they can take their data elsewhere.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+// formatVersion is incremented whenever the archive format changes in a way
+// that readers of older archives would notice.
+const formatVersion = 1
+
+// taskPageSize is how many tasks are read at a time, which bounds how many are
+// held in memory while they're written.
+const taskPageSize = 200
+
+// DB is the part of the database that exports read from.
+type DB interface {
+	TransactionalWithOptions(context.Context, *db.TxOptions, func(tx db.Tx) error) error
+
+	User(db.Tx, todo.UserID) (*todo.User, error)
+	AuthIdentities(db.Tx, todo.UserID) ([]*todo.AuthIdentity, error)
+	TasksByCreator(db.Tx, todo.UserID, *db.TaskQuery) (*db.TaskPage, error)
+	TrashedTasks(db.Tx, todo.UserID) ([]*todo.Task, error)
+	CollaboratorsByTaskID(db.Tx, []todo.TaskID) (map[todo.TaskID][]*todo.TaskCollaborator, error)
+	ListsByCreator(db.Tx, todo.UserID) ([]*todo.List, error)
+}
+
+type Handler struct {
+	db     DB
+	logger *zap.Logger
+	now    func() time.Time // Stubbed out for deterministic tests
+}
+
+func New(db DB, logger *zap.Logger) *Handler {
+	return &Handler{
+		db:     db,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// ServeHTTP responds to GET requests with the logged-in user's data, which
+// must be behind session.Client.WithAuthorization. The format query parameter
+// picks the format: "json" (the default) for a single JSON document, or "zip"
+// for a ZIP archive with a JSON file for each kind of data.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.logger.Warn("export request had invalid HTTP method - only GET is supported", zap.String("http_method", r.Method))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := todo.UserIDFromContext(r.Context())
+	if err != nil || userID == "" {
+		h.logger.Warn("export request had no user", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		http.Error(w, fmt.Sprintf("unknown format %q, must be json or zip", format), http.StatusBadRequest)
+		return
+	}
+
+	exportedAt := h.now().UTC()
+	filename := fmt.Sprintf("silicon-starter-export-%s.%s", exportedAt.Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	out := &trackingWriter{w: w}
+	var aw archiveWriter
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		aw = &jsonWriter{w: out}
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		aw = &zipWriter{zw: zip.NewWriter(out), modified: exportedAt}
+	}
+	if err := h.write(r.Context(), userID, exportedAt, aw); err != nil {
+		h.logger.Error("failed to export data", zap.String("user_id", string(userID)), zap.String("format", format), zap.Error(err))
+		// Once we've started writing, the status has been sent, so the client
+		// sees a truncated download.
+		if !out.wrote {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+}
+
+// write streams the user's data to aw as it's read. It's all read in a single
+// transaction, so that the export is consistent, and tasks are read a page at
+// a time, so that the archive is never held in memory.
+func (h *Handler) write(ctx context.Context, userID todo.UserID, exportedAt time.Time, aw archiveWriter) error {
+	opts := &db.TxOptions{
+		// Every query sees the same snapshot of the database.
+		Isolation: db.RepeatableRead,
+		ReadOnly:  true,
+		// The archive is written as it's read, so the transaction can't be
+		// run again.
+		MaxAttempts: 1,
+	}
+	return h.db.TransactionalWithOptions(ctx, opts, func(tx db.Tx) error {
+		user, err := h.db.User(tx, userID)
+		if err != nil {
+			return fmt.Errorf("reading user: %w", err)
+		}
+		ids, err := h.db.AuthIdentities(tx, userID)
+		if err != nil {
+			return fmt.Errorf("reading auth identities: %w", err)
+		}
+		if err := aw.writeProfile(formatVersion, exportedAt, profileFrom(user, ids)); err != nil {
+			return fmt.Errorf("writing profile: %w", err)
+		}
+
+		lists, err := h.db.ListsByCreator(tx, userID)
+		if err != nil {
+			return fmt.Errorf("reading lists: %w", err)
+		}
+		out := make([]*list, len(lists))
+		for i, l := range lists {
+			out[i] = listFrom(l)
+		}
+		if err := aw.writeLists(out); err != nil {
+			return fmt.Errorf("writing lists: %w", err)
+		}
+
+		query := &db.TaskQuery{
+			Sort:  db.TaskSort{Field: db.TaskSortByCreatedAt},
+			Limit: taskPageSize,
+		}
+		for {
+			page, err := h.db.TasksByCreator(tx, userID, query)
+			if err != nil {
+				return fmt.Errorf("reading tasks: %w", err)
+			}
+			if err := h.writeTasks(tx, aw, page.Tasks); err != nil {
+				return err
+			}
+			if !page.HasNextPage || len(page.Tasks) == 0 {
+				break
+			}
+			query.After = db.TaskCursor(page.Tasks[len(page.Tasks)-1], db.TaskSortByCreatedAt)
+		}
+		// The trash is emptied as tasks reach the retention period, so it's
+		// small enough to read at once.
+		trashed, err := h.db.TrashedTasks(tx, userID)
+		if err != nil {
+			return fmt.Errorf("reading trashed tasks: %w", err)
+		}
+		if err := h.writeTasks(tx, aw, trashed); err != nil {
+			return err
+		}
+		return aw.close()
+	})
+}
+
+func (h *Handler) writeTasks(tx db.Tx, aw archiveWriter, tasks []*todo.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]todo.TaskID, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	collaborators, err := h.db.CollaboratorsByTaskID(tx, ids)
+	if err != nil {
+		return fmt.Errorf("reading task collaborators: %w", err)
+	}
+	for _, t := range tasks {
+		if err := aw.writeTask(taskFrom(t, collaborators[t.ID])); err != nil {
+			return fmt.Errorf("writing task %q: %w", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// archive is everything in an export, which jsonWriter writes a field at a
+// time. Its JSON form is the export format, so fields shouldn't be renamed or
+// removed without changing formatVersion.
+type archive struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Profile    *profile  `json:"profile"`
+	Lists      []*list   `json:"lists"`
+	Tasks      []*task   `json:"tasks"`
+}
+
+type profile struct {
+	ID           todo.UserID `json:"id"`
+	Name         string      `json:"name"`
+	Email        string      `json:"email"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	AuthProvider string      `json:"authProvider"`
+	// AuthIdentities are all the ways the user can sign in, including the one
+	// they signed up with, which is AuthProvider.
+	AuthIdentities []*authIdentity `json:"authIdentities"`
+}
+
+func profileFrom(u *todo.User, ids []*todo.AuthIdentity) *profile {
+	p := &profile{
+		ID:             u.ID,
+		Name:           u.Name,
+		Email:          u.Email,
+		CreatedAt:      u.CreatedAt,
+		AuthProvider:   string(u.AuthnProviderType),
+		AuthIdentities: make([]*authIdentity, len(ids)),
+	}
+	for i, a := range ids {
+		p.AuthIdentities[i] = &authIdentity{
+			Provider:       string(a.Provider),
+			ProviderUserID: a.ProviderUserID,
+			Email:          a.Email,
+			EmailVerified:  a.EmailVerified,
+			CreatedAt:      a.CreatedAt,
+		}
+	}
+	return p
+}
+
+type authIdentity struct {
+	Provider       string       `json:"provider"`
+	ProviderUserID authn.UserID `json:"providerUserId"`
+	Email          string       `json:"email"`
+	EmailVerified  bool         `json:"emailVerified"`
+	CreatedAt      time.Time    `json:"createdAt"`
+}
+
+type list struct {
+	ID         todo.ListID `json:"id"`
+	Name       string      `json:"name"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	ArchivedAt *time.Time  `json:"archivedAt"`
+}
+
+func listFrom(l *todo.List) *list {
+	return &list{
+		ID:         l.ID,
+		Name:       l.Name,
+		CreatedAt:  l.CreatedAt,
+		ArchivedAt: optionalTime(l.ArchivedAt),
+	}
+}
+
+type task struct {
+	ID            todo.TaskID     `json:"id"`
+	Name          string          `json:"name"`
+	Body          string          `json:"body"`
+	Tags          []string        `json:"tags"`
+	ListID        *todo.ListID    `json:"listId"`
+	ParentID      *todo.TaskID    `json:"parentId"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+	CompletedAt   *time.Time      `json:"completedAt"`
+	DueAt         *time.Time      `json:"dueAt"`
+	DeletedAt     *time.Time      `json:"deletedAt"`
+	Collaborators []*collaborator `json:"collaborators"`
+}
+
+type collaborator struct {
+	UserID todo.UserID `json:"userId"`
+	Role   string      `json:"role"`
+}
+
+func taskFrom(t *todo.Task, collaborators []*todo.TaskCollaborator) *task {
+	out := &task{
+		ID:            t.ID,
+		Name:          t.Name,
+		Body:          t.Body,
+		Tags:          append([]string{}, t.Tags...),
+		CreatedAt:     t.CreatedAt,
+		UpdatedAt:     t.UpdatedAt,
+		CompletedAt:   optionalTime(t.CompletedAt),
+		DueAt:         optionalTime(t.DueAt),
+		DeletedAt:     optionalTime(t.DeletedAt),
+		Collaborators: make([]*collaborator, len(collaborators)),
+	}
+	if t.ListID != "" {
+		out.ListID = &t.ListID
+	}
+	if t.ParentID != "" {
+		out.ParentID = &t.ParentID
+	}
+	for i, c := range collaborators {
+		out.Collaborators[i] = &collaborator{UserID: c.UserID, Role: string(c.Role)}
+	}
+	return out
+}
+
+// optionalTime returns nil for the zero time, which is how the domain types
+// represent a missing time, so that it's null in the export.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// archiveWriter writes the parts of an archive as they're read. The profile is
+// written first, then the lists, then each task, and close finishes the
+// archive.
+type archiveWriter interface {
+	writeProfile(version int, exportedAt time.Time, p *profile) error
+	writeLists([]*list) error
+	writeTask(*task) error
+	close() error
+}
+
+// jsonWriter writes the archive as a single JSON document, in the form of
+// archive.
+type jsonWriter struct {
+	w io.Writer
+	// fields is how many of the archive's fields have been written, and tasks
+	// is how many tasks have been.
+	fields, tasks int
+}
+
+func (jw *jsonWriter) writeProfile(version int, exportedAt time.Time, p *profile) error {
+	if err := jw.field("version", version); err != nil {
+		return err
+	}
+	if err := jw.field("exportedAt", exportedAt); err != nil {
+		return err
+	}
+	return jw.field("profile", p)
+}
+
+func (jw *jsonWriter) writeLists(ls []*list) error {
+	return jw.field("lists", ls)
+}
+
+func (jw *jsonWriter) writeTask(t *task) error {
+	sep := ","
+	if jw.tasks == 0 {
+		sep = `,"tasks":[`
+	}
+	jw.tasks++
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encoding task: %w", err)
+	}
+	if _, err := io.WriteString(jw.w, sep); err != nil {
+		return err
+	}
+	_, err = jw.w.Write(buf)
+	return err
+}
+
+func (jw *jsonWriter) close() error {
+	end := "]}\n"
+	if jw.tasks == 0 {
+		end = `,"tasks":[]}` + "\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
+
+// field writes one of the archive's fields, opening the document if it's the
+// first.
+func (jw *jsonWriter) field(name string, v interface{}) error {
+	sep := ","
+	if jw.fields == 0 {
+		sep = "{"
+	}
+	jw.fields++
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", name, err)
+	}
+	_, err = fmt.Fprintf(jw.w, "%s%q:%s", sep, name, buf)
+	return err
+}
+
+// zipWriter writes the archive as a ZIP file, with the profile, lists and tasks
+// in files of their own.
+type zipWriter struct {
+	zw       *zip.Writer
+	modified time.Time
+	// tasks is tasks.json, once it's been created.
+	tasks io.Writer
+}
+
+func (zw *zipWriter) writeProfile(version int, exportedAt time.Time, p *profile) error {
+	w, err := zw.create("profile.json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Version    int       `json:"version"`
+		ExportedAt time.Time `json:"exportedAt"`
+		Profile    *profile  `json:"profile"`
+	}{version, exportedAt, p})
+}
+
+func (zw *zipWriter) writeLists(ls []*list) error {
+	w, err := zw.create("lists.json")
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(w, ls)
+}
+
+func (zw *zipWriter) writeTask(t *task) error {
+	sep := ","
+	if zw.tasks == nil {
+		w, err := zw.create("tasks.json")
+		if err != nil {
+			return err
+		}
+		zw.tasks, sep = w, "["
+	}
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encoding task: %w", err)
+	}
+	if _, err := io.WriteString(zw.tasks, sep); err != nil {
+		return err
+	}
+	_, err = zw.tasks.Write(buf)
+	return err
+}
+
+func (zw *zipWriter) close() error {
+	end := "]"
+	if zw.tasks == nil {
+		w, err := zw.create("tasks.json")
+		if err != nil {
+			return err
+		}
+		zw.tasks, end = w, "[]"
+	}
+	if _, err := io.WriteString(zw.tasks, end); err != nil {
+		return err
+	}
+	if err := zw.zw.Close(); err != nil {
+		return fmt.Errorf("finishing ZIP file: %w", err)
+	}
+	return nil
+}
+
+// create starts the next file in the archive, which finishes the previous one.
+func (zw *zipWriter) create(name string) (io.Writer, error) {
+	w, err := zw.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: zw.modified,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", name, err)
+	}
+	return w, nil
+}
+
+// trackingWriter records whether anything has been written to w, as after
+// that, the response's status can't be changed.
+type trackingWriter struct {
+	w     io.Writer
+	wrote bool
+}
+
+func (tw *trackingWriter) Write(p []byte) (int, error) {
+	tw.wrote = true
+	return tw.w.Write(p)
+}
+
+func writeJSONArray[T any](w io.Writer, vs []T) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, v := range vs {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encoding element %d: %w", i, err)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
@@ -0,0 +1,219 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/testing/testdb"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.uber.org/zap/zaptest"
+)
+
+var exportedAt = time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+
+func TestExport(t *testing.T) {
+	h, userID, want := setup(t)
+
+	t.Run("JSON", func(t *testing.T) {
+		resp := get(t, h, userID, "/api/exportMyData")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusOK)
+		}
+		if got := resp.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("got content type %q, want application/json", got)
+		}
+		var got archive
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decoding export: %v", err)
+		}
+		if diff := cmp.Diff(want, &got, archiveCmpOpts()); diff != "" {
+			t.Errorf("unexpected export (-want +got)\n%s", diff)
+		}
+		if len(got.Tasks) == 2 && got.Tasks[1].DeletedAt == nil {
+			t.Error("trashed task had no deletion time")
+		}
+	})
+
+	t.Run("ZIP", func(t *testing.T) {
+		resp := get(t, h, userID, "/api/exportMyData?format=zip")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusOK)
+		}
+		body := resp.Body.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("reading ZIP file: %v", err)
+		}
+		got := &archive{}
+		dests := map[string]interface{}{
+			"profile.json": got,
+			"lists.json":   &got.Lists,
+			"tasks.json":   &got.Tasks,
+		}
+		for _, f := range zr.File {
+			dest, ok := dests[f.Name]
+			if !ok {
+				t.Errorf("unexpected file %q in ZIP file", f.Name)
+				continue
+			}
+			delete(dests, f.Name)
+			r, err := f.Open()
+			if err != nil {
+				t.Fatalf("opening %s: %v", f.Name, err)
+			}
+			if err := json.NewDecoder(r).Decode(dest); err != nil {
+				t.Fatalf("decoding %s: %v", f.Name, err)
+			}
+			r.Close()
+		}
+		for name := range dests {
+			t.Errorf("ZIP file had no %s", name)
+		}
+		if diff := cmp.Diff(want, got, archiveCmpOpts()); diff != "" {
+			t.Errorf("unexpected export (-want +got)\n%s", diff)
+		}
+	})
+}
+
+func TestExportErrors(t *testing.T) {
+	h, userID, _ := setup(t)
+
+	if resp := get(t, h, userID, "/api/exportMyData?format=csv"); resp.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: got status %d, want %d", resp.Code, http.StatusBadRequest)
+	}
+	if resp := get(t, h, "", "/api/exportMyData"); resp.Code != http.StatusUnauthorized {
+		t.Errorf("no user: got status %d, want %d", resp.Code, http.StatusUnauthorized)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/exportMyData", nil)
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req.WithContext(todo.WithUserID(req.Context(), userID)))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", resp.Code, http.StatusMethodNotAllowed)
+	}
+	// Nothing has been written when reading the user fails, so the error can
+	// still be reported.
+	resp = get(t, h, "user.missing", "/api/exportMyData")
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("missing user: got status %d, want %d", resp.Code, http.StatusInternalServerError)
+	}
+	if got := resp.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("missing user: got Content-Disposition %q, want none", got)
+	}
+}
+
+func TestExportPagesThroughTasks(t *testing.T) {
+	tdb := testdb.New()
+	tx := tdb.NoTxn(context.Background())
+	userID, err := tdb.CreateUser(tx, authn.Google, "google-id", "Alice", "alice@example.com")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	var want []todo.TaskID
+	for i := 0; i < taskPageSize+1; i++ {
+		id, err := tdb.CreateTask(tx, userID)
+		if err != nil {
+			t.Fatalf("creating task %d: %v", i, err)
+		}
+		want = append(want, id)
+	}
+	h := New(tdb, zaptest.NewLogger(t))
+
+	resp := get(t, h, userID, "/api/exportMyData")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.Code, http.StatusOK)
+	}
+	var a archive
+	if err := json.Unmarshal(resp.Body.Bytes(), &a); err != nil {
+		t.Fatalf("decoding export: %v", err)
+	}
+	var got []todo.TaskID
+	for _, t := range a.Tasks {
+		got = append(got, t.ID)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected tasks, want every task oldest first (-want +got)\n%s", diff)
+	}
+}
+
+// setup creates a user with some data, and returns the export of it that's
+// expected, ignoring the times that the test doesn't control.
+func setup(t *testing.T) (*Handler, todo.UserID, *archive) {
+	t.Helper()
+	tdb := testdb.New()
+	tx := tdb.NoTxn(context.Background())
+	userID, err0 := tdb.CreateUser(tx, authn.Google, "google-id", "Alice", "alice@example.com")
+	otherID, err1 := tdb.CreateUser(tx, authn.Google, "other-id", "Bob", "bob@example.com")
+	listID, err2 := tdb.CreateList(tx, userID, "Errands")
+	listed, err3 := tdb.CreateTask(tx, userID)
+	trashed, err4 := tdb.CreateTask(tx, userID)
+	_, err5 := tdb.CreateTask(tx, otherID)
+	err6 := tdb.UpdateTask(tx, listed, db.SetTaskName("Buy milk"), db.SetTaskBody("Semi-skimmed"), db.AddTaskTag("shopping"), db.SetTaskList(listID))
+	err7 := tdb.ShareTask(tx, listed, otherID, todo.TaskRoleViewer)
+	err8 := tdb.UpdateTask(tx, trashed, db.SetTaskName("Old"))
+	err9 := tdb.DeleteTask(tx, trashed)
+	for i, err := range []error{err0, err1, err2, err3, err4, err5, err6, err7, err8, err9} {
+		if err != nil {
+			t.Fatalf("error during setup at index %d: %v", i, err)
+		}
+	}
+
+	h := New(tdb, zaptest.NewLogger(t))
+	h.now = func() time.Time { return exportedAt }
+	want := &archive{
+		Version:    formatVersion,
+		ExportedAt: exportedAt,
+		Profile: &profile{
+			ID:           userID,
+			Name:         "Alice",
+			Email:        "alice@example.com",
+			AuthProvider: "GOOGLE",
+			AuthIdentities: []*authIdentity{
+				{Provider: "GOOGLE", ProviderUserID: "google-id", Email: "alice@example.com"},
+			},
+		},
+		Lists: []*list{{ID: listID, Name: "Errands"}},
+		Tasks: []*task{
+			{
+				ID:            listed,
+				Name:          "Buy milk",
+				Body:          "Semi-skimmed",
+				Tags:          []string{"shopping"},
+				ListID:        &listID,
+				Collaborators: []*collaborator{{UserID: otherID, Role: "VIEWER"}},
+			},
+			{ID: trashed, Name: "Old", Tags: []string{}, Collaborators: []*collaborator{}},
+		},
+	}
+	return h, userID, want
+}
+
+func archiveCmpOpts() cmp.Option {
+	return cmp.Options{
+		cmpopts.IgnoreFields(profile{}, "CreatedAt"),
+		cmpopts.IgnoreFields(authIdentity{}, "CreatedAt"),
+		cmpopts.IgnoreFields(list{}, "CreatedAt"),
+		cmpopts.IgnoreFields(task{}, "CreatedAt", "UpdatedAt", "DeletedAt"),
+		cmpopts.EquateEmpty(),
+	}
+}
+
+func get(t *testing.T, h http.Handler, userID todo.UserID, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if userID != "" {
+		req = req.WithContext(todo.WithUserID(req.Context(), userID))
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
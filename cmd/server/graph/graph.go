@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/Silicon-Ally/gqlerr"
 	"github.com/Silicon-Ally/silicon-starter/authn"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/generated"
 	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
 	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 	"go.uber.org/zap"
 )
 
@@ -20,33 +25,98 @@ type DB interface {
 	RunOrContinueTransaction(db.Tx, func(tx db.Tx) error) error
 
 	User(db.Tx, todo.UserID) (*todo.User, error)
+	UsersByID(db.Tx, []todo.UserID) (map[todo.UserID]*todo.User, error)
 	Users(db.Tx) ([]*todo.User, error)
+	ListUsers(db.Tx, *db.UserQuery) (*db.UserPage, error)
 	CreateUser(db.Tx, authn.Provider, authn.UserID, string, string) (todo.UserID, error)
 	UpdateUser(db.Tx, todo.UserID, ...db.UpdateUserFn) error
+	DeleteUser(db.Tx, todo.UserID) error
+
+	AuthIdentities(db.Tx, todo.UserID) ([]*todo.AuthIdentity, error)
+	LinkAuthIdentity(db.Tx, *todo.AuthIdentity) error
+	UnlinkAuthIdentity(db.Tx, todo.UserID, authn.Provider, authn.UserID) error
 
 	Task(db.Tx, todo.TaskID) (*todo.Task, error)
-	TasksByCreator(db.Tx, todo.UserID) ([]*todo.Task, error)
+	TasksByID(db.Tx, []todo.TaskID) (map[todo.TaskID]*todo.Task, error)
+	TasksByCreator(db.Tx, todo.UserID, *db.TaskQuery) (*db.TaskPage, error)
+	TasksForUser(db.Tx, todo.UserID, *db.TaskQuery) (*db.TaskPage, error)
+	SearchTasks(db.Tx, todo.UserID, *db.TaskSearchQuery) (*db.TaskSearchPage, error)
+	TagsForUser(db.Tx, todo.UserID) ([]*todo.TagUsage, error)
+	TaskCountsByCreator(db.Tx, []todo.UserID) (map[todo.UserID]int, error)
 	CreateTask(db.Tx, todo.UserID) (todo.TaskID, error)
 	UpdateTask(db.Tx, todo.TaskID, ...db.UpdateTaskFn) error
 	DeleteTask(db.Tx, todo.TaskID) error
+
+	TaskCollaborators(db.Tx, todo.TaskID) ([]*todo.TaskCollaborator, error)
+	CollaboratorsByTaskID(db.Tx, []todo.TaskID) (map[todo.TaskID][]*todo.TaskCollaborator, error)
+	ShareTask(db.Tx, todo.TaskID, todo.UserID, todo.TaskRole) error
+	UnshareTask(db.Tx, todo.TaskID, todo.UserID) error
+
+	List(db.Tx, todo.ListID) (*todo.List, error)
+	ListsByCreator(db.Tx, todo.UserID) ([]*todo.List, error)
+	CreateList(db.Tx, todo.UserID, string) (todo.ListID, error)
+	UpdateList(db.Tx, todo.ListID, ...db.UpdateListFn) error
+	TasksInList(db.Tx, todo.ListID) ([]*todo.Task, error)
+	DeleteList(db.Tx, todo.ListID, db.ListTaskDisposition, todo.ListID) error
+
+	Subtasks(db.Tx, todo.TaskID) ([]*todo.Task, error)
+	SetTaskParent(db.Tx, todo.TaskID, todo.TaskID) error
+	BlockingTasks(db.Tx, todo.TaskID) ([]*todo.Task, error)
+	BlockedTasks(db.Tx, todo.TaskID) ([]*todo.Task, error)
+	AddTaskDependency(db.Tx, todo.TaskID, todo.TaskID) error
+	RemoveTaskDependency(db.Tx, todo.TaskID, todo.TaskID) error
+
+	TaskHistory(db.Tx, todo.TaskID, *db.TaskEventQuery) (*db.TaskEventPage, error)
+
+	TrashedTask(db.Tx, todo.TaskID) (*todo.Task, error)
+	TrashedTasks(db.Tx, todo.UserID) ([]*todo.Task, error)
+	RestoreTask(db.Tx, todo.TaskID) error
+	PurgeTask(db.Tx, todo.TaskID) error
+}
+
+// PubSub delivers notifications about committed task changes, to power
+// GraphQL subscriptions.
+type PubSub interface {
+	PublishTaskEvent(context.Context, *pubsub.TaskEvent) error
+	SubscribeToTaskEvents(context.Context, todo.UserID) (<-chan *pubsub.TaskEvent, error)
+}
+
+// Auth is the backing auth system, which is usually a *fireauth.Client. It's
+// the part of session.Auth that resolvers need, plus which providers it
+// manages the identities of, as users can have identities linked from others.
+type Auth interface {
+	VerifyIDToken(ctx context.Context, idToken string) (*authn.Token, error)
+	RevokeRefreshTokens(ctx context.Context, uID authn.UserID) error
+	ManagesProvider(authn.Provider) bool
 }
 
 type Resolver struct {
 	db     DB
+	pubsub PubSub
+	auth   Auth
 	logger *zap.Logger
+	now    func() time.Time // Stubbed out for deterministic tests
 }
 
 // These are part of the gqlgen interface, see https://gqlgen.com/
-func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
-func (r *Resolver) Query() generated.QueryResolver       { return &queryResolver{r} }
+func (r *Resolver) Mutation() generated.MutationResolver         { return &mutationResolver{r} }
+func (r *Resolver) Query() generated.QueryResolver               { return &queryResolver{r} }
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+func (r *Resolver) Task() generated.TaskResolver                 { return &taskResolver{r} }
+func (r *Resolver) User() generated.UserResolver                 { return &userResolver{r} }
 
 type (
-	mutationResolver struct{ *Resolver }
-	queryResolver    struct{ *Resolver }
+	mutationResolver     struct{ *Resolver }
+	queryResolver        struct{ *Resolver }
+	subscriptionResolver struct{ *Resolver }
+	taskResolver         struct{ *Resolver }
+	userResolver         struct{ *Resolver }
 )
 
 type ResolverConfig struct {
 	DB     DB
+	PubSub PubSub
+	Auth   Auth
 	Logger *zap.Logger
 }
 
@@ -55,6 +125,14 @@ func (c *ResolverConfig) validate() error {
 		return errors.New("no DB was given")
 	}
 
+	if c.PubSub == nil {
+		return errors.New("no PubSub was given")
+	}
+
+	if c.Auth == nil {
+		return errors.New("no Auth was given")
+	}
+
 	if c.Logger == nil {
 		return errors.New("no logger given")
 	}
@@ -69,10 +147,45 @@ func NewResolver(cfg *ResolverConfig) (*Resolver, error) {
 
 	return &Resolver{
 		db:     cfg.DB,
+		pubsub: cfg.PubSub,
+		auth:   cfg.Auth,
 		logger: cfg.Logger,
+		now:    time.Now,
 	}, nil
 }
 
+// conflictErr reports that a write was rejected because the entity was changed
+// since the client read it. The entity's current state is included in the
+// error's "current" extension so the client can merge its change.
+// If current is nil, the extension is omitted.
+func conflictErr(ctx context.Context, msg string, current interface{}) error {
+	ext := map[string]interface{}{
+		"code": string(errkind.Conflict),
+	}
+	if current != nil {
+		ext["current"] = current
+	}
+	return &gqlerror.Error{
+		Message:    msg,
+		Path:       graphql.GetPath(ctx),
+		Extensions: ext,
+	}
+}
+
+// invalidFieldErr reports that a write was rejected because the value given
+// for a field breaks its validation rule. The field is included in the error's
+// "field" extension so the client can point the user at it.
+func invalidFieldErr(ctx context.Context, msg, field, reason string) error {
+	return &gqlerror.Error{
+		Message: fmt.Sprintf("%s: %s %s", msg, field, reason),
+		Path:    graphql.GetPath(ctx),
+		Extensions: map[string]interface{}{
+			"code":  string(errkind.InvalidArgument),
+			"field": field,
+		},
+	}
+}
+
 func emptySuccess() (*bool, error) {
 	b := true
 	return &b, nil
@@ -81,7 +194,43 @@ func emptySuccess() (*bool, error) {
 func (r *Resolver) userIDFromContext(ctx context.Context) (todo.UserID, error) {
 	userID, err := todo.UserIDFromContext(ctx)
 	if err != nil || userID == "" {
-		return "", gqlerr.Internal(ctx, "failed to get user id from context", zap.Error(err))
+		return "", gqlerr.Unauthenticated(ctx, "failed to get user id from context", zap.Error(err))
 	}
 	return userID, nil
 }
+
+// gqlErr converts an error into the GraphQL error for its kind, so that the
+// error's "code" extension tells the client what went wrong. Errors without a
+// kind are reported as internal errors.
+func gqlErr(ctx context.Context, msg string, err error, fields ...zap.Field) error {
+	fields = append(fields, zap.Error(err))
+	switch errkind.Of(err) {
+	case errkind.NotFound:
+		return gqlerr.NotFound(ctx, msg, fields...)
+	case errkind.PermissionDenied:
+		return gqlerr.PermissionDenied(ctx, msg, fields...)
+	case errkind.InvalidArgument:
+		if field, reason, ok := todo.InvalidField(err); ok {
+			return invalidFieldErr(ctx, msg, field, reason)
+		}
+		return gqlerr.InvalidArgument(ctx, msg, fields...)
+	case errkind.Unauthenticated:
+		return gqlerr.Unauthenticated(ctx, msg, fields...)
+	case errkind.Conflict:
+		return conflictErr(ctx, msg, nil)
+	default:
+		return gqlerr.Internal(ctx, msg, fields...)
+	}
+}
+
+// listErr converts an error encountered while working with a list into the
+// appropriate GraphQL error.
+func listErr(ctx context.Context, msg, listID string, err error) error {
+	return gqlErr(ctx, msg, err, zap.String("list_id", listID))
+}
+
+// taskErr converts an error encountered while working with a task into the
+// appropriate GraphQL error.
+func taskErr(ctx context.Context, msg, taskID string, err error) error {
+	return gqlErr(ctx, msg, err, zap.String("task_id", taskID))
+}
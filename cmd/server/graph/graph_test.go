@@ -1,13 +1,23 @@
 package graph
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/generated"
 	"github.com/Silicon-Ally/silicon-starter/db/sqldb"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
 	"github.com/Silicon-Ally/silicon-starter/testing/testdb"
 	"github.com/Silicon-Ally/silicon-starter/todo"
 	"github.com/Silicon-Ally/testpgx"
@@ -51,6 +61,44 @@ func runTests(m *testing.M) int {
 type testEnv struct {
 	resolver *Resolver
 	db       DB // Can be testdb or sqldb
+	auth     *fakeAuth
+	// users is how many users were created with createUserForTest, so that
+	// each can sign in with their own identity.
+	users int
+}
+
+// fakeAuth accepts the ID tokens in tokens, and records the users whose
+// sessions were revoked. It manages every provider but OIDC, and fails to
+// revoke the sessions of users in errs.
+type fakeAuth struct {
+	mu      sync.Mutex
+	tokens  map[string]*authn.Token
+	revoked []authn.UserID
+	errs    map[authn.UserID]error
+}
+
+func (f *fakeAuth) VerifyIDToken(ctx context.Context, idToken string) (*authn.Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tkn, ok := f.tokens[idToken]
+	if !ok {
+		return nil, fmt.Errorf("ID token %q failed verification", idToken)
+	}
+	return tkn, nil
+}
+
+func (f *fakeAuth) RevokeRefreshTokens(ctx context.Context, uID authn.UserID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err, ok := f.errs[uID]; ok {
+		return err
+	}
+	f.revoked = append(f.revoked, uID)
+	return nil
+}
+
+func (f *fakeAuth) ManagesProvider(p authn.Provider) bool {
+	return p != authn.OIDC
 }
 
 func (env *testEnv) getFakeDB(t *testing.T) *testdb.DB {
@@ -109,10 +157,12 @@ func setup(t *testing.T, opts ...envOpt) (*Resolver, *testEnv) {
 
 	tdb := eOpts.initDB(t)
 	logger := zaptest.NewLogger(t)
-	env := &testEnv{db: tdb}
+	env := &testEnv{db: tdb, auth: &fakeAuth{}}
 
 	r, err := NewResolver(&ResolverConfig{
 		DB:     env.db,
+		PubSub: pubsub.NewInProcess(),
+		Auth:   env.auth,
 		Logger: logger,
 	})
 	if err != nil {
@@ -129,7 +179,9 @@ func setup(t *testing.T, opts ...envOpt) (*Resolver, *testEnv) {
 
 func createUserForTest(t *testing.T, env *testEnv) (todo.UserID, context.Context) {
 	t.Helper()
-	userID, err := env.db.CreateUser(env.db.NoTxn(context.Background()), authn.EmailAndPass, "user@example.com", "User", "user@example.com")
+	env.users++
+	authID := authn.UserID(fmt.Sprintf("user-%d", env.users))
+	userID, err := env.db.CreateUser(env.db.NoTxn(context.Background()), authn.EmailAndPass, authID, "User", "user@example.com")
 	if err != nil {
 		t.Fatalf("creating user: %v", err)
 	}
@@ -137,6 +189,39 @@ func createUserForTest(t *testing.T, env *testEnv) (todo.UserID, context.Context
 	return userID, ctx
 }
 
+// runQuery executes the query through the GraphQL schema as the user in ctx,
+// and unmarshals the response's data into resp. Unlike calling resolvers
+// directly, this tells resolvers which fields were requested.
+func runQuery(t *testing.T, ctx context.Context, r *Resolver, query string, vars map[string]interface{}, resp interface{}) {
+	t.Helper()
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: r}))
+	srv.AddTransport(transport.POST{})
+	srv.AroundOperations(r.LoadersMiddleware)
+
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	if err != nil {
+		t.Fatalf("marshalling request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	var out struct {
+		Data   json.RawMessage `json:"data"`
+		Errors json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("unmarshalling response: %v", err)
+	}
+	if len(out.Errors) > 0 {
+		t.Fatalf("query returned errors: %s", out.Errors)
+	}
+	if err := json.Unmarshal(out.Data, resp); err != nil {
+		t.Fatalf("unmarshalling response data: %v", err)
+	}
+}
+
 func noErrDuringSetup(t testing.TB, errs ...error) {
 	t.Helper()
 	for i, err := range errs {
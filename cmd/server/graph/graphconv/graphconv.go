@@ -3,9 +3,15 @@
 package graphconv
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphutil"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
 	"github.com/Silicon-Ally/silicon-starter/todo"
 )
 
@@ -18,16 +24,41 @@ func TagsToGQL(in todo.Tags) []*string {
 	return out
 }
 
+func TagUsageToGQL(in *todo.TagUsage) *model.TagUsage {
+	return &model.TagUsage{
+		Tag:       in.Tag,
+		TaskCount: in.TaskCount,
+	}
+}
+
+func TagUsagesToGQL(in []*todo.TagUsage) []*model.TagUsage {
+	out := make([]*model.TagUsage, len(in))
+	for i, t := range in {
+		out[i] = TagUsageToGQL(t)
+	}
+	return out
+}
+
 func TaskToGQL(tsk *todo.Task) (*model.Task, error) {
 	if tsk == nil {
 		return nil, nil
 	}
 
 	return &model.Task{
-		ID:   string(tsk.ID),
-		Name: tsk.Name,
-		Body: tsk.Body,
-		Tags: TagsToGQL(tsk.Tags),
+		ID:          string(tsk.ID),
+		Name:        tsk.Name,
+		Body:        tsk.Body,
+		Tags:        TagsToGQL(tsk.Tags),
+		Completed:   tsk.IsCompleted(),
+		CompletedAt: graphutil.TimeToPtr(tsk.CompletedAt),
+		DueAt:       graphutil.TimeToPtr(tsk.DueAt),
+		ListID:      listIDToPtr(tsk.ListID),
+		CreatedByID: string(tsk.CreatedBy),
+		CreatedAt:   tsk.CreatedAt,
+		UpdatedAt:   tsk.UpdatedAt,
+		ParentID:    taskIDToPtr(tsk.ParentID),
+		DeletedAt:   graphutil.TimeToPtr(tsk.DeletedAt),
+		Version:     tsk.Version,
 	}, nil
 }
 
@@ -35,15 +66,387 @@ func TasksToGQL(tsks []*todo.Task) ([]*model.Task, error) {
 	return sliceToGQLWithErrHandling(tsks, TaskToGQL)
 }
 
+// TaskQueryFromGQL converts the filter and sort arguments of a task listing
+// into a query, pagination arguments are handled by the caller.
+func TaskQueryFromGQL(filter *model.TaskFilter, sort *model.TaskSort) (*db.TaskQuery, error) {
+	q := db.DefaultTaskQuery()
+	if filter != nil {
+		if filter.Tag != nil {
+			q.Filter.Tag = *filter.Tag
+		}
+		if filter.ListID != nil {
+			q.Filter.ListID = todo.ListID(*filter.ListID)
+		}
+		q.Filter.Completed = filter.Completed
+		if filter.CreatedAfter != nil {
+			q.Filter.CreatedAfter = *filter.CreatedAfter
+		}
+		if filter.CreatedBefore != nil {
+			q.Filter.CreatedBefore = *filter.CreatedBefore
+		}
+	}
+	if sort != nil {
+		field, err := taskSortFieldFromGQL(sort.Field)
+		if err != nil {
+			return nil, err
+		}
+		q.Sort.Field = field
+		q.Sort.Descending = sort.Direction != nil && *sort.Direction == model.SortDirectionDesc
+	}
+	return q, nil
+}
+
+// TaskPatchFromGQL converts a patch into the mutations that make its changes,
+// now is used as the completion time when the patch completes the task. The
+// returned mutations don't check the patch's expected version, which is left to
+// the caller.
+func TaskPatchFromGQL(in *model.TaskPatch, now time.Time) ([]db.UpdateTaskFn, error) {
+	if in == nil {
+		return nil, errors.New("no task patch was given")
+	}
+	if in.DueAt != nil && in.ClearDueAt != nil && *in.ClearDueAt {
+		return nil, errors.New("dueAt and clearDueAt can't both be given")
+	}
+	var fns []db.UpdateTaskFn
+	if in.Name != nil {
+		fns = append(fns, db.SetTaskName(*in.Name))
+	}
+	if in.Body != nil {
+		fns = append(fns, db.SetTaskBody(*in.Body))
+	}
+	for _, tag := range in.AddTags {
+		fns = append(fns, db.AddTaskTag(tag))
+	}
+	for _, tag := range in.RemoveTags {
+		fns = append(fns, db.RemoveTaskTag(tag))
+	}
+	if in.Completed != nil {
+		fns = append(fns, db.SetTaskCompleted(*in.Completed, now))
+	}
+	if in.DueAt != nil {
+		fns = append(fns, db.SetTaskDueAt(*in.DueAt))
+	} else if in.ClearDueAt != nil && *in.ClearDueAt {
+		fns = append(fns, db.SetTaskDueAt(time.Time{}))
+	}
+	return fns, nil
+}
+
+func taskSortFieldFromGQL(in model.TaskSortField) (db.TaskSortField, error) {
+	switch in {
+	case model.TaskSortFieldName:
+		return db.TaskSortByName, nil
+	case model.TaskSortFieldCreatedAt:
+		return db.TaskSortByCreatedAt, nil
+	case model.TaskSortFieldDueAt:
+		return db.TaskSortByDueAt, nil
+	default:
+		return "", fmt.Errorf("unknown task sort field %q", in)
+	}
+}
+
+func TaskPageToGQL(page *db.TaskPage, field db.TaskSortField) (*model.TaskConnection, error) {
+	edges := make([]*model.TaskEdge, len(page.Tasks))
+	for i, t := range page.Tasks {
+		node, err := TaskToGQL(t)
+		if err != nil {
+			return nil, fmt.Errorf("converting task at index %d: %w", i, err)
+		}
+		edges[i] = &model.TaskEdge{
+			Cursor: string(db.TaskCursor(t, field)),
+			Node:   node,
+		}
+	}
+	pageInfo := &model.PageInfo{
+		HasNextPage: page.HasNextPage,
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+	return &model.TaskConnection{
+		Edges:    edges,
+		PageInfo: pageInfo,
+	}, nil
+}
+
+func TaskSearchPageToGQL(page *db.TaskSearchPage) (*model.TaskSearchConnection, error) {
+	edges := make([]*model.TaskSearchEdge, len(page.Results))
+	for i, r := range page.Results {
+		task, err := TaskToGQL(r.Task)
+		if err != nil {
+			return nil, fmt.Errorf("converting task of result at index %d: %w", i, err)
+		}
+		edges[i] = &model.TaskSearchEdge{
+			Cursor: string(db.TaskSearchCursor(r)),
+			Node: &model.TaskSearchResult{
+				Task:        task,
+				Rank:        float64(r.Rank),
+				Name:        textSpansToGQL(r.Name),
+				BodySnippet: textSpansToGQL(r.BodySnippet),
+			},
+		}
+	}
+	pageInfo := &model.PageInfo{
+		HasNextPage: page.HasNextPage,
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+	return &model.TaskSearchConnection{
+		Edges:    edges,
+		PageInfo: pageInfo,
+	}, nil
+}
+
+func textSpansToGQL(in []db.TextSpan) []*model.TextSpan {
+	out := make([]*model.TextSpan, len(in))
+	for i, s := range in {
+		out[i] = &model.TextSpan{Text: s.Text, Match: s.Match}
+	}
+	return out
+}
+
+func TaskRoleToGQL(in todo.TaskRole) (model.TaskRole, error) {
+	switch in {
+	case todo.TaskRoleViewer:
+		return model.TaskRoleViewer, nil
+	case todo.TaskRoleEditor:
+		return model.TaskRoleEditor, nil
+	case todo.TaskRoleOwner:
+		return model.TaskRoleOwner, nil
+	default:
+		return "", fmt.Errorf("unknown task role %q", in)
+	}
+}
+
+func TaskRoleFromGQL(in model.TaskRole) (todo.TaskRole, error) {
+	switch in {
+	case model.TaskRoleViewer:
+		return todo.TaskRoleViewer, nil
+	case model.TaskRoleEditor:
+		return todo.TaskRoleEditor, nil
+	case model.TaskRoleOwner:
+		return todo.TaskRoleOwner, nil
+	default:
+		return "", fmt.Errorf("unknown task role %q", in)
+	}
+}
+
+func TaskCollaboratorToGQL(c *todo.TaskCollaborator, user *todo.User) (*model.TaskCollaborator, error) {
+	role, err := TaskRoleToGQL(c.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TaskCollaborator{
+		User: UserToGQL(user),
+		Role: role,
+	}, nil
+}
+
+func TaskEventKindToGQL(in todo.TaskEventKind) (model.TaskEventKind, error) {
+	switch in {
+	case todo.TaskEventCreated:
+		return model.TaskEventKindCreated, nil
+	case todo.TaskEventUpdated:
+		return model.TaskEventKindUpdated, nil
+	case todo.TaskEventDeleted:
+		return model.TaskEventKindDeleted, nil
+	default:
+		return "", fmt.Errorf("unknown task event kind %q", in)
+	}
+}
+
+// TaskEventToGQL converts an event from a task's history, actor should be nil
+// if the event has no actor, or the actor no longer exists.
+func TaskEventToGQL(e *todo.TaskEvent, actor *todo.User) (*model.TaskEvent, error) {
+	kind, err := TaskEventKindToGQL(e.Kind)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*model.TaskFieldChange, len(e.Changes))
+	for i, c := range e.Changes {
+		changes[i] = &model.TaskFieldChange{
+			Field:  c.Field,
+			Before: rawJSONToPtr(c.Before),
+			After:  rawJSONToPtr(c.After),
+		}
+	}
+	return &model.TaskEvent{
+		ID:        string(e.ID),
+		Kind:      kind,
+		Actor:     UserToGQL(actor),
+		CreatedAt: e.CreatedAt,
+		Changes:   changes,
+	}, nil
+}
+
+// TaskEventPageToGQL converts a page of a task's history, actors holds the
+// users that made the changes, keyed by ID.
+func TaskEventPageToGQL(page *db.TaskEventPage, actors map[todo.UserID]*todo.User) (*model.TaskEventConnection, error) {
+	edges := make([]*model.TaskEventEdge, len(page.Events))
+	for i, e := range page.Events {
+		node, err := TaskEventToGQL(e, actors[e.ActorID])
+		if err != nil {
+			return nil, fmt.Errorf("converting task event at index %d: %w", i, err)
+		}
+		edges[i] = &model.TaskEventEdge{
+			Cursor: string(db.TaskEventCursor(e)),
+			Node:   node,
+		}
+	}
+	pageInfo := &model.PageInfo{
+		HasNextPage: page.HasNextPage,
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+	return &model.TaskEventConnection{
+		Edges:    edges,
+		PageInfo: pageInfo,
+	}, nil
+}
+
+func rawJSONToPtr(in json.RawMessage) *string {
+	if len(in) == 0 {
+		return nil
+	}
+	s := string(in)
+	return &s
+}
+
+func ListToGQL(l *todo.List) *model.List {
+	if l == nil {
+		return nil
+	}
+
+	return &model.List{
+		ID:         string(l.ID),
+		Name:       l.Name,
+		Archived:   l.IsArchived(),
+		ArchivedAt: graphutil.TimeToPtr(l.ArchivedAt),
+		CreatedAt:  l.CreatedAt,
+	}
+}
+
+func ListsToGQL(ls []*todo.List) []*model.List {
+	out := make([]*model.List, len(ls))
+	for i, l := range ls {
+		out[i] = ListToGQL(l)
+	}
+	return out
+}
+
+func ListTaskDispositionFromGQL(in model.ListTaskDisposition) (db.ListTaskDisposition, error) {
+	switch in {
+	case model.ListTaskDispositionDeleteTasks:
+		return db.DeleteListTasks, nil
+	case model.ListTaskDispositionMoveTasks:
+		return db.MoveListTasks, nil
+	default:
+		return "", fmt.Errorf("unknown list task disposition %q", in)
+	}
+}
+
+func listIDToPtr(id todo.ListID) *string {
+	if id == "" {
+		return nil
+	}
+	s := string(id)
+	return &s
+}
+
+func taskIDToPtr(id todo.TaskID) *string {
+	if id == "" {
+		return nil
+	}
+	s := string(id)
+	return &s
+}
+
 func UserToGQL(user *todo.User) *model.User {
 	if user == nil {
 		return nil
 	}
 
+	// The private fields and the task count have their own resolvers.
 	return &model.User{
-		ID:   string(user.ID),
-		Name: user.Name,
+		ID:        string(user.ID),
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		Admin:     user.Admin,
+		Version:   user.Version,
+	}
+}
+
+func UserPageToGQL(page *db.UserPage) *model.UserConnection {
+	edges := make([]*model.UserEdge, len(page.Users))
+	for i, u := range page.Users {
+		edges[i] = &model.UserEdge{
+			Cursor: string(db.UserCursor(u)),
+			Node:   UserToGQL(u),
+		}
 	}
+	pageInfo := &model.PageInfo{
+		HasNextPage: page.HasNextPage,
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+	return &model.UserConnection{
+		Edges:    edges,
+		PageInfo: pageInfo,
+	}
+}
+
+func AuthProviderToGQL(in authn.Provider) (model.AuthProvider, error) {
+	switch in {
+	case authn.Google:
+		return model.AuthProviderGoogle, nil
+	case authn.EmailAndPass:
+		return model.AuthProviderEmailAndPass, nil
+	case authn.Facebook:
+		return model.AuthProviderFacebook, nil
+	case authn.OIDC:
+		return model.AuthProviderOidc, nil
+	default:
+		return "", fmt.Errorf("unknown auth provider %q", in)
+	}
+}
+
+func AuthProviderFromGQL(in model.AuthProvider) (authn.Provider, error) {
+	switch in {
+	case model.AuthProviderGoogle:
+		return authn.Google, nil
+	case model.AuthProviderEmailAndPass:
+		return authn.EmailAndPass, nil
+	case model.AuthProviderFacebook:
+		return authn.Facebook, nil
+	case model.AuthProviderOidc:
+		return authn.OIDC, nil
+	default:
+		return "", fmt.Errorf("unknown auth provider %q", in)
+	}
+}
+
+func AuthIdentityToGQL(a *todo.AuthIdentity) (*model.AuthIdentity, error) {
+	p, err := AuthProviderToGQL(a.Provider)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuthIdentity{
+		Provider:       p,
+		ProviderUserID: string(a.ProviderUserID),
+		Email:          a.Email,
+		EmailVerified:  a.EmailVerified,
+		CreatedAt:      a.CreatedAt,
+	}, nil
+}
+
+func AuthIdentitiesToGQL(as []*todo.AuthIdentity) ([]*model.AuthIdentity, error) {
+	return sliceToGQLWithErrHandling(as, AuthIdentityToGQL)
 }
 
 func sliceToGQLWithErrHandling[I any, O any](is []I, fn func(I) (O, error)) ([]O, error) {
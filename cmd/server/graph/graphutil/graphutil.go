@@ -26,6 +26,14 @@ func ContainsAnyOf(ctx context.Context, targets ...string) bool {
 	return GetPreloads(ctx).ContainsAnyOf(targets...)
 }
 
+// MayContainAnyOf is like ContainsAnyOf, except that it's true when ctx isn't
+// from a GraphQL operation, e.g. when a resolver is called directly, as then
+// any field may be needed. It's meant for skipping work that's only needed for
+// some fields.
+func MayContainAnyOf(ctx context.Context, targets ...string) bool {
+	return !graphql.HasOperationContext(ctx) || ContainsAnyOf(ctx, targets...)
+}
+
 func GetPreloads(ctx context.Context) *Fields {
 	if !graphql.HasOperationContext(ctx) {
 		return &Fields{fields: make(map[string]struct{})}
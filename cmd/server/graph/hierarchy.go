@@ -0,0 +1,181 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/authz"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+func (t *taskResolver) Parent(ctx context.Context, obj *model.Task) (*model.Task, error) {
+	if obj.ParentID == nil {
+		return nil, nil
+	}
+	tasks, err := t.linkedTasks(ctx, func(tx db.Tx) ([]*todo.Task, error) {
+		// Parents are looked up through the loader, as the parent of every task
+		// in a listing is usually resolved at once.
+		parent, ok, err := t.loaders(ctx).tasks.load(ctx, todo.TaskID(*obj.ParentID))
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			// The parent is in the trash.
+			return nil, nil
+		}
+		return []*todo.Task{parent}, nil
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't read parent task", obj.ID, err)
+	}
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+	return tasks[0], nil
+}
+
+func (t *taskResolver) Subtasks(ctx context.Context, obj *model.Task) ([]*model.Task, error) {
+	tasks, err := t.linkedTasks(ctx, func(tx db.Tx) ([]*todo.Task, error) {
+		return t.db.Subtasks(tx, todo.TaskID(obj.ID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't read subtasks", obj.ID, err)
+	}
+	return tasks, nil
+}
+
+func (t *taskResolver) BlockedBy(ctx context.Context, obj *model.Task) ([]*model.Task, error) {
+	tasks, err := t.linkedTasks(ctx, func(tx db.Tx) ([]*todo.Task, error) {
+		return t.db.BlockingTasks(tx, todo.TaskID(obj.ID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't read blocking tasks", obj.ID, err)
+	}
+	return tasks, nil
+}
+
+func (t *taskResolver) Blocks(ctx context.Context, obj *model.Task) ([]*model.Task, error) {
+	tasks, err := t.linkedTasks(ctx, func(tx db.Tx) ([]*todo.Task, error) {
+		return t.db.BlockedTasks(tx, todo.TaskID(obj.ID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't read blocked tasks", obj.ID, err)
+	}
+	return tasks, nil
+}
+
+// linkedTasks loads the tasks linked to another task, dropping any that the
+// logged-in user can't read, as links can cross between users' tasks. The
+// collaborators of the linked tasks are looked up through the loader, so that
+// resolving the links of every task in a listing doesn't make a query per
+// linked task.
+func (t *taskResolver) linkedTasks(ctx context.Context, load func(tx db.Tx) ([]*todo.Task, error)) ([]*model.Task, error) {
+	userID, err := t.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := load(t.db.NoTxn(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("loading linked tasks: %w", err)
+	}
+	ids := make([]todo.TaskID, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	collaborators, err := t.loaders(ctx).collaborators.loadAll(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("reading collaborators of linked tasks: %w", err)
+	}
+	var readable []*todo.Task
+	for _, task := range tasks {
+		err := authz.CheckTask(userID, task, collaborators[task.ID], authz.Read)
+		if authz.IsPermissionDenied(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		readable = append(readable, task)
+	}
+	return graphconv.TasksToGQL(readable)
+}
+
+func (m *mutationResolver) SetTaskParent(ctx context.Context, taskID string, parentID *string) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var parent todo.TaskID
+	if parentID != nil {
+		parent = todo.TaskID(*parentID)
+	}
+	err = m.linkTasks(ctx, userID, todo.TaskID(taskID), parent, func(tx db.Tx) error {
+		return m.db.SetTaskParent(tx, todo.TaskID(taskID), parent)
+	})
+	if errors.Is(err, todo.ErrTaskCycle) {
+		return nil, gqlerr.InvalidArgument(ctx, "a task can't be a subtask of itself or its subtasks", zap.String("task_id", taskID), zap.String("parent_id", string(parent)), zap.Error(err))
+	} else if err != nil {
+		return nil, taskErr(ctx, "couldn't set task parent", taskID, err)
+	}
+	return emptySuccess()
+}
+
+func (m *mutationResolver) AddTaskDependency(ctx context.Context, taskID string, blockedByID string) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = m.linkTasks(ctx, userID, todo.TaskID(taskID), todo.TaskID(blockedByID), func(tx db.Tx) error {
+		return m.db.AddTaskDependency(tx, todo.TaskID(taskID), todo.TaskID(blockedByID))
+	})
+	if errors.Is(err, todo.ErrTaskCycle) {
+		return nil, gqlerr.InvalidArgument(ctx, "a task can't be blocked by a task that's waiting on it", zap.String("task_id", taskID), zap.String("blocked_by_id", blockedByID), zap.Error(err))
+	} else if err != nil {
+		return nil, taskErr(ctx, "couldn't add task dependency", taskID, err)
+	}
+	return emptySuccess()
+}
+
+func (m *mutationResolver) RemoveTaskDependency(ctx context.Context, taskID string, blockedByID string) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = m.linkTasks(ctx, userID, todo.TaskID(taskID), "", func(tx db.Tx) error {
+		return m.db.RemoveTaskDependency(tx, todo.TaskID(taskID), todo.TaskID(blockedByID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't remove task dependency", taskID, err)
+	}
+	return emptySuccess()
+}
+
+// linkTasks runs the given change to the links of a task in a transaction,
+// after checking that the logged-in user may edit the task and read the task
+// it's being linked to, if any.
+func (m *mutationResolver) linkTasks(ctx context.Context, userID todo.UserID, taskID, otherID todo.TaskID, fn func(tx db.Tx) error) error {
+	var ownerID todo.UserID
+	err := m.db.Transactional(ctx, func(tx db.Tx) error {
+		task, err := m.authorizedTask(tx, userID, taskID, authz.Edit)
+		if err != nil {
+			return err
+		}
+		ownerID = task.CreatedBy
+		if otherID != "" {
+			if _, err := m.authorizedTask(tx, userID, otherID, authz.Read); err != nil {
+				return fmt.Errorf("checking linked task: %w", err)
+			}
+		}
+		return fn(tx)
+	})
+	if err != nil {
+		return err
+	}
+	m.publishTaskEvent(ctx, pubsub.TaskUpdated, taskID, ownerID)
+	return nil
+}
@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetTaskParent(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	parentID, err0 := r.Mutation().CreateTask(ctx)
+	childID, err1 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0, err1)
+
+	if _, err := r.Mutation().SetTaskParent(ctx, childID, &parentID); err != nil {
+		t.Fatalf("setting task parent: %v", err)
+	}
+	if _, err := r.Mutation().SetTaskParent(ctx, parentID, &childID); err == nil {
+		t.Error("expected an error when making a task a subtask of its subtask, but got none")
+	}
+
+	child, err := r.Query().Task(ctx, childID)
+	if err != nil {
+		t.Fatalf("reading child: %v", err)
+	}
+	parent, err := r.Task().Parent(ctx, child)
+	if err != nil {
+		t.Fatalf("reading parent: %v", err)
+	}
+	if diff := cmp.Diff(&model.Task{ID: parentID}, parent, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected parent (-want +got):\n %s", diff)
+	}
+	subtasks, err := r.Task().Subtasks(ctx, &model.Task{ID: parentID})
+	if err != nil {
+		t.Fatalf("reading subtasks: %v", err)
+	}
+	expected := []*model.Task{{ID: childID, ParentID: &parentID}}
+	if diff := cmp.Diff(expected, subtasks, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected subtasks (-want +got):\n %s", diff)
+	}
+
+	if _, err := r.Mutation().SetTaskParent(ctx, childID, nil); err != nil {
+		t.Fatalf("clearing task parent: %v", err)
+	}
+	subtasks, err = r.Task().Subtasks(ctx, &model.Task{ID: parentID})
+	if err != nil {
+		t.Fatalf("reading subtasks: %v", err)
+	}
+	if len(subtasks) != 0 {
+		t.Errorf("expected no subtasks after clearing the parent, but got %d", len(subtasks))
+	}
+}
+
+func TestTaskDependencies(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	taskA, err0 := r.Mutation().CreateTask(ctx)
+	taskB, err1 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0, err1)
+
+	if _, err := r.Mutation().AddTaskDependency(ctx, taskA, taskB); err != nil {
+		t.Fatalf("adding dependency: %v", err)
+	}
+	if _, err := r.Mutation().AddTaskDependency(ctx, taskB, taskA); err == nil {
+		t.Error("expected an error when adding a cyclic dependency, but got none")
+	}
+
+	blockedBy, err := r.Task().BlockedBy(ctx, &model.Task{ID: taskA})
+	if err != nil {
+		t.Fatalf("reading blocking tasks: %v", err)
+	}
+	if diff := cmp.Diff([]*model.Task{{ID: taskB}}, blockedBy, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected blocking tasks (-want +got):\n %s", diff)
+	}
+	blocks, err := r.Task().Blocks(ctx, &model.Task{ID: taskB})
+	if err != nil {
+		t.Fatalf("reading blocked tasks: %v", err)
+	}
+	if diff := cmp.Diff([]*model.Task{{ID: taskA}}, blocks, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected blocked tasks (-want +got):\n %s", diff)
+	}
+
+	if _, err := r.Mutation().RemoveTaskDependency(ctx, taskA, taskB); err != nil {
+		t.Fatalf("removing dependency: %v", err)
+	}
+	if _, err := r.Mutation().RemoveTaskDependency(ctx, taskA, taskB); err == nil {
+		t.Error("expected an error when removing a missing dependency, but got none")
+	}
+	if _, err := r.Mutation().AddTaskDependency(ctx, taskB, taskA); err != nil {
+		t.Errorf("adding the reverse dependency after removing the original: %v", err)
+	}
+}
+
+func TestLinkedTaskAuthorization(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	otherID, otherCtx := createUserForTest(t, env)
+	ownerTask, err0 := r.Mutation().CreateTask(ownerCtx)
+	otherTask, err1 := r.Mutation().CreateTask(otherCtx)
+	noErrDuringSetup(t, err0, err1)
+
+	if _, err := r.Mutation().SetTaskParent(otherCtx, otherTask, &ownerTask); err == nil {
+		t.Error("expected an error when linking to an unreadable task, but got none")
+	}
+	if _, err := r.Mutation().AddTaskDependency(otherCtx, ownerTask, otherTask); err == nil {
+		t.Error("expected an error when adding a dependency to another user's task, but got none")
+	}
+
+	// Once the other user can read the owner's task, they can link to it, but
+	// the owner still can't see the other user's task.
+	if _, err := r.Mutation().ShareTask(ownerCtx, ownerTask, string(otherID), model.TaskRoleViewer); err != nil {
+		t.Fatalf("sharing task: %v", err)
+	}
+	if _, err := r.Mutation().AddTaskDependency(otherCtx, otherTask, ownerTask); err != nil {
+		t.Fatalf("adding dependency on shared task: %v", err)
+	}
+	blocks, err := r.Task().Blocks(ownerCtx, &model.Task{ID: ownerTask})
+	if err != nil {
+		t.Fatalf("reading blocked tasks: %v", err)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("expected unreadable blocked tasks to be omitted, but got %d", len(blocks))
+	}
+}
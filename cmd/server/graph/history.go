@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/authz"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphutil"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+func (t *taskResolver) History(ctx context.Context, obj *model.Task, first *int, after *string) (*model.TaskEventConnection, error) {
+	userID, err := t.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := &db.TaskEventQuery{Limit: defaultPageSize}
+	if first != nil {
+		if *first < 1 || *first > maxPageSize {
+			return nil, gqlerr.InvalidArgument(ctx, fmt.Sprintf("first must be between 1 and %d", maxPageSize), zap.Int("first", *first))
+		}
+		query.Limit = *first
+	}
+	if after != nil {
+		if _, err := db.DecodeTaskEventCursor(db.Cursor(*after)); err != nil {
+			return nil, gqlerr.InvalidArgument(ctx, "invalid cursor", zap.String("after", *after), zap.Error(err))
+		}
+		query.After = db.Cursor(*after)
+	}
+
+	var (
+		page   *db.TaskEventPage
+		actors map[todo.UserID]*todo.User
+	)
+	err = t.db.Transactional(ctx, func(tx db.Tx) error {
+		if _, err := t.authorizedTask(tx, userID, todo.TaskID(obj.ID), authz.Read); err != nil {
+			return err
+		}
+		p, err := t.db.TaskHistory(tx, todo.TaskID(obj.ID), query)
+		if err != nil {
+			return fmt.Errorf("reading task history: %w", err)
+		}
+		page = p
+		if !graphutil.MayContainAnyOf(ctx, "edges.node.actor") {
+			return nil
+		}
+		var ids []todo.UserID
+		for _, e := range page.Events {
+			if e.ActorID != "" {
+				ids = append(ids, e.ActorID)
+			}
+		}
+		// History outlives users, so a missing actor is left as null.
+		if actors, err = t.db.UsersByID(tx, ids); err != nil {
+			return fmt.Errorf("reading actors: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't read task history", obj.ID, err)
+	}
+	out, err := graphconv.TaskEventPageToGQL(page, actors)
+	if err != nil {
+		return nil, gqlerr.Internal(ctx, "couldn't convert task history", zap.String("task_id", obj.ID), zap.Error(err))
+	}
+	return out, nil
+}
@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestTaskHistory(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	_, err1 := r.Mutation().SetTaskName(ctx, taskID, "New Name", nil)
+	_, err2 := r.Mutation().AddTaskTag(ctx, taskID, "tag", nil)
+	noErrDuringSetup(t, err0, err1, err2)
+
+	task := &model.Task{ID: taskID}
+	first := 2
+	page, err := r.Task().History(ctx, task, &first, nil)
+	if err != nil {
+		t.Fatalf("reading history: %v", err)
+	}
+	if !page.PageInfo.HasNextPage {
+		t.Error("expected a next page of history, but there wasn't one")
+	}
+	rest, err := r.Task().History(ctx, task, nil, page.PageInfo.EndCursor)
+	if err != nil {
+		t.Fatalf("reading next page of history: %v", err)
+	}
+
+	var got []*model.TaskEvent
+	for _, e := range append(page.Edges, rest.Edges...) {
+		got = append(got, e.Node)
+	}
+	actor := &model.User{ID: string(userID), Name: "User", Version: 1}
+	tags, name := `["tag"]`, `"New Name"`
+	want := []*model.TaskEvent{
+		{
+			Kind:    model.TaskEventKindUpdated,
+			Actor:   actor,
+			Changes: []*model.TaskFieldChange{{Field: "tags", After: &tags}},
+		},
+		{
+			Kind:    model.TaskEventKindUpdated,
+			Actor:   actor,
+			Changes: []*model.TaskFieldChange{{Field: "name", After: &name}},
+		},
+		{
+			Kind:  model.TaskEventKindCreated,
+			Actor: actor,
+		},
+	}
+	opts := cmp.Options{
+		cmpopts.IgnoreFields(model.TaskEvent{}, "ID", "CreatedAt"),
+		cmpopts.EquateEmpty(),
+		userCmpOpts(),
+	}
+	if diff := cmp.Diff(want, got, opts); diff != "" {
+		t.Errorf("unexpected history (-want +got):\n %s", diff)
+	}
+}
+
+func TestTaskHistoryAuthorization(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	_, otherCtx := createUserForTest(t, env)
+	taskID, err := r.Mutation().CreateTask(ownerCtx)
+	noErrDuringSetup(t, err)
+
+	if _, err := r.Task().History(otherCtx, &model.Task{ID: taskID}, nil, nil); err == nil {
+		t.Error("expected an error when reading another user's task history, but got none")
+	}
+}
@@ -0,0 +1,229 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/authz"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+func (q *queryResolver) List(ctx context.Context, listID string) (*model.List, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := q.authorizedList(q.db.NoTxn(ctx), userID, todo.ListID(listID), authz.Read)
+	if err != nil {
+		return nil, listErr(ctx, "couldn't read list", listID, err)
+	}
+	return graphconv.ListToGQL(list), nil
+}
+
+func (q *queryResolver) Lists(ctx context.Context, includeArchived *bool) ([]*model.List, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// ListsByCreator only returns the user's own lists, so there's nothing
+	// further to authorize.
+	lists, err := q.db.ListsByCreator(q.db.NoTxn(ctx), userID)
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't read lists", err, zap.String("user_id", string(userID)))
+	}
+	if includeArchived == nil || !*includeArchived {
+		var active []*todo.List
+		for _, l := range lists {
+			if !l.IsArchived() {
+				active = append(active, l)
+			}
+		}
+		lists = active
+	}
+	return graphconv.ListsToGQL(lists), nil
+}
+
+func (m *mutationResolver) CreateList(ctx context.Context, name string) (string, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	listID, err := m.db.CreateList(m.db.NoTxn(ctx), userID, name)
+	if err != nil {
+		return "", gqlErr(ctx, "couldn't create list", err)
+	}
+	return string(listID), nil
+}
+
+func (m *mutationResolver) SetListName(ctx context.Context, listID string, name string) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.updateList(ctx, userID, todo.ListID(listID), db.SetListName(name)); err != nil {
+		return nil, listErr(ctx, "couldn't update list name", listID, err)
+	}
+	return emptySuccess()
+}
+
+func (m *mutationResolver) SetListArchived(ctx context.Context, listID string, archived bool) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.updateList(ctx, userID, todo.ListID(listID), db.SetListArchived(archived, m.now())); err != nil {
+		return nil, listErr(ctx, "couldn't update list archived state", listID, err)
+	}
+	return emptySuccess()
+}
+
+func (m *mutationResolver) DeleteList(ctx context.Context, listID string, tasks model.ListTaskDisposition, moveTasksTo *string) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	disposition, err := graphconv.ListTaskDispositionFromGQL(tasks)
+	if err != nil {
+		return nil, gqlerr.InvalidArgument(ctx, "invalid list task disposition", zap.String("tasks", string(tasks)), zap.Error(err))
+	}
+	var moveTo todo.ListID
+	if moveTasksTo != nil {
+		moveTo = todo.ListID(*moveTasksTo)
+	}
+	switch {
+	case disposition == db.DeleteListTasks && moveTo != "":
+		return nil, gqlerr.InvalidArgument(ctx, "moveTasksTo can't be given when deleting tasks", zap.String("list_id", listID))
+	case moveTo == todo.ListID(listID):
+		return nil, gqlerr.InvalidArgument(ctx, "can't move tasks to the list being deleted", zap.String("list_id", listID))
+	}
+
+	var affected []*todo.Task
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		if _, err := m.authorizedList(tx, userID, todo.ListID(listID), authz.Delete); err != nil {
+			return err
+		}
+		if moveTo != "" {
+			if _, err := m.authorizedList(tx, userID, moveTo, authz.Edit); err != nil {
+				return fmt.Errorf("checking destination list: %w", err)
+			}
+		}
+		tasks, err := m.db.TasksInList(tx, todo.ListID(listID))
+		if err != nil {
+			return fmt.Errorf("reading tasks in list: %w", err)
+		}
+		if err := m.checkTasksInList(tx, userID, tasks, disposition); err != nil {
+			return err
+		}
+		for _, t := range tasks {
+			if !t.IsTrashed() {
+				affected = append(affected, t)
+			}
+		}
+		return m.db.DeleteList(tx, todo.ListID(listID), disposition, moveTo)
+	})
+	if err != nil {
+		return nil, listErr(ctx, "couldn't delete list", listID, err)
+	}
+	kind := pubsub.TaskUpdated
+	if disposition == db.DeleteListTasks {
+		kind = pubsub.TaskDeleted
+	}
+	for _, t := range affected {
+		m.publishTaskEvent(ctx, kind, t.ID, t.CreatedBy)
+	}
+	return emptySuccess()
+}
+
+// checkTasksInList returns nil if the user may delete or move, per disposition,
+// every task in one of their lists. Owning the list isn't enough, as a task's
+// collaborators can move it into their own lists, and may since have lost
+// access to it. Trashed tasks are only moved out of the list.
+func (r *Resolver) checkTasksInList(tx db.Tx, userID todo.UserID, tasks []*todo.Task, disposition db.ListTaskDisposition) error {
+	ids := make([]todo.TaskID, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	collaborators, err := r.db.CollaboratorsByTaskID(tx, ids)
+	if err != nil {
+		return fmt.Errorf("reading task collaborators: %w", err)
+	}
+	for _, t := range tasks {
+		action := authz.Move
+		if disposition == db.DeleteListTasks && !t.IsTrashed() {
+			action = authz.Delete
+		}
+		if err := authz.CheckTask(userID, t, collaborators[t.ID], action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errMoveToArchivedList = errors.New("tasks can't be moved into an archived list")
+
+func (m *mutationResolver) MoveTask(ctx context.Context, taskID string, listID *string, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dest todo.ListID
+	if listID != nil {
+		dest = todo.ListID(*listID)
+	}
+	var ownerID todo.UserID
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		task, err := m.authorizedTask(tx, userID, todo.TaskID(taskID), authz.Move)
+		if err != nil {
+			return err
+		}
+		ownerID = task.CreatedBy
+		if dest != "" {
+			list, err := m.authorizedList(tx, userID, dest, authz.Edit)
+			if err != nil {
+				return fmt.Errorf("checking destination list: %w", err)
+			}
+			if list.IsArchived() {
+				return errMoveToArchivedList
+			}
+		}
+		return m.db.UpdateTask(tx, todo.TaskID(taskID), withExpectedTaskVersion(expectedVersion, []db.UpdateTaskFn{db.SetTaskList(dest)})...)
+	})
+	if errors.Is(err, errMoveToArchivedList) {
+		return nil, gqlerr.InvalidArgument(ctx, "can't move a task into an archived list", zap.String("task_id", taskID), zap.String("list_id", string(dest)))
+	} else if err != nil {
+		return nil, m.taskUpdateErr(ctx, "couldn't move task", taskID, err)
+	}
+	m.publishTaskEvent(ctx, pubsub.TaskUpdated, todo.TaskID(taskID), ownerID)
+	return emptySuccess()
+}
+
+// updateList applies the given mutations to the list in a single transaction,
+// after checking that the logged-in user is allowed to edit it.
+func (m *mutationResolver) updateList(ctx context.Context, userID todo.UserID, listID todo.ListID, fns ...db.UpdateListFn) error {
+	return m.db.Transactional(ctx, func(tx db.Tx) error {
+		if _, err := m.authorizedList(tx, userID, listID, authz.Edit); err != nil {
+			return err
+		}
+		return m.db.UpdateList(tx, listID, fns...)
+	})
+}
+
+// authorizedList loads the given list, returning it only if the user is
+// allowed to perform the given action on it.
+func (r *Resolver) authorizedList(tx db.Tx, userID todo.UserID, listID todo.ListID, action authz.Action) (*todo.List, error) {
+	list, err := r.db.List(tx, listID)
+	if err != nil {
+		return nil, fmt.Errorf("reading list: %w", err)
+	}
+	if err := authz.CheckList(userID, list, action); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
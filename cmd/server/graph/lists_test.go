@@ -0,0 +1,247 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCreateAndUpdateList(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+
+	listID, err := r.Mutation().CreateList(ctx, "Groceries")
+	if err != nil {
+		t.Fatalf("creating list: %v", err)
+	}
+	if _, err := r.Mutation().SetListName(ctx, listID, "Errands"); err != nil {
+		t.Fatalf("renaming list: %v", err)
+	}
+	if _, err := r.Mutation().CreateList(ctx, "Bell\x07"); err == nil {
+		t.Error("expected an error creating a list with a control character in its name, but got none")
+	}
+	if _, err := r.Mutation().SetListName(ctx, listID, strings.Repeat("a", 201)); err == nil {
+		t.Error("expected an error renaming a list to a name that's too long, but got none")
+	}
+
+	actual, err := r.Query().List(ctx, listID)
+	if err != nil {
+		t.Fatalf("reading list: %v", err)
+	}
+	expected := &model.List{
+		ID:   listID,
+		Name: "Errands",
+	}
+	if diff := cmp.Diff(expected, actual, listCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+}
+
+func TestSetListArchived(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	activeID, err0 := r.Mutation().CreateList(ctx, "Active")
+	archivedID, err1 := r.Mutation().CreateList(ctx, "Archived")
+	noErrDuringSetup(t, err0, err1)
+
+	archivedAt := time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return archivedAt }
+	if _, err := r.Mutation().SetListArchived(ctx, archivedID, true); err != nil {
+		t.Fatalf("archiving list: %v", err)
+	}
+
+	actual, err := r.Query().Lists(ctx, nil)
+	if err != nil {
+		t.Fatalf("listing lists: %v", err)
+	}
+	expected := []*model.List{{ID: activeID, Name: "Active"}}
+	if diff := cmp.Diff(expected, actual, listCmpOpts()); diff != "" {
+		t.Errorf("unexpected active lists (-want +got):\n %s", diff)
+	}
+
+	includeArchived := true
+	actual, err = r.Query().Lists(ctx, &includeArchived)
+	if err != nil {
+		t.Fatalf("listing lists: %v", err)
+	}
+	expected = []*model.List{
+		{ID: activeID, Name: "Active"},
+		{ID: archivedID, Name: "Archived", Archived: true, ArchivedAt: &archivedAt},
+	}
+	if diff := cmp.Diff(expected, actual, listCmpOpts()); diff != "" {
+		t.Errorf("unexpected lists (-want +got):\n %s", diff)
+	}
+
+	if _, err := r.Mutation().SetListArchived(ctx, archivedID, false); err != nil {
+		t.Fatalf("unarchiving list: %v", err)
+	}
+	list, err := r.Query().List(ctx, archivedID)
+	if err != nil {
+		t.Fatalf("reading list: %v", err)
+	}
+	if list.Archived || list.ArchivedAt != nil {
+		t.Errorf("list was still archived after unarchiving: %+v", list)
+	}
+}
+
+func TestMoveTask(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	_, otherCtx := createUserForTest(t, env)
+	listID, err0 := r.Mutation().CreateList(ctx, "List")
+	archivedID, err1 := r.Mutation().CreateList(ctx, "Archived")
+	_, err2 := r.Mutation().SetListArchived(ctx, archivedID, true)
+	otherListID, err3 := r.Mutation().CreateList(otherCtx, "Other")
+	taskID, err4 := r.Mutation().CreateTask(ctx)
+	_, err5 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5)
+
+	if _, err := r.Mutation().MoveTask(ctx, taskID, &otherListID, nil); err == nil {
+		t.Error("expected an error when moving a task into another user's list, but got none")
+	}
+	if _, err := r.Mutation().MoveTask(ctx, taskID, &archivedID, nil); err == nil {
+		t.Error("expected an error when moving a task into an archived list, but got none")
+	}
+	if _, err := r.Mutation().MoveTask(otherCtx, taskID, &otherListID, nil); err == nil {
+		t.Error("expected an error when moving another user's task, but got none")
+	}
+	if _, err := r.Mutation().MoveTask(ctx, taskID, &listID, nil); err != nil {
+		t.Fatalf("moving task: %v", err)
+	}
+
+	conn, err := r.Query().Tasks(ctx, nil, nil, &model.TaskFilter{ListID: &listID}, nil)
+	if err != nil {
+		t.Fatalf("listing tasks: %v", err)
+	}
+	expected := []*model.Task{{ID: taskID, ListID: &listID}}
+	if diff := cmp.Diff(expected, taskNodes(conn), taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected tasks in list (-want +got):\n %s", diff)
+	}
+
+	if _, err := r.Mutation().MoveTask(ctx, taskID, nil, nil); err != nil {
+		t.Fatalf("moving task out of list: %v", err)
+	}
+	task, err := r.Query().Task(ctx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	if task.ListID != nil {
+		t.Errorf("task was still in list %q after moving it out", *task.ListID)
+	}
+}
+
+func TestDeleteList(t *testing.T) {
+	t.Run("deleting tasks", func(t *testing.T) {
+		r, env := setup(t)
+		_, ctx := createUserForTest(t, env)
+		listID, err0 := r.Mutation().CreateList(ctx, "List")
+		taskID, err1 := r.Mutation().CreateTask(ctx)
+		_, err2 := r.Mutation().MoveTask(ctx, taskID, &listID, nil)
+		noErrDuringSetup(t, err0, err1, err2)
+
+		if _, err := r.Mutation().DeleteList(ctx, listID, model.ListTaskDispositionDeleteTasks, nil); err != nil {
+			t.Fatalf("deleting list: %v", err)
+		}
+		if _, err := r.Query().List(ctx, listID); err == nil {
+			t.Error("expected an error reading a deleted list, but got none")
+		}
+		if _, err := r.Query().Task(ctx, taskID); err == nil {
+			t.Error("expected an error reading a task deleted with its list, but got none")
+		}
+	})
+
+	t.Run("moving tasks", func(t *testing.T) {
+		r, env := setup(t)
+		_, ctx := createUserForTest(t, env)
+		listID, err0 := r.Mutation().CreateList(ctx, "List")
+		destID, err1 := r.Mutation().CreateList(ctx, "Destination")
+		taskID, err2 := r.Mutation().CreateTask(ctx)
+		_, err3 := r.Mutation().MoveTask(ctx, taskID, &listID, nil)
+		noErrDuringSetup(t, err0, err1, err2, err3)
+
+		if _, err := r.Mutation().DeleteList(ctx, listID, model.ListTaskDispositionDeleteTasks, &destID); err == nil {
+			t.Error("expected an error giving a destination when deleting tasks, but got none")
+		}
+		if _, err := r.Mutation().DeleteList(ctx, listID, model.ListTaskDispositionMoveTasks, &listID); err == nil {
+			t.Error("expected an error moving tasks to the list being deleted, but got none")
+		}
+		if _, err := r.Mutation().DeleteList(ctx, listID, model.ListTaskDispositionMoveTasks, &destID); err != nil {
+			t.Fatalf("deleting list: %v", err)
+		}
+
+		actual, err := r.Query().Task(ctx, taskID)
+		if err != nil {
+			t.Fatalf("reading task: %v", err)
+		}
+		expected := &model.Task{ID: taskID, ListID: &destID}
+		if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+			t.Errorf("unexpected diff (-want +got):\n %s", diff)
+		}
+	})
+
+	t.Run("another user's task", func(t *testing.T) {
+		r, env := setup(t)
+		_, ownerCtx := createUserForTest(t, env)
+		collaboratorID, collaboratorCtx := createUserForTest(t, env)
+		listID, err0 := r.Mutation().CreateList(collaboratorCtx, "List")
+		taskID, err1 := r.Mutation().CreateTask(ownerCtx)
+		_, err2 := r.Mutation().ShareTask(ownerCtx, taskID, string(collaboratorID), model.TaskRoleOwner)
+		_, err3 := r.Mutation().MoveTask(collaboratorCtx, taskID, &listID, nil)
+		_, err4 := r.Mutation().UnshareTask(ownerCtx, taskID, string(collaboratorID))
+		noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+		if _, err := r.Mutation().DeleteList(collaboratorCtx, listID, model.ListTaskDispositionDeleteTasks, nil); err == nil {
+			t.Error("expected an error deleting a list with a task the user can't delete, but got none")
+		}
+		if _, err := r.Mutation().DeleteList(collaboratorCtx, listID, model.ListTaskDispositionMoveTasks, nil); err == nil {
+			t.Error("expected an error deleting a list with a task the user can't move, but got none")
+		}
+		actual, err := r.Query().Task(ownerCtx, taskID)
+		if err != nil {
+			t.Fatalf("reading task: %v", err)
+		}
+		expected := &model.Task{ID: taskID, ListID: &listID}
+		if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+			t.Errorf("unexpected diff (-want +got):\n %s", diff)
+		}
+	})
+}
+
+func TestListAuthorization(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	_, otherCtx := createUserForTest(t, env)
+	listID, err := r.Mutation().CreateList(ownerCtx, "Owner's List")
+	noErrDuringSetup(t, err)
+
+	if _, err := r.Query().List(otherCtx, listID); err == nil {
+		t.Error("expected an error when reading another user's list, but got none")
+	}
+	if _, err := r.Mutation().SetListName(otherCtx, listID, "Stolen"); err == nil {
+		t.Error("expected an error when renaming another user's list, but got none")
+	}
+	if _, err := r.Mutation().SetListArchived(otherCtx, listID, true); err == nil {
+		t.Error("expected an error when archiving another user's list, but got none")
+	}
+	if _, err := r.Mutation().DeleteList(otherCtx, listID, model.ListTaskDispositionDeleteTasks, nil); err == nil {
+		t.Error("expected an error when deleting another user's list, but got none")
+	}
+	lists, err := r.Query().Lists(otherCtx, nil)
+	if err != nil {
+		t.Fatalf("listing lists: %v", err)
+	}
+	if len(lists) != 0 {
+		t.Errorf("expected no lists for other user, but got %d", len(lists))
+	}
+}
+
+func listCmpOpts() cmp.Option {
+	return cmp.Options{
+		cmpopts.EquateEmpty(),
+		cmpopts.IgnoreFields(model.List{}, "CreatedAt"),
+	}
+}
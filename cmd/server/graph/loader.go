@@ -0,0 +1,195 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	// loaderWait is how long a loader waits for more lookups after the first
+	// one in a batch, before it fetches the batch. gqlgen resolves the fields of
+	// the items in a list concurrently, so their lookups arrive well within it.
+	loaderWait = 2 * time.Millisecond
+	// loaderMaxBatch is the most lookups in a batch, a full batch is fetched
+	// without waiting.
+	loaderMaxBatch = 500
+)
+
+// loader batches the lookups of single entities made while resolving a
+// GraphQL operation into one call to fetch, so that resolving a field of each
+// item in a list doesn't make a query per item. Results are cached for the rest
+// of the operation, so an entity is only fetched once however often it's
+// looked up.
+type loader[K comparable, V any] struct {
+	// fetch returns the values for the given keys, leaving out keys that don't
+	// have a value.
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu sync.Mutex
+	// batches maps each key that has been looked up to the batch that fetches
+	// it.
+	batches map[K]*loaderBatch[K, V]
+	// pending is the batch that new keys are added to, or nil if there isn't
+	// one waiting to be fetched.
+	pending *loaderBatch[K, V]
+}
+
+type loaderBatch[K comparable, V any] struct {
+	keys    []K
+	started bool
+	// done is closed once values and err are set.
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+func newLoader[K comparable, V any](fetch func(context.Context, []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		batches: make(map[K]*loaderBatch[K, V]),
+	}
+}
+
+// load returns the value for the key, and whether it has one.
+func (l *loader[K, V]) load(ctx context.Context, key K) (V, bool, error) {
+	l.mu.Lock()
+	b := l.batchFor(ctx, key)
+	l.mu.Unlock()
+
+	var zero V
+	if err := b.wait(ctx); err != nil {
+		return zero, false, err
+	}
+	v, ok := b.values[key]
+	return v, ok, nil
+}
+
+// loadAll returns the values for the keys, leaving out keys that don't have a
+// value. The keys are batched with other lookups like they would be by load.
+func (l *loader[K, V]) loadAll(ctx context.Context, keys []K) (map[K]V, error) {
+	l.mu.Lock()
+	batches := make([]*loaderBatch[K, V], len(keys))
+	for i, k := range keys {
+		batches[i] = l.batchFor(ctx, k)
+	}
+	l.mu.Unlock()
+
+	out := make(map[K]V)
+	for i, b := range batches {
+		if err := b.wait(ctx); err != nil {
+			return nil, err
+		}
+		if v, ok := b.values[keys[i]]; ok {
+			out[keys[i]] = v
+		}
+	}
+	return out, nil
+}
+
+// batchFor returns the batch that fetches the key, adding it to the pending
+// batch if it hasn't been looked up before. l.mu must be held.
+func (l *loader[K, V]) batchFor(ctx context.Context, key K) *loaderBatch[K, V] {
+	if b, ok := l.batches[key]; ok {
+		return b
+	}
+	if l.pending == nil {
+		l.pending = &loaderBatch[K, V]{done: make(chan struct{})}
+		go l.fetchAfterWait(ctx, l.pending)
+	}
+	b := l.pending
+	b.keys = append(b.keys, key)
+	l.batches[key] = b
+	if len(b.keys) >= loaderMaxBatch {
+		l.pending = nil
+		b.started = true
+		go l.fetchBatch(ctx, b)
+	}
+	return b
+}
+
+func (b *loaderBatch[K, V]) wait(ctx context.Context) error {
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *loader[K, V]) fetchAfterWait(ctx context.Context, b *loaderBatch[K, V]) {
+	time.Sleep(loaderWait)
+	l.mu.Lock()
+	if l.pending == b {
+		l.pending = nil
+	}
+	// The batch may already have been fetched because it filled up.
+	started := b.started
+	b.started = true
+	l.mu.Unlock()
+	if !started {
+		l.fetchBatch(ctx, b)
+	}
+}
+
+func (l *loader[K, V]) fetchBatch(ctx context.Context, b *loaderBatch[K, V]) {
+	b.values, b.err = l.fetch(ctx, b.keys)
+	close(b.done)
+}
+
+// loaders are the loaders for one GraphQL operation. They read outside of any
+// transaction, so resolvers that need a consistent view of several entities
+// should read them in a transaction instead.
+type loaders struct {
+	users *loader[todo.UserID, *todo.User]
+	tasks *loader[todo.TaskID, *todo.Task]
+	// collaborators has no value for tasks that aren't shared.
+	collaborators *loader[todo.TaskID, []*todo.TaskCollaborator]
+	// taskCounts has no value for users without any tasks.
+	taskCounts *loader[todo.UserID, int]
+}
+
+func (r *Resolver) newLoaders() *loaders {
+	return &loaders{
+		users: newLoader(func(ctx context.Context, ids []todo.UserID) (map[todo.UserID]*todo.User, error) {
+			return r.db.UsersByID(r.db.NoTxn(ctx), ids)
+		}),
+		tasks: newLoader(func(ctx context.Context, ids []todo.TaskID) (map[todo.TaskID]*todo.Task, error) {
+			return r.db.TasksByID(r.db.NoTxn(ctx), ids)
+		}),
+		collaborators: newLoader(func(ctx context.Context, ids []todo.TaskID) (map[todo.TaskID][]*todo.TaskCollaborator, error) {
+			return r.db.CollaboratorsByTaskID(r.db.NoTxn(ctx), ids)
+		}),
+		taskCounts: newLoader(func(ctx context.Context, ids []todo.UserID) (map[todo.UserID]int, error) {
+			return r.db.TaskCountsByCreator(r.db.NoTxn(ctx), ids)
+		}),
+	}
+}
+
+type loadersKey struct{}
+
+// LoadersMiddleware gives each GraphQL operation its own loaders, it should be
+// installed with the server's AroundOperations. Subscriptions don't get
+// loaders, as they live long enough for cached entities to go stale.
+func (r *Resolver) LoadersMiddleware(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	if graphql.HasOperationContext(ctx) {
+		if op := graphql.GetOperationContext(ctx).Operation; op != nil && op.Operation == ast.Subscription {
+			return next(ctx)
+		}
+	}
+	return next(context.WithValue(ctx, loadersKey{}, r.newLoaders()))
+}
+
+// loaders returns the loaders for the operation being resolved. Without any,
+// e.g. when resolving a subscription, the returned loaders still batch lookups
+// made through them, but they're not shared with other resolvers.
+func (r *Resolver) loaders(ctx context.Context) *loaders {
+	if l, ok := ctx.Value(loadersKey{}).(*loaders); ok {
+		return l
+	}
+	return r.newLoaders()
+}
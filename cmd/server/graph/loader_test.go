@@ -0,0 +1,173 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestLoaderBatchesLookups(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]int
+	)
+	l := newLoader(func(_ context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, keys)
+		out := make(map[int]string)
+		for _, k := range keys {
+			if k%2 == 0 {
+				out[k] = "even"
+			}
+		}
+		return out, nil
+	})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			v, ok, err := l.load(ctx, key%5)
+			if err != nil {
+				t.Errorf("loading %d: %v", key%5, err)
+			}
+			if wantOK := key%5%2 == 0; ok != wantOK || (ok && v != "even") {
+				t.Errorf("load(%d) = %q, %t, want a value only for even keys", key%5, v, ok)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// Cached keys aren't fetched again.
+	if _, _, err := l.load(ctx, 3); err != nil {
+		t.Fatalf("loading cached key: %v", err)
+	}
+
+	if len(batches) != 1 {
+		t.Fatalf("lookups were fetched in %d batches, want 1", len(batches))
+	}
+	if diff := cmp.Diff([]int{0, 1, 2, 3, 4}, batches[0], cmpopts.SortSlices(func(a, b int) bool { return a < b })); diff != "" {
+		t.Errorf("unexpected keys in batch, each should be fetched once (-want +got)\n%s", diff)
+	}
+}
+
+// countingDB counts the lookups of users, tasks and task collaborators.
+type countingDB struct {
+	DB
+	userLookups, taskLookups, collaboratorLookups atomic.Int32
+}
+
+func (c *countingDB) User(tx db.Tx, id todo.UserID) (*todo.User, error) {
+	c.userLookups.Add(1)
+	return c.DB.User(tx, id)
+}
+
+func (c *countingDB) UsersByID(tx db.Tx, ids []todo.UserID) (map[todo.UserID]*todo.User, error) {
+	c.userLookups.Add(1)
+	return c.DB.UsersByID(tx, ids)
+}
+
+func (c *countingDB) Task(tx db.Tx, id todo.TaskID) (*todo.Task, error) {
+	c.taskLookups.Add(1)
+	return c.DB.Task(tx, id)
+}
+
+func (c *countingDB) TasksByID(tx db.Tx, ids []todo.TaskID) (map[todo.TaskID]*todo.Task, error) {
+	c.taskLookups.Add(1)
+	return c.DB.TasksByID(tx, ids)
+}
+
+func (c *countingDB) TaskCollaborators(tx db.Tx, id todo.TaskID) ([]*todo.TaskCollaborator, error) {
+	c.collaboratorLookups.Add(1)
+	return c.DB.TaskCollaborators(tx, id)
+}
+
+func (c *countingDB) CollaboratorsByTaskID(tx db.Tx, ids []todo.TaskID) (map[todo.TaskID][]*todo.TaskCollaborator, error) {
+	c.collaboratorLookups.Add(1)
+	return c.DB.CollaboratorsByTaskID(tx, ids)
+}
+
+func TestLinkedEntitiesAreBatched(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	parentID, err0 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0)
+	var childIDs []string
+	for i := 0; i < 5; i++ {
+		id, err0 := r.Mutation().CreateTask(ctx)
+		_, err1 := r.Mutation().SetTaskParent(ctx, id, &parentID)
+		noErrDuringSetup(t, err0, err1)
+		childIDs = append(childIDs, id)
+	}
+	conn, err := r.Query().Tasks(ctx, nil, nil, nil, nil)
+	noErrDuringSetup(t, err)
+
+	counter := &countingDB{DB: r.db}
+	r.db = counter
+	r.LoadersMiddleware(ctx, func(ctx context.Context) graphql.ResponseHandler {
+		// gqlgen resolves the fields of each task in a list concurrently.
+		var wg sync.WaitGroup
+		for _, task := range taskNodes(conn) {
+			wg.Add(1)
+			go func(task *model.Task) {
+				defer wg.Done()
+				creator, err := r.Task().CreatedBy(ctx, task)
+				if err != nil {
+					t.Errorf("reading creator of %q: %v", task.ID, err)
+				} else if creator.ID != string(userID) {
+					t.Errorf("creator of %q was %q, want %q", task.ID, creator.ID, userID)
+				}
+				if task.ParentID == nil {
+					return
+				}
+				parent, err := r.Task().Parent(ctx, task)
+				if err != nil {
+					t.Errorf("reading parent of %q: %v", task.ID, err)
+				} else if parent == nil || parent.ID != parentID {
+					t.Errorf("parent of %q was %+v, want %q", task.ID, parent, parentID)
+				}
+			}(task)
+		}
+		wg.Wait()
+		if n := counter.collaboratorLookups.Load(); n != 1 {
+			t.Errorf("collaborators of parent tasks were looked up %d times for %d tasks, want 1", n, len(childIDs))
+		}
+
+		// Every task's subtasks are resolved at once too, and the parent's
+		// subtasks haven't had their collaborators looked up yet.
+		for _, task := range taskNodes(conn) {
+			wg.Add(1)
+			go func(task *model.Task) {
+				defer wg.Done()
+				subtasks, err := r.Task().Subtasks(ctx, task)
+				if err != nil {
+					t.Errorf("reading subtasks of %q: %v", task.ID, err)
+				} else if task.ID == parentID && len(subtasks) != len(childIDs) {
+					t.Errorf("parent had %d subtasks, want %d", len(subtasks), len(childIDs))
+				}
+			}(task)
+		}
+		wg.Wait()
+		if n := counter.collaboratorLookups.Load(); n != 2 {
+			t.Errorf("collaborators were looked up %d times for two levels of linked tasks, want 2", n)
+		}
+		return nil
+	})
+
+	if n := counter.userLookups.Load(); n != 1 {
+		t.Errorf("users were looked up %d times for %d tasks, want 1", n, len(childIDs)+1)
+	}
+	if n := counter.taskLookups.Load(); n != 1 {
+		t.Errorf("parent tasks were looked up %d times for %d tasks, want 1", n, len(childIDs))
+	}
+}
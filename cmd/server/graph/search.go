@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+// maxSearchQueryLength is the longest search query in characters, which is far
+// longer than anyone would type.
+const maxSearchQueryLength = 500
+
+func (q *queryResolver) SearchTasks(ctx context.Context, query string, first *int, after *string, tag *string) (*model.TaskSearchConnection, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	search, err := taskSearchFromArgs(ctx, query, first, after, tag)
+	if err != nil {
+		return nil, err
+	}
+	// Like TasksForUser, SearchTasks only returns tasks that the user can read.
+	page, err := q.db.SearchTasks(q.db.NoTxn(ctx), userID, search)
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't search tasks", err, zap.String("user_id", string(userID)))
+	}
+	return graphconv.TaskSearchPageToGQL(page)
+}
+
+// taskSearchFromArgs validates the arguments of a task search.
+func taskSearchFromArgs(ctx context.Context, query string, first *int, after *string, tag *string) (*db.TaskSearchQuery, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, gqlerr.InvalidArgument(ctx, "search query must not be empty")
+	}
+	if n := utf8.RuneCountInString(query); n > maxSearchQueryLength {
+		return nil, gqlerr.InvalidArgument(ctx, fmt.Sprintf("search query must be at most %d characters", maxSearchQueryLength), zap.Int("length", n))
+	}
+	search := &db.TaskSearchQuery{
+		Text:  query,
+		Limit: defaultPageSize,
+	}
+	if tag != nil {
+		// Tags are stored normalized, so the tag being filtered on has to be too.
+		search.Tag = todo.TagRule.Normalize(*tag)
+	}
+	if first != nil {
+		if *first < 1 || *first > maxPageSize {
+			return nil, gqlerr.InvalidArgument(ctx, fmt.Sprintf("first must be between 1 and %d", maxPageSize), zap.Int("first", *first))
+		}
+		search.Limit = *first
+	}
+	if after != nil {
+		if _, err := db.DecodeTaskSearchCursor(db.Cursor(*after)); err != nil {
+			return nil, gqlerr.InvalidArgument(ctx, "invalid cursor", zap.String("after", *after), zap.Error(err))
+		}
+		search.After = db.Cursor(*after)
+	}
+	return search, nil
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSearchTasks(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	otherID, otherCtx := createUserForTest(t, env)
+	newTask := func(name, body string, tags ...string) string {
+		t.Helper()
+		id, err := r.Mutation().CreateTask(ownerCtx)
+		noErrDuringSetup(t, err)
+		_, err = r.Mutation().UpdateTask(ownerCtx, id, model.TaskPatch{Name: &name, Body: &body, AddTags: tags})
+		noErrDuringSetup(t, err)
+		return id
+	}
+	dog := newTask("Walk the dog", "")
+	chores := newTask("Chores", "Remember to walk the dog before dinner", "outdoors")
+	_ = newTask("Buy milk", "")
+	_, err := r.Mutation().ShareTask(ownerCtx, chores, string(otherID), model.TaskRoleViewer)
+	noErrDuringSetup(t, err)
+
+	conn, err := r.Query().SearchTasks(ownerCtx, "walking", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("searching tasks: %v", err)
+	}
+	var got []string
+	for _, e := range conn.Edges {
+		got = append(got, e.Node.Task.ID)
+	}
+	if diff := cmp.Diff([]string{dog, chores}, got); diff != "" {
+		t.Errorf("unexpected results, name matches should come first (-want +got)\n%s", diff)
+	}
+	wantName := []*model.TextSpan{{Text: "Walk", Match: true}, {Text: " the dog"}}
+	if diff := cmp.Diff(wantName, conn.Edges[0].Node.Name); diff != "" {
+		t.Errorf("unexpected name highlights (-want +got)\n%s", diff)
+	}
+
+	// The tag is normalized like stored tags are.
+	tag := " Outdoors "
+	conn, err = r.Query().SearchTasks(ownerCtx, "dog", nil, nil, &tag)
+	if err != nil {
+		t.Fatalf("searching tasks by tag: %v", err)
+	}
+	if len(conn.Edges) != 1 || conn.Edges[0].Node.Task.ID != chores {
+		t.Errorf("unexpected results for tag %q: %+v, want only %q", tag, conn.Edges, chores)
+	}
+
+	// Other users only find the tasks that have been shared with them.
+	conn, err = r.Query().SearchTasks(otherCtx, "walk", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("searching tasks as another user: %v", err)
+	}
+	if len(conn.Edges) != 1 || conn.Edges[0].Node.Task.ID != chores {
+		t.Errorf("unexpected results for another user: %+v, want only %q", conn.Edges, chores)
+	}
+
+	first := 1
+	conn, err = r.Query().SearchTasks(ownerCtx, "walk", &first, nil, nil)
+	if err != nil {
+		t.Fatalf("searching for the first page: %v", err)
+	}
+	if len(conn.Edges) != 1 || !conn.PageInfo.HasNextPage || conn.Edges[0].Node.Task.ID != dog {
+		t.Fatalf("unexpected first page %+v, want only %q and a next page", conn.Edges, dog)
+	}
+	conn, err = r.Query().SearchTasks(ownerCtx, "walk", &first, conn.PageInfo.EndCursor, nil)
+	if err != nil {
+		t.Fatalf("searching for the second page: %v", err)
+	}
+	if len(conn.Edges) != 1 || conn.PageInfo.HasNextPage || conn.Edges[0].Node.Task.ID != chores {
+		t.Errorf("unexpected second page %+v, want only %q and no next page", conn.Edges, chores)
+	}
+}
+
+func TestSearchTasksInvalidArgs(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	zero, badCursor := 0, "not a cursor"
+
+	tests := []struct {
+		desc  string
+		query string
+		first *int
+		after *string
+	}{
+		{"empty query", " ", nil, nil},
+		{"zero page size", "walk", &zero, nil},
+		{"bad cursor", "walk", nil, &badCursor},
+	}
+	for _, test := range tests {
+		if _, err := r.Query().SearchTasks(ctx, test.query, test.first, test.after, nil); err == nil {
+			t.Errorf("%s: expected an error, but got none", test.desc)
+		}
+	}
+}
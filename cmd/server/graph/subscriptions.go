@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/authz"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+func (s *subscriptionResolver) TaskChanged(ctx context.Context, userID string) (<-chan *model.TaskChange, error) {
+	loggedInID, err := s.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.CheckTasksByCreator(loggedInID, todo.UserID(userID)); err != nil {
+		return nil, gqlerr.PermissionDenied(ctx, "can't subscribe to tasks of another user", zap.String("user_id", userID), zap.Error(err))
+	}
+	events, err := s.pubsub.SubscribeToTaskEvents(ctx, todo.UserID(userID))
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't subscribe to task changes", err, zap.String("user_id", userID))
+	}
+
+	out := make(chan *model.TaskChange)
+	go func() {
+		// The events channel is closed when ctx is done, which is when the
+		// client unsubscribes or disconnects.
+		defer close(out)
+		for e := range events {
+			change, ok := s.taskChange(ctx, loggedInID, e)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// taskChange converts an event into what we send to subscribers, loading the
+// latest state of the task. It returns false if the event should be skipped,
+// e.g. because the task has since been deleted.
+func (s *subscriptionResolver) taskChange(ctx context.Context, userID todo.UserID, e *pubsub.TaskEvent) (*model.TaskChange, bool) {
+	change := &model.TaskChange{
+		TaskID: string(e.TaskID),
+	}
+	switch e.Kind {
+	case pubsub.TaskCreated:
+		change.Kind = model.TaskChangeKindCreated
+	case pubsub.TaskUpdated:
+		change.Kind = model.TaskChangeKindUpdated
+	case pubsub.TaskDeleted:
+		change.Kind = model.TaskChangeKindDeleted
+		return change, true
+	default:
+		s.logger.Error("unknown task event kind", zap.String("kind", string(e.Kind)))
+		return nil, false
+	}
+
+	task, err := s.authorizedTask(s.db.NoTxn(ctx), userID, e.TaskID, authz.Read)
+	if db.IsNotFound(err) || authz.IsPermissionDenied(err) {
+		return nil, false
+	} else if err != nil {
+		s.logger.Error("failed to load changed task", zap.String("task_id", string(e.TaskID)), zap.Error(err))
+		return nil, false
+	}
+	if change.Task, err = graphconv.TaskToGQL(task); err != nil {
+		s.logger.Error("failed to convert changed task", zap.String("task_id", string(e.TaskID)), zap.Error(err))
+		return nil, false
+	}
+	return change, true
+}
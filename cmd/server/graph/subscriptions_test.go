@@ -0,0 +1,97 @@
+package graph
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTaskChanged(t *testing.T) {
+	r, env := setup(t)
+	userID, userCtx := createUserForTest(t, env)
+	ctx, cancel := context.WithCancel(userCtx)
+	defer cancel()
+
+	changes, err := r.Subscription().TaskChanged(ctx, string(userID))
+	if err != nil {
+		t.Fatalf("subscribing to task changes: %v", err)
+	}
+
+	// We wait for each change before making the next one, so that the task is
+	// loaded in the state it was in right after the mutation.
+	taskID, err := r.Mutation().CreateTask(userCtx)
+	if err != nil {
+		t.Fatalf("creating task: %v", err)
+	}
+	created := receiveChange(t, changes)
+
+	name := "New Name"
+	if _, err := r.Mutation().SetTaskName(userCtx, taskID, name, nil); err != nil {
+		t.Fatalf("setting task name: %v", err)
+	}
+	updated := receiveChange(t, changes)
+
+	if _, err := r.Mutation().DeleteTask(userCtx, taskID); err != nil {
+		t.Fatalf("deleting task: %v", err)
+	}
+	deleted := receiveChange(t, changes)
+
+	expected := []*model.TaskChange{{
+		Kind:   model.TaskChangeKindCreated,
+		TaskID: taskID,
+		Task: &model.Task{
+			ID: taskID,
+		},
+	}, {
+		Kind:   model.TaskChangeKindUpdated,
+		TaskID: taskID,
+		Task: &model.Task{
+			ID:   taskID,
+			Name: name,
+		},
+	}, {
+		Kind:   model.TaskChangeKindDeleted,
+		TaskID: taskID,
+	}}
+	actual := []*model.TaskChange{created, updated, deleted}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Error("expected no more changes after unsubscribing")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the subscription to close")
+	}
+}
+
+func TestTaskChangedOtherUser(t *testing.T) {
+	r, env := setup(t)
+	userIDA, _ := createUserForTest(t, env)
+	_, ctxB := createUserForTest(t, env)
+
+	if _, err := r.Subscription().TaskChanged(ctxB, string(userIDA)); err == nil {
+		t.Fatal("expected an error when subscribing to another user's tasks, but got none")
+	}
+}
+
+func receiveChange(t *testing.T, ch <-chan *model.TaskChange) *model.TaskChange {
+	t.Helper()
+	select {
+	case c, ok := <-ch:
+		if !ok {
+			t.Fatal("subscription was closed before receiving a change")
+		}
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a task change")
+		return nil
+	}
+}
@@ -2,29 +2,168 @@ package graph
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/authz"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphutil"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
 	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
 	"github.com/Silicon-Ally/silicon-starter/todo"
 	"go.uber.org/zap"
 )
 
 func (q *queryResolver) Task(ctx context.Context, taskID string) (*model.Task, error) {
-	task, err := q.db.Task(q.db.NoTxn(ctx), todo.TaskID(taskID))
+	userID, err := q.userIDFromContext(ctx)
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't read task", zap.String("task_id", taskID), zap.Error(err))
+		return nil, err
+	}
+	task, err := q.authorizedTask(q.db.NoTxn(ctx), userID, todo.TaskID(taskID), authz.Read)
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't read task", taskID, err)
 	}
 	return graphconv.TaskToGQL(task)
 }
 
-func (q *queryResolver) TasksByCreator(ctx context.Context, userID string) ([]*model.Task, error) {
-	tasks, err := q.db.TasksByCreator(q.db.NoTxn(ctx), todo.UserID(userID))
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+func (q *queryResolver) TasksByCreator(ctx context.Context, creatorID string, first *int, after *string, filter *model.TaskFilter, sort *model.TaskSort) (*model.TaskConnection, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.CheckTasksByCreator(userID, todo.UserID(creatorID)); err != nil {
+		return nil, gqlerr.PermissionDenied(ctx, "can't read tasks by another creator", zap.String("creator_id", creatorID), zap.Error(err))
+	}
+	query, err := taskQueryFromArgs(ctx, first, after, filter, sort)
+	if err != nil {
+		return nil, err
+	}
+	page, err := q.db.TasksByCreator(q.db.NoTxn(ctx), todo.UserID(creatorID), query)
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't read tasks by creator", err, zap.String("creator_id", creatorID))
+	}
+	return graphconv.TaskPageToGQL(page, query.Sort.Field)
+}
+
+func (q *queryResolver) Tasks(ctx context.Context, first *int, after *string, filter *model.TaskFilter, sort *model.TaskSort) (*model.TaskConnection, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, err := taskQueryFromArgs(ctx, first, after, filter, sort)
+	if err != nil {
+		return nil, err
+	}
+	// TasksForUser only returns tasks the user created or that were shared
+	// with them, so there's nothing further to authorize.
+	page, err := q.db.TasksForUser(q.db.NoTxn(ctx), userID, query)
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't read tasks for user", err, zap.String("user_id", string(userID)))
+	}
+	return graphconv.TaskPageToGQL(page, query.Sort.Field)
+}
+
+// taskQueryFromArgs validates the standard arguments of a task listing.
+func taskQueryFromArgs(ctx context.Context, first *int, after *string, filter *model.TaskFilter, sort *model.TaskSort) (*db.TaskQuery, error) {
+	query, err := graphconv.TaskQueryFromGQL(filter, sort)
+	if err != nil {
+		return nil, gqlerr.InvalidArgument(ctx, "invalid task listing arguments", zap.Error(err))
+	}
+	query.Limit = defaultPageSize
+	if first != nil {
+		if *first < 1 || *first > maxPageSize {
+			return nil, gqlerr.InvalidArgument(ctx, fmt.Sprintf("first must be between 1 and %d", maxPageSize), zap.Int("first", *first))
+		}
+		query.Limit = *first
+	}
+	if after != nil {
+		if _, err := db.DecodeTaskCursor(db.Cursor(*after), query.Sort.Field); err != nil {
+			return nil, gqlerr.InvalidArgument(ctx, "invalid cursor", zap.String("after", *after), zap.Error(err))
+		}
+		query.After = db.Cursor(*after)
+	}
+	return query, nil
+}
+
+func (q *queryResolver) TaskCollaborators(ctx context.Context, taskID string) ([]*model.TaskCollaborator, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []*model.TaskCollaborator
+	err = q.db.Transactional(ctx, func(tx db.Tx) error {
+		task, collaborators, err := q.taskAccess(tx, todo.TaskID(taskID))
+		if err != nil {
+			return err
+		}
+		if err := authz.CheckTask(userID, task, collaborators, authz.Read); err != nil {
+			return err
+		}
+		// Only the IDs of the users are known without reading them, so they're
+		// only read if any other field of them was requested.
+		var users map[todo.UserID]*todo.User
+		if graphutil.MayContainAnyOf(ctx, "user.name", "user.createdAt", "user.admin", "user.version") {
+			ids := make([]todo.UserID, len(collaborators))
+			for i, c := range collaborators {
+				ids[i] = c.UserID
+			}
+			if users, err = q.db.UsersByID(tx, ids); err != nil {
+				return fmt.Errorf("reading collaborators: %w", err)
+			}
+		}
+		out = make([]*model.TaskCollaborator, len(collaborators))
+		for i, c := range collaborators {
+			user := &todo.User{ID: c.UserID}
+			if users != nil {
+				u, ok := users[c.UserID]
+				if !ok {
+					return fmt.Errorf("reading collaborator: %w", db.NotFound(c.UserID, "user"))
+				}
+				user = u
+			}
+			if out[i], err = graphconv.TaskCollaboratorToGQL(c, user); err != nil {
+				return fmt.Errorf("converting collaborator %q: %w", c.UserID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't read task collaborators", taskID, err)
+	}
+	return out, nil
+}
+
+func (t *taskResolver) CreatedBy(ctx context.Context, obj *model.Task) (*model.User, error) {
+	user, ok, err := t.loaders(ctx).users.load(ctx, todo.UserID(obj.CreatedByID))
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't read tasks by creator", zap.String("user_id", userID), zap.Error(err))
+		return nil, taskErr(ctx, "couldn't read task creator", obj.ID, err)
+	} else if !ok {
+		return nil, taskErr(ctx, "couldn't read task creator", obj.ID, db.NotFound(obj.CreatedByID, "user"))
 	}
-	return graphconv.TasksToGQL(tasks)
+	return graphconv.UserToGQL(user), nil
+}
+
+func (q *queryResolver) TagsForUser(ctx context.Context, userID string) ([]*model.TagUsage, error) {
+	loggedInID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.CheckTasksByCreator(loggedInID, todo.UserID(userID)); err != nil {
+		return nil, gqlerr.PermissionDenied(ctx, "can't read tags of another user", zap.String("user_id", userID), zap.Error(err))
+	}
+	tags, err := q.db.TagsForUser(q.db.NoTxn(ctx), todo.UserID(userID))
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't read tags for user", err, zap.String("user_id", userID))
+	}
+	return graphconv.TagUsagesToGQL(tags), nil
 }
 
 func (m *mutationResolver) CreateTask(ctx context.Context) (string, error) {
@@ -34,47 +173,323 @@ func (m *mutationResolver) CreateTask(ctx context.Context) (string, error) {
 	}
 	taskID, err := m.db.CreateTask(m.db.NoTxn(ctx), todo.UserID(userID))
 	if err != nil {
-		return "", gqlerr.Internal(ctx, "couldn't create task", zap.Error(err))
+		return "", gqlErr(ctx, "couldn't create task", err)
 	}
+	m.publishTaskEvent(ctx, pubsub.TaskCreated, taskID, userID)
 	return string(taskID), nil
 }
 
-func (m *mutationResolver) SetTaskName(ctx context.Context, taskID string, taskName string) (*bool, error) {
-	err := m.db.UpdateTask(m.db.NoTxn(ctx), todo.TaskID(taskID), db.SetTaskName(taskName))
+func (m *mutationResolver) SetTaskName(ctx context.Context, taskID string, taskName string, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't update task name", zap.String("task_id", taskID), zap.Error(err))
+		return nil, err
+	}
+	if err := m.updateTask(ctx, userID, todo.TaskID(taskID), expectedVersion, db.SetTaskName(taskName)); err != nil {
+		return nil, m.taskUpdateErr(ctx, "couldn't update task name", taskID, err)
 	}
 	return emptySuccess()
 }
 
-func (m *mutationResolver) SetTaskBody(ctx context.Context, taskID string, taskBody string) (*bool, error) {
-	err := m.db.UpdateTask(m.db.NoTxn(ctx), todo.TaskID(taskID), db.SetTaskBody(taskBody))
+func (m *mutationResolver) SetTaskBody(ctx context.Context, taskID string, taskBody string, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't update task body", zap.String("task_id", taskID), zap.Error(err))
+		return nil, err
+	}
+	if err := m.updateTask(ctx, userID, todo.TaskID(taskID), expectedVersion, db.SetTaskBody(taskBody)); err != nil {
+		return nil, m.taskUpdateErr(ctx, "couldn't update task body", taskID, err)
 	}
 	return emptySuccess()
 }
 
-func (m *mutationResolver) AddTaskTag(ctx context.Context, taskID string, tag string) (*bool, error) {
-	err := m.db.UpdateTask(m.db.NoTxn(ctx), todo.TaskID(taskID), db.AddTaskTag(tag))
+func (m *mutationResolver) AddTaskTag(ctx context.Context, taskID string, tag string, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't add task tag", zap.String("task_id", taskID), zap.Error(err))
+		return nil, err
+	}
+	if err := m.updateTask(ctx, userID, todo.TaskID(taskID), expectedVersion, db.AddTaskTag(tag)); err != nil {
+		return nil, m.taskUpdateErr(ctx, "couldn't add task tag", taskID, err)
 	}
 	return emptySuccess()
 }
 
-func (m *mutationResolver) RemoveTaskTag(ctx context.Context, taskID string, tag string) (*bool, error) {
-	err := m.db.UpdateTask(m.db.NoTxn(ctx), todo.TaskID(taskID), db.RemoveTaskTag(tag))
+func (m *mutationResolver) RemoveTaskTag(ctx context.Context, taskID string, tag string, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't remove task tag", zap.String("task_id", taskID), zap.Error(err))
+		return nil, err
+	}
+	if err := m.updateTask(ctx, userID, todo.TaskID(taskID), expectedVersion, db.RemoveTaskTag(tag)); err != nil {
+		return nil, m.taskUpdateErr(ctx, "couldn't remove task tag", taskID, err)
 	}
 	return emptySuccess()
 }
 
+func (m *mutationResolver) SetTaskCompleted(ctx context.Context, taskID string, completed bool, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.updateTask(ctx, userID, todo.TaskID(taskID), expectedVersion, db.SetTaskCompleted(completed, m.now())); err != nil {
+		return nil, m.taskUpdateErr(ctx, "couldn't update task completion", taskID, err)
+	}
+	return emptySuccess()
+}
+
+func (m *mutationResolver) SetTaskDueAt(ctx context.Context, taskID string, dueAt *time.Time, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var due time.Time
+	if dueAt != nil {
+		due = *dueAt
+	}
+	if err := m.updateTask(ctx, userID, todo.TaskID(taskID), expectedVersion, db.SetTaskDueAt(due)); err != nil {
+		return nil, m.taskUpdateErr(ctx, "couldn't update task due date", taskID, err)
+	}
+	return emptySuccess()
+}
+
+// maxBulkTaskUpdates is the most updates that can be made in one call to
+// bulkUpdateTasks, to bound how long its transaction holds locks.
+const maxBulkTaskUpdates = 100
+
+func (m *mutationResolver) UpdateTask(ctx context.Context, taskID string, input model.TaskPatch) (*model.Task, error) {
+	tasks, err := m.patchTasks(ctx, []*model.TaskUpdate{{TaskID: taskID, Patch: &input}})
+	if err != nil {
+		return nil, err
+	}
+	return tasks[0], nil
+}
+
+func (m *mutationResolver) BulkUpdateTasks(ctx context.Context, updates []*model.TaskUpdate) ([]*model.Task, error) {
+	if len(updates) > maxBulkTaskUpdates {
+		return nil, gqlerr.InvalidArgument(ctx, fmt.Sprintf("at most %d tasks can be updated at once", maxBulkTaskUpdates), zap.Int("updates", len(updates)))
+	}
+	return m.patchTasks(ctx, updates)
+}
+
+// patchTasks applies the updates in order in a single transaction, and returns
+// the state of each updated task once all of them have been applied.
+func (m *mutationResolver) patchTasks(ctx context.Context, updates []*model.TaskUpdate) ([]*model.Task, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fns := make([][]db.UpdateTaskFn, len(updates))
+	for i, u := range updates {
+		f, err := graphconv.TaskPatchFromGQL(u.Patch, m.now())
+		if err != nil {
+			return nil, gqlerr.InvalidArgument(ctx, "invalid task patch", zap.String("task_id", u.TaskID), zap.Error(err))
+		}
+		fns[i] = withExpectedTaskVersion(u.Patch.ExpectedVersion, f)
+	}
+
+	var (
+		tasks []*todo.Task
+		// failedID is the task whose update failed, if any.
+		failedID string
+	)
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		tasks = nil
+		for i, u := range updates {
+			failedID = u.TaskID
+			if _, err := m.authorizedTask(tx, userID, todo.TaskID(u.TaskID), authz.Edit); err != nil {
+				return err
+			}
+			if err := m.db.UpdateTask(tx, todo.TaskID(u.TaskID), fns[i]...); err != nil {
+				return err
+			}
+		}
+		failedID = ""
+		// Tasks are only read once every update has been applied, as the same
+		// task may be updated more than once.
+		for _, u := range updates {
+			task, err := m.db.Task(tx, todo.TaskID(u.TaskID))
+			if err != nil {
+				return fmt.Errorf("reading updated task %q: %w", u.TaskID, err)
+			}
+			tasks = append(tasks, task)
+		}
+		return nil
+	})
+	if err != nil && failedID != "" {
+		return nil, m.taskUpdateErr(ctx, "couldn't update task", failedID, err)
+	} else if err != nil {
+		return nil, gqlErr(ctx, "couldn't update tasks", err)
+	}
+
+	published := make(map[todo.TaskID]bool)
+	for _, task := range tasks {
+		if !published[task.ID] {
+			published[task.ID] = true
+			m.publishTaskEvent(ctx, pubsub.TaskUpdated, task.ID, task.CreatedBy)
+		}
+	}
+	out, err := graphconv.TasksToGQL(tasks)
+	if err != nil {
+		return nil, gqlerr.Internal(ctx, "couldn't convert updated tasks", zap.Error(err))
+	}
+	return out, nil
+}
+
 func (m *mutationResolver) DeleteTask(ctx context.Context, taskID string) (*bool, error) {
-	err := m.db.DeleteTask(m.db.NoTxn(ctx), todo.TaskID(taskID))
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ownerID todo.UserID
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		task, err := m.authorizedTask(tx, userID, todo.TaskID(taskID), authz.Delete)
+		if err != nil {
+			return err
+		}
+		ownerID = task.CreatedBy
+		return m.db.DeleteTask(tx, todo.TaskID(taskID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't delete task", taskID, err)
+	}
+	m.publishTaskEvent(ctx, pubsub.TaskDeleted, todo.TaskID(taskID), ownerID)
+	return emptySuccess()
+}
+
+var errShareWithCreator = errors.New("tasks can't be shared with their creator")
+
+func (m *mutationResolver) ShareTask(ctx context.Context, taskID string, userID string, role model.TaskRole) (*bool, error) {
+	loggedInID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := graphconv.TaskRoleFromGQL(role)
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't delete task", zap.String("task_id", taskID), zap.Error(err))
+		return nil, gqlerr.InvalidArgument(ctx, "invalid task role", zap.String("role", string(role)), zap.Error(err))
+	}
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		task, err := m.authorizedTask(tx, loggedInID, todo.TaskID(taskID), authz.Share)
+		if err != nil {
+			return err
+		}
+		if task.CreatedBy == todo.UserID(userID) {
+			return errShareWithCreator
+		}
+		if _, err := m.db.User(tx, todo.UserID(userID)); err != nil {
+			return fmt.Errorf("reading user to share with: %w", err)
+		}
+		return m.db.ShareTask(tx, todo.TaskID(taskID), todo.UserID(userID), r)
+	})
+	if errors.Is(err, errShareWithCreator) {
+		return nil, gqlerr.InvalidArgument(ctx, "can't share a task with its creator", zap.String("task_id", taskID), zap.String("user_id", userID))
+	} else if err != nil {
+		return nil, taskErr(ctx, "couldn't share task", taskID, err)
 	}
 	return emptySuccess()
 }
+
+func (m *mutationResolver) UnshareTask(ctx context.Context, taskID string, userID string) (*bool, error) {
+	loggedInID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		task, collaborators, err := m.taskAccess(tx, todo.TaskID(taskID))
+		if err != nil {
+			return err
+		}
+		if err := authz.CheckUnshareTask(loggedInID, task, collaborators, todo.UserID(userID)); err != nil {
+			return err
+		}
+		return m.db.UnshareTask(tx, todo.TaskID(taskID), todo.UserID(userID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't unshare task", taskID, err)
+	}
+	return emptySuccess()
+}
+
+// updateTask applies the given mutations to the task in a single transaction,
+// after checking that the logged-in user is allowed to edit it, and that the
+// task is at the expected version if one is given.
+func (m *mutationResolver) updateTask(ctx context.Context, userID todo.UserID, taskID todo.TaskID, expectedVersion *int, fns ...db.UpdateTaskFn) error {
+	var ownerID todo.UserID
+	err := m.db.Transactional(ctx, func(tx db.Tx) error {
+		task, err := m.authorizedTask(tx, userID, taskID, authz.Edit)
+		if err != nil {
+			return err
+		}
+		ownerID = task.CreatedBy
+		return m.db.UpdateTask(tx, taskID, withExpectedTaskVersion(expectedVersion, fns)...)
+	})
+	if err != nil {
+		return err
+	}
+	m.publishTaskEvent(ctx, pubsub.TaskUpdated, taskID, ownerID)
+	return nil
+}
+
+// withExpectedTaskVersion guards the mutations with a version check, if an
+// expected version was given.
+func withExpectedTaskVersion(expectedVersion *int, fns []db.UpdateTaskFn) []db.UpdateTaskFn {
+	if expectedVersion == nil {
+		return fns
+	}
+	return append([]db.UpdateTaskFn{db.ExpectTaskVersion(*expectedVersion)}, fns...)
+}
+
+// taskUpdateErr is taskErr for updates, which also returns the current state
+// of the task when the update failed because the task has changed.
+func (m *mutationResolver) taskUpdateErr(ctx context.Context, msg, taskID string, err error) error {
+	if !db.IsConflict(err) {
+		return taskErr(ctx, msg, taskID, err)
+	}
+	// The user was allowed to edit the task, so they can read it.
+	task, err := m.db.Task(m.db.NoTxn(ctx), todo.TaskID(taskID))
+	if err != nil {
+		return taskErr(ctx, msg, taskID, fmt.Errorf("reading current task: %w", err))
+	}
+	current, err := graphconv.TaskToGQL(task)
+	if err != nil {
+		return gqlerr.Internal(ctx, "couldn't convert current task", zap.String("task_id", taskID), zap.Error(err))
+	}
+	return conflictErr(ctx, msg+", it was changed by someone else", current)
+}
+
+// publishTaskEvent notifies subscribers of a change that has already been
+// committed. Failures are logged rather than returned, as the change itself
+// succeeded.
+func (r *Resolver) publishTaskEvent(ctx context.Context, kind pubsub.TaskEventKind, taskID todo.TaskID, ownerID todo.UserID) {
+	err := r.pubsub.PublishTaskEvent(ctx, &pubsub.TaskEvent{
+		Kind:   kind,
+		TaskID: taskID,
+		UserID: ownerID,
+	})
+	if err != nil {
+		r.logger.Error("failed to publish task event", zap.String("task_id", string(taskID)), zap.String("kind", string(kind)), zap.Error(err))
+	}
+}
+
+// authorizedTask loads the given task, returning it only if the user is
+// allowed to perform the given action on it.
+func (r *Resolver) authorizedTask(tx db.Tx, userID todo.UserID, taskID todo.TaskID, action authz.Action) (*todo.Task, error) {
+	task, collaborators, err := r.taskAccess(tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.CheckTask(userID, task, collaborators, action); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// taskAccess loads the given task and everyone it has been shared with, which
+// is what's needed to make authorization decisions about it.
+func (r *Resolver) taskAccess(tx db.Tx, taskID todo.TaskID) (*todo.Task, []*todo.TaskCollaborator, error) {
+	task, err := r.db.Task(tx, taskID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading task: %w", err)
+	}
+	collaborators, err := r.db.TaskCollaborators(tx, taskID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading task collaborators: %w", err)
+	}
+	return task, collaborators, nil
+}
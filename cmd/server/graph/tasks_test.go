@@ -2,11 +2,16 @@ package graph
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 func TestCreateTask(t *testing.T) {
@@ -24,7 +29,11 @@ func TestCreateTask(t *testing.T) {
 		t.Fatalf("expected no error when creating a task with a logged-in context, but got %v", err)
 	}
 
-	actual, err := r.Query().Task(anonCtx, taskID)
+	if _, err := r.Query().Task(anonCtx, taskID); err == nil {
+		t.Fatalf("expected an error when reading a task as an anonymous user, but got none")
+	}
+
+	actual, err := r.Query().Task(ctx, taskID)
 	if err != nil {
 		t.Fatalf("reading task: %v", err)
 	}
@@ -43,7 +52,7 @@ func TestSetTaskName(t *testing.T) {
 	noErrDuringSetup(t, err0)
 
 	name := "name would go here for example"
-	_, err := r.Mutation().SetTaskName(ctx, taskID, name)
+	_, err := r.Mutation().SetTaskName(ctx, taskID, name, nil)
 	if err != nil {
 		t.Fatalf("setting task name: %v", err)
 	}
@@ -68,7 +77,7 @@ func TestSetTaskBody(t *testing.T) {
 	noErrDuringSetup(t, err0)
 
 	body := "a body would go here"
-	_, err := r.Mutation().SetTaskBody(ctx, taskID, body)
+	_, err := r.Mutation().SetTaskBody(ctx, taskID, body, nil)
 	if err != nil {
 		t.Fatalf("setting task name: %v", err)
 	}
@@ -86,6 +95,64 @@ func TestSetTaskBody(t *testing.T) {
 	}
 }
 
+func TestTaskFieldValidation(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0)
+
+	tests := []struct {
+		desc   string
+		update func() (*bool, error)
+		field  string
+	}{
+		{
+			desc:   "empty name",
+			update: func() (*bool, error) { return r.Mutation().SetTaskName(ctx, taskID, "  ", nil) },
+			field:  "task.name",
+		},
+		{
+			desc:   "long body",
+			update: func() (*bool, error) { return r.Mutation().SetTaskBody(ctx, taskID, strings.Repeat("a", 10001), nil) },
+			field:  "task.body",
+		},
+		{
+			desc:   "control character in tag",
+			update: func() (*bool, error) { return r.Mutation().AddTaskTag(ctx, taskID, "a\x00b", nil) },
+			field:  "task.tags",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := test.update()
+			var gqlErr *gqlerror.Error
+			if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "INVALID_ARGUMENT" {
+				t.Fatalf("expected an invalid argument error, but got %v", err)
+			}
+			if got := gqlErr.Extensions["field"]; got != test.field {
+				t.Errorf("error was for field %v, want %q", got, test.field)
+			}
+		})
+	}
+
+	_, err1 := r.Mutation().SetTaskName(ctx, taskID, "  Trimmed   Name ", nil)
+	_, err2 := r.Mutation().AddTaskTag(ctx, taskID, " Chores ", nil)
+	noErrDuringSetup(t, err1, err2)
+	actual, err := r.Query().Task(ctx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	tag := "chores"
+	expected := &model.Task{
+		ID:   string(taskID),
+		Name: "Trimmed Name",
+		Tags: []*string{&tag},
+	}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected normalized task (-want +got):\n %s", diff)
+	}
+}
+
 func TestAddTaskTags(t *testing.T) {
 	r, env := setup(t)
 	_, ctx := createUserForTest(t, env)
@@ -94,11 +161,11 @@ func TestAddTaskTags(t *testing.T) {
 
 	tagA := "hi world"
 	tagB := "oh hi"
-	_, err := r.Mutation().AddTaskTag(ctx, taskID, tagA)
+	_, err := r.Mutation().AddTaskTag(ctx, taskID, tagA, nil)
 	if err != nil {
 		t.Fatalf("adding task tag: %v", err)
 	}
-	_, err = r.Mutation().AddTaskTag(ctx, taskID, tagB)
+	_, err = r.Mutation().AddTaskTag(ctx, taskID, tagB, nil)
 	if err != nil {
 		t.Fatalf("adding task tag: %v", err)
 	}
@@ -120,13 +187,13 @@ func TestRemoveTaskTag(t *testing.T) {
 	r, env := setup(t)
 	_, ctx := createUserForTest(t, env)
 	taskID, err0 := r.Mutation().CreateTask(ctx)
-	tagA := "Guaddo"
+	tagA := "guaddo"
 	tagB := "Vaccinated for rabies"
-	_, err1 := r.Mutation().AddTaskTag(ctx, taskID, tagA)
-	_, err2 := r.Mutation().AddTaskTag(ctx, taskID, tagB)
+	_, err1 := r.Mutation().AddTaskTag(ctx, taskID, tagA, nil)
+	_, err2 := r.Mutation().AddTaskTag(ctx, taskID, tagB, nil)
 	noErrDuringSetup(t, err0, err1, err2)
 
-	_, err := r.Mutation().RemoveTaskTag(ctx, taskID, tagB)
+	_, err := r.Mutation().RemoveTaskTag(ctx, taskID, tagB, nil)
 	if err != nil {
 		t.Fatalf("adding task tag: %v", err)
 	}
@@ -151,18 +218,23 @@ func TestTagsByCreator(t *testing.T) {
 	taskIDA1, err0 := r.Mutation().CreateTask(ctxA)
 	taskIDA2, err1 := r.Mutation().CreateTask(ctxA)
 	taskIDB, err2 := r.Mutation().CreateTask(ctxB)
-	tagA1 := "A1"
-	tagA2 := "A2"
-	tagB := "B"
-	_, err3 := r.Mutation().AddTaskTag(ctxA, taskIDA1, tagA1)
-	_, err4 := r.Mutation().AddTaskTag(ctxA, taskIDA2, tagA2)
-	_, err5 := r.Mutation().AddTaskTag(ctxB, taskIDB, tagB)
+	tagA1 := "a1"
+	tagA2 := "a2"
+	tagB := "b"
+	_, err3 := r.Mutation().AddTaskTag(ctxA, taskIDA1, tagA1, nil)
+	_, err4 := r.Mutation().AddTaskTag(ctxA, taskIDA2, tagA2, nil)
+	_, err5 := r.Mutation().AddTaskTag(ctxB, taskIDB, tagB, nil)
 	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5)
 
-	actual, err := r.Query().TasksByCreator(ctxB, string(userIDA))
+	if _, err := r.Query().TasksByCreator(ctxB, string(userIDA), nil, nil, nil, nil); err == nil {
+		t.Fatalf("expected an error when listing another user's tasks, but got none")
+	}
+
+	conn, err := r.Query().TasksByCreator(ctxA, string(userIDA), nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("tasks by creator: %v", err)
 	}
+	actual := taskNodes(conn)
 
 	expected := []*model.Task{{
 		ID:   string(taskIDA1),
@@ -177,6 +249,180 @@ func TestTagsByCreator(t *testing.T) {
 	}
 }
 
+func TestTagsForUser(t *testing.T) {
+	r, env := setup(t)
+	userIDA, ctxA := createUserForTest(t, env)
+	_, ctxB := createUserForTest(t, env)
+	taskIDA1, err0 := r.Mutation().CreateTask(ctxA)
+	taskIDA2, err1 := r.Mutation().CreateTask(ctxA)
+	taskIDB, err2 := r.Mutation().CreateTask(ctxB)
+	_, err3 := r.Mutation().AddTaskTag(ctxA, taskIDA1, "shared", nil)
+	_, err4 := r.Mutation().AddTaskTag(ctxA, taskIDA2, "shared", nil)
+	_, err5 := r.Mutation().AddTaskTag(ctxA, taskIDA2, "a b", nil)
+	_, err6 := r.Mutation().AddTaskTag(ctxB, taskIDB, "shared", nil)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5, err6)
+
+	if _, err := r.Query().TagsForUser(ctxB, string(userIDA)); err == nil {
+		t.Fatalf("expected an error when listing another user's tags, but got none")
+	}
+
+	actual, err := r.Query().TagsForUser(ctxA, string(userIDA))
+	if err != nil {
+		t.Fatalf("tags for user: %v", err)
+	}
+	expected := []*model.TagUsage{
+		{Tag: "shared", TaskCount: 2},
+		{Tag: "a b", TaskCount: 1},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+}
+
+func TestUpdateTaskConflict(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	version := 1
+	_, err1 := r.Mutation().SetTaskName(ctx, taskID, "First", &version)
+	noErrDuringSetup(t, err0, err1)
+
+	_, err := r.Mutation().SetTaskBody(ctx, taskID, "Body", &version)
+	var gqlErr *gqlerror.Error
+	if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "CONFLICT" {
+		t.Fatalf("expected a conflict error when updating a task at a stale version, but got %v", err)
+	}
+	current, ok := gqlErr.Extensions["current"].(*model.Task)
+	if !ok {
+		t.Fatalf("conflict error had current state of type %T, want *model.Task", gqlErr.Extensions["current"])
+	}
+	if diff := cmp.Diff(&model.Task{ID: taskID, Name: "First"}, current, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected current task (-want +got)\n%s", diff)
+	}
+	if current.Version != 2 {
+		t.Errorf("current task was at version %d, want 2", current.Version)
+	}
+
+	// Without an expected version, the update is always applied.
+	if _, err := r.Mutation().SetTaskBody(ctx, taskID, "Body", nil); err != nil {
+		t.Fatalf("updating task without an expected version: %v", err)
+	}
+}
+
+func TestUpdateTaskPatch(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	_, err1 := r.Mutation().AddTaskTag(ctx, taskID, "old", nil)
+	noErrDuringSetup(t, err0, err1)
+
+	name, body, completed, version := "Name", "Body", true, 2
+	dueAt := time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC)
+	actual, err := r.Mutation().UpdateTask(ctx, taskID, model.TaskPatch{
+		Name:            &name,
+		Body:            &body,
+		AddTags:         []string{"a", "b", "c"},
+		RemoveTags:      []string{"old"},
+		Completed:       &completed,
+		DueAt:           &dueAt,
+		ExpectedVersion: &version,
+	})
+	if err != nil {
+		t.Fatalf("updating task: %v", err)
+	}
+	a, b, c := "a", "b", "c"
+	expected := &model.Task{
+		ID:        taskID,
+		Name:      name,
+		Body:      body,
+		Tags:      []*string{&a, &b, &c},
+		Completed: true,
+		DueAt:     &dueAt,
+	}
+	opts := cmp.Options{taskCmpOpts(), cmpopts.IgnoreFields(model.Task{}, "CompletedAt")}
+	if diff := cmp.Diff(expected, actual, opts); diff != "" {
+		t.Errorf("unexpected updated task (-want +got):\n %s", diff)
+	}
+	// All the changes are made in one write.
+	if actual.Version != 3 {
+		t.Errorf("updated task is at version %d, want 3", actual.Version)
+	}
+	read, err := r.Query().Task(ctx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	if diff := cmp.Diff(actual, read); diff != "" {
+		t.Errorf("returned task differs from stored task (-want +got):\n %s", diff)
+	}
+
+	clear := true
+	if _, err := r.Mutation().UpdateTask(ctx, taskID, model.TaskPatch{DueAt: &dueAt, ClearDueAt: &clear}); err == nil {
+		t.Error("expected an error when both setting and clearing the due date, but got none")
+	}
+}
+
+func TestBulkUpdateTasks(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	_, otherCtx := createUserForTest(t, env)
+	taskID1, err0 := r.Mutation().CreateTask(ctx)
+	taskID2, err1 := r.Mutation().CreateTask(ctx)
+	otherTaskID, err2 := r.Mutation().CreateTask(otherCtx)
+	noErrDuringSetup(t, err0, err1, err2)
+
+	first, second, third, empty := "First", "Second", "Third", ""
+	actual, err := r.Mutation().BulkUpdateTasks(ctx, []*model.TaskUpdate{
+		{TaskID: taskID1, Patch: &model.TaskPatch{Name: &first}},
+		{TaskID: taskID2, Patch: &model.TaskPatch{Name: &second}},
+		{TaskID: taskID1, Patch: &model.TaskPatch{Body: &third}},
+	})
+	if err != nil {
+		t.Fatalf("bulk updating tasks: %v", err)
+	}
+	// Each update returns the task as of the end of the whole batch.
+	expected := []*model.Task{
+		{ID: taskID1, Name: first, Body: third},
+		{ID: taskID2, Name: second},
+		{ID: taskID1, Name: first, Body: third},
+	}
+	if diff := cmp.Diff(expected, actual, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(model.Task{}, "CreatedByID", "CreatedAt", "UpdatedAt", "Version")); diff != "" {
+		t.Errorf("unexpected updated tasks (-want +got):\n %s", diff)
+	}
+
+	// If any update fails, none of them are applied.
+	tests := []struct {
+		desc   string
+		update *model.TaskUpdate
+	}{
+		{
+			desc:   "invalid value",
+			update: &model.TaskUpdate{TaskID: taskID2, Patch: &model.TaskPatch{Name: &empty}},
+		},
+		{
+			desc:   "another user's task",
+			update: &model.TaskUpdate{TaskID: otherTaskID, Patch: &model.TaskPatch{Name: &third}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := r.Mutation().BulkUpdateTasks(ctx, []*model.TaskUpdate{
+				{TaskID: taskID1, Patch: &model.TaskPatch{Name: &third}},
+				test.update,
+			})
+			if err == nil {
+				t.Fatal("expected an error from the bulk update, but got none")
+			}
+			task, err := r.Query().Task(ctx, taskID1)
+			if err != nil {
+				t.Fatalf("reading task: %v", err)
+			}
+			if task.Name != first {
+				t.Errorf("task name is %q after a failed bulk update, want %q", task.Name, first)
+			}
+		})
+	}
+}
+
 func TestDeleteTask(t *testing.T) {
 	r, env := setup(t)
 	userID, ctx := createUserForTest(t, env)
@@ -186,9 +432,9 @@ func TestDeleteTask(t *testing.T) {
 	tag1 := "1"
 	tag2 := "2"
 	tag3 := "3"
-	_, err3 := r.Mutation().AddTaskTag(ctx, taskID1, tag1)
-	_, err4 := r.Mutation().AddTaskTag(ctx, taskID2, tag2)
-	_, err5 := r.Mutation().AddTaskTag(ctx, taskID3, tag3)
+	_, err3 := r.Mutation().AddTaskTag(ctx, taskID1, tag1, nil)
+	_, err4 := r.Mutation().AddTaskTag(ctx, taskID2, tag2, nil)
+	_, err5 := r.Mutation().AddTaskTag(ctx, taskID3, tag3, nil)
 	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5)
 
 	_, err := r.Mutation().DeleteTask(ctx, taskID2)
@@ -196,10 +442,11 @@ func TestDeleteTask(t *testing.T) {
 		t.Fatalf("deleting task: %v", err)
 	}
 
-	actual, err := r.Query().TasksByCreator(ctx, string(userID))
+	conn, err := r.Query().TasksByCreator(ctx, string(userID), nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("tasks by creator: %v", err)
 	}
+	actual := taskNodes(conn)
 
 	expected := []*model.Task{{
 		ID:   string(taskID1),
@@ -208,19 +455,345 @@ func TestDeleteTask(t *testing.T) {
 		ID:   string(taskID3),
 		Tags: []*string{&tag3},
 	}}
-	opts := cmpopts.SortSlices(func(a, b *model.Task) bool {
-		return a.ID < b.ID
-	})
-	if diff := cmp.Diff(expected, actual, opts); diff != "" {
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
 		t.Errorf("unexpected diff (-want +got):\n %s", diff)
 	}
 }
 
+func TestSetTaskCompleted(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0)
+
+	completedAt := time.Date(2023, time.March, 4, 5, 6, 7, 0, time.UTC)
+	r.now = func() time.Time { return completedAt }
+	if _, err := r.Mutation().SetTaskCompleted(ctx, taskID, true, nil); err != nil {
+		t.Fatalf("completing task: %v", err)
+	}
+	// Completing the task again shouldn't change when it was completed.
+	r.now = func() time.Time { return completedAt.Add(time.Hour) }
+	if _, err := r.Mutation().SetTaskCompleted(ctx, taskID, true, nil); err != nil {
+		t.Fatalf("completing task again: %v", err)
+	}
+
+	actual, err := r.Query().Task(ctx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	expected := &model.Task{
+		ID:          string(taskID),
+		Completed:   true,
+		CompletedAt: &completedAt,
+	}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+
+	if _, err := r.Mutation().SetTaskCompleted(ctx, taskID, false, nil); err != nil {
+		t.Fatalf("uncompleting task: %v", err)
+	}
+
+	actual, err = r.Query().Task(ctx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	expected = &model.Task{
+		ID: string(taskID),
+	}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+}
+
+func TestSetTaskDueAt(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0)
+
+	dueAt := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := r.Mutation().SetTaskDueAt(ctx, taskID, &dueAt, nil); err != nil {
+		t.Fatalf("setting due date: %v", err)
+	}
+
+	actual, err := r.Query().Task(ctx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	expected := &model.Task{
+		ID:    string(taskID),
+		DueAt: &dueAt,
+	}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+
+	if _, err := r.Mutation().SetTaskDueAt(ctx, taskID, nil, nil); err != nil {
+		t.Fatalf("clearing due date: %v", err)
+	}
+
+	actual, err = r.Query().Task(ctx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	expected = &model.Task{
+		ID: string(taskID),
+	}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+}
+
+func TestTasksByCreatorPagination(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	names := []string{"d", "b", "e", "a", "c"}
+	for _, name := range names {
+		taskID, err0 := r.Mutation().CreateTask(ctx)
+		_, err1 := r.Mutation().SetTaskName(ctx, taskID, name, nil)
+		noErrDuringSetup(t, err0, err1)
+	}
+
+	first := 2
+	sort := &model.TaskSort{Field: model.TaskSortFieldName}
+	var (
+		after *string
+		got   []string
+	)
+	for i := 0; ; i++ {
+		if i > len(names) {
+			t.Fatal("too many pages returned")
+		}
+		conn, err := r.Query().TasksByCreator(ctx, string(userID), &first, after, nil, sort)
+		if err != nil {
+			t.Fatalf("tasks by creator: %v", err)
+		}
+		for _, e := range conn.Edges {
+			got = append(got, e.Node.Name)
+		}
+		if !conn.PageInfo.HasNextPage {
+			break
+		}
+		after = conn.PageInfo.EndCursor
+	}
+
+	want := []string{"a", "b", "c", "d", "e"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+
+	badCursor := "not a cursor"
+	if _, err := r.Query().TasksByCreator(ctx, string(userID), &first, &badCursor, nil, sort); err == nil {
+		t.Error("expected an error for an invalid cursor, but got none")
+	}
+	tooMany := maxPageSize + 1
+	if _, err := r.Query().TasksByCreator(ctx, string(userID), &tooMany, nil, nil, nil); err == nil {
+		t.Error("expected an error for a page size that's too large, but got none")
+	}
+}
+
+func TestTasksByCreatorFilter(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	taskID1, err0 := r.Mutation().CreateTask(ctx)
+	taskID2, err1 := r.Mutation().CreateTask(ctx)
+	_, err2 := r.Mutation().CreateTask(ctx)
+	tag := "chores"
+	_, err3 := r.Mutation().AddTaskTag(ctx, taskID1, tag, nil)
+	_, err4 := r.Mutation().AddTaskTag(ctx, taskID2, tag, nil)
+	_, err5 := r.Mutation().SetTaskCompleted(ctx, taskID2, true, nil)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5)
+
+	notCompleted := false
+	filter := &model.TaskFilter{Tag: &tag, Completed: &notCompleted}
+	conn, err := r.Query().TasksByCreator(ctx, string(userID), nil, nil, filter, nil)
+	if err != nil {
+		t.Fatalf("tasks by creator: %v", err)
+	}
+
+	expected := []*model.Task{{
+		ID:   string(taskID1),
+		Tags: []*string{&tag},
+	}}
+	if diff := cmp.Diff(expected, taskNodes(conn), taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+}
+
+func TestTaskAuthorization(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	_, otherCtx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ownerCtx)
+	_, err1 := r.Mutation().SetTaskName(ownerCtx, taskID, "Owner's Task", nil)
+	noErrDuringSetup(t, err0, err1)
+
+	if _, err := r.Query().Task(otherCtx, taskID); err == nil {
+		t.Error("expected an error when reading another user's task, but got none")
+	}
+	if _, err := r.Mutation().SetTaskName(otherCtx, taskID, "Stolen", nil); err == nil {
+		t.Error("expected an error when renaming another user's task, but got none")
+	}
+	if _, err := r.Mutation().SetTaskBody(otherCtx, taskID, "Stolen", nil); err == nil {
+		t.Error("expected an error when setting the body of another user's task, but got none")
+	}
+	if _, err := r.Mutation().AddTaskTag(otherCtx, taskID, "Stolen", nil); err == nil {
+		t.Error("expected an error when tagging another user's task, but got none")
+	}
+	if _, err := r.Mutation().RemoveTaskTag(otherCtx, taskID, "Stolen", nil); err == nil {
+		t.Error("expected an error when untagging another user's task, but got none")
+	}
+	if _, err := r.Mutation().DeleteTask(otherCtx, taskID); err == nil {
+		t.Error("expected an error when deleting another user's task, but got none")
+	}
+
+	actual, err := r.Query().Task(ownerCtx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	expected := &model.Task{
+		ID:   string(taskID),
+		Name: "Owner's Task",
+	}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n %s", diff)
+	}
+}
+
+func taskNodes(conn *model.TaskConnection) []*model.Task {
+	var out []*model.Task
+	for _, e := range conn.Edges {
+		out = append(out, e.Node)
+	}
+	return out
+}
+
 func taskCmpOpts() cmp.Option {
 	return cmp.Options{
 		cmpopts.SortSlices(func(a, b *model.Task) bool {
 			return a.ID < b.ID
 		}),
 		cmpopts.EquateEmpty(),
+		cmpopts.IgnoreFields(model.Task{}, "CreatedByID", "CreatedAt", "UpdatedAt", "Version"),
+	}
+}
+
+func TestShareTask(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	collaboratorID, collaboratorCtx := createUserForTest(t, env)
+	otherID, otherCtx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ownerCtx)
+	_, err1 := r.Mutation().SetTaskName(ownerCtx, taskID, "Shared Task", nil)
+	noErrDuringSetup(t, err0, err1)
+
+	if _, err := r.Query().Task(collaboratorCtx, taskID); err == nil {
+		t.Fatal("expected an error reading a task before it was shared, but got none")
+	}
+	if _, err := r.Mutation().ShareTask(otherCtx, taskID, string(collaboratorID), model.TaskRoleViewer); err == nil {
+		t.Fatal("expected an error when a non-owner shares a task, but got none")
+	}
+
+	// As a viewer, the collaborator can read and list the task, but not edit it.
+	if _, err := r.Mutation().ShareTask(ownerCtx, taskID, string(collaboratorID), model.TaskRoleViewer); err != nil {
+		t.Fatalf("sharing task: %v", err)
+	}
+	if _, err := r.Query().Task(collaboratorCtx, taskID); err != nil {
+		t.Errorf("reading shared task: %v", err)
+	}
+	conn, err := r.Query().Tasks(collaboratorCtx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("listing tasks: %v", err)
+	}
+	expectedTasks := []*model.Task{{ID: taskID, Name: "Shared Task"}}
+	if diff := cmp.Diff(expectedTasks, taskNodes(conn), taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected tasks for collaborator (-want +got):\n %s", diff)
+	}
+	if _, err := r.Mutation().SetTaskName(collaboratorCtx, taskID, "Renamed", nil); err == nil {
+		t.Error("expected an error when a viewer renames a task, but got none")
+	}
+
+	// As an editor, the collaborator can edit the task, but not delete or share it.
+	if _, err := r.Mutation().ShareTask(ownerCtx, taskID, string(collaboratorID), model.TaskRoleEditor); err != nil {
+		t.Fatalf("changing collaborator role: %v", err)
+	}
+	if _, err := r.Mutation().SetTaskName(collaboratorCtx, taskID, "Renamed", nil); err != nil {
+		t.Errorf("renaming task as editor: %v", err)
+	}
+	if _, err := r.Mutation().DeleteTask(collaboratorCtx, taskID); err == nil {
+		t.Error("expected an error when an editor deletes a task, but got none")
+	}
+	if _, err := r.Mutation().ShareTask(collaboratorCtx, taskID, string(otherID), model.TaskRoleViewer); err == nil {
+		t.Error("expected an error when an editor shares a task, but got none")
+	}
+
+	collaborators, err := r.Query().TaskCollaborators(ownerCtx, taskID)
+	if err != nil {
+		t.Fatalf("reading collaborators: %v", err)
+	}
+	expectedCollaborators := []*model.TaskCollaborator{{
+		User: &model.User{ID: string(collaboratorID), Name: "User", Version: 1},
+		Role: model.TaskRoleEditor,
+	}}
+	if diff := cmp.Diff(expectedCollaborators, collaborators, userCmpOpts()); diff != "" {
+		t.Errorf("unexpected collaborators (-want +got):\n %s", diff)
+	}
+
+	// Collaborators can remove themselves.
+	if _, err := r.Mutation().UnshareTask(collaboratorCtx, taskID, string(collaboratorID)); err != nil {
+		t.Fatalf("unsharing task: %v", err)
+	}
+	if _, err := r.Query().Task(collaboratorCtx, taskID); err == nil {
+		t.Error("expected an error reading a task after it was unshared, but got none")
+	}
+}
+
+func TestTaskCollaboratorUserFields(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	collaboratorID, _ := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ownerCtx)
+	_, err1 := r.Mutation().ShareTask(ownerCtx, taskID, string(collaboratorID), model.TaskRoleViewer)
+	err2 := env.db.UpdateUser(env.db.NoTxn(context.Background()), collaboratorID, db.SetUserAdmin(true))
+	noErrDuringSetup(t, err0, err1, err2)
+
+	// Only fields that the user ID alone can't answer are requested, so the
+	// collaborator has to be read.
+	var resp struct {
+		TaskCollaborators []struct {
+			User struct {
+				CreatedAt time.Time
+				Admin     bool
+			}
+		}
+	}
+	runQuery(t, ownerCtx, r, `query($taskId: ID!) {
+		taskCollaborators(taskId: $taskId) { user { createdAt admin } }
+	}`, map[string]interface{}{"taskId": taskID}, &resp)
+
+	if len(resp.TaskCollaborators) != 1 {
+		t.Fatalf("got %d collaborators, want 1", len(resp.TaskCollaborators))
+	}
+	user := resp.TaskCollaborators[0].User
+	if user.CreatedAt.IsZero() {
+		t.Error("collaborator's createdAt was zero")
+	}
+	if !user.Admin {
+		t.Error("collaborator wasn't an admin")
+	}
+}
+
+func TestShareTaskWithCreator(t *testing.T) {
+	r, env := setup(t)
+	ownerID, ownerCtx := createUserForTest(t, env)
+	taskID, err := r.Mutation().CreateTask(ownerCtx)
+	noErrDuringSetup(t, err)
+
+	if _, err := r.Mutation().ShareTask(ownerCtx, taskID, string(ownerID), model.TaskRoleViewer); err == nil {
+		t.Error("expected an error when sharing a task with its creator, but got none")
+	}
+	if _, err := r.Mutation().ShareTask(ownerCtx, taskID, "user.missing", model.TaskRoleViewer); err == nil {
+		t.Error("expected an error when sharing a task with a missing user, but got none")
 	}
 }
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/authz"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+func (q *queryResolver) TrashedTasks(ctx context.Context) ([]*model.Task, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := q.db.TrashedTasks(q.db.NoTxn(ctx), userID)
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't read trashed tasks", err, zap.String("user_id", string(userID)))
+	}
+	out, err := graphconv.TasksToGQL(tasks)
+	if err != nil {
+		return nil, gqlerr.Internal(ctx, "couldn't convert trashed tasks", zap.Error(err))
+	}
+	return out, nil
+}
+
+func (m *mutationResolver) RestoreTask(ctx context.Context, taskID string) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ownerID todo.UserID
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		task, err := m.authorizedTrashedTask(tx, userID, todo.TaskID(taskID))
+		if err != nil {
+			return err
+		}
+		ownerID = task.CreatedBy
+		return m.db.RestoreTask(tx, todo.TaskID(taskID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't restore task", taskID, err)
+	}
+	m.publishTaskEvent(ctx, pubsub.TaskUpdated, todo.TaskID(taskID), ownerID)
+	return emptySuccess()
+}
+
+func (m *mutationResolver) PurgeTask(ctx context.Context, taskID string) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		if _, err := m.authorizedTrashedTask(tx, userID, todo.TaskID(taskID)); err != nil {
+			return err
+		}
+		return m.db.PurgeTask(tx, todo.TaskID(taskID))
+	})
+	if err != nil {
+		return nil, taskErr(ctx, "couldn't purge task", taskID, err)
+	}
+	return emptySuccess()
+}
+
+// authorizedTrashedTask loads the given task from the trash, returning it only
+// if the user is allowed to delete it, which is what's required to restore or
+// purge it.
+func (r *Resolver) authorizedTrashedTask(tx db.Tx, userID todo.UserID, taskID todo.TaskID) (*todo.Task, error) {
+	task, err := r.db.TrashedTask(tx, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("reading trashed task: %w", err)
+	}
+	collaborators, err := r.db.TaskCollaborators(tx, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("reading task collaborators: %w", err)
+	}
+	if err := authz.CheckTask(userID, task, collaborators, authz.Delete); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
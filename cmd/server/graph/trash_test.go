@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTrashAndRestoreTask(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	_, err1 := r.Mutation().DeleteTask(ctx, taskID)
+	noErrDuringSetup(t, err0, err1)
+
+	if _, err := r.Query().Task(ctx, taskID); err == nil {
+		t.Error("expected an error reading a trashed task, but got none")
+	}
+	trashed, err := r.Query().TrashedTasks(ctx)
+	if err != nil {
+		t.Fatalf("reading trashed tasks: %v", err)
+	}
+	if len(trashed) != 1 || trashed[0].ID != taskID || trashed[0].DeletedAt == nil {
+		t.Errorf("unexpected trashed tasks %+v, want only %q with a deletion time", trashed, taskID)
+	}
+
+	if _, err := r.Mutation().RestoreTask(ctx, taskID); err != nil {
+		t.Fatalf("restoring task: %v", err)
+	}
+	conn, err := r.Query().TasksByCreator(ctx, string(userID), nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("tasks by creator: %v", err)
+	}
+	if diff := cmp.Diff([]*model.Task{{ID: taskID}}, taskNodes(conn), taskCmpOpts()); diff != "" {
+		t.Errorf("unexpected tasks (-want +got)\n%s", diff)
+	}
+	trashed, err = r.Query().TrashedTasks(ctx)
+	if err != nil {
+		t.Fatalf("reading trashed tasks: %v", err)
+	}
+	if len(trashed) != 0 {
+		t.Errorf("expected an empty trash after restoring, got %d tasks", len(trashed))
+	}
+}
+
+func TestPurgeTask(t *testing.T) {
+	r, env := setup(t)
+	_, ctx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err0)
+
+	if _, err := r.Mutation().PurgeTask(ctx, taskID); err == nil {
+		t.Error("expected an error purging a task that isn't in the trash, but got none")
+	}
+	_, err := r.Mutation().DeleteTask(ctx, taskID)
+	noErrDuringSetup(t, err)
+
+	if _, err := r.Mutation().PurgeTask(ctx, taskID); err != nil {
+		t.Fatalf("purging task: %v", err)
+	}
+	if _, err := r.Mutation().RestoreTask(ctx, taskID); err == nil {
+		t.Error("expected an error restoring a purged task, but got none")
+	}
+}
+
+func TestTrashAuthorization(t *testing.T) {
+	r, env := setup(t)
+	_, ownerCtx := createUserForTest(t, env)
+	collaboratorID, collaboratorCtx := createUserForTest(t, env)
+	taskID, err0 := r.Mutation().CreateTask(ownerCtx)
+	_, err1 := r.Mutation().ShareTask(ownerCtx, taskID, string(collaboratorID), model.TaskRoleEditor)
+	_, err2 := r.Mutation().DeleteTask(ownerCtx, taskID)
+	noErrDuringSetup(t, err0, err1, err2)
+
+	if _, err := r.Mutation().RestoreTask(collaboratorCtx, taskID); err == nil {
+		t.Error("expected an error when an editor restores a task, but got none")
+	}
+	if _, err := r.Mutation().PurgeTask(collaboratorCtx, taskID); err == nil {
+		t.Error("expected an error when an editor purges a task, but got none")
+	}
+	trashed, err := r.Query().TrashedTasks(collaboratorCtx)
+	if err != nil {
+		t.Fatalf("reading trashed tasks: %v", err)
+	}
+	if len(trashed) != 0 {
+		t.Errorf("expected the collaborator's trash to be empty, got %d tasks", len(trashed))
+	}
+}
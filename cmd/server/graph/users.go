@@ -2,8 +2,14 @@ package graph
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Silicon-Ally/gqlerr"
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/authz"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph/graphconv"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
 	"github.com/Silicon-Ally/silicon-starter/db"
@@ -18,19 +24,266 @@ func (q *queryResolver) Me(ctx context.Context) (*model.User, error) {
 	}
 	user, err := q.db.User(q.db.NoTxn(ctx), todo.UserID(userID))
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't read user", zap.String("user_id", string(userID)), zap.Error(err))
+		return nil, gqlErr(ctx, "couldn't read user", err, zap.String("user_id", string(userID)))
 	}
 	return graphconv.UserToGQL(user), nil
 }
 
-func (m *mutationResolver) SetUserName(ctx context.Context, userName string) (*bool, error) {
+func (q *queryResolver) Users(ctx context.Context, first *int, after *string, search *string) (*model.UserConnection, error) {
+	userID, err := q.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, err := userQueryFromArgs(ctx, first, after, search)
+	if err != nil {
+		return nil, err
+	}
+	var page *db.UserPage
+	err = q.db.Transactional(ctx, func(tx db.Tx) error {
+		user, err := q.db.User(tx, userID)
+		if err != nil {
+			return fmt.Errorf("reading user: %w", err)
+		}
+		if err := authz.CheckListUsers(user); err != nil {
+			return err
+		}
+		if page, err = q.db.ListUsers(tx, query); err != nil {
+			return fmt.Errorf("listing users: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't list users", err, zap.String("user_id", string(userID)))
+	}
+	return graphconv.UserPageToGQL(page), nil
+}
+
+// userQueryFromArgs validates the arguments of the user directory.
+func userQueryFromArgs(ctx context.Context, first *int, after *string, search *string) (*db.UserQuery, error) {
+	query := &db.UserQuery{Limit: defaultPageSize}
+	if search != nil {
+		query.Search = strings.TrimSpace(*search)
+		if n := utf8.RuneCountInString(query.Search); n > maxSearchQueryLength {
+			return nil, gqlerr.InvalidArgument(ctx, fmt.Sprintf("search must be at most %d characters", maxSearchQueryLength), zap.Int("length", n))
+		}
+	}
+	if first != nil {
+		if *first < 1 || *first > maxPageSize {
+			return nil, gqlerr.InvalidArgument(ctx, fmt.Sprintf("first must be between 1 and %d", maxPageSize), zap.Int("first", *first))
+		}
+		query.Limit = *first
+	}
+	if after != nil {
+		if _, err := db.DecodeUserCursor(db.Cursor(*after)); err != nil {
+			return nil, gqlerr.InvalidArgument(ctx, "invalid cursor", zap.String("after", *after), zap.Error(err))
+		}
+		query.After = db.Cursor(*after)
+	}
+	return query, nil
+}
+
+// Email is only visible to the user and to admins.
+func (u *userResolver) Email(ctx context.Context, obj *model.User) (*string, error) {
+	user, ok, err := u.privateUser(ctx, obj)
+	if !ok {
+		return nil, err
+	}
+	return &user.Email, nil
+}
+
+// AuthProvider is only visible to the user and to admins.
+func (u *userResolver) AuthProvider(ctx context.Context, obj *model.User) (*model.AuthProvider, error) {
+	user, ok, err := u.privateUser(ctx, obj)
+	if !ok {
+		return nil, err
+	}
+	p, err := graphconv.AuthProviderToGQL(user.AuthnProviderType)
+	if err != nil {
+		// Users from providers the API doesn't know about are left as null,
+		// rather than failing the whole query.
+		u.logger.Warn("couldn't convert auth provider", zap.String("user_id", obj.ID), zap.Error(err))
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// privateUser returns the user, and whether the logged-in user may read its
+// private fields. Not being allowed to isn't an error, the fields are null.
+func (u *userResolver) privateUser(ctx context.Context, obj *model.User) (*todo.User, bool, error) {
+	viewerID, err := todo.UserIDFromContext(ctx)
+	if err != nil || viewerID == "" {
+		return nil, false, nil
+	}
+	l := u.loaders(ctx)
+	viewer, ok, err := l.users.load(ctx, viewerID)
+	if err != nil {
+		return nil, false, gqlErr(ctx, "couldn't read current user", err, zap.String("user_id", string(viewerID)))
+	} else if !ok {
+		return nil, false, nil
+	}
+	if err := authz.CheckUserPrivateFields(viewer, todo.UserID(obj.ID)); err != nil {
+		return nil, false, nil
+	}
+	user, ok, err := l.users.load(ctx, todo.UserID(obj.ID))
+	if err != nil {
+		return nil, false, gqlErr(ctx, "couldn't read user", err, zap.String("user_id", obj.ID))
+	}
+	return user, ok, nil
+}
+
+func (u *userResolver) TaskCount(ctx context.Context, obj *model.User) (int, error) {
+	// Users without any tasks have no count, which is zero.
+	n, _, err := u.loaders(ctx).taskCounts.load(ctx, todo.UserID(obj.ID))
+	if err != nil {
+		return 0, gqlErr(ctx, "couldn't count tasks", err, zap.String("user_id", obj.ID))
+	}
+	return n, nil
+}
+
+func (m *mutationResolver) SetUserName(ctx context.Context, userName string, expectedVersion *int) (*bool, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fns := []db.UpdateUserFn{db.SetUserName(userName)}
+	if expectedVersion != nil {
+		fns = append([]db.UpdateUserFn{db.ExpectUserVersion(*expectedVersion)}, fns...)
+	}
+	err = m.db.UpdateUser(m.db.NoTxn(ctx), todo.UserID(userID), fns...)
+	if db.IsConflict(err) {
+		user, err := m.db.User(m.db.NoTxn(ctx), userID)
+		if err != nil {
+			return nil, gqlErr(ctx, "couldn't read current user", err, zap.String("user_id", string(userID)))
+		}
+		return nil, conflictErr(ctx, "couldn't update user, it was changed by someone else", graphconv.UserToGQL(user))
+	} else if err != nil {
+		return nil, gqlErr(ctx, "couldn't update user", err, zap.String("user_id", string(userID)))
+	}
+	return emptySuccess()
+}
+
+func (m *mutationResolver) DeleteMyAccount(ctx context.Context) (*bool, error) {
 	userID, err := m.userIDFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	err = m.db.UpdateUser(m.db.NoTxn(ctx), todo.UserID(userID), db.SetUserName(userName))
+	ids, err := m.db.AuthIdentities(m.db.NoTxn(ctx), userID)
 	if err != nil {
-		return nil, gqlerr.Internal(ctx, "couldn't update user", zap.String("user_id", string(userID)), zap.Error(err))
+		return nil, gqlErr(ctx, "couldn't read auth identities", err, zap.String("user_id", string(userID)))
+	}
+	// Collaborators lose access to the user's shared tasks without being
+	// notified, as task events are only delivered to a task's owner.
+	if err := m.db.DeleteUser(m.db.NoTxn(ctx), userID); err != nil {
+		return nil, gqlErr(ctx, "couldn't delete user", err, zap.String("user_id", string(userID)))
+	}
+	// Like when unlinking an identity, sessions of identities that no longer
+	// belong to anyone can't be used, so failing to revoke them isn't worth
+	// failing over. Identities from providers the auth system doesn't manage
+	// have no sessions of ours to revoke.
+	for _, a := range ids {
+		if !m.auth.ManagesProvider(a.Provider) {
+			continue
+		}
+		if err := m.auth.RevokeRefreshTokens(ctx, a.ProviderUserID); err != nil {
+			m.logger.Warn("couldn't revoke refresh tokens of deleted user", zap.String("user_id", string(userID)), zap.String("auth_provider", string(a.Provider)), zap.Error(err))
+		}
 	}
 	return emptySuccess()
 }
+
+// AuthIdentities are only visible to the user and to admins.
+func (u *userResolver) AuthIdentities(ctx context.Context, obj *model.User) ([]*model.AuthIdentity, error) {
+	user, ok, err := u.privateUser(ctx, obj)
+	if !ok {
+		return nil, err
+	}
+	ids, err := u.db.AuthIdentities(u.db.NoTxn(ctx), user.ID)
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't read auth identities", err, zap.String("user_id", obj.ID))
+	}
+	out, err := graphconv.AuthIdentitiesToGQL(ids)
+	if err != nil {
+		return nil, gqlerr.Internal(ctx, "couldn't convert auth identities", zap.String("user_id", obj.ID), zap.Error(err))
+	}
+	return out, nil
+}
+
+// maxLinkSignInAge is how long ago the user can have signed in with an
+// identity to link it, like the limit on signing in to start a session.
+const maxLinkSignInAge = 5 * time.Minute
+
+func (m *mutationResolver) LinkAuthProvider(ctx context.Context, idToken string) ([]*model.AuthIdentity, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tkn, err := m.auth.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return nil, gqlerr.InvalidArgument(ctx, "invalid ID token", zap.String("user_id", string(userID)), zap.Error(err))
+	}
+	if age := m.now().Sub(tkn.AuthTime); age > maxLinkSignInAge {
+		return nil, gqlerr.InvalidArgument(ctx, "the ID token is too old, sign in again to link it", zap.String("user_id", string(userID)), zap.Duration("sign_in_age", age))
+	}
+	ui := tkn.UserInfo
+	var ids []*todo.AuthIdentity
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		err := m.db.LinkAuthIdentity(tx, &todo.AuthIdentity{
+			UserID:         userID,
+			Provider:       ui.AuthProvider,
+			ProviderUserID: ui.UserID,
+			Email:          ui.Email,
+			EmailVerified:  ui.EmailVerified,
+		})
+		if err != nil {
+			return fmt.Errorf("linking auth identity: %w", err)
+		}
+		if ids, err = m.db.AuthIdentities(tx, userID); err != nil {
+			return fmt.Errorf("reading auth identities: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't link auth provider", err, zap.String("user_id", string(userID)), zap.String("auth_provider", string(ui.AuthProvider)))
+	}
+	out, err := graphconv.AuthIdentitiesToGQL(ids)
+	if err != nil {
+		return nil, gqlerr.Internal(ctx, "couldn't convert auth identities", zap.String("user_id", string(userID)), zap.Error(err))
+	}
+	return out, nil
+}
+
+func (m *mutationResolver) UnlinkAuthProvider(ctx context.Context, provider model.AuthProvider, providerUserID string) ([]*model.AuthIdentity, error) {
+	userID, err := m.userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := graphconv.AuthProviderFromGQL(provider)
+	if err != nil {
+		return nil, gqlerr.InvalidArgument(ctx, "invalid auth provider", zap.String("provider", string(provider)), zap.Error(err))
+	}
+	var ids []*todo.AuthIdentity
+	err = m.db.Transactional(ctx, func(tx db.Tx) error {
+		if err := m.db.UnlinkAuthIdentity(tx, userID, p, authn.UserID(providerUserID)); err != nil {
+			return fmt.Errorf("unlinking auth identity: %w", err)
+		}
+		if ids, err = m.db.AuthIdentities(tx, userID); err != nil {
+			return fmt.Errorf("reading auth identities: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, gqlErr(ctx, "couldn't unlink auth provider", err, zap.String("user_id", string(userID)), zap.String("auth_provider", string(p)))
+	}
+	// Sessions that used the identity already can't be used, as it no longer
+	// belongs to anyone, so failing to revoke them isn't worth failing over.
+	if m.auth.ManagesProvider(p) {
+		if err := m.auth.RevokeRefreshTokens(ctx, authn.UserID(providerUserID)); err != nil {
+			m.logger.Warn("couldn't revoke refresh tokens of unlinked identity", zap.String("user_id", string(userID)), zap.Error(err))
+		}
+	}
+	out, err := graphconv.AuthIdentitiesToGQL(ids)
+	if err != nil {
+		return nil, gqlerr.Internal(ctx, "couldn't convert auth identities", zap.String("user_id", string(userID)), zap.Error(err))
+	}
+	return out, nil
+}
@@ -2,10 +2,17 @@ package graph
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/Silicon-Ally/silicon-starter/authn"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/model"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 func TestSetUserName(t *testing.T) {
@@ -23,12 +30,12 @@ func testSetUserName(t *testing.T, r *Resolver, env *testEnv) {
 	name := "Inego Montoya"
 
 	anonCtx := context.Background()
-	_, err := r.Mutation().SetUserName(anonCtx, name)
+	_, err := r.Mutation().SetUserName(anonCtx, name, nil)
 	if err == nil {
 		t.Fatalf("expected an error when setting user name with anonymous context, but got none")
 	}
 
-	_, err = r.Mutation().SetUserName(ctx, name)
+	_, err = r.Mutation().SetUserName(ctx, name, nil)
 	if err != nil {
 		t.Fatalf("expected no error when setting user name with logged-in context, but got %v", err)
 	}
@@ -38,10 +45,295 @@ func testSetUserName(t *testing.T, r *Resolver, env *testEnv) {
 		t.Fatalf("reading me: %v", err)
 	}
 	expected := &model.User{
-		ID:   string(userID),
-		Name: name,
+		ID:      string(userID),
+		Name:    name,
+		Version: 2,
 	}
-	if diff := cmp.Diff(expected, actual); diff != "" {
+	if diff := cmp.Diff(expected, actual, userCmpOpts()); diff != "" {
 		t.Errorf("unexpected diff (-want +got):\n %s", diff)
 	}
 }
+
+func TestSetUserNameConflict(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	version := 1
+	_, err := r.Mutation().SetUserName(ctx, "First", &version)
+	noErrDuringSetup(t, err)
+
+	_, err = r.Mutation().SetUserName(ctx, "Second", &version)
+	var gqlErr *gqlerror.Error
+	if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "CONFLICT" {
+		t.Fatalf("expected a conflict error when setting user name at a stale version, but got %v", err)
+	}
+	expected := &model.User{
+		ID:      string(userID),
+		Name:    "First",
+		Version: 2,
+	}
+	if diff := cmp.Diff(expected, gqlErr.Extensions["current"], userCmpOpts()); diff != "" {
+		t.Errorf("unexpected current user (-want +got):\n %s", diff)
+	}
+}
+
+func TestUserPrivateFields(t *testing.T) {
+	r, env := setup(t)
+	userID, userCtx := createUserForTest(t, env)
+	_, otherCtx := createUserForTest(t, env)
+	adminID, adminCtx := createUserForTest(t, env)
+	err := env.db.UpdateUser(env.db.NoTxn(context.Background()), adminID, db.SetUserAdmin(true))
+	noErrDuringSetup(t, err)
+	user := &model.User{ID: string(userID)}
+
+	tests := []struct {
+		desc        string
+		ctx         context.Context
+		wantPrivate bool
+	}{
+		{"self", userCtx, true},
+		{"other user", otherCtx, false},
+		{"admin", adminCtx, true},
+		{"anonymous", context.Background(), false},
+	}
+	for _, test := range tests {
+		email, err := r.User().Email(test.ctx, user)
+		if err != nil {
+			t.Fatalf("%s: reading email: %v", test.desc, err)
+		}
+		provider, err := r.User().AuthProvider(test.ctx, user)
+		if err != nil {
+			t.Fatalf("%s: reading auth provider: %v", test.desc, err)
+		}
+		ids, err := r.User().AuthIdentities(test.ctx, user)
+		if err != nil {
+			t.Fatalf("%s: reading auth identities: %v", test.desc, err)
+		}
+		if !test.wantPrivate {
+			if email != nil || provider != nil || ids != nil {
+				t.Errorf("%s: got email %v, auth provider %v and auth identities %v, want all null", test.desc, email, provider, ids)
+			}
+			continue
+		}
+		if len(ids) != 1 || ids[0].ProviderUserID != "user-1" {
+			t.Errorf("%s: got auth identities %v, want the one the user signed up with", test.desc, ids)
+		}
+		if email == nil || *email != "user@example.com" || provider == nil || *provider != model.AuthProviderEmailAndPass {
+			t.Errorf("%s: got email %v and auth provider %v, want %q and %q", test.desc, email, provider, "user@example.com", model.AuthProviderEmailAndPass)
+		}
+	}
+}
+
+func TestUserTaskCount(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	_, err0 := r.Mutation().CreateTask(ctx)
+	trashed, err1 := r.Mutation().CreateTask(ctx)
+	_, err2 := r.Mutation().DeleteTask(ctx, trashed)
+	noErrDuringSetup(t, err0, err1, err2)
+
+	n, err := r.User().TaskCount(ctx, &model.User{ID: string(userID)})
+	if err != nil {
+		t.Fatalf("counting tasks: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("got a task count of %d, want 1 as trashed tasks don't count", n)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	r, env := setup(t)
+	_, userCtx := createUserForTest(t, env)
+	adminID, adminCtx := createUserForTest(t, env)
+	tx := env.db.NoTxn(context.Background())
+	err0 := env.db.UpdateUser(tx, adminID, db.SetUserAdmin(true), db.SetUserName("Admin"))
+	noErrDuringSetup(t, err0)
+
+	if _, err := r.Query().Users(userCtx, nil, nil, nil); err == nil {
+		t.Error("expected an error when a non-admin lists users, but got none")
+	}
+
+	first := 1
+	conn, err := r.Query().Users(adminCtx, &first, nil, nil)
+	if err != nil {
+		t.Fatalf("listing users: %v", err)
+	}
+	if len(conn.Edges) != 1 || conn.Edges[0].Node.Name != "Admin" || !conn.PageInfo.HasNextPage {
+		t.Fatalf("unexpected first page %+v, want only the admin, who sorts first, and a next page", conn.Edges)
+	}
+	conn, err = r.Query().Users(adminCtx, &first, conn.PageInfo.EndCursor, nil)
+	if err != nil {
+		t.Fatalf("listing the second page of users: %v", err)
+	}
+	if len(conn.Edges) != 1 || conn.Edges[0].Node.Name != "User" || conn.PageInfo.HasNextPage {
+		t.Errorf("unexpected second page %+v, want only the other user and no next page", conn.Edges)
+	}
+
+	search := " admin "
+	conn, err = r.Query().Users(adminCtx, nil, nil, &search)
+	if err != nil {
+		t.Fatalf("searching users: %v", err)
+	}
+	var got []todo.UserID
+	for _, e := range conn.Edges {
+		got = append(got, todo.UserID(e.Node.ID))
+	}
+	if diff := cmp.Diff([]todo.UserID{adminID}, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("unexpected users for search %q (-want +got)\n%s", search, diff)
+	}
+}
+
+func TestDeleteMyAccount(t *testing.T) {
+	r, env := setup(t)
+	userID, ctx := createUserForTest(t, env)
+	_, err0 := r.Mutation().CreateTask(ctx)
+	err1 := env.db.LinkAuthIdentity(env.db.NoTxn(ctx), &todo.AuthIdentity{
+		UserID:         userID,
+		Provider:       authn.Google,
+		ProviderUserID: "google-user",
+		Email:          "user@example.com",
+	})
+	err2 := env.db.LinkAuthIdentity(env.db.NoTxn(ctx), &todo.AuthIdentity{
+		UserID:         userID,
+		Provider:       authn.Facebook,
+		ProviderUserID: "facebook-user",
+		Email:          "user@example.com",
+	})
+	err3 := env.db.LinkAuthIdentity(env.db.NoTxn(ctx), &todo.AuthIdentity{
+		UserID:         userID,
+		Provider:       authn.OIDC,
+		ProviderUserID: "oidc-user",
+		Email:          "user@example.com",
+	})
+	noErrDuringSetup(t, err0, err1, err2, err3)
+
+	// Failing to sign out of one identity doesn't stop the account from being
+	// deleted, or the other identities from being signed out.
+	env.auth.errs = map[authn.UserID]error{"google-user": errors.New("auth is down")}
+	if _, err := r.Mutation().DeleteMyAccount(ctx); err != nil {
+		t.Fatalf("deleting account: %v", err)
+	}
+	// The OIDC identity isn't managed by the auth system, so it's skipped.
+	if diff := cmp.Diff([]authn.UserID{"user-1", "facebook-user"}, env.auth.revoked); diff != "" {
+		t.Errorf("unexpected revoked sessions (-want +got)\n%s", diff)
+	}
+	if _, err := env.db.User(env.db.NoTxn(context.Background()), userID); !db.IsNotFound(err) {
+		t.Errorf("reading deleted user returned %v, want not found", err)
+	}
+}
+
+func TestAuthProviders(t *testing.T) {
+	r, env := setup(t)
+	testAuthProviders(t, r, env)
+}
+
+func TestAuthProvidersRealDB(t *testing.T) {
+	r, env := setup(t, withRealDB())
+	testAuthProviders(t, r, env)
+}
+
+func testAuthProviders(t *testing.T, r *Resolver, env *testEnv) {
+	now := time.Unix(123456789, 0)
+	r.now = func() time.Time { return now }
+	_, ctx := createUserForTest(t, env)
+	_, otherCtx := createUserForTest(t, env)
+	emptyID, _ := createUserForTest(t, env)
+	// The first user has a task, so their identities can't be moved to
+	// another user.
+	_, err := r.Mutation().CreateTask(ctx)
+	noErrDuringSetup(t, err)
+	env.auth.tokens = map[string]*authn.Token{
+		"empty": {
+			UserInfo: &authn.UserInfo{UserID: "user-3", Email: "user@example.com", AuthProvider: authn.EmailAndPass},
+			AuthTime: now.Add(-time.Minute),
+		},
+		"google": {
+			UserInfo: &authn.UserInfo{UserID: "google-user", Email: "user@example.com", EmailVerified: true, AuthProvider: authn.Google},
+			AuthTime: now.Add(-time.Minute),
+		},
+		"stale": {
+			UserInfo: &authn.UserInfo{UserID: "facebook-user", Email: "user@example.com", AuthProvider: authn.Facebook},
+			AuthTime: now.Add(-time.Hour),
+		},
+	}
+	type identity struct {
+		Provider model.AuthProvider
+		ID       string
+		Verified bool
+	}
+	identities := func(ids []*model.AuthIdentity) []identity {
+		var out []identity
+		for _, a := range ids {
+			out = append(out, identity{a.Provider, a.ProviderUserID, a.EmailVerified})
+		}
+		return out
+	}
+	ids, err := r.Mutation().LinkAuthProvider(ctx, "google")
+	if err != nil {
+		t.Fatalf("linking auth provider: %v", err)
+	}
+	want := []identity{
+		{model.AuthProviderEmailAndPass, "user-1", false},
+		{model.AuthProviderGoogle, "google-user", true},
+	}
+	if diff := cmp.Diff(want, identities(ids)); diff != "" {
+		t.Errorf("unexpected identities after linking (-want +got)\n%s", diff)
+	}
+
+	errOf := func(_ interface{}, err error) error { return err }
+	errTests := []struct {
+		desc         string
+		err          error
+		wantConflict bool
+	}{
+		{"unverified token", errOf(r.Mutation().LinkAuthProvider(ctx, "forged")), false},
+		{"stale token", errOf(r.Mutation().LinkAuthProvider(ctx, "stale")), false},
+		{"identity of another user with tasks", errOf(r.Mutation().LinkAuthProvider(otherCtx, "google")), true},
+		{"unlink another user's identity", errOf(r.Mutation().UnlinkAuthProvider(otherCtx, model.AuthProviderGoogle, "google-user")), false},
+		{"unlink only identity", errOf(r.Mutation().UnlinkAuthProvider(otherCtx, model.AuthProviderEmailAndPass, "user-2")), true},
+	}
+	for _, test := range errTests {
+		if test.err == nil {
+			t.Errorf("%s: expected an error, but got none", test.desc)
+			continue
+		}
+		var gqlErr *gqlerror.Error
+		isConflict := errors.As(test.err, &gqlErr) && gqlErr.Extensions["code"] == "CONFLICT"
+		if isConflict != test.wantConflict {
+			t.Errorf("%s: got error %v, want a conflict: %t", test.desc, test.err, test.wantConflict)
+		}
+	}
+
+	// An empty user's identity moves to the user linking it, and the empty
+	// user is deleted, as nobody can sign in to it any more.
+	ids, err = r.Mutation().LinkAuthProvider(otherCtx, "empty")
+	if err != nil {
+		t.Fatalf("linking an empty user's identity: %v", err)
+	}
+	wantOther := []identity{
+		{model.AuthProviderEmailAndPass, "user-2", false},
+		{model.AuthProviderEmailAndPass, "user-3", false},
+	}
+	if diff := cmp.Diff(wantOther, identities(ids)); diff != "" {
+		t.Errorf("unexpected identities after merging (-want +got)\n%s", diff)
+	}
+	if _, err := env.db.User(env.db.NoTxn(context.Background()), emptyID); !db.IsNotFound(err) {
+		t.Errorf("reading merged user returned %v, want not found", err)
+	}
+
+	ids, err = r.Mutation().UnlinkAuthProvider(ctx, model.AuthProviderEmailAndPass, "user-1")
+	if err != nil {
+		t.Fatalf("unlinking auth provider: %v", err)
+	}
+	if diff := cmp.Diff(want[1:], identities(ids)); diff != "" {
+		t.Errorf("unexpected identities after unlinking (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff([]authn.UserID{"user-1"}, env.auth.revoked); diff != "" {
+		t.Errorf("unexpected revoked sessions (-want +got)\n%s", diff)
+	}
+}
+
+// userCmpOpts ignores the creation time of users, which the tests don't
+// control.
+func userCmpOpts() cmp.Option {
+	return cmpopts.IgnoreFields(model.User{}, "CreatedAt")
+}
@@ -6,18 +6,28 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/Silicon-Ally/gqlerr"
 	"github.com/Silicon-Ally/silicon-starter/authn/fireauth"
+	"github.com/Silicon-Ally/silicon-starter/authn/oidcauth"
 	"github.com/Silicon-Ally/silicon-starter/authn/session"
+	"github.com/Silicon-Ally/silicon-starter/cmd/server/export"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/generated"
 	"github.com/Silicon-Ally/silicon-starter/cmd/server/graph"
 	"github.com/Silicon-Ally/silicon-starter/common/flagext"
 	"github.com/Silicon-Ally/silicon-starter/db/sqldb"
+	"github.com/Silicon-Ally/silicon-starter/secrets"
+	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/namsral/flag"
 	"github.com/rs/cors"
@@ -51,6 +61,14 @@ func run(args []string) error {
 
 		debug = fs.Bool("debug", false, "If true, enable the /playground endpoint for testing out GraphQL queries and CORS debugging.")
 
+		maxTxAttempts  = fs.Int("max_tx_attempts", 3, "How many times a database transaction is run when it fails because of a conflict with a concurrent transaction.")
+		trashRetention = fs.Duration("trash_retention", 30*24*time.Hour, "How long deleted tasks are kept in the trash before they're permanently purged.")
+
+		authProvider       = fs.String("auth_provider", "firebase", "Which auth system users sign in with. Options: 'firebase', 'oidc'.")
+		oidcIssuerURL      = fs.String("oidc_issuer_url", "", "The URL of the OpenID Connect issuer, e.g. https://accounts.google.com. Required when --auth_provider=oidc.")
+		oidcClientID       = fs.String("oidc_client_id", "", "The client ID the OpenID Connect issuer assigned to this app. Required when --auth_provider=oidc.")
+		oidcSessionKeyFile = fs.String("oidc_session_key_file", "", "If set, read the key that signs OpenID Connect session cookies from this file instead of the sops configuration. Can only be used when running locally.")
+
 		allowedCORSOrigins flagext.StringList
 	)
 	fs.Var(&minLogLevel, "min_log_level", "If set, retains logs at the given level and above. Options: 'debug', 'info', 'warn', 'error', 'dpanic', 'panic', 'fatal' - default warn.")
@@ -69,6 +87,9 @@ func run(args []string) error {
 	if *localDSN != "" && metadata.OnGCE() {
 		return errors.New("--local_dsn set outside of local environment")
 	}
+	if *oidcSessionKeyFile != "" && metadata.OnGCE() {
+		return errors.New("--oidc_session_key_file set outside of local environment")
+	}
 
 	var config zap.Config
 	if *debug {
@@ -121,38 +142,114 @@ func run(args []string) error {
 	if err := pgConn.Ping(ctx); err != nil {
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
-	db, err := sqldb.New(pgConn)
+	db, err := sqldb.New(pgConn,
+		sqldb.WithLogger(logger.With(zap.Namespace("sqldb"))),
+		sqldb.WithMaxTxAttempts(*maxTxAttempts))
 	if err != nil {
 		return fmt.Errorf("failed to init sqldb: %w", err)
 	}
 
-	logger.Info("Initializing Firebase Connection")
-	// Without option.WithQuotaProject(...), the service will authenticate using
-	// your default project, which may not have the
-	// identitytoolkit.googleapis.com service enabled.
-	firebaseApp, err := firebase.NewApp(
-		ctx,
-		&firebase.Config{ProjectID: *projectID},
-		option.WithQuotaProject(*projectID))
-	if err != nil {
-		return fmt.Errorf("failed to init Firebase client: %w", err)
+	// The change feed delivers task changes made by any server instance, so
+	// subscriptions work when we're running more than one.
+	changeFeed := sqldb.NewChangeFeed(pgConn, logger.With(zap.Namespace("change feed")))
+	go func() {
+		if err := changeFeed.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("change feed stopped", zap.Error(err))
+		}
+	}()
+
+	trashPurger := sqldb.NewTrashPurger(db, *trashRetention, time.Hour, logger.With(zap.Namespace("trash purger")))
+	go func() {
+		if err := trashPurger.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("trash purger stopped", zap.Error(err))
+		}
+	}()
+
+	var auth interface {
+		session.Auth
+		graph.Auth
 	}
-	firebaseAuth, err := firebaseApp.Auth(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to init Firebase auth client: %w", err)
+	switch *authProvider {
+	case "firebase":
+		logger.Info("Initializing Firebase Connection")
+		// Without option.WithQuotaProject(...), the service will authenticate using
+		// your default project, which may not have the
+		// identitytoolkit.googleapis.com service enabled.
+		firebaseApp, err := firebase.NewApp(
+			ctx,
+			&firebase.Config{ProjectID: *projectID},
+			option.WithQuotaProject(*projectID))
+		if err != nil {
+			return fmt.Errorf("failed to init Firebase client: %w", err)
+		}
+		firebaseAuth, err := firebaseApp.Auth(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to init Firebase auth client: %w", err)
+		}
+		auth = fireauth.New(firebaseAuth)
+	case "oidc":
+		logger.Info("Initializing OpenID Connect auth", zap.String("issuer_url", *oidcIssuerURL))
+		var sessionKey []byte
+		if *oidcSessionKeyFile != "" {
+			if sessionKey, err = os.ReadFile(*oidcSessionKeyFile); err != nil {
+				return fmt.Errorf("failed to read OIDC session key: %w", err)
+			}
+		} else {
+			logger.Info("Decrypting OIDC session key", zap.String("sops_path", *sopsConfigPath))
+			cfg, err := secrets.LoadTodoSecrets(*sopsConfigPath)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt configuration: %w", err)
+			}
+			if cfg.OIDCSessionKey == nil {
+				return errors.New("sops configuration has no 'oidc' session key")
+			}
+			sessionKey = cfg.OIDCSessionKey
+		}
+		if auth, err = oidcauth.New(ctx, &oidcauth.Config{
+			IssuerURL:  *oidcIssuerURL,
+			ClientID:   *oidcClientID,
+			SessionKey: sessionKey,
+			DB:         db,
+		}); err != nil {
+			return fmt.Errorf("failed to init OIDC auth client: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown --auth_provider %q", *authProvider)
 	}
 
 	logger.Info("Initializing GraphQL resolvers")
 	resolver, err := graph.NewResolver(&graph.ResolverConfig{
 		DB:     db,
+		PubSub: changeFeed,
+		Auth:   auth,
 		Logger: logger,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to init resolver: %w", err)
 	}
 
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: resolver}))
+	// This is equivalent to handler.NewDefaultServer, except that the websocket
+	// transport (used for subscriptions) checks origins against the same list
+	// we use for CORS, as browsers don't apply CORS to websockets.
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: resolver}))
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: websocketOriginChecker(allowedCORSOrigins),
+		},
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+	srv.SetQueryCache(lru.New(1000))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
 	srv.SetErrorPresenter(gqlerr.ErrorPresenter(logger))
+	// Batch the lookups made while resolving each operation.
+	srv.AroundOperations(resolver.LoadersMiddleware)
 
 	mux := http.NewServeMux()
 
@@ -166,14 +263,15 @@ func run(args []string) error {
 	}
 
 	sess := session.New(
-		fireauth.New(firebaseAuth),
+		auth,
 		db,
-		logger.With(zap.Namespace("firebase auth")),
+		logger.With(zap.Namespace("auth")),
 	)
 
 	mux.Handle("/api/graphql", srv)
 	mux.Handle("/api/sessionLogin", sess.LoginHandler())
 	mux.Handle("/api/sessionLogout", sess.LogoutHandler())
+	mux.Handle("/api/exportMyData", export.New(db, logger.With(zap.Namespace("export"))))
 
 	handler := sess.WithAuthorization(mux, "/api/sessionLogin")
 	handler = withCORS(handler, []string(allowedCORSOrigins), *debug, logger.With(zap.Namespace("cors")))
@@ -221,6 +319,31 @@ func withCORS(next http.Handler, allowedOrigins []string, debug bool, logger *za
 	return corsHandler.Handler(next)
 }
 
+// websocketOriginChecker allows websocket connections from the same origin as
+// the server, or from any of the given allowed origins.
+func websocketOriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			// Not a browser, so there's no ambient credential to worry about.
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, o := range allowedOrigins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // corsLogger is a thin shim around our zap-based logging to match the
 // cors.Logger interface.
 type corsLogger struct {
@@ -6,7 +6,9 @@ package db
 import (
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/Silicon-Ally/silicon-starter/errkind"
 	"github.com/Silicon-Ally/silicon-starter/todo"
 )
 
@@ -30,20 +32,101 @@ func (e *errNotFound) Is(target error) bool {
 	return ok
 }
 
+func (e *errNotFound) Kind() errkind.Kind {
+	return errkind.NotFound
+}
+
 func IsNotFound(err error) bool {
 	return errors.Is(err, &errNotFound{})
 }
 
+type errConflict struct {
+	// id is the ID of the entity that was written concurrently.
+	id string
+	// entityType is the type of the entity that the caller was writing.
+	entityType string
+}
+
+func (e *errConflict) Error() string {
+	return fmt.Sprintf("entity of type %q with ID %q was changed since it was read", e.entityType, e.id)
+}
+
+// Conflict returns an error for a write that was rejected because the entity
+// isn't at the version the writer expected.
+func Conflict[T ~string](id T, entityType string) error {
+	return &errConflict{id: string(id), entityType: entityType}
+}
+
+func (e *errConflict) Is(target error) bool {
+	_, ok := target.(*errConflict)
+	return ok
+}
+
+func (e *errConflict) Kind() errkind.Kind {
+	return errkind.Conflict
+}
+
+func IsConflict(err error) bool {
+	return errors.Is(err, &errConflict{})
+}
+
+// Tx is a database transaction, or a handle for running statements outside of
+// a transaction.
+//
+// Transactions nest: passing a transaction to RunOrContinueTransaction runs
+// the function inside it, and if the function fails, only the changes it made
+// are rolled back, leaving the outer transaction usable. In SQL databases this
+// is done with a SAVEPOINT. Nested changes that succeed are only committed
+// when the outer transaction is.
 type Tx interface {
 	Commit() error
 	Rollback() error
 }
 
+// IsolationLevel is how much a transaction is isolated from the effects of
+// concurrent transactions, see
+// https://www.postgresql.org/docs/current/transaction-iso.html
+type IsolationLevel string
+
+const (
+	ReadCommitted  = IsolationLevel("read committed")
+	RepeatableRead = IsolationLevel("repeatable read")
+	Serializable   = IsolationLevel("serializable")
+)
+
+// TxOptions configures a transaction. The zero value runs a read-write
+// transaction at the database's default isolation level.
+type TxOptions struct {
+	// Isolation is the isolation level of the transaction, or the database's
+	// default if empty.
+	Isolation IsolationLevel
+	ReadOnly  bool
+	// MaxAttempts is the most times a transaction is run when it fails because
+	// of a conflict with a concurrent transaction, like a serialization failure
+	// or a deadlock. Zero uses the database's default.
+	MaxAttempts int
+}
+
 type UpdateUserFn func(*todo.User) error
 
+// ExpectUserVersion fails the update with a conflict error if the user isn't
+// at the given version, i.e. it was changed since the caller read it.
+func ExpectUserVersion(version int) UpdateUserFn {
+	return func(u *todo.User) error {
+		if u.Version != version {
+			return Conflict(u.ID, "user")
+		}
+		return nil
+	}
+}
+
 func SetUserName(value string) UpdateUserFn {
 	return func(u *todo.User) error {
-		u.Name = value
+		name, err := todo.UserNameRule.Apply(value)
+		if err != nil {
+			return err
+		}
+		u.Name = name
 		return nil
 	}
 }
@@ -55,32 +138,143 @@ func SetUserEmail(value string) UpdateUserFn {
 	}
 }
 
+// SetUserAdmin grants or revokes admin access. Nothing in the app calls it, it's
+// for tests and operational tooling.
+func SetUserAdmin(admin bool) UpdateUserFn {
+	return func(u *todo.User) error {
+		u.Admin = admin
+		return nil
+	}
+}
+
 type UpdateTaskFn func(*todo.Task) error
 
+// ExpectTaskVersion fails the update with a conflict error if the task isn't
+// at the given version, i.e. it was changed since the caller read it.
+func ExpectTaskVersion(version int) UpdateTaskFn {
+	return func(t *todo.Task) error {
+		if t.Version != version {
+			return Conflict(t.ID, "task")
+		}
+		return nil
+	}
+}
+
 func SetTaskName(value string) UpdateTaskFn {
 	return func(t *todo.Task) error {
-		t.Name = value
+		name, err := todo.TaskNameRule.Apply(value)
+		if err != nil {
+			return err
+		}
+		t.Name = name
 		return nil
 	}
 }
 
 func SetTaskBody(value string) UpdateTaskFn {
 	return func(t *todo.Task) error {
-		t.Body = value
+		body, err := todo.TaskBodyRule.Apply(value)
+		if err != nil {
+			return err
+		}
+		t.Body = body
+		return nil
+	}
+}
+
+// SetTaskCompleted marks the task as completed at the given time, or as not
+// completed. Completing an already completed task keeps the original
+// completion time.
+func SetTaskCompleted(completed bool, at time.Time) UpdateTaskFn {
+	return func(t *todo.Task) error {
+		switch {
+		case !completed:
+			t.CompletedAt = time.Time{}
+		case t.CompletedAt.IsZero():
+			if at.IsZero() {
+				return errkind.New(errkind.InvalidArgument, "a completion time must be given when completing a task")
+			}
+			t.CompletedAt = at
+		}
+		return nil
+	}
+}
+
+// SetTaskDueAt sets the due date of the task, the zero value clears it.
+func SetTaskDueAt(value time.Time) UpdateTaskFn {
+	return func(t *todo.Task) error {
+		t.DueAt = value
+		return nil
+	}
+}
+
+// SetTaskList moves the task into the given list, the empty ID removes it from
+// any list.
+func SetTaskList(value todo.ListID) UpdateTaskFn {
+	return func(t *todo.Task) error {
+		t.ListID = value
 		return nil
 	}
 }
 
 func AddTaskTag(value string) UpdateTaskFn {
 	return func(tsk *todo.Task) error {
-		tsk.Tags = tsk.Tags.Add(value)
+		tag, err := todo.TagRule.Apply(value)
+		if err != nil {
+			return err
+		}
+		tsk.Tags = tsk.Tags.Add(tag)
 		return nil
 	}
 }
 
+// RemoveTaskTag removes the tag from the task. The tag is normalized like in
+// AddTaskTag, but isn't validated, so that tags added before a rule changed
+// can still be removed.
 func RemoveTaskTag(value string) UpdateTaskFn {
 	return func(p *todo.Task) error {
-		p.Tags = p.Tags.Remove(value)
+		p.Tags = p.Tags.Remove(todo.TagRule.Normalize(value))
+		return nil
+	}
+}
+
+type UpdateListFn func(*todo.List) error
+
+func SetListName(value string) UpdateListFn {
+	return func(l *todo.List) error {
+		name, err := todo.ListNameRule.Apply(value)
+		if err != nil {
+			return err
+		}
+		l.Name = name
+		return nil
+	}
+}
+
+// SetListArchived archives the list at the given time, or unarchives it.
+// Archiving an already archived list keeps the original archive time.
+func SetListArchived(archived bool, at time.Time) UpdateListFn {
+	return func(l *todo.List) error {
+		switch {
+		case !archived:
+			l.ArchivedAt = time.Time{}
+		case l.ArchivedAt.IsZero():
+			if at.IsZero() {
+				return errkind.New(errkind.InvalidArgument, "an archive time must be given when archiving a list")
+			}
+			l.ArchivedAt = at
+		}
 		return nil
 	}
 }
+
+// ListTaskDisposition is what happens to the tasks in a list when it's
+// deleted.
+type ListTaskDisposition string
+
+const (
+	// DeleteListTasks deletes the tasks along with the list.
+	DeleteListTasks = ListTaskDisposition("DELETE_TASKS")
+	// MoveListTasks moves the tasks to another list, or out of any list.
+	MoveListTasks = ListTaskDisposition("MOVE_TASKS")
+)
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+type TaskSortField string
+
+const (
+	TaskSortByCreatedAt = TaskSortField("CREATED_AT")
+	TaskSortByName      = TaskSortField("NAME")
+	TaskSortByDueAt     = TaskSortField("DUE_AT")
+)
+
+type TaskSort struct {
+	Field      TaskSortField
+	Descending bool
+}
+
+// TaskFilter restricts which tasks are returned from a listing. The zero value
+// matches every task.
+type TaskFilter struct {
+	// Tag, if set, only matches tasks that have the given tag.
+	Tag string
+	// ListID, if set, only matches tasks in the given list.
+	ListID todo.ListID
+	// Completed, if set, only matches tasks whose completion state matches.
+	Completed *bool
+	// CreatedAfter, if set, only matches tasks created at or after the given
+	// time.
+	CreatedAfter time.Time
+	// CreatedBefore, if set, only matches tasks created before the given time.
+	CreatedBefore time.Time
+}
+
+// TaskQuery describes a filtered, sorted page of tasks. Tasks are always
+// sorted by ID after the sort field, so that the ordering is total.
+type TaskQuery struct {
+	Filter TaskFilter
+	Sort   TaskSort
+	// Limit is the maximum number of tasks to return, zero means no limit.
+	Limit int
+	// After, if set, returns tasks that come after the task with this cursor.
+	After Cursor
+}
+
+func (q *TaskQuery) Validate() error {
+	switch q.Sort.Field {
+	case TaskSortByCreatedAt, TaskSortByName, TaskSortByDueAt:
+	default:
+		return errkind.Errorf(errkind.InvalidArgument, "unknown task sort field %q", q.Sort.Field)
+	}
+	if q.Limit < 0 {
+		return errkind.Errorf(errkind.InvalidArgument, "limit must be non-negative, was %d", q.Limit)
+	}
+	return nil
+}
+
+// DefaultTaskQuery returns every task, oldest first.
+func DefaultTaskQuery() *TaskQuery {
+	return &TaskQuery{
+		Sort: TaskSort{Field: TaskSortByCreatedAt},
+	}
+}
+
+type TaskPage struct {
+	Tasks       []*todo.Task
+	HasNextPage bool
+}
+
+// Cursor is an opaque pointer to a position in a sorted listing. Callers
+// shouldn't inspect or construct cursors, they should only pass back ones that
+// were returned from TaskCursor.
+type Cursor string
+
+// TaskCursorKey is the decoded form of a task Cursor, it's exported so that
+// each DB implementation can use it to resume a listing.
+type TaskCursorKey struct {
+	Field TaskSortField `json:"f"`
+	ID    todo.TaskID   `json:"id"`
+	Name  string        `json:"n,omitempty"`
+	// Time is the value of the sort field for time-based sorts, the zero value
+	// represents a NULL value (e.g. no due date), which sorts after all other
+	// values.
+	Time time.Time `json:"t"`
+}
+
+// TaskCursorKeyFor returns the sort key of the given task in a listing sorted
+// by the given field.
+func TaskCursorKeyFor(t *todo.Task, field TaskSortField) *TaskCursorKey {
+	k := &TaskCursorKey{Field: field, ID: t.ID}
+	switch field {
+	case TaskSortByName:
+		k.Name = t.Name
+	case TaskSortByCreatedAt:
+		k.Time = t.CreatedAt
+	case TaskSortByDueAt:
+		k.Time = t.DueAt
+	}
+	return k
+}
+
+// Compare returns -1, 0 or 1 depending on whether k sorts before, equal to or
+// after other in ascending order. Names are compared byte-wise.
+func (k *TaskCursorKey) Compare(other *TaskCursorKey) int {
+	switch k.Field {
+	case TaskSortByName:
+		if c := strings.Compare(k.Name, other.Name); c != 0 {
+			return c
+		}
+	case TaskSortByCreatedAt, TaskSortByDueAt:
+		if c := compareNullableTimes(k.Time, other.Time); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(string(k.ID), string(other.ID))
+}
+
+func compareNullableTimes(a, b time.Time) int {
+	switch {
+	case a.IsZero() && b.IsZero():
+		return 0
+	case a.IsZero():
+		return 1
+	case b.IsZero():
+		return -1
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// TaskCursor returns a cursor pointing at the given task in a listing sorted by
+// the given field.
+func TaskCursor(t *todo.Task, field TaskSortField) Cursor {
+	// Marshaling a struct of strings and times can't fail.
+	buf, _ := json.Marshal(TaskCursorKeyFor(t, field))
+	return Cursor(base64.RawURLEncoding.EncodeToString(buf))
+}
+
+// DecodeTaskCursor parses a cursor returned from TaskCursor, validating that
+// it was created for the given sort field.
+func DecodeTaskCursor(c Cursor, field TaskSortField) (*TaskCursorKey, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor: %w", err)
+	}
+	var k TaskCursorKey
+	if err := json.Unmarshal(buf, &k); err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor contents: %w", err)
+	}
+	if k.Field != field {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "cursor was for sort field %q, but listing is sorted by %q", k.Field, field)
+	}
+	if k.ID == "" {
+		return nil, errkind.New(errkind.InvalidArgument, "cursor had no ID")
+	}
+	return &k, nil
+}
+
+// TaskEventQuery describes a page of a task's history, which is always sorted
+// newest first.
+type TaskEventQuery struct {
+	// Limit is the maximum number of events to return, zero means no limit.
+	Limit int
+	// After, if set, returns events that come after the event with this cursor.
+	After Cursor
+}
+
+func (q *TaskEventQuery) Validate() error {
+	if q.Limit < 0 {
+		return errkind.Errorf(errkind.InvalidArgument, "limit must be non-negative, was %d", q.Limit)
+	}
+	return nil
+}
+
+type TaskEventPage struct {
+	Events      []*todo.TaskEvent
+	HasNextPage bool
+}
+
+// TaskEventCursorKey is the decoded form of a task event Cursor.
+type TaskEventCursorKey struct {
+	ID        todo.TaskEventID `json:"id"`
+	CreatedAt time.Time        `json:"t"`
+}
+
+// Before reports whether k sorts before other, i.e. whether k is newer.
+func (k *TaskEventCursorKey) Before(other *TaskEventCursorKey) bool {
+	if !k.CreatedAt.Equal(other.CreatedAt) {
+		return k.CreatedAt.After(other.CreatedAt)
+	}
+	return k.ID > other.ID
+}
+
+func TaskEventCursorKeyFor(e *todo.TaskEvent) *TaskEventCursorKey {
+	return &TaskEventCursorKey{ID: e.ID, CreatedAt: e.CreatedAt}
+}
+
+// TaskEventCursor returns a cursor pointing at the given event in a task's
+// history.
+func TaskEventCursor(e *todo.TaskEvent) Cursor {
+	// Marshaling a struct of strings and times can't fail.
+	buf, _ := json.Marshal(TaskEventCursorKeyFor(e))
+	return Cursor(base64.RawURLEncoding.EncodeToString(buf))
+}
+
+// DecodeTaskEventCursor parses a cursor returned from TaskEventCursor.
+func DecodeTaskEventCursor(c Cursor) (*TaskEventCursorKey, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor: %w", err)
+	}
+	var k TaskEventCursorKey
+	if err := json.Unmarshal(buf, &k); err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor contents: %w", err)
+	}
+	if k.ID == "" || k.CreatedAt.IsZero() {
+		return nil, errkind.New(errkind.InvalidArgument, "cursor had no ID or time")
+	}
+	return &k, nil
+}
+
+// UserQuery describes a page of users, which is always sorted by name, then by
+// ID.
+type UserQuery struct {
+	// Search, if set, only matches users whose name or email contains it,
+	// ignoring case.
+	Search string
+	// Limit is the maximum number of users to return, zero means no limit.
+	Limit int
+	// After, if set, returns users that come after the user with this cursor.
+	After Cursor
+}
+
+func (q *UserQuery) Validate() error {
+	if q.Limit < 0 {
+		return errkind.Errorf(errkind.InvalidArgument, "limit must be non-negative, was %d", q.Limit)
+	}
+	return nil
+}
+
+type UserPage struct {
+	Users       []*todo.User
+	HasNextPage bool
+}
+
+// UserCursorKey is the decoded form of a user Cursor.
+type UserCursorKey struct {
+	Name string      `json:"n"`
+	ID   todo.UserID `json:"id"`
+}
+
+// Before reports whether k sorts before other. Names are compared byte-wise.
+func (k *UserCursorKey) Before(other *UserCursorKey) bool {
+	if k.Name != other.Name {
+		return k.Name < other.Name
+	}
+	return k.ID < other.ID
+}
+
+func UserCursorKeyFor(u *todo.User) *UserCursorKey {
+	return &UserCursorKey{Name: u.Name, ID: u.ID}
+}
+
+// UserCursor returns a cursor pointing at the given user in a listing of users.
+func UserCursor(u *todo.User) Cursor {
+	// Marshaling a struct of strings can't fail.
+	buf, _ := json.Marshal(UserCursorKeyFor(u))
+	return Cursor(base64.RawURLEncoding.EncodeToString(buf))
+}
+
+// DecodeUserCursor parses a cursor returned from UserCursor.
+func DecodeUserCursor(c Cursor) (*UserCursorKey, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor: %w", err)
+	}
+	var k UserCursorKey
+	if err := json.Unmarshal(buf, &k); err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor contents: %w", err)
+	}
+	if k.ID == "" {
+		return nil, errkind.New(errkind.InvalidArgument, "cursor had no ID")
+	}
+	return &k, nil
+}
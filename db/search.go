@@ -0,0 +1,111 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+// TaskSearchQuery describes a page of the results of a full-text search over
+// the names and bodies of tasks. Results are sorted by how well they match,
+// best first.
+//
+// Text uses the syntax of web search engines: every word has to match, words in
+// "quotes" have to match as a phrase, "or" between words allows either of them
+// to match, and a word with a leading "-" must not match. Words match other
+// forms of the same word, e.g. "walk" matches "walking", and common words like
+// "the" are ignored.
+type TaskSearchQuery struct {
+	Text string
+	// Tag, if set, only matches tasks that have the given tag.
+	Tag string
+	// Limit is the maximum number of results to return, zero means no limit.
+	Limit int
+	// After, if set, returns results that come after the result with this
+	// cursor.
+	After Cursor
+}
+
+func (q *TaskSearchQuery) Validate() error {
+	if strings.TrimSpace(q.Text) == "" {
+		return errkind.New(errkind.InvalidArgument, "search text must not be empty")
+	}
+	if q.Limit < 0 {
+		return errkind.Errorf(errkind.InvalidArgument, "limit must be non-negative, was %d", q.Limit)
+	}
+	return nil
+}
+
+// TaskSearchResult is a task that matched a search, along with the parts of it
+// that matched.
+type TaskSearchResult struct {
+	Task *todo.Task
+	// Rank is how well the task matched, higher is better. Ranks are only
+	// meaningful relative to other results of the same search.
+	Rank float32
+	// Name is the task's name with the matching words highlighted.
+	Name []TextSpan
+	// BodySnippet is the part of the task's body with the most matches, with
+	// the matching words highlighted, or the start of the body if it doesn't
+	// match.
+	BodySnippet []TextSpan
+}
+
+// TextSpan is a piece of highlighted text, concatenating the text of a list of
+// spans gives the original text.
+type TextSpan struct {
+	Text string
+	// Match is whether the text matched the search.
+	Match bool
+}
+
+type TaskSearchPage struct {
+	Results     []*TaskSearchResult
+	HasNextPage bool
+}
+
+// TaskSearchCursorKey is the decoded form of a search result Cursor.
+type TaskSearchCursorKey struct {
+	Rank float32     `json:"r"`
+	ID   todo.TaskID `json:"id"`
+}
+
+// Before reports whether k sorts before other, i.e. whether it has a higher
+// rank, using the ID to break ties.
+func (k *TaskSearchCursorKey) Before(other *TaskSearchCursorKey) bool {
+	if k.Rank != other.Rank {
+		return k.Rank > other.Rank
+	}
+	return k.ID < other.ID
+}
+
+func TaskSearchCursorKeyFor(r *TaskSearchResult) *TaskSearchCursorKey {
+	return &TaskSearchCursorKey{Rank: r.Rank, ID: r.Task.ID}
+}
+
+// TaskSearchCursor returns a cursor pointing at the given result in the results
+// of a search.
+func TaskSearchCursor(r *TaskSearchResult) Cursor {
+	// Marshaling a struct of a string and a float can't fail.
+	buf, _ := json.Marshal(TaskSearchCursorKeyFor(r))
+	return Cursor(base64.RawURLEncoding.EncodeToString(buf))
+}
+
+// DecodeTaskSearchCursor parses a cursor returned from TaskSearchCursor.
+func DecodeTaskSearchCursor(c Cursor) (*TaskSearchCursorKey, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor: %w", err)
+	}
+	var k TaskSearchCursorKey
+	if err := json.Unmarshal(buf, &k); err != nil {
+		return nil, errkind.Errorf(errkind.InvalidArgument, "malformed cursor contents: %w", err)
+	}
+	if k.ID == "" {
+		return nil, errkind.New(errkind.InvalidArgument, "cursor had no ID")
+	}
+	return &k, nil
+}
@@ -0,0 +1,206 @@
+package sqldb
+
+import (
+	"fmt"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/jackc/pgx/v4"
+)
+
+// AuthIdentities returns the ways the user can sign in, oldest first.
+func (d *DB) AuthIdentities(tx db.Tx, userID todo.UserID) ([]*todo.AuthIdentity, error) {
+	rows, err := d.query(tx, `
+		SELECT
+			user_id, provider, provider_user_id, email, email_verified, created_at
+		FROM auth_identity
+		WHERE user_id = $1
+		ORDER BY created_at, provider, provider_user_id;
+		`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying auth identities: %w", err)
+	}
+	ids, err := rowsToAuthIdentities(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading auth identities: %w", err)
+	}
+	return ids, nil
+}
+
+// LinkAuthIdentity lets the identity's user sign in with it. Linking an
+// identity the user already has updates its email. Linking an identity that
+// belongs to another user moves it if that user has nothing to lose, i.e. no
+// tasks, lists or tasks shared with them, and deletes them if it was their
+// only identity. Otherwise, it's a conflict.
+func (d *DB) LinkAuthIdentity(tx db.Tx, a *todo.AuthIdentity) error {
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		var ownerID todo.UserID
+		err := d.queryRow(tx, `
+			SELECT user_id FROM auth_identity
+			WHERE provider = $1 AND provider_user_id = $2
+			FOR UPDATE;
+			`, a.Provider, a.ProviderUserID).Scan(&ownerID)
+		// An identity that isn't linked yet has no user.
+		if err := ifNoRows(err, nil, "reading auth_identity row"); err != nil {
+			return err
+		}
+		if ownerID != "" && ownerID != a.UserID {
+			if err := d.mergeAwayUser(tx, ownerID, a); err != nil {
+				return err
+			}
+		}
+		if err := d.exec(tx, `
+			INSERT INTO auth_identity
+				(provider, provider_user_id, user_id, email, email_verified)
+				VALUES
+				($1, $2, $3, $4, $5)
+			ON CONFLICT (provider, provider_user_id) DO UPDATE SET
+				user_id = EXCLUDED.user_id,
+				email = EXCLUDED.email,
+				email_verified = EXCLUDED.email_verified;
+			`, a.Provider, a.ProviderUserID, a.UserID, a.Email, a.EmailVerified); err != nil {
+			return fmt.Errorf("writing auth_identity row: %w", err)
+		}
+		if ownerID == "" || ownerID == a.UserID {
+			return nil
+		}
+		var remaining int
+		if err := d.queryRow(tx, `SELECT COUNT(*) FROM auth_identity WHERE user_id = $1;`, ownerID).Scan(&remaining); err != nil {
+			return fmt.Errorf("counting remaining identities: %w", err)
+		}
+		if remaining > 0 {
+			return nil
+		}
+		// Nobody can sign in to the user any more, and they had nothing to keep.
+		if err := d.DeleteUser(tx, ownerID); err != nil {
+			return fmt.Errorf("deleting merged user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("running link auth identity txn: %w", err)
+	}
+	return nil
+}
+
+// mergeAwayUser checks that the identity's current user can give it up, i.e.
+// that they have no data that linking would strand.
+func (d *DB) mergeAwayUser(tx db.Tx, ownerID todo.UserID, a *todo.AuthIdentity) error {
+	// Locking the user stops them from creating tasks or lists while the
+	// identity is moved, as those take a key share lock on the user row.
+	var n int
+	err := d.queryRow(tx, `SELECT 1 FROM user_account WHERE id = $1 FOR UPDATE;`, ownerID).Scan(&n)
+	if err := ifNoRows(err, db.NotFound(ownerID, "user"), "locking user"); err != nil {
+		return err
+	}
+	var hasData bool
+	if err := d.queryRow(tx, `
+		SELECT
+			EXISTS (SELECT 1 FROM task WHERE created_by = $1) OR
+			EXISTS (SELECT 1 FROM list WHERE created_by = $1) OR
+			EXISTS (SELECT 1 FROM task_collaborator WHERE user_id = $1);
+		`, ownerID).Scan(&hasData); err != nil {
+		return fmt.Errorf("checking for user's data: %w", err)
+	}
+	if hasData {
+		return errkind.New(errkind.Conflict, fmt.Sprintf("%s identity %q is linked to another user who has tasks or lists", a.Provider, a.ProviderUserID))
+	}
+	return nil
+}
+
+// UnlinkAuthIdentity stops the user from signing in with the given identity.
+// A user's last identity can't be unlinked, as they'd have no way to sign in.
+func (d *DB) UnlinkAuthIdentity(tx db.Tx, userID todo.UserID, provider authn.Provider, providerUserID authn.UserID) error {
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		// Locking the user stops concurrent unlinks from each leaving the other
+		// as the last identity.
+		var n int
+		err := d.queryRow(tx, `SELECT 1 FROM user_account WHERE id = $1 FOR UPDATE;`, userID).Scan(&n)
+		if err := ifNoRows(err, db.NotFound(userID, "user"), "locking user"); err != nil {
+			return err
+		}
+		ids, err := d.AuthIdentities(tx, userID)
+		if err != nil {
+			return fmt.Errorf("reading auth identities: %w", err)
+		}
+		found := false
+		for _, a := range ids {
+			if a.Provider == provider && a.ProviderUserID == providerUserID {
+				found = true
+			}
+		}
+		if !found {
+			return db.NotFound(string(provider)+":"+string(providerUserID), "auth identity")
+		}
+		if len(ids) == 1 {
+			return errkind.New(errkind.Conflict, "the only way a user can sign in can't be unlinked")
+		}
+		if err := d.exec(tx, `
+			DELETE FROM auth_identity
+			WHERE provider = $1 AND provider_user_id = $2;
+			`, provider, providerUserID); err != nil {
+			return fmt.Errorf("deleting auth_identity row: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("running unlink auth identity txn: %w", err)
+	}
+	return nil
+}
+
+// UsersByVerifiedEmail returns the users with an identity whose provider
+// verified that it has the given email, ignoring case.
+func (d *DB) UsersByVerifiedEmail(tx db.Tx, email string) ([]*todo.User, error) {
+	rows, err := d.query(tx, `
+		SELECT
+			id, name, email, created_at, auth_provider_type, auth_provider_id, is_admin, version
+		FROM user_account
+		WHERE id IN (
+			SELECT user_id FROM auth_identity
+			WHERE lower(email) = lower($1) AND email_verified
+		)
+		ORDER BY created_at, id;
+		`, email)
+	if err != nil {
+		return nil, fmt.Errorf("querying users by email: %w", err)
+	}
+	users, err := rowsToUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading users: %w", err)
+	}
+	return users, nil
+}
+
+func rowToAuthIdentity(s rowScanner) (*todo.AuthIdentity, error) {
+	a := &todo.AuthIdentity{}
+	err := s.Scan(
+		&a.UserID,
+		&a.Provider,
+		&a.ProviderUserID,
+		&a.Email,
+		&a.EmailVerified,
+		&a.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("scanning into auth identity: %w", err)
+	}
+	return a, nil
+}
+
+func rowsToAuthIdentities(rows pgx.Rows) ([]*todo.AuthIdentity, error) {
+	defer rows.Close()
+	var as []*todo.AuthIdentity
+	for rows.Next() {
+		a, err := rowToAuthIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("converting row to auth identity: %w", err)
+		}
+		as = append(as, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing auth identity rows: %w", err)
+	}
+	return as, nil
+}
@@ -0,0 +1,253 @@
+package sqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// changeFeedChannel is the Postgres notification channel that the
+// notify_row_change trigger sends to, see migration 0006.
+const changeFeedChannel = "row_changes"
+
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+
+	// changeBufferSize is the number of changes that can be queued for a
+	// subscriber before further changes are dropped.
+	changeBufferSize = 64
+)
+
+type ChangeOp string
+
+const (
+	ChangeInsert = ChangeOp("INSERT")
+	ChangeUpdate = ChangeOp("UPDATE")
+	ChangeDelete = ChangeOp("DELETE")
+)
+
+type TaskChange struct {
+	Op        ChangeOp
+	TaskID    todo.TaskID
+	CreatedBy todo.UserID
+	// Trashed is true if the task is in the trash after the change, moving a
+	// task to the trash is an update rather than a delete.
+	Trashed bool
+}
+
+type UserChange struct {
+	Op     ChangeOp
+	UserID todo.UserID
+}
+
+// ChangeFeed listens for changes to task and user_account rows, from any
+// process connected to the database, and fans them out to subscribers.
+// Changes are only delivered once the transaction that made them commits.
+//
+// Run must be called for any changes to be delivered.
+type ChangeFeed struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+
+	tasks *subscribers[*TaskChange]
+	users *subscribers[*UserChange]
+
+	// afterListen, if set, is called each time the feed (re)starts listening.
+	// Stubbed out in tests to avoid racing against the initial LISTEN.
+	afterListen func()
+}
+
+func NewChangeFeed(pool *pgxpool.Pool, logger *zap.Logger) *ChangeFeed {
+	return &ChangeFeed{
+		pool:   pool,
+		logger: logger,
+		tasks:  newSubscribers[*TaskChange](),
+		users:  newSubscribers[*UserChange](),
+	}
+}
+
+// Run listens for changes until the context is done, reconnecting with
+// exponential backoff whenever the connection is lost. It always returns a
+// non-nil error, which is ctx.Err() on a clean shutdown.
+func (f *ChangeFeed) Run(ctx context.Context) error {
+	delay := minReconnectDelay
+	for {
+		err := f.listen(ctx, func() { delay = minReconnectDelay })
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		f.logger.Warn("change feed lost its connection, reconnecting", zap.Duration("delay", delay), zap.Error(err))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (f *ChangeFeed) listen(ctx context.Context, onListen func()) error {
+	pc, err := f.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	// The connection is dedicated to listening, so we take it out of the pool
+	// rather than returning it with an active LISTEN.
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+changeFeedChannel); err != nil {
+		return fmt.Errorf("listening on channel %q: %w", changeFeedChannel, err)
+	}
+	onListen()
+	if f.afterListen != nil {
+		f.afterListen()
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("waiting for notification: %w", err)
+		}
+		if err := f.dispatch(n.Payload); err != nil {
+			f.logger.Error("failed to dispatch change", zap.String("payload", n.Payload), zap.Error(err))
+		}
+	}
+}
+
+// changePayload mirrors the JSON built by the notify_row_change trigger.
+type changePayload struct {
+	Table     string   `json:"table"`
+	Op        ChangeOp `json:"op"`
+	ID        string   `json:"id"`
+	CreatedBy string   `json:"created_by"`
+	Trashed   bool     `json:"trashed"`
+}
+
+func (f *ChangeFeed) dispatch(payload string) error {
+	var p changePayload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return fmt.Errorf("unmarshaling payload: %w", err)
+	}
+	switch p.Table {
+	case "task":
+		f.tasks.send(&TaskChange{
+			Op:        p.Op,
+			TaskID:    todo.TaskID(p.ID),
+			CreatedBy: todo.UserID(p.CreatedBy),
+			Trashed:   p.Trashed,
+		})
+	case "user_account":
+		f.users.send(&UserChange{
+			Op:     p.Op,
+			UserID: todo.UserID(p.ID),
+		})
+	default:
+		return fmt.Errorf("unknown table %q", p.Table)
+	}
+	return nil
+}
+
+// SubscribeToTasks returns a channel that receives every change to a task. The
+// channel is closed once the context is done.
+func (f *ChangeFeed) SubscribeToTasks(ctx context.Context) <-chan *TaskChange {
+	return f.tasks.add(ctx)
+}
+
+// SubscribeToUsers returns a channel that receives every change to a user. The
+// channel is closed once the context is done.
+func (f *ChangeFeed) SubscribeToUsers(ctx context.Context) <-chan *UserChange {
+	return f.users.add(ctx)
+}
+
+// PublishTaskEvent is a no-op, as task events are published by database
+// triggers when the change is committed. It exists so that a ChangeFeed can be
+// used in place of an in-process pubsub.
+func (f *ChangeFeed) PublishTaskEvent(context.Context, *pubsub.TaskEvent) error {
+	return nil
+}
+
+// SubscribeToTaskEvents returns a channel that receives events for tasks
+// created by the given user. The channel is closed once the context is done.
+func (f *ChangeFeed) SubscribeToTaskEvents(ctx context.Context, userID todo.UserID) (<-chan *pubsub.TaskEvent, error) {
+	changes := f.SubscribeToTasks(ctx)
+	out := make(chan *pubsub.TaskEvent, changeBufferSize)
+	go func() {
+		defer close(out)
+		for c := range changes {
+			if c.CreatedBy != userID {
+				continue
+			}
+			e := &pubsub.TaskEvent{TaskID: c.TaskID, UserID: c.CreatedBy}
+			switch c.Op {
+			case ChangeInsert:
+				e.Kind = pubsub.TaskCreated
+			case ChangeUpdate:
+				e.Kind = pubsub.TaskUpdated
+				if c.Trashed {
+					e.Kind = pubsub.TaskDeleted
+				}
+			case ChangeDelete:
+				e.Kind = pubsub.TaskDeleted
+			default:
+				f.logger.Error("unknown change op", zap.String("op", string(c.Op)))
+				continue
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+type subscribers[T any] struct {
+	mu  sync.Mutex
+	chs map[chan T]struct{}
+}
+
+func newSubscribers[T any]() *subscribers[T] {
+	return &subscribers[T]{chs: make(map[chan T]struct{})}
+}
+
+func (s *subscribers[T]) add(ctx context.Context) <-chan T {
+	ch := make(chan T, changeBufferSize)
+	s.mu.Lock()
+	s.chs[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.chs, ch)
+		close(ch)
+	}()
+	return ch
+}
+
+// send delivers the value to every subscriber without blocking, dropping it
+// for subscribers that aren't keeping up.
+func (s *subscribers[T]) send(v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.chs {
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package sqldb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/pubsub"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestChangeFeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tdb, feed, listening := createChangeFeedForTesting(t)
+	tasks := feed.SubscribeToTasks(ctx)
+	users := feed.SubscribeToUsers(ctx)
+	waitForSignal(t, listening)
+
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskID, err1 := tdb.CreateTask(tx, userID)
+	err2 := tdb.UpdateTask(tx, taskID, db.SetTaskName("New Name"))
+	err3 := tdb.DeleteTask(tx, taskID)
+	err4 := tdb.PurgeTask(tx, taskID)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+	expectedTasks := []*TaskChange{
+		{Op: ChangeInsert, TaskID: taskID, CreatedBy: userID},
+		{Op: ChangeUpdate, TaskID: taskID, CreatedBy: userID},
+		{Op: ChangeUpdate, TaskID: taskID, CreatedBy: userID, Trashed: true},
+		{Op: ChangeDelete, TaskID: taskID, CreatedBy: userID, Trashed: true},
+	}
+	var actualTasks []*TaskChange
+	for range expectedTasks {
+		actualTasks = append(actualTasks, receiveFrom(t, tasks))
+	}
+	if diff := cmp.Diff(expectedTasks, actualTasks); diff != "" {
+		t.Errorf("unexpected task changes (-want +got)\n%s", diff)
+	}
+
+	expectedUser := &UserChange{Op: ChangeInsert, UserID: userID}
+	if diff := cmp.Diff(expectedUser, receiveFrom(t, users)); diff != "" {
+		t.Errorf("unexpected user change (-want +got)\n%s", diff)
+	}
+}
+
+func TestChangeFeedOnlyDeliversCommittedChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tdb, feed, listening := createChangeFeedForTesting(t)
+	users := feed.SubscribeToUsers(ctx)
+	waitForSignal(t, listening)
+
+	err := tdb.Transactional(ctx, func(tx db.Tx) error {
+		if _, err := tdb.CreateUser(tx, authn.EmailAndPass, "rolled-back@example.com", "Rolled Back", "rolled-back@example.com"); err != nil {
+			return err
+		}
+		return errors.New("roll it back")
+	})
+	if err == nil {
+		t.Fatal("expected transaction to fail, but it succeeded")
+	}
+	userID, err := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, "committed@example.com", "Committed", "committed@example.com")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	// Notifications are delivered in commit order, so if the rolled back user
+	// had been sent, we'd see it first.
+	expected := &UserChange{Op: ChangeInsert, UserID: userID}
+	if diff := cmp.Diff(expected, receiveFrom(t, users)); diff != "" {
+		t.Errorf("unexpected user change (-want +got)\n%s", diff)
+	}
+}
+
+func TestChangeFeedReconnects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tdb, feed, listening := createChangeFeedForTesting(t)
+	users := feed.SubscribeToUsers(ctx)
+	waitForSignal(t, listening)
+
+	// Kill the listening connection out from under the feed.
+	_, err := tdb.db.Exec(ctx, `
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE query = 'LISTEN `+changeFeedChannel+`';`)
+	if err != nil {
+		t.Fatalf("terminating listener: %v", err)
+	}
+	waitForSignal(t, listening)
+
+	userID, err := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, "user@example.com", "User's Name", "user@example.com")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	expected := &UserChange{Op: ChangeInsert, UserID: userID}
+	if diff := cmp.Diff(expected, receiveFrom(t, users)); diff != "" {
+		t.Errorf("unexpected user change (-want +got)\n%s", diff)
+	}
+}
+
+func TestChangeFeedTaskEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tdb, feed, listening := createChangeFeedForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	userIDA, err0 := tdb.CreateUser(tx, authn.EmailAndPass, "a@example.com", "User A", "a@example.com")
+	userIDB, err1 := tdb.CreateUser(tx, authn.EmailAndPass, "b@example.com", "User B", "b@example.com")
+	noErrDuringSetup(t, err0, err1)
+	events, err := feed.SubscribeToTaskEvents(ctx, userIDA)
+	if err != nil {
+		t.Fatalf("subscribing to task events: %v", err)
+	}
+	waitForSignal(t, listening)
+
+	_, err0 = tdb.CreateTask(tx, userIDB)
+	taskID, err1 := tdb.CreateTask(tx, userIDA)
+	noErrDuringSetup(t, err0, err1)
+
+	expected := &pubsub.TaskEvent{Kind: pubsub.TaskCreated, TaskID: taskID, UserID: userIDA}
+	if diff := cmp.Diff(expected, receiveFrom(t, events)); diff != "" {
+		t.Errorf("unexpected task event (-want +got)\n%s", diff)
+	}
+}
+
+func TestDispatchChange(t *testing.T) {
+	feed := NewChangeFeed(nil, zaptest.NewLogger(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tasks := feed.SubscribeToTasks(ctx)
+	users := feed.SubscribeToUsers(ctx)
+
+	err0 := feed.dispatch(`{"table": "task", "op": "UPDATE", "id": "task.1", "created_by": "user.1", "trashed": true}`)
+	err1 := feed.dispatch(`{"table": "user_account", "op": "DELETE", "id": "user.1", "created_by": null}`)
+	noErrDuringSetup(t, err0, err1)
+
+	if diff := cmp.Diff(&TaskChange{Op: ChangeUpdate, TaskID: "task.1", CreatedBy: "user.1", Trashed: true}, receiveFrom(t, tasks)); diff != "" {
+		t.Errorf("unexpected task change (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(&UserChange{Op: ChangeDelete, UserID: "user.1"}, receiveFrom(t, users)); diff != "" {
+		t.Errorf("unexpected user change (-want +got)\n%s", diff)
+	}
+
+	if err := feed.dispatch(`{"table": "unknown", "op": "INSERT", "id": "1"}`); err == nil {
+		t.Error("expected an error for an unknown table, but got none")
+	}
+	if err := feed.dispatch(`not json`); err == nil {
+		t.Error("expected an error for a malformed payload, but got none")
+	}
+}
+
+// createChangeFeedForTesting returns a DB and a running change feed on the
+// same database, along with a channel that's signaled each time the feed
+// starts listening.
+func createChangeFeedForTesting(t *testing.T) (*DB, *ChangeFeed, <-chan struct{}) {
+	pool := env.GetMigratedDB(context.Background(), t)
+	tdb := createDBForTestingWithSQL(t, pool)
+
+	listening := make(chan struct{}, 1)
+	feed := NewChangeFeed(pool, zaptest.NewLogger(t))
+	feed.afterListen = func() {
+		select {
+		case listening <- struct{}{}:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		feed.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return tdb, feed, listening
+}
+
+func waitForSignal(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the change feed to start listening")
+	}
+}
+
+func receiveFrom[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatal("channel was closed before receiving a change")
+		}
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for a change")
+	}
+	var zero T
+	return zero
+}
@@ -8,7 +8,44 @@
 CREATE TYPE auth_provider AS ENUM (
     'GOOGLE',
     'FACEBOOK',
-    'EMAIL_AND_PASS');
+    'EMAIL_AND_PASS',
+    'OIDC');
+
+
+CREATE TYPE task_event_kind AS ENUM (
+    'CREATED',
+    'UPDATED',
+    'DELETED');
+
+
+CREATE TYPE task_role AS ENUM (
+    'VIEWER',
+    'EDITOR',
+    'OWNER');
+
+
+CREATE TABLE auth_identity (
+	created_at timestamp with time zone DEFAULT now() NOT NULL,
+	email text NOT NULL,
+	email_verified boolean DEFAULT false NOT NULL,
+	provider auth_provider NOT NULL,
+	provider_user_id text NOT NULL,
+	user_id text NOT NULL);
+ALTER TABLE ONLY auth_identity ADD CONSTRAINT auth_identity_pkey PRIMARY KEY (provider, provider_user_id);
+ALTER TABLE ONLY auth_identity ADD CONSTRAINT auth_identity_user_id_fkey FOREIGN KEY (user_id) REFERENCES user_account(id) ON DELETE CASCADE;
+CREATE INDEX auth_identity_email_idx ON auth_identity USING btree (lower(email)) WHERE email_verified;
+CREATE INDEX auth_identity_user_id_idx ON auth_identity USING btree (user_id);
+
+
+CREATE TABLE list (
+	archived_at timestamp with time zone,
+	created_at timestamp with time zone DEFAULT now() NOT NULL,
+	created_by text NOT NULL,
+	id text NOT NULL,
+	name text NOT NULL);
+ALTER TABLE ONLY list ADD CONSTRAINT list_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY list ADD CONSTRAINT list_created_by_fkey FOREIGN KEY (created_by) REFERENCES user_account(id);
+CREATE INDEX list_created_by_idx ON list USING btree (created_by);
 
 
 CREATE TABLE schema_migrations_history (
@@ -19,14 +56,74 @@ ALTER TABLE ONLY schema_migrations_history ADD CONSTRAINT schema_migrations_hist
 ALTER SEQUENCE schema_migrations_history_id_seq OWNED BY schema_migrations_history.id;
 
 
+CREATE TABLE session_revocation (
+	provider auth_provider NOT NULL,
+	provider_user_id text NOT NULL,
+	revoked_at timestamp with time zone NOT NULL);
+ALTER TABLE ONLY session_revocation ADD CONSTRAINT session_revocation_pkey PRIMARY KEY (provider, provider_user_id);
+
+
 CREATE TABLE task (
 	body text NOT NULL,
+	completed_at timestamp with time zone,
+	created_at timestamp with time zone DEFAULT now() NOT NULL,
 	created_by text NOT NULL,
+	deleted_at timestamp with time zone,
+	due_at timestamp with time zone,
 	id text NOT NULL,
+	list_id text,
 	name text NOT NULL,
-	tags text NOT NULL);
+	parent_id text,
+	search_vector tsvector GENERATED ALWAYS AS ((setweight(to_tsvector('english'::regconfig, name), 'A'::"char") || setweight(to_tsvector('english'::regconfig, body), 'B'::"char"))) STORED,
+	updated_at timestamp with time zone DEFAULT now() NOT NULL,
+	version integer DEFAULT 1 NOT NULL);
 ALTER TABLE ONLY task ADD CONSTRAINT task_pkey PRIMARY KEY (id);
 ALTER TABLE ONLY task ADD CONSTRAINT task_created_by_fkey FOREIGN KEY (created_by) REFERENCES user_account(id);
+ALTER TABLE ONLY task ADD CONSTRAINT task_list_id_fkey FOREIGN KEY (list_id) REFERENCES list(id);
+ALTER TABLE ONLY task ADD CONSTRAINT task_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES task(id) ON DELETE SET NULL;
+CREATE INDEX task_deleted_at_idx ON task USING btree (deleted_at) WHERE (deleted_at IS NOT NULL);
+CREATE INDEX task_list_id_idx ON task USING btree (list_id);
+CREATE INDEX task_parent_id_idx ON task USING btree (parent_id);
+CREATE INDEX task_search_vector_idx ON task USING gin (search_vector);
+
+
+CREATE TABLE task_collaborator (
+	role task_role NOT NULL,
+	task_id text NOT NULL,
+	user_id text NOT NULL);
+ALTER TABLE ONLY task_collaborator ADD CONSTRAINT task_collaborator_pkey PRIMARY KEY (task_id, user_id);
+ALTER TABLE ONLY task_collaborator ADD CONSTRAINT task_collaborator_task_id_fkey FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE;
+ALTER TABLE ONLY task_collaborator ADD CONSTRAINT task_collaborator_user_id_fkey FOREIGN KEY (user_id) REFERENCES user_account(id);
+CREATE INDEX task_collaborator_user_id_idx ON task_collaborator USING btree (user_id);
+
+
+CREATE TABLE task_dependency (
+	blocked_by_id text NOT NULL,
+	task_id text NOT NULL);
+ALTER TABLE ONLY task_dependency ADD CONSTRAINT task_dependency_pkey PRIMARY KEY (task_id, blocked_by_id);
+ALTER TABLE ONLY task_dependency ADD CONSTRAINT task_dependency_blocked_by_id_fkey FOREIGN KEY (blocked_by_id) REFERENCES task(id) ON DELETE CASCADE;
+ALTER TABLE ONLY task_dependency ADD CONSTRAINT task_dependency_task_id_fkey FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE;
+CREATE INDEX task_dependency_blocked_by_id_idx ON task_dependency USING btree (blocked_by_id);
+
+
+CREATE TABLE task_event (
+	actor_id text,
+	changes jsonb NOT NULL,
+	created_at timestamp with time zone DEFAULT now() NOT NULL,
+	id text NOT NULL,
+	kind task_event_kind NOT NULL,
+	task_id text NOT NULL);
+ALTER TABLE ONLY task_event ADD CONSTRAINT task_event_pkey PRIMARY KEY (id);
+CREATE INDEX task_event_task_id_idx ON task_event USING btree (task_id, created_at DESC, id DESC);
+
+
+CREATE TABLE task_tag (
+	sort_order integer NOT NULL,
+	tag text NOT NULL,
+	task_id text NOT NULL);
+ALTER TABLE ONLY task_tag ADD CONSTRAINT task_tag_pkey PRIMARY KEY (task_id, tag);
+ALTER TABLE ONLY task_tag ADD CONSTRAINT task_tag_task_id_fkey FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE;
+CREATE INDEX task_tag_tag_idx ON task_tag USING btree (tag);
 
 
 CREATE TABLE user_account (
@@ -35,6 +132,8 @@ CREATE TABLE user_account (
 	created_at timestamp with time zone DEFAULT now() NOT NULL,
 	email text NOT NULL,
 	id text NOT NULL,
-	name text NOT NULL);
+	is_admin boolean DEFAULT false NOT NULL,
+	name text NOT NULL,
+	version integer DEFAULT 1 NOT NULL);
 ALTER TABLE ONLY user_account ADD CONSTRAINT user_account_pkey PRIMARY KEY (id);
 CREATE INDEX account_auth_provider_id_idx ON user_account USING btree (auth_provider_id);
\ No newline at end of file
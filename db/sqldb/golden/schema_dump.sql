@@ -23,12 +23,67 @@ SET row_security = off;
 CREATE TYPE public.auth_provider AS ENUM (
     'GOOGLE',
     'FACEBOOK',
-    'EMAIL_AND_PASS'
+    'EMAIL_AND_PASS',
+    'OIDC'
 );
 
 
 ALTER TYPE public.auth_provider OWNER TO postgres;
 
+--
+-- Name: task_event_kind; Type: TYPE; Schema: public; Owner: postgres
+--
+
+CREATE TYPE public.task_event_kind AS ENUM (
+    'CREATED',
+    'UPDATED',
+    'DELETED'
+);
+
+
+ALTER TYPE public.task_event_kind OWNER TO postgres;
+
+--
+-- Name: task_role; Type: TYPE; Schema: public; Owner: postgres
+--
+
+CREATE TYPE public.task_role AS ENUM (
+    'VIEWER',
+    'EDITOR',
+    'OWNER'
+);
+
+
+ALTER TYPE public.task_role OWNER TO postgres;
+
+--
+-- Name: notify_row_change(); Type: FUNCTION; Schema: public; Owner: postgres
+--
+
+CREATE FUNCTION public.notify_row_change() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE _row jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        _row := to_jsonb(OLD);
+    ELSE
+        _row := to_jsonb(NEW);
+    END IF;
+    PERFORM pg_notify('row_changes', json_build_object(
+        'table', TG_TABLE_NAME,
+        'op', TG_OP,
+        'id', _row->>'id',
+        'created_by', _row->>'created_by',
+        'trashed', _row->>'deleted_at' IS NOT NULL
+    )::text);
+    RETURN NULL;
+END;
+$$;
+
+
+ALTER FUNCTION public.notify_row_change() OWNER TO postgres;
+
 --
 -- Name: track_applied_migration(); Type: FUNCTION; Schema: public; Owner: postgres
 --
@@ -53,6 +108,37 @@ SET default_tablespace = '';
 
 SET default_table_access_method = heap;
 
+--
+-- Name: auth_identity; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.auth_identity (
+    provider public.auth_provider NOT NULL,
+    provider_user_id text NOT NULL,
+    user_id text NOT NULL,
+    email text NOT NULL,
+    email_verified boolean DEFAULT false NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.auth_identity OWNER TO postgres;
+
+--
+-- Name: list; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.list (
+    id text NOT NULL,
+    name text NOT NULL,
+    created_by text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    archived_at timestamp with time zone
+);
+
+
+ALTER TABLE public.list OWNER TO postgres;
+
 --
 -- Name: schema_migrations; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -100,6 +186,19 @@ ALTER TABLE public.schema_migrations_history_id_seq OWNER TO postgres;
 ALTER SEQUENCE public.schema_migrations_history_id_seq OWNED BY public.schema_migrations_history.id;
 
 
+--
+-- Name: session_revocation; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.session_revocation (
+    provider public.auth_provider NOT NULL,
+    provider_user_id text NOT NULL,
+    revoked_at timestamp with time zone NOT NULL
+);
+
+
+ALTER TABLE public.session_revocation OWNER TO postgres;
+
 --
 -- Name: task; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -108,13 +207,75 @@ CREATE TABLE public.task (
     id text NOT NULL,
     name text NOT NULL,
     body text NOT NULL,
-    tags text NOT NULL,
-    created_by text NOT NULL
+    created_by text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL,
+    completed_at timestamp with time zone,
+    due_at timestamp with time zone,
+    list_id text,
+    parent_id text,
+    deleted_at timestamp with time zone,
+    version integer DEFAULT 1 NOT NULL,
+    search_vector tsvector GENERATED ALWAYS AS ((setweight(to_tsvector('english'::regconfig, name), 'A'::"char") || setweight(to_tsvector('english'::regconfig, body), 'B'::"char"))) STORED
 );
 
 
 ALTER TABLE public.task OWNER TO postgres;
 
+--
+-- Name: task_collaborator; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.task_collaborator (
+    task_id text NOT NULL,
+    user_id text NOT NULL,
+    role public.task_role NOT NULL
+);
+
+
+ALTER TABLE public.task_collaborator OWNER TO postgres;
+
+--
+-- Name: task_dependency; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.task_dependency (
+    task_id text NOT NULL,
+    blocked_by_id text NOT NULL
+);
+
+
+ALTER TABLE public.task_dependency OWNER TO postgres;
+
+--
+-- Name: task_event; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.task_event (
+    id text NOT NULL,
+    task_id text NOT NULL,
+    actor_id text,
+    kind public.task_event_kind NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    changes jsonb NOT NULL
+);
+
+
+ALTER TABLE public.task_event OWNER TO postgres;
+
+--
+-- Name: task_tag; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.task_tag (
+    task_id text NOT NULL,
+    tag text NOT NULL,
+    sort_order integer NOT NULL
+);
+
+
+ALTER TABLE public.task_tag OWNER TO postgres;
+
 --
 -- Name: user_account; Type: TABLE; Schema: public; Owner: postgres
 --
@@ -125,7 +286,9 @@ CREATE TABLE public.user_account (
     email text NOT NULL,
     created_at timestamp with time zone DEFAULT now() NOT NULL,
     auth_provider_type public.auth_provider NOT NULL,
-    auth_provider_id text NOT NULL
+    auth_provider_id text NOT NULL,
+    version integer DEFAULT 1 NOT NULL,
+    is_admin boolean DEFAULT false NOT NULL
 );
 
 
@@ -138,6 +301,22 @@ ALTER TABLE public.user_account OWNER TO postgres;
 ALTER TABLE ONLY public.schema_migrations_history ALTER COLUMN id SET DEFAULT nextval('public.schema_migrations_history_id_seq'::regclass);
 
 
+--
+-- Name: auth_identity auth_identity_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.auth_identity
+    ADD CONSTRAINT auth_identity_pkey PRIMARY KEY (provider, provider_user_id);
+
+
+--
+-- Name: list list_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.list
+    ADD CONSTRAINT list_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: schema_migrations_history schema_migrations_history_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -154,6 +333,38 @@ ALTER TABLE ONLY public.schema_migrations
     ADD CONSTRAINT schema_migrations_pkey PRIMARY KEY (version);
 
 
+--
+-- Name: session_revocation session_revocation_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.session_revocation
+    ADD CONSTRAINT session_revocation_pkey PRIMARY KEY (provider, provider_user_id);
+
+
+--
+-- Name: task_collaborator task_collaborator_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_collaborator
+    ADD CONSTRAINT task_collaborator_pkey PRIMARY KEY (task_id, user_id);
+
+
+--
+-- Name: task_dependency task_dependency_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_dependency
+    ADD CONSTRAINT task_dependency_pkey PRIMARY KEY (task_id, blocked_by_id);
+
+
+--
+-- Name: task_event task_event_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_event
+    ADD CONSTRAINT task_event_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: task task_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -162,6 +373,14 @@ ALTER TABLE ONLY public.task
     ADD CONSTRAINT task_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: task_tag task_tag_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_tag
+    ADD CONSTRAINT task_tag_pkey PRIMARY KEY (task_id, tag);
+
+
 --
 -- Name: user_account user_account_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -177,6 +396,97 @@ ALTER TABLE ONLY public.user_account
 CREATE INDEX account_auth_provider_id_idx ON public.user_account USING btree (auth_provider_id);
 
 
+--
+-- Name: auth_identity_email_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX auth_identity_email_idx ON public.auth_identity USING btree (lower(email)) WHERE email_verified;
+
+
+--
+-- Name: auth_identity_user_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX auth_identity_user_id_idx ON public.auth_identity USING btree (user_id);
+
+
+--
+-- Name: list_created_by_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX list_created_by_idx ON public.list USING btree (created_by);
+
+
+--
+-- Name: task_collaborator_user_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_collaborator_user_id_idx ON public.task_collaborator USING btree (user_id);
+
+
+--
+-- Name: task_deleted_at_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_deleted_at_idx ON public.task USING btree (deleted_at) WHERE (deleted_at IS NOT NULL);
+
+
+--
+-- Name: task_dependency_blocked_by_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_dependency_blocked_by_id_idx ON public.task_dependency USING btree (blocked_by_id);
+
+
+--
+-- Name: task_event_task_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_event_task_id_idx ON public.task_event USING btree (task_id, created_at DESC, id DESC);
+
+
+--
+-- Name: task_list_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_list_id_idx ON public.task USING btree (list_id);
+
+
+--
+-- Name: task_parent_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_parent_id_idx ON public.task USING btree (parent_id);
+
+
+--
+-- Name: task_search_vector_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_search_vector_idx ON public.task USING gin (search_vector);
+
+
+--
+-- Name: task_tag_tag_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX task_tag_tag_idx ON public.task_tag USING btree (tag);
+
+
+--
+-- Name: task notify_task_change; Type: TRIGGER; Schema: public; Owner: postgres
+--
+
+CREATE TRIGGER notify_task_change AFTER INSERT OR DELETE OR UPDATE ON public.task FOR EACH ROW EXECUTE FUNCTION public.notify_row_change();
+
+
+--
+-- Name: user_account notify_user_account_change; Type: TRIGGER; Schema: public; Owner: postgres
+--
+
+CREATE TRIGGER notify_user_account_change AFTER INSERT OR DELETE OR UPDATE ON public.user_account FOR EACH ROW EXECUTE FUNCTION public.notify_row_change();
+
+
 --
 -- Name: schema_migrations track_applied_migrations; Type: TRIGGER; Schema: public; Owner: postgres
 --
@@ -184,6 +494,38 @@ CREATE INDEX account_auth_provider_id_idx ON public.user_account USING btree (au
 CREATE TRIGGER track_applied_migrations AFTER INSERT ON public.schema_migrations FOR EACH ROW EXECUTE FUNCTION public.track_applied_migration();
 
 
+--
+-- Name: auth_identity auth_identity_user_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.auth_identity
+    ADD CONSTRAINT auth_identity_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.user_account(id) ON DELETE CASCADE;
+
+
+--
+-- Name: list list_created_by_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.list
+    ADD CONSTRAINT list_created_by_fkey FOREIGN KEY (created_by) REFERENCES public.user_account(id);
+
+
+--
+-- Name: task_collaborator task_collaborator_task_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_collaborator
+    ADD CONSTRAINT task_collaborator_task_id_fkey FOREIGN KEY (task_id) REFERENCES public.task(id) ON DELETE CASCADE;
+
+
+--
+-- Name: task_collaborator task_collaborator_user_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_collaborator
+    ADD CONSTRAINT task_collaborator_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.user_account(id);
+
+
 --
 -- Name: task task_created_by_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
 --
@@ -192,6 +534,46 @@ ALTER TABLE ONLY public.task
     ADD CONSTRAINT task_created_by_fkey FOREIGN KEY (created_by) REFERENCES public.user_account(id);
 
 
+--
+-- Name: task_dependency task_dependency_blocked_by_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_dependency
+    ADD CONSTRAINT task_dependency_blocked_by_id_fkey FOREIGN KEY (blocked_by_id) REFERENCES public.task(id) ON DELETE CASCADE;
+
+
+--
+-- Name: task_dependency task_dependency_task_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_dependency
+    ADD CONSTRAINT task_dependency_task_id_fkey FOREIGN KEY (task_id) REFERENCES public.task(id) ON DELETE CASCADE;
+
+
+--
+-- Name: task task_list_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task
+    ADD CONSTRAINT task_list_id_fkey FOREIGN KEY (list_id) REFERENCES public.list(id);
+
+
+--
+-- Name: task task_parent_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task
+    ADD CONSTRAINT task_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES public.task(id) ON DELETE SET NULL;
+
+
+--
+-- Name: task_tag task_tag_task_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.task_tag
+    ADD CONSTRAINT task_tag_task_id_fkey FOREIGN KEY (task_id) REFERENCES public.task(id) ON DELETE CASCADE;
+
+
 --
 -- PostgreSQL database dump complete
 --
@@ -0,0 +1,225 @@
+package sqldb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+// taskLinksLockKey is the transaction-level advisory lock taken while changing
+// task parents or dependencies. Cycle detection reads the existing links before
+// writing a new one, so two concurrent changes could otherwise each pass
+// validation and together form a cycle.
+const taskLinksLockKey = int64(0x7461736b6c6e6b) // "tasklnk"
+
+func (d *DB) lockTaskLinks(tx db.Tx) error {
+	if err := d.exec(tx, "SELECT pg_advisory_xact_lock($1);", taskLinksLockKey); err != nil {
+		return fmt.Errorf("locking task links: %w", err)
+	}
+	return nil
+}
+
+// Subtasks returns the direct subtasks of the given task, oldest first.
+func (d *DB) Subtasks(tx db.Tx, parentID todo.TaskID) ([]*todo.Task, error) {
+	rows, err := d.query(tx, `
+		SELECT `+taskColumns+`
+		FROM task
+		WHERE parent_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at, id;
+		`, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("querying subtasks: %w", err)
+	}
+	tasks, err := rowsToTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading subtasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// SetTaskParent makes the task a subtask of parentID, or a top-level task if
+// parentID is empty. It returns an error wrapping todo.ErrTaskCycle if the
+// parent is the task itself or one of its subtasks.
+func (d *DB) SetTaskParent(tx db.Tx, taskID, parentID todo.TaskID) error {
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		if err := d.lockTaskLinks(tx); err != nil {
+			return err
+		}
+		task, err := d.Task(tx, taskID)
+		if err != nil {
+			return fmt.Errorf("reading task: %w", err)
+		}
+		if parentID != "" {
+			if _, err := d.Task(tx, parentID); err != nil {
+				return fmt.Errorf("reading parent: %w", err)
+			}
+		}
+		// Trashed tasks can be restored, so they're included when looking for
+		// cycles.
+		err = todo.ValidateParent(taskID, parentID, func(id todo.TaskID) (todo.TaskID, error) {
+			t, err := d.taskIncludingTrashed(tx, id)
+			if err != nil {
+				return "", err
+			}
+			return t.ParentID, nil
+		})
+		if err != nil {
+			return fmt.Errorf("validating parent: %w", err)
+		}
+		return d.updateTaskParent(tx, task, parentID)
+	})
+	if err != nil {
+		return fmt.Errorf("running set task parent txn: %w", err)
+	}
+	return nil
+}
+
+// updateTaskParent writes the new parent of the task and records the change,
+// without any validation.
+func (d *DB) updateTaskParent(tx db.Tx, task *todo.Task, parentID todo.TaskID) error {
+	after := task.Clone()
+	after.ParentID = parentID
+	after.UpdatedAt = time.Now()
+	var parent *todo.TaskID
+	if parentID != "" {
+		parent = &parentID
+	}
+	err := d.exec(tx, `
+		UPDATE task SET
+			parent_id = $2,
+			updated_at = $3,
+			version = version + 1
+		WHERE id = $1;
+		`, task.ID, parent, after.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("updating task parent: %w", err)
+	}
+	if err := d.recordTaskDiff(tx, task.ID, todo.TaskEventUpdated, task, after); err != nil {
+		return fmt.Errorf("recording task parent change: %w", err)
+	}
+	return nil
+}
+
+// BlockingTasks returns the tasks that the given task is blocked by, oldest
+// first.
+func (d *DB) BlockingTasks(tx db.Tx, taskID todo.TaskID) ([]*todo.Task, error) {
+	rows, err := d.query(tx, `
+		SELECT `+taskColumns+`
+		FROM task
+		WHERE id IN (SELECT blocked_by_id FROM task_dependency WHERE task_id = $1) AND deleted_at IS NULL
+		ORDER BY created_at, id;
+		`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("querying blocking tasks: %w", err)
+	}
+	tasks, err := rowsToTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading blocking tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// BlockedTasks returns the tasks that are blocked by the given task, oldest
+// first.
+func (d *DB) BlockedTasks(tx db.Tx, taskID todo.TaskID) ([]*todo.Task, error) {
+	rows, err := d.query(tx, `
+		SELECT `+taskColumns+`
+		FROM task
+		WHERE id IN (SELECT task_id FROM task_dependency WHERE blocked_by_id = $1) AND deleted_at IS NULL
+		ORDER BY created_at, id;
+		`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("querying blocked tasks: %w", err)
+	}
+	tasks, err := rowsToTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading blocked tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// AddTaskDependency records that the task is blocked by blockedByID, which is
+// a no-op if it already was. It returns an error wrapping todo.ErrTaskCycle if
+// blockedByID is the task itself, or is already blocked by it, and a not found
+// error if either task doesn't exist or is in the trash.
+func (d *DB) AddTaskDependency(tx db.Tx, taskID, blockedByID todo.TaskID) error {
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		if err := d.lockTaskLinks(tx); err != nil {
+			return err
+		}
+		if _, err := d.Task(tx, taskID); err != nil {
+			return fmt.Errorf("reading task: %w", err)
+		}
+		if _, err := d.Task(tx, blockedByID); err != nil {
+			return fmt.Errorf("reading blocking task: %w", err)
+		}
+		if err := todo.ValidateBlockedBy(taskID, blockedByID, func(id todo.TaskID) ([]todo.TaskID, error) {
+			return d.blockingTaskIDs(tx, id)
+		}); err != nil {
+			return fmt.Errorf("validating dependency: %w", err)
+		}
+		return d.changeBlockers(tx, taskID, func(tx db.Tx) error {
+			err := d.exec(tx, `
+				INSERT INTO task_dependency
+					(task_id, blocked_by_id)
+					VALUES
+					($1, $2)
+				ON CONFLICT DO NOTHING;
+				`, taskID, blockedByID)
+			if err != nil {
+				return fmt.Errorf("inserting task dependency: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("running add task dependency txn: %w", err)
+	}
+	return nil
+}
+
+// RemoveTaskDependency records that the task is no longer blocked by
+// blockedByID, returning a not found error if it wasn't.
+func (d *DB) RemoveTaskDependency(tx db.Tx, taskID, blockedByID todo.TaskID) error {
+	return d.changeBlockers(tx, taskID, func(tx db.Tx) error {
+		var removed todo.TaskID
+		err := d.queryRow(tx, `
+			DELETE FROM task_dependency
+			WHERE task_id = $1 AND blocked_by_id = $2
+			RETURNING task_id;
+			`, taskID, blockedByID).Scan(&removed)
+		return ifNoRows(err, db.NotFound(string(taskID)+":"+string(blockedByID), "task dependency"), "deleting task dependency")
+	})
+}
+
+// changeBlockers runs fn in a transaction, recording the resulting change to
+// the tasks blocking the task in its history.
+func (d *DB) changeBlockers(tx db.Tx, taskID todo.TaskID, fn func(tx db.Tx) error) error {
+	return d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		before, err := d.blockingTaskIDs(tx, taskID)
+		if err != nil {
+			return fmt.Errorf("reading blockers pre-change: %w", err)
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		after, err := d.blockingTaskIDs(tx, taskID)
+		if err != nil {
+			return fmt.Errorf("reading blockers post-change: %w", err)
+		}
+		changes, err := todo.DiffTaskBlockers(before, after)
+		if err != nil {
+			return fmt.Errorf("diffing blockers: %w", err)
+		}
+		if err := d.recordTaskEvent(tx, taskID, todo.TaskEventUpdated, changes); err != nil {
+			return fmt.Errorf("recording blocker change: %w", err)
+		}
+		return nil
+	})
+}
+
+func (d *DB) blockingTaskIDs(tx db.Tx, taskID todo.TaskID) ([]todo.TaskID, error) {
+	return d.taskIDs(tx, "SELECT blocked_by_id FROM task_dependency WHERE task_id = $1;", taskID)
+}
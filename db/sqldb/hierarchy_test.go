@@ -0,0 +1,118 @@
+package sqldb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetTaskParent(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	parentID, err1 := tdb.CreateTask(tx, userID)
+	childID, err2 := tdb.CreateTask(tx, userID)
+	grandchildID, err3 := tdb.CreateTask(tx, userID)
+	err4 := tdb.SetTaskParent(tx, childID, parentID)
+	err5 := tdb.SetTaskParent(tx, grandchildID, childID)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5)
+
+	child, err := tdb.Task(tx, childID)
+	if err != nil {
+		t.Fatalf("reading child: %v", err)
+	}
+	if child.ParentID != parentID {
+		t.Errorf("child had parent %q, want %q", child.ParentID, parentID)
+	}
+	subtasks, err := tdb.Subtasks(tx, parentID)
+	if err != nil {
+		t.Fatalf("reading subtasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{childID}, taskIDs(subtasks)); diff != "" {
+		t.Errorf("unexpected subtasks (-want +got)\n%s", diff)
+	}
+
+	if err := tdb.SetTaskParent(tx, parentID, grandchildID); !errors.Is(err, todo.ErrTaskCycle) {
+		t.Errorf("making a task a subtask of its grandchild returned %v, want a cycle error", err)
+	}
+	if err := tdb.SetTaskParent(tx, parentID, parentID); !errors.Is(err, todo.ErrTaskCycle) {
+		t.Errorf("making a task its own parent returned %v, want a cycle error", err)
+	}
+
+	// Purging a task promotes its subtasks.
+	err0 = tdb.DeleteTask(tx, childID)
+	err1 = tdb.PurgeTask(tx, childID)
+	noErrDuringSetup(t, err0, err1)
+	grandchild, err := tdb.Task(tx, grandchildID)
+	if err != nil {
+		t.Fatalf("reading grandchild: %v", err)
+	}
+	if grandchild.ParentID != "" {
+		t.Errorf("grandchild had parent %q after its parent was deleted, want none", grandchild.ParentID)
+	}
+}
+
+func TestTaskDependencies(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskA, err1 := tdb.CreateTask(tx, userID)
+	taskB, err2 := tdb.CreateTask(tx, userID)
+	taskC, err3 := tdb.CreateTask(tx, userID)
+	// A is blocked by B, which is blocked by C.
+	err4 := tdb.AddTaskDependency(tx, taskA, taskB)
+	err5 := tdb.AddTaskDependency(tx, taskB, taskC)
+	// Adding an existing dependency is a no-op.
+	err6 := tdb.AddTaskDependency(tx, taskA, taskB)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5, err6)
+
+	blocking, err := tdb.BlockingTasks(tx, taskA)
+	if err != nil {
+		t.Fatalf("reading blocking tasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{taskB}, taskIDs(blocking)); diff != "" {
+		t.Errorf("unexpected blocking tasks (-want +got)\n%s", diff)
+	}
+	blocked, err := tdb.BlockedTasks(tx, taskC)
+	if err != nil {
+		t.Fatalf("reading blocked tasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{taskB}, taskIDs(blocked)); diff != "" {
+		t.Errorf("unexpected blocked tasks (-want +got)\n%s", diff)
+	}
+
+	if err := tdb.AddTaskDependency(tx, taskC, taskA); !errors.Is(err, todo.ErrTaskCycle) {
+		t.Errorf("adding a cyclic dependency returned %v, want a cycle error", err)
+	}
+	if err := tdb.AddTaskDependency(tx, taskA, taskA); !errors.Is(err, todo.ErrTaskCycle) {
+		t.Errorf("blocking a task on itself returned %v, want a cycle error", err)
+	}
+
+	if err := tdb.RemoveTaskDependency(tx, taskB, taskC); err != nil {
+		t.Fatalf("removing dependency: %v", err)
+	}
+	if err := tdb.RemoveTaskDependency(tx, taskB, taskC); !db.IsNotFound(err) {
+		t.Errorf("removing a missing dependency returned %v, want not found", err)
+	}
+	// With B no longer blocked by C, C can now be blocked by A.
+	if err := tdb.AddTaskDependency(tx, taskC, taskA); err != nil {
+		t.Errorf("adding dependency after removing the cycle: %v", err)
+	}
+}
+
+func taskIDs(tasks []*todo.Task) []todo.TaskID {
+	var out []todo.TaskID
+	for _, t := range tasks {
+		out = append(out, t.ID)
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package sqldb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/jackc/pgx/v4"
+)
+
+const taskEventIDNamespace = "taskevent"
+
+// TaskHistory returns a page of the events recorded for the given task, newest
+// first. History is kept after a task is deleted, so this doesn't check that
+// the task exists.
+func (d *DB) TaskHistory(tx db.Tx, taskID todo.TaskID, q *db.TaskEventQuery) (*db.TaskEventPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid task event query: %w", err)
+	}
+	args := []interface{}{taskID}
+	where := "task_id = $1"
+	if q.After != "" {
+		k, err := db.DecodeTaskEventCursor(q.After)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		args = append(args, k.CreatedAt, k.ID)
+		where += " AND (created_at, id) < ($2, $3)"
+	}
+	limit := ""
+	if q.Limit > 0 {
+		// Fetch one extra row to find out if there's another page.
+		limit = fmt.Sprintf(" LIMIT %d", q.Limit+1)
+	}
+	rows, err := d.query(tx, `
+		SELECT id, task_id, actor_id, kind, created_at, changes
+		FROM task_event
+		WHERE `+where+`
+		ORDER BY created_at DESC, id DESC`+limit+`;`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying task events: %w", err)
+	}
+	events, err := rowsToTaskEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading task events: %w", err)
+	}
+	page := &db.TaskEventPage{Events: events}
+	if q.Limit > 0 && len(events) > q.Limit {
+		page.Events = events[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
+}
+
+// recordTaskDiff records an event with the differences between the two
+// versions of a task, see todo.DiffTasks.
+func (d *DB) recordTaskDiff(tx db.Tx, taskID todo.TaskID, kind todo.TaskEventKind, before, after *todo.Task) error {
+	changes, err := todo.DiffTasks(before, after)
+	if err != nil {
+		return fmt.Errorf("diffing task: %w", err)
+	}
+	return d.recordTaskEvent(tx, taskID, kind, changes)
+}
+
+// recordTaskEvent appends an event to the task's history, attributed to the
+// user in the transaction's context, if any. Updates that didn't change
+// anything aren't recorded.
+func (d *DB) recordTaskEvent(tx db.Tx, taskID todo.TaskID, kind todo.TaskEventKind, changes []*todo.TaskFieldChange) error {
+	if kind == todo.TaskEventUpdated && len(changes) == 0 {
+		return nil
+	}
+	if changes == nil {
+		changes = []*todo.TaskFieldChange{}
+	}
+	buf, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("marshaling changes: %w", err)
+	}
+	var actorID *todo.UserID
+	if id := actorFromTx(tx); id != "" {
+		actorID = &id
+	}
+	err = d.exec(tx, `
+		INSERT INTO task_event
+			(id, task_id, actor_id, kind, created_at, changes)
+			VALUES
+			($1, $2, $3, $4, $5, $6);
+		`, d.randomID(taskEventIDNamespace), taskID, actorID, kind, time.Now(), buf)
+	if err != nil {
+		return fmt.Errorf("inserting task event: %w", err)
+	}
+	return nil
+}
+
+// actorFromTx returns the user that the transaction is running on behalf of,
+// or the empty ID for anonymous or background work.
+func actorFromTx(tx db.Tx) todo.UserID {
+	c, ok := tx.(*ctxtx)
+	if !ok || c == nil || c.ctx == nil {
+		return ""
+	}
+	id, err := todo.UserIDFromContext(c.ctx)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+func rowToTaskEvent(s rowScanner) (*todo.TaskEvent, error) {
+	var (
+		e       todo.TaskEvent
+		actorID *todo.UserID
+		changes []byte
+	)
+	if err := s.Scan(&e.ID, &e.TaskID, &actorID, &e.Kind, &e.CreatedAt, &changes); err != nil {
+		return nil, fmt.Errorf("scanning into task event: %w", err)
+	}
+	if actorID != nil {
+		e.ActorID = *actorID
+	}
+	if err := json.Unmarshal(changes, &e.Changes); err != nil {
+		return nil, fmt.Errorf("unmarshaling changes: %w", err)
+	}
+	for _, c := range e.Changes {
+		c.Before = nullToNil(c.Before)
+		c.After = nullToNil(c.After)
+	}
+	return &e, nil
+}
+
+func rowsToTaskEvents(rows pgx.Rows) ([]*todo.TaskEvent, error) {
+	defer rows.Close()
+	var events []*todo.TaskEvent
+	for rows.Next() {
+		e, err := rowToTaskEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("converting row to task event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing task event rows: %w", err)
+	}
+	return events, nil
+}
+
+// nullToNil undoes the round trip of a nil json.RawMessage through JSON, which
+// decodes as a literal null.
+func nullToNil(m json.RawMessage) json.RawMessage {
+	if string(m) == "null" {
+		return nil
+	}
+	return m
+}
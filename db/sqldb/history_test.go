@@ -0,0 +1,134 @@
+package sqldb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestTaskHistory(t *testing.T) {
+	tdb := createDBForTesting(t)
+	email := "user@example.com"
+	userID, err := tdb.CreateUser(tdb.NoTxn(context.Background()), authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	noErrDuringSetup(t, err)
+
+	tx := tdb.NoTxn(todo.WithUserID(context.Background(), userID))
+	taskID, err0 := tdb.CreateTask(tx, userID)
+	err1 := tdb.UpdateTask(tx, taskID, db.SetTaskName("New Name"))
+	// An update that doesn't change anything isn't recorded.
+	err2 := tdb.UpdateTask(tx, taskID, db.SetTaskName("New Name"))
+	err3 := tdb.DeleteTask(tx, taskID)
+	err4 := tdb.PurgeTask(tx, taskID)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+	// History is kept after the task is purged.
+	page, err := tdb.TaskHistory(tx, taskID, &db.TaskEventQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("reading history: %v", err)
+	}
+	if !page.HasNextPage {
+		t.Error("expected a next page of history, but there wasn't one")
+	}
+	rest, err := tdb.TaskHistory(tx, taskID, &db.TaskEventQuery{After: db.TaskEventCursor(page.Events[1])})
+	if err != nil {
+		t.Fatalf("reading next page of history: %v", err)
+	}
+
+	raw := func(s string) json.RawMessage { return json.RawMessage(s) }
+	got := append(page.Events, rest.Events...)
+	// The time the task was trashed isn't known up front.
+	for _, e := range got {
+		for _, c := range e.Changes {
+			if c.Field == "deletedAt" {
+				c.Before, c.After = nil, nil
+			}
+		}
+	}
+	want := []*todo.TaskEvent{
+		{
+			TaskID:  taskID,
+			ActorID: userID,
+			Kind:    todo.TaskEventDeleted,
+			Changes: []*todo.TaskFieldChange{
+				{Field: "name", Before: raw(`"New Name"`)},
+				{Field: "body", Before: raw(`"New Task Body"`)},
+				{Field: "deletedAt"},
+			},
+		},
+		{
+			TaskID:  taskID,
+			ActorID: userID,
+			Kind:    todo.TaskEventDeleted,
+			Changes: []*todo.TaskFieldChange{{Field: "deletedAt"}},
+		},
+		{
+			TaskID:  taskID,
+			ActorID: userID,
+			Kind:    todo.TaskEventUpdated,
+			Changes: []*todo.TaskFieldChange{
+				{Field: "name", Before: raw(`"Unnamed Task"`), After: raw(`"New Name"`)},
+			},
+		},
+		{
+			TaskID:  taskID,
+			ActorID: userID,
+			Kind:    todo.TaskEventCreated,
+			Changes: []*todo.TaskFieldChange{
+				{Field: "name", After: raw(`"Unnamed Task"`)},
+				{Field: "body", After: raw(`"New Task Body"`)},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(todo.TaskEvent{}, "ID", "CreatedAt")); diff != "" {
+		t.Errorf("unexpected history (-want +got)\n%s", diff)
+	}
+}
+
+func TestTaskHistoryOfLinks(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskA, err1 := tdb.CreateTask(tx, userID)
+	taskB, err2 := tdb.CreateTask(tx, userID)
+	err3 := tdb.AddTaskDependency(tx, taskA, taskB)
+	err4 := tdb.SetTaskParent(tx, taskA, taskB)
+	err5 := tdb.DeleteTask(tx, taskB)
+	err6 := tdb.PurgeTask(tx, taskB)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5, err6)
+
+	page, err := tdb.TaskHistory(tx, taskA, &db.TaskEventQuery{})
+	if err != nil {
+		t.Fatalf("reading history: %v", err)
+	}
+	blockers := json.RawMessage(`["` + string(taskB) + `"]`)
+	parent := json.RawMessage(`"` + string(taskB) + `"`)
+	// Changes made outside of a user's context have no actor. Purging taskB
+	// promotes and then unblocks taskA, listed newest first.
+	want := [][]*todo.TaskFieldChange{
+		{{Field: "blockedBy", Before: blockers}},
+		{{Field: "parentId", Before: parent}},
+		{{Field: "parentId", After: parent}},
+		{{Field: "blockedBy", After: blockers}},
+	}
+	var got [][]*todo.TaskFieldChange
+	for _, e := range page.Events {
+		if e.Kind != todo.TaskEventUpdated {
+			continue
+		}
+		if e.ActorID != "" {
+			t.Errorf("event %q had actor %q, want none", e.ID, e.ActorID)
+		}
+		got = append(got, e.Changes)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected changes (-want +got)\n%s", diff)
+	}
+}
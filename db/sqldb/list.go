@@ -0,0 +1,221 @@
+package sqldb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/jackc/pgx/v4"
+)
+
+func (d *DB) List(tx db.Tx, id todo.ListID) (*todo.List, error) {
+	row := d.queryRow(tx, `
+		SELECT id, name, created_by, created_at, archived_at
+		FROM list
+		WHERE id = $1;
+		`, id)
+	list, err := rowToList(row)
+	if err := ifNoRows(err, db.NotFound(id, "list"), "reading list"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListsByCreator returns every list created by the given user, including
+// archived ones, oldest first.
+func (db *DB) ListsByCreator(tx db.Tx, creatorID todo.UserID) ([]*todo.List, error) {
+	rows, err := db.query(tx, `
+		SELECT id, name, created_by, created_at, archived_at
+		FROM list
+		WHERE created_by = $1
+		ORDER BY created_at, id;
+		`, creatorID)
+	if err != nil {
+		return nil, fmt.Errorf("querying lists: %w", err)
+	}
+	lists, err := rowsToLists(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading lists: %w", err)
+	}
+	return lists, nil
+}
+
+const listIDNamespace = "list"
+
+func (db *DB) CreateList(tx db.Tx, creatorID todo.UserID, name string) (todo.ListID, error) {
+	name, err := todo.ListNameRule.Apply(name)
+	if err != nil {
+		return "", err
+	}
+	id := todo.ListID(db.randomID(listIDNamespace))
+	err = db.exec(tx, `
+		INSERT INTO list
+			(id, name, created_by, created_at)
+			VALUES
+			($1, $2, $3, $4);
+		`, id, name, creatorID, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("creating list row: %w", err)
+	}
+	return id, nil
+}
+
+func (d *DB) UpdateList(
+	tx db.Tx,
+	listID todo.ListID,
+	listMutations ...db.UpdateListFn) error {
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		list, err := d.List(tx, listID)
+		if err != nil {
+			return fmt.Errorf("reading list pre-mutations: %w", err)
+		}
+		for i, m := range listMutations {
+			err := m(list)
+			if err != nil {
+				return fmt.Errorf("running mutation #%d: %w", i, err)
+			}
+		}
+		err = d.putList(tx, list)
+		if err != nil {
+			return fmt.Errorf("writing list post-mutations: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("running update list txn: %w", err)
+	}
+	return nil
+}
+
+// DeleteList deletes the list, and either deletes its tasks or moves them to
+// moveTo, as determined by disposition. An empty moveTo moves the tasks out of
+// any list.
+func (d *DB) DeleteList(tx db.Tx, listID todo.ListID, disposition db.ListTaskDisposition, moveTo todo.ListID) error {
+	switch disposition {
+	case db.DeleteListTasks:
+		if moveTo != "" {
+			return fmt.Errorf("can't move tasks to list %q when deleting them", moveTo)
+		}
+	case db.MoveListTasks:
+		if moveTo == listID {
+			return fmt.Errorf("can't move tasks to list %q while deleting it", moveTo)
+		}
+	default:
+		return fmt.Errorf("unknown list task disposition %q", disposition)
+	}
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		if _, err := d.List(tx, listID); err != nil {
+			return fmt.Errorf("reading list: %w", err)
+		}
+		if moveTo != "" {
+			if _, err := d.List(tx, moveTo); err != nil {
+				return fmt.Errorf("reading destination list: %w", err)
+			}
+		}
+		// Tasks are handled one at a time, so that each change is recorded in
+		// the task's history. Tasks that are already in the trash are moved
+		// out of the list too, as the list won't exist when they're restored.
+		tasks, err := d.TasksInList(tx, listID)
+		if err != nil {
+			return fmt.Errorf("reading tasks in list: %w", err)
+		}
+		for _, t := range tasks {
+			if disposition == db.DeleteListTasks {
+				if err := d.updateTask(tx, t.ID, todo.TaskEventUpdated, db.SetTaskList("")); err != nil {
+					return fmt.Errorf("removing task %q from list: %w", t.ID, err)
+				}
+				if !t.IsTrashed() {
+					if err := d.DeleteTask(tx, t.ID); err != nil {
+						return fmt.Errorf("deleting task %q in list: %w", t.ID, err)
+					}
+				}
+				continue
+			}
+			if err := d.updateTask(tx, t.ID, todo.TaskEventUpdated, db.SetTaskList(moveTo)); err != nil {
+				return fmt.Errorf("moving task %q out of list: %w", t.ID, err)
+			}
+		}
+		if err := d.exec(tx, "DELETE FROM list WHERE id = $1;", listID); err != nil {
+			return fmt.Errorf("deleting list: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("running delete list transaction: %w", err)
+	}
+	return nil
+}
+
+// TasksInList returns every task in the list, including trashed ones, oldest
+// first.
+func (d *DB) TasksInList(tx db.Tx, listID todo.ListID) ([]*todo.Task, error) {
+	rows, err := d.query(tx, `
+		SELECT `+taskColumns+`
+		FROM task
+		WHERE list_id = $1
+		ORDER BY created_at, id;
+		`, listID)
+	if err != nil {
+		return nil, fmt.Errorf("querying tasks: %w", err)
+	}
+	tasks, err := rowsToTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (db *DB) putList(tx db.Tx, list *todo.List) error {
+	err := db.exec(tx, `
+		UPDATE list SET
+			name = $2,
+			archived_at = $3
+		WHERE id = $1;
+		`, list.ID, list.Name, timeToNullable(list.ArchivedAt))
+	if err != nil {
+		return fmt.Errorf("updating list writable fields: %w", err)
+	}
+	return nil
+}
+
+// listIDToNullable converts the empty ID to NULL, for tasks that aren't in a
+// list.
+func listIDToNullable(id todo.ListID) *todo.ListID {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
+
+func rowToList(s rowScanner) (*todo.List, error) {
+	var archivedAt *time.Time
+	l := &todo.List{}
+	err := s.Scan(
+		&l.ID,
+		&l.Name,
+		&l.CreatedBy,
+		&l.CreatedAt,
+		&archivedAt)
+	if err != nil {
+		return nil, fmt.Errorf("scanning into list: %w", err)
+	}
+	l.ArchivedAt = timeFromNullable(archivedAt)
+	return l, nil
+}
+
+func rowsToLists(rows pgx.Rows) ([]*todo.List, error) {
+	defer rows.Close()
+	var ls []*todo.List
+	for rows.Next() {
+		l, err := rowToList(rows)
+		if err != nil {
+			return nil, fmt.Errorf("converting row to list: %w", err)
+		}
+		ls = append(ls, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing list rows: %w", err)
+	}
+	return ls, nil
+}
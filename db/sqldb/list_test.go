@@ -0,0 +1,185 @@
+package sqldb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCreateAndUpdateList(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	listID, err1 := tdb.CreateList(tx, userID, "Groceries")
+	noErrDuringSetup(t, err0, err1)
+
+	archivedAt := time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC)
+	err := tdb.UpdateList(tx, listID, db.SetListName("Errands"), db.SetListArchived(true, archivedAt))
+	if err != nil {
+		t.Fatalf("updating list: %v", err)
+	}
+
+	actual, err := tdb.List(tx, listID)
+	if err != nil {
+		t.Fatalf("getting list: %v", err)
+	}
+	expected := &todo.List{
+		ID:         listID,
+		Name:       "Errands",
+		CreatedBy:  userID,
+		ArchivedAt: archivedAt,
+	}
+	if diff := cmp.Diff(expected, actual, listCmpOpts()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+
+	if _, err := tdb.List(tx, "list.missing"); !db.IsNotFound(err) {
+		t.Errorf("getting missing list returned %v, want not found", err)
+	}
+}
+
+func TestListsByCreator(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	userA, err0 := tdb.CreateUser(tx, authn.EmailAndPass, "a@example.com", "User A", "a@example.com")
+	userB, err1 := tdb.CreateUser(tx, authn.EmailAndPass, "b@example.com", "User B", "b@example.com")
+	listA1, err2 := tdb.CreateList(tx, userA, "A1")
+	listA2, err3 := tdb.CreateList(tx, userA, "A2")
+	_, err4 := tdb.CreateList(tx, userB, "B")
+	noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+	actual, err := tdb.ListsByCreator(tx, userA)
+	if err != nil {
+		t.Fatalf("listing lists: %v", err)
+	}
+	expected := []*todo.List{
+		{ID: listA1, Name: "A1", CreatedBy: userA},
+		{ID: listA2, Name: "A2", CreatedBy: userA},
+	}
+	if diff := cmp.Diff(expected, actual, listCmpOpts()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
+func TestDeleteList(t *testing.T) {
+	tests := []struct {
+		desc        string
+		disposition db.ListTaskDisposition
+		moveToOther bool
+	}{
+		{desc: "deleting tasks", disposition: db.DeleteListTasks},
+		{desc: "moving tasks out of any list", disposition: db.MoveListTasks},
+		{desc: "moving tasks to another list", disposition: db.MoveListTasks, moveToOther: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ctx := context.Background()
+			tdb := createDBForTesting(t)
+			tx := tdb.NoTxn(ctx)
+			email := "user@example.com"
+			userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+			listID, err1 := tdb.CreateList(tx, userID, "Doomed")
+			otherListID, err2 := tdb.CreateList(tx, userID, "Other")
+			taskID, err3 := tdb.CreateTask(tx, userID)
+			err4 := tdb.UpdateTask(tx, taskID, db.SetTaskList(listID), db.AddTaskTag("tag"))
+			noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+			var moveTo todo.ListID
+			if test.moveToOther {
+				moveTo = otherListID
+			}
+			if err := tdb.DeleteList(tx, listID, test.disposition, moveTo); err != nil {
+				t.Fatalf("deleting list: %v", err)
+			}
+
+			if _, err := tdb.List(tx, listID); !db.IsNotFound(err) {
+				t.Errorf("getting deleted list returned %v, want not found", err)
+			}
+			page, err := tdb.TasksByCreator(tx, userID, nil)
+			if err != nil {
+				t.Fatalf("listing tasks: %v", err)
+			}
+			if test.disposition == db.DeleteListTasks {
+				if len(page.Tasks) != 0 {
+					t.Errorf("expected tasks to be deleted with the list, but got %d", len(page.Tasks))
+				}
+				return
+			}
+			var actual []todo.ListID
+			for _, task := range page.Tasks {
+				actual = append(actual, task.ListID)
+			}
+			if diff := cmp.Diff([]todo.ListID{moveTo}, actual); diff != "" {
+				t.Errorf("unexpected task lists (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeleteListInvalidArguments(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	listID, err1 := tdb.CreateList(tx, userID, "List")
+	otherListID, err2 := tdb.CreateList(tx, userID, "Other")
+	noErrDuringSetup(t, err0, err1, err2)
+
+	if err := tdb.DeleteList(tx, listID, db.MoveListTasks, listID); err == nil {
+		t.Error("expected an error moving tasks to the list being deleted, but got none")
+	}
+	if err := tdb.DeleteList(tx, listID, db.DeleteListTasks, otherListID); err == nil {
+		t.Error("expected an error when deleting tasks but also moving them, but got none")
+	}
+	if err := tdb.DeleteList(tx, listID, db.ListTaskDisposition("UNKNOWN"), ""); err == nil {
+		t.Error("expected an error for an unknown disposition, but got none")
+	}
+	if _, err := tdb.List(tx, listID); err != nil {
+		t.Errorf("list should still exist after failed deletes: %v", err)
+	}
+}
+
+func TestListTasksByList(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	listID, err1 := tdb.CreateList(tx, userID, "List")
+	taskA, err2 := tdb.CreateTask(tx, userID)
+	_, err3 := tdb.CreateTask(tx, userID)
+	err4 := tdb.UpdateTask(tx, taskA, db.SetTaskList(listID))
+	noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+	page, err := tdb.TasksByCreator(tx, userID, &db.TaskQuery{
+		Filter: db.TaskFilter{ListID: listID},
+		Sort:   db.TaskSort{Field: db.TaskSortByCreatedAt},
+	})
+	if err != nil {
+		t.Fatalf("listing tasks: %v", err)
+	}
+	var actual []todo.TaskID
+	for _, task := range page.Tasks {
+		actual = append(actual, task.ID)
+	}
+	if diff := cmp.Diff([]todo.TaskID{taskA}, actual); diff != "" {
+		t.Errorf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
+func listCmpOpts() cmp.Option {
+	return cmp.Options{
+		cmpopts.IgnoreFields(todo.List{}, "CreatedAt"),
+		cmpopts.EquateApproxTime(time.Microsecond),
+	}
+}
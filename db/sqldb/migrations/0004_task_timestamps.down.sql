@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE task
+  DROP COLUMN due_at,
+  DROP COLUMN completed_at,
+  DROP COLUMN updated_at,
+  DROP COLUMN created_at;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE task
+  ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  ADD COLUMN completed_at TIMESTAMPTZ,
+  ADD COLUMN due_at TIMESTAMPTZ;
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+ALTER TABLE task ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+
+UPDATE task SET tags = agg.tags
+  FROM (
+    SELECT task_id, string_agg(tag, ',' ORDER BY sort_order) AS tags
+    FROM task_tag
+    GROUP BY task_id
+  ) AS agg
+  WHERE task.id = agg.task_id;
+
+ALTER TABLE task ALTER COLUMN tags DROP DEFAULT;
+
+DROP TABLE task_tag;
+
+COMMIT;
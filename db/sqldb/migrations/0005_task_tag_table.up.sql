@@ -0,0 +1,22 @@
+BEGIN;
+
+CREATE TABLE task_tag (
+  task_id TEXT NOT NULL REFERENCES task(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  -- sort_order preserves the order that tags were added to the task in.
+  sort_order INTEGER NOT NULL,
+  PRIMARY KEY (task_id, tag)
+);
+CREATE INDEX task_tag_tag_idx ON task_tag (tag);
+
+-- Backfill from the comma-joined tags column. Empty and duplicate tags were
+-- artifacts of the old format, so they're dropped.
+INSERT INTO task_tag (task_id, tag, sort_order)
+  SELECT task.id, t.tag, t.ordinal - 1
+  FROM task, unnest(string_to_array(task.tags, ',')) WITH ORDINALITY AS t(tag, ordinal)
+  WHERE t.tag <> ''
+  ON CONFLICT DO NOTHING;
+
+ALTER TABLE task DROP COLUMN tags;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TRIGGER notify_user_account_change ON user_account;
+DROP TRIGGER notify_task_change ON task;
+DROP FUNCTION notify_row_change;
+
+COMMIT;
@@ -0,0 +1,32 @@
+/*
+ * Sends a notification on the 'row_changes' channel whenever a task or user
+ * is created, updated or deleted, which powers the change feed in sqldb.
+ *
+ * Notification payloads are limited to 8000 bytes, so we only send enough
+ * information to identify the row, listeners can load the rest.
+ */
+BEGIN;
+
+CREATE FUNCTION notify_row_change()
+RETURNS TRIGGER AS $$
+DECLARE _row jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        _row := to_jsonb(OLD);
+    ELSE
+        _row := to_jsonb(NEW);
+    END IF;
+    PERFORM pg_notify('row_changes', json_build_object(
+        'table', TG_TABLE_NAME,
+        'op', TG_OP,
+        'id', _row->>'id',
+        'created_by', _row->>'created_by'
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER notify_task_change AFTER INSERT OR UPDATE OR DELETE ON task FOR EACH ROW EXECUTE PROCEDURE notify_row_change();
+CREATE TRIGGER notify_user_account_change AFTER INSERT OR UPDATE OR DELETE ON user_account FOR EACH ROW EXECUTE PROCEDURE notify_row_change();
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE task_collaborator;
+DROP TYPE task_role;
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+CREATE TYPE task_role AS ENUM ('VIEWER', 'EDITOR', 'OWNER');
+
+-- task_collaborator holds the users a task has been shared with. The creator
+-- of a task is implicitly its owner, and doesn't have a row here.
+CREATE TABLE task_collaborator (
+  task_id TEXT NOT NULL REFERENCES task(id) ON DELETE CASCADE,
+  user_id TEXT NOT NULL REFERENCES user_account(id),
+  role task_role NOT NULL,
+  PRIMARY KEY (task_id, user_id)
+);
+CREATE INDEX task_collaborator_user_id_idx ON task_collaborator (user_id);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE task DROP COLUMN list_id;
+DROP TABLE list;
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE list (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  created_by TEXT NOT NULL REFERENCES user_account(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  archived_at TIMESTAMPTZ
+);
+CREATE INDEX list_created_by_idx ON list (created_by);
+
+-- Deleting a list requires choosing what happens to its tasks, so there's
+-- deliberately no ON DELETE behavior here, see sqldb.DeleteList.
+ALTER TABLE task ADD COLUMN list_id TEXT REFERENCES list(id);
+CREATE INDEX task_list_id_idx ON task (list_id);
+
+COMMIT;
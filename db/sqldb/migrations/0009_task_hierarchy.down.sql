@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE task_dependency;
+ALTER TABLE task DROP COLUMN parent_id;
+
+COMMIT;
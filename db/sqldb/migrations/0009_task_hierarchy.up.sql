@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Deleting a task promotes its subtasks to top-level tasks, rather than
+-- silently deleting them along with it.
+ALTER TABLE task ADD COLUMN parent_id TEXT REFERENCES task(id) ON DELETE SET NULL;
+CREATE INDEX task_parent_id_idx ON task (parent_id);
+
+-- task_dependency holds "blocked by" links, task_id can't be done until
+-- blocked_by_id is. Cycles are rejected by the application, see
+-- todo.ValidateBlockedBy.
+CREATE TABLE task_dependency (
+  task_id TEXT NOT NULL REFERENCES task(id) ON DELETE CASCADE,
+  blocked_by_id TEXT NOT NULL REFERENCES task(id) ON DELETE CASCADE,
+  PRIMARY KEY (task_id, blocked_by_id)
+);
+CREATE INDEX task_dependency_blocked_by_id_idx ON task_dependency (blocked_by_id);
+
+COMMIT;
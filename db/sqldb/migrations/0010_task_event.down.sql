@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE task_event;
+DROP TYPE task_event_kind;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE TYPE task_event_kind AS ENUM ('CREATED', 'UPDATED', 'DELETED');
+
+-- task_event is the append-only history of every change to a task. There are
+-- deliberately no foreign keys, so that history outlives the task it describes
+-- and the user that made the change. changes is a JSON array of
+-- todo.TaskFieldChange.
+CREATE TABLE task_event (
+  id TEXT PRIMARY KEY,
+  task_id TEXT NOT NULL,
+  actor_id TEXT,
+  kind task_event_kind NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  changes JSONB NOT NULL
+);
+CREATE INDEX task_event_task_id_idx ON task_event (task_id, created_at DESC, id DESC);
+
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+
+CREATE OR REPLACE FUNCTION notify_row_change()
+RETURNS TRIGGER AS $$
+DECLARE _row jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        _row := to_jsonb(OLD);
+    ELSE
+        _row := to_jsonb(NEW);
+    END IF;
+    PERFORM pg_notify('row_changes', json_build_object(
+        'table', TG_TABLE_NAME,
+        'op', TG_OP,
+        'id', _row->>'id',
+        'created_by', _row->>'created_by'
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- Tasks in the trash would otherwise reappear.
+DELETE FROM task WHERE deleted_at IS NOT NULL;
+ALTER TABLE task DROP COLUMN deleted_at;
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+
+-- Deleted tasks are moved to the trash by setting deleted_at, and are purged
+-- once they've been there for longer than the retention period.
+ALTER TABLE task ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX task_deleted_at_idx ON task (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Moving a task to the trash is an UPDATE, so the change feed needs to be told
+-- whether the row is trashed to report it as a deletion.
+CREATE OR REPLACE FUNCTION notify_row_change()
+RETURNS TRIGGER AS $$
+DECLARE _row jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        _row := to_jsonb(OLD);
+    ELSE
+        _row := to_jsonb(NEW);
+    END IF;
+    PERFORM pg_notify('row_changes', json_build_object(
+        'table', TG_TABLE_NAME,
+        'op', TG_OP,
+        'id', _row->>'id',
+        'created_by', _row->>'created_by',
+        'trashed', _row->>'deleted_at' IS NOT NULL
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE user_account DROP COLUMN version;
+ALTER TABLE task DROP COLUMN version;
+
+COMMIT;
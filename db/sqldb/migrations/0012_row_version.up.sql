@@ -0,0 +1,8 @@
+BEGIN;
+
+-- version is incremented on every write to the row, so that a writer can tell
+-- whether the row changed since it was read.
+ALTER TABLE task ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE user_account ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX task_search_vector_idx;
+ALTER TABLE task DROP COLUMN search_vector;
+
+COMMIT;
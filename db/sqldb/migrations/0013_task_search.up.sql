@@ -0,0 +1,11 @@
+BEGIN;
+
+-- search_vector is what full-text search matches tasks against. Matches in the
+-- name are weighted above matches in the body, so they rank higher.
+ALTER TABLE task ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('english', name), 'A') ||
+  setweight(to_tsvector('english', body), 'B')
+) STORED;
+CREATE INDEX task_search_vector_idx ON task USING gin (search_vector);
+
+COMMIT;
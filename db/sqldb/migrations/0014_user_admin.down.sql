@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE user_account DROP COLUMN is_admin;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+-- is_admin grants access to administrative features, like the user directory.
+-- There's deliberately no way to set it from the app, admins are made by
+-- updating the row directly.
+ALTER TABLE user_account ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE auth_identity;
+
+COMMIT;
@@ -0,0 +1,32 @@
+BEGIN;
+
+-- auth_identity records every way a user can sign in. A user starts with the
+-- identity they signed up with, and can link more, e.g. signing in with Google
+-- and with a password under the same address. The auth_provider_* columns on
+-- user_account are kept as the identity the account was created with.
+CREATE TABLE auth_identity (
+  provider auth_provider NOT NULL,
+  provider_user_id TEXT NOT NULL,
+  user_id TEXT NOT NULL REFERENCES user_account (id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  -- email_verified is whether the provider vouched for the email the last
+  -- time the user signed in with this identity. Only verified emails are used
+  -- to link new identities to existing accounts automatically.
+  email_verified BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (provider, provider_user_id)
+);
+CREATE INDEX auth_identity_user_id_idx ON auth_identity (user_id);
+CREATE INDEX auth_identity_email_idx ON auth_identity (lower(email)) WHERE email_verified;
+
+-- Every existing account gets the identity it signed up with. We don't know
+-- whether those emails were verified, so they're marked as unverified until
+-- the user next signs in with that identity. Accounts that were already
+-- duplicated across providers are left separate. The user can only link them
+-- if one of them is empty, see LinkAuthIdentity, and otherwise has to delete
+-- one of them first.
+INSERT INTO auth_identity (provider, provider_user_id, user_id, email, created_at)
+  SELECT auth_provider_type, auth_provider_id, id, email, created_at
+  FROM user_account;
+
+COMMIT;
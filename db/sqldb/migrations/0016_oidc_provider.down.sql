@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Postgres can't remove a value from an enum, so the type is recreated without
+-- it. This fails if any users or identities are still from an OIDC issuer.
+ALTER TYPE auth_provider RENAME TO auth_provider_old;
+CREATE TYPE auth_provider AS ENUM ('GOOGLE', 'FACEBOOK', 'EMAIL_AND_PASS');
+ALTER TABLE user_account
+  ALTER COLUMN auth_provider_type TYPE auth_provider USING auth_provider_type::text::auth_provider;
+ALTER TABLE auth_identity
+  ALTER COLUMN provider TYPE auth_provider USING provider::text::auth_provider;
+DROP TYPE auth_provider_old;
+
+COMMIT;
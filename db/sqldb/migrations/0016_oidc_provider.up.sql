@@ -0,0 +1,7 @@
+BEGIN;
+
+-- OIDC is for users of the OpenID Connect issuer the server is configured
+-- with, see authn/oidcauth. Their auth_provider_id is the issuer's subject.
+ALTER TYPE auth_provider ADD VALUE 'OIDC';
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- session_revocation records when an identity's sessions were last revoked,
+-- for auth systems whose session cookies we sign ourselves, see authn/oidcauth.
+-- Cookies issued at or before revoked_at are rejected. It isn't tied to
+-- user_account, so that revocations outlive deleting the user.
+CREATE TABLE session_revocation (
+  provider auth_provider NOT NULL,
+  provider_user_id TEXT NOT NULL,
+  revoked_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (provider, provider_user_id)
+);
+
+COMMIT;
@@ -0,0 +1,141 @@
+package sqldb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/jackc/pgx/v4"
+)
+
+// These delimit the matches in the text returned by ts_headline. They're
+// control characters, which todo.TextRule doesn't allow in names or bodies, so
+// they can't be confused with the text itself.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+// SearchTasks returns a page of the tasks that the given user can read which
+// match the search, best match first.
+func (d *DB) SearchTasks(tx db.Tx, userID todo.UserID, q *db.TaskSearchQuery) (*db.TaskSearchPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid search query: %w", err)
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	query := "websearch_to_tsquery('english', " + arg(q.Text) + ")"
+	rank := "ts_rank(search_vector, " + query + ")"
+	conds := []string{
+		"search_vector @@ " + query,
+		"deleted_at IS NULL",
+		readableBy(arg(userID)),
+	}
+	if q.Tag != "" {
+		conds = append(conds, "EXISTS (SELECT 1 FROM task_tag WHERE task_tag.task_id = task.id AND task_tag.tag = "+arg(q.Tag)+")")
+	}
+	if q.After != "" {
+		k, err := db.DecodeTaskSearchCursor(q.After)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		r, id := arg(k.Rank)+"::real", arg(k.ID)
+		conds = append(conds, fmt.Sprintf(`(%s < %s OR (%s = %s AND id COLLATE "C" > %s))`, rank, r, rank, r, id))
+	}
+	opts := `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `"`
+
+	sql := fmt.Sprintf(`
+		SELECT `+taskColumns+`,
+			%s,
+			ts_headline('english', name, %s, '%s, HighlightAll=true'),
+			ts_headline('english', body, %s, '%s, MinWords=15, MaxWords=35')
+		FROM task
+		WHERE %s
+		ORDER BY %s DESC, id COLLATE "C"`, rank, query, opts, query, opts, strings.Join(conds, " AND "), rank)
+	if q.Limit > 0 {
+		// We fetch one extra row to determine if there's another page.
+		sql += " LIMIT " + arg(q.Limit+1)
+	}
+
+	rows, err := d.query(tx, sql+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("searching tasks: %w", err)
+	}
+	results, err := rowsToSearchResults(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading search results: %w", err)
+	}
+	page := &db.TaskSearchPage{Results: results}
+	if q.Limit > 0 && len(results) > q.Limit {
+		page.Results = results[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
+}
+
+// withExtraColumns scans the columns after the ones that the wrapped scanner's
+// caller expects into extra.
+type withExtraColumns struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (w *withExtraColumns) Scan(dest ...interface{}) error {
+	return w.rowScanner.Scan(append(dest, w.extra...)...)
+}
+
+func rowsToSearchResults(rows pgx.Rows) ([]*db.TaskSearchResult, error) {
+	defer rows.Close()
+	var out []*db.TaskSearchResult
+	for rows.Next() {
+		var (
+			r          db.TaskSearchResult
+			name, body string
+		)
+		task, err := rowToTask(&withExtraColumns{rowScanner: rows, extra: []interface{}{&r.Rank, &name, &body}})
+		if err != nil {
+			return nil, fmt.Errorf("converting row to search result: %w", err)
+		}
+		r.Task = task
+		r.Name = parseHighlights(name)
+		r.BodySnippet = parseHighlights(body)
+		out = append(out, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing search result rows: %w", err)
+	}
+	return out, nil
+}
+
+// parseHighlights splits text returned by ts_headline into spans.
+func parseHighlights(s string) []db.TextSpan {
+	var spans []db.TextSpan
+	add := func(text string, match bool) {
+		if text != "" {
+			spans = append(spans, db.TextSpan{Text: text, Match: match})
+		}
+	}
+	for s != "" {
+		start := strings.Index(s, highlightStart)
+		if start < 0 {
+			add(s, false)
+			break
+		}
+		add(s[:start], false)
+		s = s[start+len(highlightStart):]
+		stop := strings.Index(s, highlightStop)
+		if stop < 0 {
+			add(s, true)
+			break
+		}
+		add(s[:stop], true)
+		s = s[stop+len(highlightStop):]
+	}
+	return spans
+}
@@ -0,0 +1,41 @@
+package sqldb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+)
+
+// RevokeSessions revokes the identity's sessions issued at or before the given
+// time. A revocation never moves back in time, so servers with slightly
+// different clocks can't undo each other's revocations.
+func (d *DB) RevokeSessions(tx db.Tx, provider authn.Provider, providerUserID authn.UserID, at time.Time) error {
+	if err := d.exec(tx, `
+		INSERT INTO session_revocation
+			(provider, provider_user_id, revoked_at)
+			VALUES
+			($1, $2, $3)
+		ON CONFLICT (provider, provider_user_id) DO UPDATE SET
+			revoked_at = GREATEST(session_revocation.revoked_at, EXCLUDED.revoked_at);
+		`, provider, providerUserID, at); err != nil {
+		return fmt.Errorf("writing session_revocation row: %w", err)
+	}
+	return nil
+}
+
+// SessionsRevokedAt returns when the identity's sessions were last revoked,
+// or the zero time if they never were.
+func (d *DB) SessionsRevokedAt(tx db.Tx, provider authn.Provider, providerUserID authn.UserID) (time.Time, error) {
+	var at time.Time
+	err := d.queryRow(tx, `
+		SELECT revoked_at FROM session_revocation
+		WHERE provider = $1 AND provider_user_id = $2;
+		`, provider, providerUserID).Scan(&at)
+	// Without a row, at is still the zero time.
+	if err := ifNoRows(err, nil, "reading session_revocation row"); err != nil {
+		return time.Time{}, err
+	}
+	return at, nil
+}
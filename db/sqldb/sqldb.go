@@ -5,35 +5,73 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/Silicon-Ally/cryptorand"
 	"github.com/Silicon-Ally/idgen"
 	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
 	"github.com/hashicorp/go-multierror"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
 )
 
 type DB struct {
 	db          SQL
 	idGenerator *idgen.Generator
+	logger      *zap.Logger
+	// maxTxAttempts is how many times a transaction is run when it fails
+	// because of a conflict, unless its options say otherwise.
+	maxTxAttempts int
 }
 
 type SQL interface {
 	DBConn
 	Begin(context.Context) (pgx.Tx, error)
+	BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error)
 }
 
-func New(sqlDB SQL) (*DB, error) {
+type Option func(*DB)
+
+// WithLogger sets the logger that retried transactions are reported to.
+func WithLogger(logger *zap.Logger) Option {
+	return func(d *DB) {
+		d.logger = logger
+	}
+}
+
+// WithMaxTxAttempts sets how many times a transaction is run when it fails
+// because of a conflict, for transactions that don't set
+// db.TxOptions.MaxAttempts.
+func WithMaxTxAttempts(n int) Option {
+	return func(d *DB) {
+		d.maxTxAttempts = n
+	}
+}
+
+const defaultMaxTxAttempts = 3
+
+func New(sqlDB SQL, opts ...Option) (*DB, error) {
 	r := cryptorand.New()
 	idg, err := idgen.New(r, idgen.WithDefaultLength(20), idgen.WithCharSet([]rune("abcdef0123456789")))
 	if err != nil {
 		return nil, fmt.Errorf("initializing idgen: %w", err)
 	}
-	return &DB{
-		db:          sqlDB,
-		idGenerator: idg,
-	}, nil
+	d := &DB{
+		db:            sqlDB,
+		idGenerator:   idg,
+		logger:        zap.NewNop(),
+		maxTxAttempts: defaultMaxTxAttempts,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.maxTxAttempts < 1 {
+		return nil, fmt.Errorf("max transaction attempts must be at least 1, was %d", d.maxTxAttempts)
+	}
+	return d, nil
 }
 
 type ctxtx struct {
@@ -42,8 +80,22 @@ type ctxtx struct {
 	ctx context.Context
 }
 
-func (db *DB) Begin(ctx context.Context) (db.Tx, error) {
-	tx, err := db.db.Begin(ctx)
+func (d *DB) Begin(ctx context.Context) (db.Tx, error) {
+	return d.BeginTx(ctx, nil)
+}
+
+// BeginTx starts a transaction with the given options, nil options are the
+// same as the zero value. MaxAttempts is ignored, as only Transactional
+// retries transactions.
+func (d *DB) BeginTx(ctx context.Context, opts *db.TxOptions) (db.Tx, error) {
+	var pgOpts pgx.TxOptions
+	if opts != nil {
+		pgOpts.IsoLevel = pgx.TxIsoLevel(opts.Isolation)
+		if opts.ReadOnly {
+			pgOpts.AccessMode = pgx.ReadOnly
+		}
+	}
+	tx, err := d.db.BeginTx(ctx, pgOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
@@ -112,7 +164,7 @@ func (d *DB) query(tx db.Tx, sql string, args ...interface{}) (rows pgx.Rows, er
 	err = d.withConn(tx, func(c *ctxtx, dbc DBConn) error {
 		r, e := dbc.Query(c.ctx, sql, args...)
 		rows = r
-		return e
+		return translateErr(e)
 	})
 	return
 }
@@ -120,7 +172,7 @@ func (d *DB) query(tx db.Tx, sql string, args ...interface{}) (rows pgx.Rows, er
 func (d *DB) queryRow(tx db.Tx, sql string, args ...interface{}) rowScanner {
 	var row rowScanner
 	err := d.withConn(tx, func(c *ctxtx, dbc DBConn) error {
-		row = dbc.QueryRow(c.ctx, sql, args...)
+		row = &translatingRow{row: dbc.QueryRow(c.ctx, sql, args...)}
 		return nil
 	})
 	if err != nil {
@@ -132,7 +184,7 @@ func (d *DB) queryRow(tx db.Tx, sql string, args ...interface{}) rowScanner {
 func (d *DB) exec(tx db.Tx, sql string, args ...interface{}) error {
 	err := d.withConn(tx, func(c *ctxtx, dbc DBConn) error {
 		_, err := dbc.Exec(c.ctx, sql, args...)
-		return err
+		return translateErr(err)
 	})
 	return err
 }
@@ -141,13 +193,59 @@ type rowScanner interface {
 	Scan(...interface{}) error
 }
 
-func (db *DB) Transactional(ctx context.Context, fn func(tx db.Tx) error) error {
-	tx, err := db.Begin(ctx)
+// translatingRow gives the errors from scanning a row their kind.
+type translatingRow struct {
+	row rowScanner
+}
+
+func (r *translatingRow) Scan(dest ...interface{}) error {
+	return translateErr(r.row.Scan(dest...))
+}
+
+func (d *DB) Transactional(ctx context.Context, fn func(tx db.Tx) error) error {
+	return d.TransactionalWithOptions(ctx, nil, fn)
+}
+
+// TransactionalWithOptions runs fn in a transaction with the given options,
+// committing it if fn succeeds. If the transaction fails because of a conflict
+// with a concurrent transaction, like a serialization failure or a deadlock,
+// it's run again from the start after a short backoff, so fn shouldn't have
+// effects outside of the transaction.
+func (d *DB) TransactionalWithOptions(ctx context.Context, opts *db.TxOptions, fn func(tx db.Tx) error) error {
+	maxAttempts := d.maxTxAttempts
+	if opts != nil && opts.MaxAttempts > 0 {
+		maxAttempts = opts.MaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		err := d.transactOnce(ctx, opts, fn)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		backoff := txBackoff(attempt)
+		d.logger.Warn("retrying transaction",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("waiting to retry txn: %w", multierror.Append(err, ctx.Err()))
+		}
+	}
+}
+
+func (d *DB) transactOnce(ctx context.Context, opts *db.TxOptions, fn func(tx db.Tx) error) error {
+	tx, err := d.BeginTx(ctx, opts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
 	if err := fn(tx); err != nil {
-		tx.Rollback()
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			err = multierror.Append(err, rollbackErr)
+		}
 		return fmt.Errorf("failed to perform operation: %w", err)
 	}
 	if err := tx.Commit(); err != nil {
@@ -156,57 +254,132 @@ func (db *DB) Transactional(ctx context.Context, fn func(tx db.Tx) error) error
 	return nil
 }
 
-func (db *DB) RunOrContinueTransaction(in db.Tx, fn func(db.Tx) error) error {
-	tx, err, commitFn, rollbackFn := db.startOrContinueTx(in)
-	if err != nil {
-		return fmt.Errorf("failed to start or continue txn: %w", err)
-	}
-	err = fn(tx)
-	if err == nil {
-		err = commitFn()
-	}
-	if err == nil {
-		return nil
-	}
-	rollbackErr := rollbackFn()
-	if rollbackErr != nil {
-		err = multierror.Append(err, rollbackErr)
-	}
-	return fmt.Errorf("err in txn: %w", err)
-}
-
-func (db *DB) startOrContinueTx(in db.Tx) (db.Tx, error, func() error, func() error) {
-	nilFn := func() error { return nil }
-	var c *ctxtx
+// RunOrContinueTransaction runs fn in a new transaction, or if tx is already a
+// transaction, in a savepoint of it, so that if fn fails only its changes are
+// rolled back. Only new transactions are retried on conflicts, as it's up to
+// whoever started an existing transaction to retry it.
+func (d *DB) RunOrContinueTransaction(in db.Tx, fn func(db.Tx) error) error {
 	ctx := context.Background()
 	if in != nil {
-		cc, ok := in.(*ctxtx)
+		c, ok := in.(*ctxtx)
 		if !ok {
-			return nil, fmt.Errorf("unexpected type for transaction: %T", in), nilFn, nilFn
+			return fmt.Errorf("unexpected type for transaction: %T", in)
+		}
+		if c.tx != nil {
+			return d.runInSavepoint(c, fn)
 		}
-		c = cc
 		ctx = c.ctx
 	}
-	if c != nil && c.tx != nil {
-		return c, nil, nilFn, nilFn
+	if err := d.Transactional(ctx, fn); err != nil {
+		return fmt.Errorf("err in txn: %w", err)
 	}
-	tx, err := db.Begin(ctx)
+	return nil
+}
+
+func (d *DB) runInSavepoint(c *ctxtx, fn func(db.Tx) error) error {
+	// Beginning a transaction inside a pgx transaction creates a savepoint,
+	// which committing releases, and rolling back rolls back to.
+	sp, err := c.tx.Begin(c.ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin txn: %w", err), nilFn, nilFn
+		return fmt.Errorf("failed to create savepoint: %w", err)
 	}
-	commitFn := func() error {
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit txn: %w", err)
+	if err := fn(&ctxtx{tx: sp, ctx: c.ctx}); err != nil {
+		if rollbackErr := sp.Rollback(c.ctx); rollbackErr != nil {
+			err = multierror.Append(err, rollbackErr)
 		}
-		return nil
+		return fmt.Errorf("err in savepoint: %w", err)
 	}
-	rollbackFn := func() error {
-		if err := tx.Rollback(); err != nil {
-			return fmt.Errorf("failed to rollback txn: %w", err)
-		}
-		return nil
+	if err := sp.Commit(c.ctx); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
+
+// SQLSTATE codes we handle specially, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	// Failures caused by concurrent transactions.
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+
+	// Integrity constraint violations.
+	sqlStateNotNullViolation    = "23502"
+	sqlStateForeignKeyViolation = "23503"
+	sqlStateUniqueViolation     = "23505"
+	sqlStateCheckViolation      = "23514"
+
+	// Data exceptions.
+	sqlStateStringDataRightTruncation = "22001"
+	sqlStateInvalidTextRepresentation = "22P02"
+)
+
+// translateErr gives errors from PostgreSQL the kind matching their cause, so
+// that e.g. inserting a duplicate is reported as a conflict, rather than as an
+// internal error. The original error is still in the chain. Errors without a
+// more specific kind are returned unchanged.
+func translateErr(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case sqlStateUniqueViolation:
+		return errkind.Wrap(errkind.Conflict, err)
+	case sqlStateForeignKeyViolation:
+		// A foreign key is violated when a row refers to an entity that
+		// doesn't exist (or is deleted while it's referred to).
+		return errkind.Wrap(errkind.NotFound, err)
+	case sqlStateNotNullViolation, sqlStateCheckViolation,
+		sqlStateStringDataRightTruncation, sqlStateInvalidTextRepresentation:
+		return errkind.Wrap(errkind.InvalidArgument, err)
+	default:
+		return err
+	}
+}
+
+// ifNoRows returns errIfNone if err is because a query returned no rows, and
+// otherwise err wrapped with the given description.
+func ifNoRows(err, errIfNone error, desc string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errIfNone
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", desc, err)
+	}
+	return nil
+}
+
+// isRetryable reports whether the error came from a conflict with a concurrent
+// transaction, meaning the transaction may succeed if it's run again.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	minTxBackoff = 10 * time.Millisecond
+	maxTxBackoff = time.Second
+)
+
+// txBackoff returns how long to wait before retrying a transaction that has
+// failed the given number of times. The backoff doubles with each attempt, and
+// is jittered so that conflicting transactions don't retry in lockstep.
+func txBackoff(attempt int) time.Duration {
+	b := maxTxBackoff
+	if attempt < 8 {
+		b = minTxBackoff << (attempt - 1)
+	}
+	if b > maxTxBackoff {
+		b = maxTxBackoff
 	}
-	return tx, nil, commitFn, rollbackFn
+	return b/2 + time.Duration(rand.Int63n(int64(b/2)+1))
 }
 
 type idNamespace string
@@ -216,3 +389,29 @@ const idNamespaceIDSeparator = "."
 func (db *DB) randomID(ns idNamespace) string {
 	return fmt.Sprintf("%s%s%s", ns, idNamespaceIDSeparator, db.idGenerator.NewID())
 }
+
+// timeToNullable converts the zero time to NULL for storage in nullable
+// TIMESTAMPTZ columns.
+func timeToNullable(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeFromNullable(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// idsToStrings converts typed IDs to a slice that pgx can encode as a text
+// array, for use with `= ANY($1)`.
+func idsToStrings[S ~string](ids []S) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = string(id)
+	}
+	return out
+}
@@ -2,16 +2,25 @@ package sqldb
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
 	"testing"
 
 	"github.com/Silicon-Ally/idgen"
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/testing/dbtest"
 	"github.com/Silicon-Ally/testpgx"
 	"github.com/Silicon-Ally/testpgx/migrate"
 	"github.com/bazelbuild/rules_go/go/tools/bazel"
 	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap/zaptest"
 )
 
 func TestMain(m *testing.M) {
@@ -80,9 +89,23 @@ func TestSchemaHistory(t *testing.T) {
 	}
 
 	want := []versionHistory{
-		{ID: 1, Version: 1}, // 0001_create_schema_migrations_history
-		{ID: 2, Version: 2}, // 0002_create_user_table
-		{ID: 3, Version: 3}, // 0003_create_todo_table
+		{ID: 1, Version: 1},   // 0001_create_schema_migrations_history
+		{ID: 2, Version: 2},   // 0002_create_user_table
+		{ID: 3, Version: 3},   // 0003_create_todo_table
+		{ID: 4, Version: 4},   // 0004_task_timestamps
+		{ID: 5, Version: 5},   // 0005_task_tag_table
+		{ID: 6, Version: 6},   // 0006_change_feed
+		{ID: 7, Version: 7},   // 0007_task_collaborator
+		{ID: 8, Version: 8},   // 0008_list_table
+		{ID: 9, Version: 9},   // 0009_task_hierarchy
+		{ID: 10, Version: 10}, // 0010_task_event
+		{ID: 11, Version: 11}, // 0011_task_trash
+		{ID: 12, Version: 12}, // 0012_row_version
+		{ID: 13, Version: 13}, // 0013_task_search
+		{ID: 14, Version: 14}, // 0014_user_admin
+		{ID: 15, Version: 15}, // 0015_auth_identity
+		{ID: 16, Version: 16}, // 0016_oidc_provider
+		{ID: 17, Version: 17}, // 0017_session_revocation
 	}
 
 	if diff := cmp.Diff(want, got); diff != "" {
@@ -91,15 +114,216 @@ func TestSchemaHistory(t *testing.T) {
 }
 
 func createDBForTesting(t *testing.T) *DB {
+	return createDBForTestingWithSQL(t, env.GetMigratedDB(context.Background(), t))
+}
+
+func createDBForTestingWithSQL(t *testing.T, pool SQL) *DB {
 	r := rand.New(rand.NewSource(0))
 	idg, err := idgen.New(r, idgen.WithCharSet([]rune("abcdefhijklmnopqrstuvwxyz")))
 	if err != nil {
 		t.Fatalf("creating id generator: %v", err)
 	}
-	ctx := context.Background()
-	pool := env.GetMigratedDB(ctx, t)
 	return &DB{
-		db:          pool,
-		idGenerator: idg,
+		db:            pool,
+		idGenerator:   idg,
+		logger:        zaptest.NewLogger(t),
+		maxTxAttempts: defaultMaxTxAttempts,
+	}
+}
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) dbtest.DB {
+		return createDBForTesting(t)
+	})
+}
+
+func TestTransactionalRetriesConflicts(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskID, err1 := tdb.CreateTask(tdb.NoTxn(ctx), userID)
+	noErrDuringSetup(t, err0, err1)
+
+	attempts := 0
+	err := tdb.TransactionalWithOptions(ctx, &db.TxOptions{Isolation: db.RepeatableRead}, func(tx db.Tx) error {
+		attempts++
+		if _, err := tdb.Task(tx, taskID); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			// A write that commits after this transaction's snapshot was taken
+			// makes this transaction's write fail with a serialization failure.
+			if err := tdb.UpdateTask(tdb.NoTxn(ctx), taskID, db.SetTaskBody("Concurrent Body")); err != nil {
+				return err
+			}
+		}
+		return tdb.UpdateTask(tx, taskID, db.SetTaskName("Retried Name"))
+	})
+	if err != nil {
+		t.Fatalf("running transaction: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("transaction was attempted %d times, want 2", attempts)
+	}
+
+	task, err := tdb.Task(tdb.NoTxn(ctx), taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	if task.Name != "Retried Name" || task.Body != "Concurrent Body" {
+		t.Errorf("got task with name %q and body %q, want both writes applied", task.Name, task.Body)
+	}
+}
+
+func TestTransactionalAttemptLimit(t *testing.T) {
+	ctx := context.Background()
+	sql := &conflictingSQL{}
+	tdb := createDBForTestingWithSQL(t, sql)
+	noop := func(db.Tx) error { return nil }
+
+	err := tdb.TransactionalWithOptions(ctx, &db.TxOptions{MaxAttempts: 2}, noop)
+	if !isRetryable(err) {
+		t.Errorf("expected a serialization failure after running out of attempts, got %v", err)
+	}
+	if sql.begun != 2 {
+		t.Errorf("transaction was attempted %d times, want 2", sql.begun)
+	}
+
+	sql.begun = 0
+	errFailed := errors.New("failed")
+	err = tdb.Transactional(ctx, func(db.Tx) error { return errFailed })
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected the transaction's error, got %v", err)
+	}
+	if sql.begun != 1 {
+		t.Errorf("transaction that failed without a conflict was attempted %d times, want 1", sql.begun)
+	}
+}
+
+// conflictingSQL starts transactions that always fail to commit with a
+// serialization failure.
+type conflictingSQL struct {
+	SQL
+	begun int
+}
+
+func (c *conflictingSQL) BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error) {
+	c.begun++
+	return &conflictingTx{}, nil
+}
+
+type conflictingTx struct {
+	pgx.Tx
+}
+
+func (*conflictingTx) Commit(context.Context) error {
+	return &pgconn.PgError{Code: sqlStateSerializationFailure}
+}
+
+func (*conflictingTx) Rollback(context.Context) error {
+	return nil
+}
+
+func TestNestedTransactionRollsBackToSavepoint(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskID, err1 := tdb.CreateTask(tdb.NoTxn(ctx), userID)
+	noErrDuringSetup(t, err0, err1)
+
+	errInner := errors.New("inner failure")
+	err := tdb.Transactional(ctx, func(tx db.Tx) error {
+		if err := tdb.UpdateTask(tx, taskID, db.SetTaskName("Outer Name")); err != nil {
+			return err
+		}
+		err := tdb.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+			if err := tdb.UpdateTask(tx, taskID, db.SetTaskBody("Inner Body")); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("expected the inner error from the nested transaction, got %v", err)
+		}
+		// A failed statement would abort the whole transaction if it weren't
+		// for the savepoint.
+		err = tdb.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+			return tdb.exec(tx, "SELECT * FROM not_a_table;")
+		})
+		if err == nil {
+			t.Error("expected an error from the invalid statement, but got none")
+		}
+		return tdb.UpdateTask(tx, taskID, db.AddTaskTag("tag"))
+	})
+	if err != nil {
+		t.Fatalf("running outer transaction: %v", err)
+	}
+
+	task, err := tdb.Task(tdb.NoTxn(ctx), taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	if task.Name != "Outer Name" || task.Body != defaultTaskBody {
+		t.Errorf("got task with name %q and body %q, want only the outer transaction's changes", task.Name, task.Body)
+	}
+	if diff := cmp.Diff([]string{"tag"}, []string(task.Tags)); diff != "" {
+		t.Errorf("unexpected tags (-want +got)\n%s", diff)
+	}
+}
+
+func TestTranslateErr(t *testing.T) {
+	tests := []struct {
+		desc string
+		err  error
+		want errkind.Kind
+	}{
+		{
+			desc: "unique violation",
+			err:  &pgconn.PgError{Code: sqlStateUniqueViolation},
+			want: errkind.Conflict,
+		},
+		{
+			desc: "foreign key violation",
+			err:  fmt.Errorf("inserting: %w", &pgconn.PgError{Code: sqlStateForeignKeyViolation}),
+			want: errkind.NotFound,
+		},
+		{
+			desc: "check violation",
+			err:  &pgconn.PgError{Code: sqlStateCheckViolation},
+			want: errkind.InvalidArgument,
+		},
+		{
+			desc: "serialization failure",
+			err:  &pgconn.PgError{Code: sqlStateSerializationFailure},
+			want: errkind.Internal,
+		},
+		{
+			desc: "not from postgres",
+			err:  errors.New("failed"),
+			want: errkind.Internal,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := translateErr(test.err)
+			if kind := errkind.Of(got); kind != test.want {
+				t.Errorf("got error of kind %q, want %q", kind, test.want)
+			}
+			if !errors.Is(got, test.err) {
+				t.Errorf("expected %v to wrap %v", got, test.err)
+			}
+		})
+	}
+}
+
+func TestMissingReferenceIsNotFound(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+
+	_, err := tdb.CreateTask(tdb.NoTxn(ctx), "user.nonexistent")
+	if !errkind.Is(err, errkind.NotFound) {
+		t.Errorf("expected a not found error creating a task for a nonexistent user, got %q: %v", errkind.Of(err), err)
 	}
 }
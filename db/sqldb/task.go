@@ -2,30 +2,163 @@ package sqldb
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Silicon-Ally/silicon-starter/db"
 	"github.com/Silicon-Ally/silicon-starter/todo"
 	"github.com/jackc/pgx/v4"
 )
 
-func (db *DB) Task(tx db.Tx, id todo.TaskID) (*todo.Task, error) {
-	row := db.queryRow(tx, `
-		SELECT id, name, body, tags, created_by 
+// Task returns the given task, tasks in the trash aren't returned.
+func (d *DB) Task(tx db.Tx, id todo.TaskID) (*todo.Task, error) {
+	row := d.queryRow(tx, `
+		SELECT `+taskColumns+`
 		FROM task
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
 		`, id)
 	task, err := rowToTask(row)
-	if err != nil {
-		return nil, fmt.Errorf("reading task: %w", err)
+	if err := ifNoRows(err, db.NotFound(id, "task"), "reading task"); err != nil {
+		return nil, err
 	}
 	return task, nil
 }
 
-func (db *DB) TasksByCreator(tx db.Tx, creatorID todo.UserID) ([]*todo.Task, error) {
-	rows, err := db.query(tx, `
-		SELECT id, name, body, tags, created_by
+// TasksByID returns the tasks with the given IDs, keyed by ID. Tasks that don't
+// exist or are in the trash are left out, rather than being an error.
+func (d *DB) TasksByID(tx db.Tx, ids []todo.TaskID) (map[todo.TaskID]*todo.Task, error) {
+	rows, err := d.query(tx, `
+		SELECT `+taskColumns+`
+		FROM task
+		WHERE id = ANY($1) AND deleted_at IS NULL;
+		`, idsToStrings(ids))
+	if err != nil {
+		return nil, fmt.Errorf("querying tasks: %w", err)
+	}
+	tasks, err := rowsToTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading tasks: %w", err)
+	}
+	out := make(map[todo.TaskID]*todo.Task, len(tasks))
+	for _, t := range tasks {
+		out[t.ID] = t
+	}
+	return out, nil
+}
+
+// TasksByCreator returns a page of the tasks created by the given user. A nil
+// query returns every task, oldest first.
+func (d *DB) TasksByCreator(tx db.Tx, creatorID todo.UserID, q *db.TaskQuery) (*db.TaskPage, error) {
+	return d.listTasks(tx, q, func(arg func(interface{}) string) string {
+		return "created_by = " + arg(creatorID)
+	})
+}
+
+// TasksForUser returns a page of the tasks that the given user can read, i.e.
+// the tasks they created and the tasks that have been shared with them. A nil
+// query returns every task, oldest first.
+func (d *DB) TasksForUser(tx db.Tx, userID todo.UserID, q *db.TaskQuery) (*db.TaskPage, error) {
+	return d.listTasks(tx, q, func(arg func(interface{}) string) string {
+		return readableBy(arg(userID))
+	})
+}
+
+// readableBy returns a condition matching the tasks that the user given by the
+// query argument u can read.
+func readableBy(u string) string {
+	return "(created_by = " + u + " OR EXISTS (SELECT 1 FROM task_collaborator WHERE task_collaborator.task_id = task.id AND task_collaborator.user_id = " + u + "))"
+}
+
+// listTasks returns a page of the tasks matching the condition returned by
+// scope, which should use the given arg function to add query arguments.
+func (d *DB) listTasks(tx db.Tx, q *db.TaskQuery, scope func(arg func(interface{}) string) string) (*db.TaskPage, error) {
+	if q == nil {
+		q = db.DefaultTaskQuery()
+	}
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid task query: %w", err)
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conds = append(conds, scope(arg), "deleted_at IS NULL")
+	f := q.Filter
+	if f.Tag != "" {
+		conds = append(conds, "EXISTS (SELECT 1 FROM task_tag WHERE task_tag.task_id = task.id AND task_tag.tag = "+arg(f.Tag)+")")
+	}
+	if f.ListID != "" {
+		conds = append(conds, "list_id = "+arg(f.ListID))
+	}
+	if f.Completed != nil {
+		if *f.Completed {
+			conds = append(conds, "completed_at IS NOT NULL")
+		} else {
+			conds = append(conds, "completed_at IS NULL")
+		}
+	}
+	if !f.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at >= "+arg(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < "+arg(f.CreatedBefore))
+	}
+
+	// Names and IDs are compared with the "C" collation so that the ordering
+	// is byte-wise, which matches the ordering of db.TaskCursorKey.Compare.
+	var sortExpr string
+	switch q.Sort.Field {
+	case db.TaskSortByName:
+		sortExpr = `name COLLATE "C"`
+	case db.TaskSortByCreatedAt:
+		sortExpr = "created_at"
+	case db.TaskSortByDueAt:
+		// Tasks without a due date sort after all tasks with one.
+		sortExpr = "COALESCE(due_at, 'infinity'::timestamptz)"
+	}
+	dir, cmpOp := "ASC", ">"
+	if q.Sort.Descending {
+		dir, cmpOp = "DESC", "<"
+	}
+
+	if q.After != "" {
+		k, err := db.DecodeTaskCursor(q.After, q.Sort.Field)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		var keyArg string
+		switch q.Sort.Field {
+		case db.TaskSortByName:
+			keyArg = arg(k.Name)
+		case db.TaskSortByCreatedAt:
+			keyArg = arg(k.Time) + "::timestamptz"
+		case db.TaskSortByDueAt:
+			if k.Time.IsZero() {
+				keyArg = "'infinity'::timestamptz"
+			} else {
+				keyArg = arg(k.Time) + "::timestamptz"
+			}
+		}
+		conds = append(conds, fmt.Sprintf(`(%s, id COLLATE "C") %s (%s, %s)`, sortExpr, cmpOp, keyArg, arg(k.ID)))
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT `+taskColumns+`
 		FROM task
-		WHERE created_by = $1;`, creatorID)
+		WHERE %s
+		ORDER BY %s %s, id COLLATE "C" %s`, strings.Join(conds, " AND "), sortExpr, dir, dir)
+	if q.Limit > 0 {
+		// We fetch one extra row to determine if there's another page.
+		sql += " LIMIT " + arg(q.Limit+1)
+	}
+
+	rows, err := d.query(tx, sql+";", args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying tasks: %w", err)
 	}
@@ -33,50 +166,89 @@ func (db *DB) TasksByCreator(tx db.Tx, creatorID todo.UserID) ([]*todo.Task, err
 	if err != nil {
 		return nil, fmt.Errorf("reading task: %w", err)
 	}
-	return tasks, nil
+	page := &db.TaskPage{Tasks: tasks}
+	if q.Limit > 0 && len(tasks) > q.Limit {
+		page.Tasks = tasks[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
 }
 
+// taskColumns are the columns that rowToTask expects, in order. Tags are
+// stored in the task_tag table, and are aggregated back into an array here.
+const taskColumns = `
+			id, name, body, created_by, list_id, parent_id, created_at, updated_at, completed_at, due_at, deleted_at, version,
+			ARRAY(SELECT tag FROM task_tag WHERE task_tag.task_id = task.id ORDER BY sort_order)`
+
 const taskIDNamespace = "task"
 
 const defaultTaskName = "Unnamed Task"
 const defaultTaskBody = "New Task Body"
 
-func (db *DB) CreateTask(tx db.Tx, creatorID todo.UserID) (todo.TaskID, error) {
-	id := todo.TaskID(db.randomID(taskIDNamespace))
-	name := defaultTaskName
-	body := defaultTaskBody
-	tags := todo.Tags{}.ToStored()
-	err := db.exec(tx, `
-		INSERT INTO task 
-			(id, name, body, tags, created_by)
-			VALUES
-			($1, $2, $3, $4, $5);
-		`, id, name, body, tags, creatorID)
+func (d *DB) CreateTask(tx db.Tx, creatorID todo.UserID) (todo.TaskID, error) {
+	task := &todo.Task{
+		ID:        todo.TaskID(d.randomID(taskIDNamespace)),
+		Name:      defaultTaskName,
+		Body:      defaultTaskBody,
+		CreatedBy: creatorID,
+	}
+	now := time.Now()
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		err := d.exec(tx, `
+			INSERT INTO task 
+				(id, name, body, created_by, created_at, updated_at)
+				VALUES
+				($1, $2, $3, $4, $5, $5);
+			`, task.ID, task.Name, task.Body, task.CreatedBy, now)
+		if err != nil {
+			return fmt.Errorf("creating task row: %w", err)
+		}
+		if err := d.recordTaskDiff(tx, task.ID, todo.TaskEventCreated, nil, task); err != nil {
+			return fmt.Errorf("recording task creation: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("creating task row: %w", err)
+		return "", fmt.Errorf("running create task txn: %w", err)
 	}
-	return id, nil
+	return task.ID, nil
 }
 
 func (d *DB) UpdateTask(
 	tx db.Tx,
 	taskID todo.TaskID,
 	taskMutations ...db.UpdateTaskFn) error {
+	ms := append([]db.UpdateTaskFn{requireTrashed(false)}, taskMutations...)
+	return d.updateTask(tx, taskID, todo.TaskEventUpdated, ms...)
+}
+
+// updateTask applies the mutations to the task, whether or not it's in the
+// trash, and records the change as an event of the given kind.
+func (d *DB) updateTask(
+	tx db.Tx,
+	taskID todo.TaskID,
+	kind todo.TaskEventKind,
+	taskMutations ...db.UpdateTaskFn) error {
 	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
-		task, err := d.Task(tx, taskID)
+		task, err := d.taskIncludingTrashed(tx, taskID)
 		if err != nil {
 			return fmt.Errorf("reading task pre-mutations: %w", err)
 		}
+		before := task.Clone()
 		for i, m := range taskMutations {
 			err := m(task)
 			if err != nil {
 				return fmt.Errorf("running mutation #%d: %w", i, err)
 			}
 		}
+		task.UpdatedAt = time.Now()
 		err = d.putTask(tx, task)
 		if err != nil {
 			return fmt.Errorf("writing task post-mutations: %w", err)
 		}
+		if err := d.recordTaskDiff(tx, taskID, kind, before, task); err != nil {
+			return fmt.Errorf("recording task change: %w", err)
+		}
 		return nil
 	})
 	if err != nil {
@@ -85,43 +257,261 @@ func (d *DB) UpdateTask(
 	return nil
 }
 
+// DeleteTask moves the task to the trash, from where it can be restored until
+// it's purged, see RestoreTask and PurgeTask.
 func (d *DB) DeleteTask(tx db.Tx, taskID todo.TaskID) error {
-	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
-		err := d.exec(tx, "DELETE FROM task WHERE id = $1;", taskID)
-		if err != nil {
-			return fmt.Errorf("deleting task: %w", err)
-		}
+	now := time.Now()
+	err := d.updateTask(tx, taskID, todo.TaskEventDeleted, requireTrashed(false), func(t *todo.Task) error {
+		t.DeletedAt = now
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("running delete task transaction: %w", err)
+		return fmt.Errorf("moving task to trash: %w", err)
 	}
 	return nil
 }
 
-func (db *DB) putTask(tx db.Tx, task *todo.Task) error {
-	err := db.exec(tx, `
+// requireTrashed returns a mutation that fails with a not found error unless
+// the task's trash state matches.
+func requireTrashed(trashed bool) db.UpdateTaskFn {
+	return func(t *todo.Task) error {
+		if t.IsTrashed() != trashed {
+			if trashed {
+				return db.NotFound(t.ID, "trashed task")
+			}
+			return db.NotFound(t.ID, "task")
+		}
+		return nil
+	}
+}
+
+func (d *DB) TaskCollaborators(tx db.Tx, taskID todo.TaskID) ([]*todo.TaskCollaborator, error) {
+	rows, err := d.query(tx, `
+		SELECT task_id, user_id, role
+		FROM task_collaborator
+		WHERE task_id = $1
+		ORDER BY user_id;`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("querying task collaborators: %w", err)
+	}
+	return rowsToTaskCollaborators(rows)
+}
+
+// CollaboratorsByTaskID returns the collaborators of each of the given tasks,
+// trashed or not, ordered by user ID. Tasks without collaborators are left out.
+func (d *DB) CollaboratorsByTaskID(tx db.Tx, ids []todo.TaskID) (map[todo.TaskID][]*todo.TaskCollaborator, error) {
+	rows, err := d.query(tx, `
+		SELECT task_id, user_id, role
+		FROM task_collaborator
+		WHERE task_id = ANY($1)
+		ORDER BY task_id, user_id;`, idsToStrings(ids))
+	if err != nil {
+		return nil, fmt.Errorf("querying task collaborators: %w", err)
+	}
+	cs, err := rowsToTaskCollaborators(rows)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[todo.TaskID][]*todo.TaskCollaborator)
+	for _, c := range cs {
+		out[c.TaskID] = append(out[c.TaskID], c)
+	}
+	return out, nil
+}
+
+func rowsToTaskCollaborators(rows pgx.Rows) ([]*todo.TaskCollaborator, error) {
+	defer rows.Close()
+	var out []*todo.TaskCollaborator
+	for rows.Next() {
+		c := &todo.TaskCollaborator{}
+		if err := rows.Scan(&c.TaskID, &c.UserID, &c.Role); err != nil {
+			return nil, fmt.Errorf("scanning into task collaborator: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing task collaborator rows: %w", err)
+	}
+	return out, nil
+}
+
+// ShareTask gives the user the given role on the task, replacing any role they
+// already had. It returns a not found error if the task or user doesn't exist.
+func (d *DB) ShareTask(tx db.Tx, taskID todo.TaskID, userID todo.UserID, role todo.TaskRole) error {
+	if !role.IsValid() {
+		return fmt.Errorf("invalid task role %q", role)
+	}
+	return d.changeCollaborators(tx, taskID, func(tx db.Tx) error {
+		if _, err := d.Task(tx, taskID); err != nil {
+			return fmt.Errorf("reading task: %w", err)
+		}
+		if _, err := d.User(tx, userID); err != nil {
+			return fmt.Errorf("reading user: %w", err)
+		}
+		err := d.exec(tx, `
+			INSERT INTO task_collaborator
+				(task_id, user_id, role)
+				VALUES
+				($1, $2, $3)
+			ON CONFLICT (task_id, user_id) DO UPDATE SET role = EXCLUDED.role;
+			`, taskID, userID, role)
+		if err != nil {
+			return fmt.Errorf("upserting task collaborator: %w", err)
+		}
+		return nil
+	})
+}
+
+// UnshareTask removes the user's access to the task, returning a not found
+// error if the task wasn't shared with them.
+func (d *DB) UnshareTask(tx db.Tx, taskID todo.TaskID, userID todo.UserID) error {
+	return d.changeCollaborators(tx, taskID, func(tx db.Tx) error {
+		var removed todo.UserID
+		err := d.queryRow(tx, `
+			DELETE FROM task_collaborator
+			WHERE task_id = $1 AND user_id = $2
+			RETURNING user_id;`, taskID, userID).Scan(&removed)
+		return ifNoRows(err, db.NotFound(string(taskID)+":"+string(userID), "task collaborator"), "deleting task collaborator")
+	})
+}
+
+// changeCollaborators runs fn in a transaction, recording the resulting change
+// to the task's collaborators in its history.
+func (d *DB) changeCollaborators(tx db.Tx, taskID todo.TaskID, fn func(tx db.Tx) error) error {
+	return d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		before, err := d.TaskCollaborators(tx, taskID)
+		if err != nil {
+			return fmt.Errorf("reading collaborators pre-change: %w", err)
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		after, err := d.TaskCollaborators(tx, taskID)
+		if err != nil {
+			return fmt.Errorf("reading collaborators post-change: %w", err)
+		}
+		changes, err := todo.DiffTaskCollaborators(before, after)
+		if err != nil {
+			return fmt.Errorf("diffing collaborators: %w", err)
+		}
+		if err := d.recordTaskEvent(tx, taskID, todo.TaskEventUpdated, changes); err != nil {
+			return fmt.Errorf("recording collaborator change: %w", err)
+		}
+		return nil
+	})
+}
+
+// putTask writes the task's mutable fields, it should be run inside of a
+// transaction since tags are written to a separate table. It returns a conflict
+// error if the row is no longer at the version the task was read at, and on
+// success, task.Version is the new version.
+func (d *DB) putTask(tx db.Tx, task *todo.Task) error {
+	row := d.queryRow(tx, `
 		UPDATE task SET
 			name = $2,
 			body = $3,
-			tags = $4
-		WHERE id = $1;
-		`, task.ID, task.Name, task.Body, task.Tags.ToStored())
+			list_id = $4,
+			updated_at = $5,
+			completed_at = $6,
+			due_at = $7,
+			deleted_at = $8,
+			version = version + 1
+		WHERE id = $1 AND version = $9
+		RETURNING version;
+		`, task.ID, task.Name, task.Body, listIDToNullable(task.ListID), task.UpdatedAt, timeToNullable(task.CompletedAt), timeToNullable(task.DueAt), timeToNullable(task.DeletedAt), task.Version)
+	err := row.Scan(&task.Version)
+	if err := ifNoRows(err, db.Conflict(task.ID, "task"), "updating task writable fields"); err != nil {
+		return err
+	}
+	if err := d.putTaskTags(tx, task.ID, task.Tags); err != nil {
+		return fmt.Errorf("updating task tags: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) putTaskTags(tx db.Tx, taskID todo.TaskID, tags todo.Tags) error {
+	if err := db.exec(tx, `DELETE FROM task_tag WHERE task_id = $1;`, taskID); err != nil {
+		return fmt.Errorf("clearing task tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	err := db.exec(tx, `
+		INSERT INTO task_tag
+			(task_id, tag, sort_order)
+			SELECT $1, t.tag, t.ordinal - 1
+			FROM unnest($2::text[]) WITH ORDINALITY AS t(tag, ordinal);
+		`, taskID, []string(tags))
 	if err != nil {
-		return fmt.Errorf("updating task writable fields: %w", err)
+		return fmt.Errorf("inserting task tags: %w", err)
 	}
 	return nil
 }
 
+// TagsForUser returns every tag used on the user's tasks, along with the
+// number of tasks using it, most used first.
+func (db *DB) TagsForUser(tx db.Tx, userID todo.UserID) ([]*todo.TagUsage, error) {
+	rows, err := db.query(tx, `
+		SELECT task_tag.tag, COUNT(*)
+		FROM task_tag
+		JOIN task ON task.id = task_tag.task_id
+		WHERE task.created_by = $1 AND task.deleted_at IS NULL
+		GROUP BY task_tag.tag
+		ORDER BY COUNT(*) DESC, task_tag.tag COLLATE "C";`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying tag usage: %w", err)
+	}
+	defer rows.Close()
+	var out []*todo.TagUsage
+	for rows.Next() {
+		u := &todo.TagUsage{}
+		if err := rows.Scan(&u.Tag, &u.TaskCount); err != nil {
+			return nil, fmt.Errorf("scanning into tag usage: %w", err)
+		}
+		out = append(out, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing tag usage rows: %w", err)
+	}
+	return out, nil
+}
+
 func rowToTask(s rowScanner) (*todo.Task, error) {
-	tagsAsStr := ""
+	var (
+		completedAt, dueAt, deletedAt *time.Time
+		listID                        *todo.ListID
+		parentID                      *todo.TaskID
+		tags                          []string
+	)
 	t := &todo.Task{}
-	err := s.Scan(&t.ID, &t.Name, &t.Body, &tagsAsStr, &t.CreatedBy)
+	err := s.Scan(
+		&t.ID,
+		&t.Name,
+		&t.Body,
+		&t.CreatedBy,
+		&listID,
+		&parentID,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&completedAt,
+		&dueAt,
+		&deletedAt,
+		&t.Version,
+		&tags)
 	if err != nil {
 		return nil, fmt.Errorf("scanning into task: %w", err)
 	}
-	if len(tagsAsStr) > 0 {
-		t.Tags = todo.TagsFromStored(tagsAsStr)
+	t.CompletedAt = timeFromNullable(completedAt)
+	t.DueAt = timeFromNullable(dueAt)
+	t.DeletedAt = timeFromNullable(deletedAt)
+	if listID != nil {
+		t.ListID = *listID
+	}
+	if parentID != nil {
+		t.ParentID = *parentID
+	}
+	if len(tags) > 0 {
+		t.Tags = todo.Tags(tags)
 	}
 	return t, nil
 }
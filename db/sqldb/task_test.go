@@ -32,9 +32,12 @@ func TestCreateTask(t *testing.T) {
 	expected := &todo.Task{
 		ID:        taskID,
 		CreatedBy: userID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
 		Name:      defaultTaskName,
 		Body:      defaultTaskBody,
 		Tags:      todo.Tags{},
+		Version:   1,
 	}
 	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
 		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
@@ -70,15 +73,116 @@ func TestUpdateTask(t *testing.T) {
 	expected := &todo.Task{
 		ID:        taskID,
 		CreatedBy: userID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
 		Name:      taskName,
 		Body:      taskBody,
 		Tags:      todo.Tags{tagA},
+		Version:   2,
 	}
 	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
 		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
 	}
 }
 
+func TestUpdateTaskVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskID, err1 := tdb.CreateTask(tx, userID)
+	noErrDuringSetup(t, err0, err1)
+
+	if err := tdb.UpdateTask(tx, taskID, db.ExpectTaskVersion(1), db.SetTaskName("First")); err != nil {
+		t.Fatalf("updating task at the current version: %v", err)
+	}
+	if err := tdb.UpdateTask(tx, taskID, db.ExpectTaskVersion(1), db.SetTaskName("Second")); !db.IsConflict(err) {
+		t.Errorf("updating task at a stale version returned %v, want conflict", err)
+	}
+
+	// A write based on a stale read is rejected even without an expected
+	// version, e.g. when another transaction wrote the task in between.
+	stale, err := tdb.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	if err := tdb.UpdateTask(tx, taskID, db.SetTaskBody("Body")); err != nil {
+		t.Fatalf("updating task: %v", err)
+	}
+	stale.Name = "Stale"
+	if err := tdb.putTask(tx, stale); !db.IsConflict(err) {
+		t.Errorf("writing a stale task returned %v, want conflict", err)
+	}
+
+	actual, err := tdb.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	if actual.Name != "First" || actual.Version != 3 {
+		t.Errorf("got task %q at version %d, want %q at version 3", actual.Name, actual.Version, "First")
+	}
+}
+
+func TestTaskTags(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskID, err1 := tdb.CreateTask(tx, userID)
+	noErrDuringSetup(t, err0, err1)
+
+	// Commas used to be the separator when tags were stored as a single
+	// string, make sure they survive a round trip now.
+	tagA := "Eggs, Milk, Bread"
+	tagB := "groceries"
+	tagC := "errands"
+	err := tdb.UpdateTask(tx, taskID, db.AddTaskTag(tagA), db.AddTaskTag(tagB), db.AddTaskTag(tagC), db.RemoveTaskTag(tagB))
+	if err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+
+	actual, err := tdb.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	// Tags come back in the order they were added.
+	expected := todo.Tags{tagA, tagC}
+	if diff := cmp.Diff(expected, actual.Tags); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
+func TestTagsForUser(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	emailA := "plankton@example.com"
+	emailB := "krabbs@example.com"
+	userIDA, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(emailA), "User's Name", emailA)
+	userIDB, err1 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(emailB), "User's Name", emailB)
+	taskA1, err2 := tdb.CreateTask(tx, userIDA)
+	taskA2, err3 := tdb.CreateTask(tx, userIDA)
+	taskB1, err4 := tdb.CreateTask(tx, userIDB)
+	err5 := tdb.UpdateTask(tx, taskA1, db.AddTaskTag("evil"), db.AddTaskTag("plans"))
+	err6 := tdb.UpdateTask(tx, taskA2, db.AddTaskTag("evil"))
+	err7 := tdb.UpdateTask(tx, taskB1, db.AddTaskTag("money"))
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5, err6, err7)
+
+	actual, err := tdb.TagsForUser(tx, userIDA)
+	if err != nil {
+		t.Fatalf("getting tags for user: %v", err)
+	}
+	expected := []*todo.TagUsage{
+		{Tag: "evil", TaskCount: 2},
+		{Tag: "plans", TaskCount: 1},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
 func TestListTasks(t *testing.T) {
 	ctx := context.Background()
 	tdb := createDBForTesting(t)
@@ -98,20 +202,27 @@ func TestListTasks(t *testing.T) {
 	err7 := tdb.UpdateTask(tx, taskB1, db.SetTaskName(nameB1))
 	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5, err6, err7)
 
-	actual, err := tdb.TasksByCreator(tx, userIDA)
+	page, err := tdb.TasksByCreator(tx, userIDA, nil)
 	if err != nil {
 		t.Fatalf("listing tasks: %v", err)
 	}
+	actual := page.Tasks
 	expected := []*todo.Task{{
 		ID:        taskA1,
 		CreatedBy: userIDA,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
 		Name:      nameA1,
 		Body:      defaultTaskBody,
+		Version:   2,
 	}, {
 		ID:        taskA2,
 		CreatedBy: userIDA,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
 		Name:      nameA2,
 		Body:      defaultTaskBody,
+		Version:   2,
 	}}
 	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
 		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
@@ -142,21 +253,193 @@ func TestDeleteTask(t *testing.T) {
 		t.Fatalf("deleting task: %v", err)
 	}
 
-	actual, err := tdb.TasksByCreator(tx, userIDA)
+	page, err := tdb.TasksByCreator(tx, userIDA, nil)
 	if err != nil {
 		t.Fatalf("listing tasks: %v", err)
 	}
+	actual := page.Tasks
 	expected := []*todo.Task{{
 		ID:        taskA1,
 		CreatedBy: userIDA,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
 		Name:      nameA1,
 		Body:      defaultTaskBody,
+		Version:   2,
 	}}
 	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
 		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
 	}
 }
 
+func TestListTasksPaginated(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	noErrDuringSetup(t, err0)
+
+	names := []string{"Delta", "alpha", "Charlie", "bravo", "Echo"}
+	for _, name := range names {
+		taskID, err1 := tdb.CreateTask(tx, userID)
+		err2 := tdb.UpdateTask(tx, taskID, db.SetTaskName(name))
+		noErrDuringSetup(t, err1, err2)
+	}
+
+	q := &db.TaskQuery{
+		Sort:  db.TaskSort{Field: db.TaskSortByName},
+		Limit: 2,
+	}
+	var got []string
+	for i := 0; ; i++ {
+		if i > len(names) {
+			t.Fatal("too many pages returned")
+		}
+		page, err := tdb.TasksByCreator(tx, userID, q)
+		if err != nil {
+			t.Fatalf("listing tasks: %v", err)
+		}
+		for _, task := range page.Tasks {
+			got = append(got, task.Name)
+		}
+		if !page.HasNextPage {
+			break
+		}
+		q.After = db.TaskCursor(page.Tasks[len(page.Tasks)-1], q.Sort.Field)
+	}
+
+	// Names are sorted byte-wise, so capitalized names come first.
+	want := []string{"Charlie", "Delta", "Echo", "alpha", "bravo"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
+func TestListTasksFiltered(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskA, err1 := tdb.CreateTask(tx, userID)
+	taskB, err2 := tdb.CreateTask(tx, userID)
+	taskC, err3 := tdb.CreateTask(tx, userID)
+	dueA := time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC)
+	dueB := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	err4 := tdb.UpdateTask(tx, taskA, db.AddTaskTag("work"), db.SetTaskDueAt(dueA))
+	err5 := tdb.UpdateTask(tx, taskB, db.AddTaskTag("work"), db.SetTaskDueAt(dueB), db.SetTaskCompleted(true, time.Now()))
+	err6 := tdb.UpdateTask(tx, taskC, db.AddTaskTag("home"))
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5, err6)
+
+	notCompleted := false
+	tests := []struct {
+		desc string
+		q    *db.TaskQuery
+		want []todo.TaskID
+	}{
+		{
+			desc: "by tag, sorted by due date",
+			q: &db.TaskQuery{
+				Filter: db.TaskFilter{Tag: "work"},
+				Sort:   db.TaskSort{Field: db.TaskSortByDueAt},
+			},
+			want: []todo.TaskID{taskB, taskA},
+		},
+		{
+			desc: "no due date sorts last",
+			q: &db.TaskQuery{
+				Sort: db.TaskSort{Field: db.TaskSortByDueAt},
+			},
+			want: []todo.TaskID{taskB, taskA, taskC},
+		},
+		{
+			desc: "not completed, newest first",
+			q: &db.TaskQuery{
+				Filter: db.TaskFilter{Completed: &notCompleted},
+				Sort:   db.TaskSort{Field: db.TaskSortByCreatedAt, Descending: true},
+			},
+			want: []todo.TaskID{taskC, taskA},
+		},
+		{
+			desc: "created in the future",
+			q: &db.TaskQuery{
+				Filter: db.TaskFilter{CreatedAfter: time.Now().Add(time.Hour)},
+				Sort:   db.TaskSort{Field: db.TaskSortByCreatedAt},
+			},
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			page, err := tdb.TasksByCreator(tx, userID, test.q)
+			if err != nil {
+				t.Fatalf("listing tasks: %v", err)
+			}
+			var got []todo.TaskID
+			for _, task := range page.Tasks {
+				got = append(got, task.ID)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected diff (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleteTaskAndSetDueDate(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	taskID, err1 := tdb.CreateTask(tx, userID)
+	noErrDuringSetup(t, err0, err1)
+
+	completedAt := time.Date(2023, time.March, 4, 5, 6, 7, 0, time.UTC)
+	dueAt := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	err := tdb.UpdateTask(tx, taskID, db.SetTaskCompleted(true, completedAt), db.SetTaskDueAt(dueAt))
+	if err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+
+	actual, err := tdb.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	expected := &todo.Task{
+		ID:          taskID,
+		CreatedBy:   userID,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		Name:        defaultTaskName,
+		Body:        defaultTaskBody,
+		CompletedAt: completedAt,
+		DueAt:       dueAt,
+		Version:     2,
+	}
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+
+	err = tdb.UpdateTask(tx, taskID, db.SetTaskCompleted(false, time.Time{}), db.SetTaskDueAt(time.Time{}))
+	if err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+
+	actual, err = tdb.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	expected.CompletedAt = time.Time{}
+	expected.DueAt = time.Time{}
+	expected.Version = 3
+	if diff := cmp.Diff(expected, actual, taskCmpOpts()); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
 func taskCmpOpts() cmp.Option {
 	userIDLessFn := func(a, b todo.TaskID) bool {
 		return a < b
@@ -171,3 +454,95 @@ func taskCmpOpts() cmp.Option {
 		cmpopts.SortSlices(groupLessFn),
 	}
 }
+
+func TestShareTask(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	ownerID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, "owner@example.com", "Owner", "owner@example.com")
+	viewerID, err1 := tdb.CreateUser(tx, authn.EmailAndPass, "viewer@example.com", "Viewer", "viewer@example.com")
+	editorID, err2 := tdb.CreateUser(tx, authn.EmailAndPass, "editor@example.com", "Editor", "editor@example.com")
+	taskID, err3 := tdb.CreateTask(tx, ownerID)
+	noErrDuringSetup(t, err0, err1, err2, err3)
+
+	err0 = tdb.ShareTask(tx, taskID, viewerID, todo.TaskRoleViewer)
+	err1 = tdb.ShareTask(tx, taskID, editorID, todo.TaskRoleViewer)
+	// Sharing again replaces the existing role.
+	err2 = tdb.ShareTask(tx, taskID, editorID, todo.TaskRoleEditor)
+	noErrDuringSetup(t, err0, err1, err2)
+
+	actual, err := tdb.TaskCollaborators(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task collaborators: %v", err)
+	}
+	expected := []*todo.TaskCollaborator{
+		{TaskID: taskID, UserID: viewerID, Role: todo.TaskRoleViewer},
+		{TaskID: taskID, UserID: editorID, Role: todo.TaskRoleEditor},
+	}
+	sortByUser := cmpopts.SortSlices(func(a, b *todo.TaskCollaborator) bool { return a.UserID < b.UserID })
+	if diff := cmp.Diff(expected, actual, sortByUser); diff != "" {
+		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
+	}
+
+	if err := tdb.UnshareTask(tx, taskID, viewerID); err != nil {
+		t.Fatalf("unsharing task: %v", err)
+	}
+	if err := tdb.UnshareTask(tx, taskID, viewerID); !db.IsNotFound(err) {
+		t.Errorf("unsharing task again returned %v, want not found", err)
+	}
+	if err := tdb.ShareTask(tx, taskID, viewerID, todo.TaskRole("ADMIN")); err == nil {
+		t.Error("expected an error sharing with an invalid role, but got none")
+	}
+
+	actual, err = tdb.TaskCollaborators(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task collaborators: %v", err)
+	}
+	expected = []*todo.TaskCollaborator{
+		{TaskID: taskID, UserID: editorID, Role: todo.TaskRoleEditor},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("unexpected diff after unsharing (-want +got)\n%s", diff)
+	}
+
+	// Purging the task removes its collaborators.
+	if err := tdb.DeleteTask(tx, taskID); err != nil {
+		t.Fatalf("deleting task: %v", err)
+	}
+	if err := tdb.PurgeTask(tx, taskID); err != nil {
+		t.Fatalf("purging task: %v", err)
+	}
+	actual, err = tdb.TaskCollaborators(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task collaborators: %v", err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("expected no collaborators after deleting task, got %d", len(actual))
+	}
+}
+
+func TestTasksForUser(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	userA, err0 := tdb.CreateUser(tx, authn.EmailAndPass, "a@example.com", "User A", "a@example.com")
+	userB, err1 := tdb.CreateUser(tx, authn.EmailAndPass, "b@example.com", "User B", "b@example.com")
+	taskA, err2 := tdb.CreateTask(tx, userA)
+	taskB1, err3 := tdb.CreateTask(tx, userB)
+	_, err4 := tdb.CreateTask(tx, userB)
+	err5 := tdb.ShareTask(tx, taskB1, userA, todo.TaskRoleViewer)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5)
+
+	page, err := tdb.TasksForUser(tx, userA, nil)
+	if err != nil {
+		t.Fatalf("listing tasks for user: %v", err)
+	}
+	var actual []todo.TaskID
+	for _, task := range page.Tasks {
+		actual = append(actual, task.ID)
+	}
+	expected := []todo.TaskID{taskA, taskB1}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
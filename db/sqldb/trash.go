@@ -0,0 +1,198 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"go.uber.org/zap"
+)
+
+// TrashedTask returns the given task, only if it's in the trash.
+func (d *DB) TrashedTask(tx db.Tx, id todo.TaskID) (*todo.Task, error) {
+	task, err := d.taskIncludingTrashed(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !task.IsTrashed() {
+		return nil, db.NotFound(id, "trashed task")
+	}
+	return task, nil
+}
+
+// TrashedTasks returns the tasks created by the given user that are in the
+// trash, most recently deleted first.
+func (d *DB) TrashedTasks(tx db.Tx, creatorID todo.UserID) ([]*todo.Task, error) {
+	rows, err := d.query(tx, `
+		SELECT `+taskColumns+`
+		FROM task
+		WHERE created_by = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id;
+		`, creatorID)
+	if err != nil {
+		return nil, fmt.Errorf("querying trashed tasks: %w", err)
+	}
+	tasks, err := rowsToTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading trashed tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// RestoreTask takes the task out of the trash, returning a not found error if
+// it isn't in the trash.
+func (d *DB) RestoreTask(tx db.Tx, id todo.TaskID) error {
+	err := d.updateTask(tx, id, todo.TaskEventUpdated, requireTrashed(true), func(t *todo.Task) error {
+		t.DeletedAt = time.Time{}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("restoring task: %w", err)
+	}
+	return nil
+}
+
+// PurgeTask permanently deletes a task that's in the trash, returning a not
+// found error if it isn't in the trash.
+func (d *DB) PurgeTask(tx db.Tx, id todo.TaskID) error {
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		task, err := d.TrashedTask(tx, id)
+		if err != nil {
+			return fmt.Errorf("reading trashed task: %w", err)
+		}
+		// The database would promote subtasks and drop dependencies itself, but
+		// we do it here so that the changes show up in the other tasks' history.
+		subtaskIDs, err := d.taskIDs(tx, "SELECT id FROM task WHERE parent_id = $1;", id)
+		if err != nil {
+			return fmt.Errorf("reading subtasks: %w", err)
+		}
+		for _, subtaskID := range subtaskIDs {
+			s, err := d.taskIncludingTrashed(tx, subtaskID)
+			if err != nil {
+				return fmt.Errorf("reading subtask %q: %w", subtaskID, err)
+			}
+			if err := d.updateTaskParent(tx, s, ""); err != nil {
+				return fmt.Errorf("promoting subtask %q: %w", subtaskID, err)
+			}
+		}
+		blockedIDs, err := d.taskIDs(tx, "SELECT task_id FROM task_dependency WHERE blocked_by_id = $1;", id)
+		if err != nil {
+			return fmt.Errorf("reading blocked tasks: %w", err)
+		}
+		for _, blockedID := range blockedIDs {
+			if err := d.RemoveTaskDependency(tx, blockedID, id); err != nil {
+				return fmt.Errorf("unblocking task %q: %w", blockedID, err)
+			}
+		}
+		if err := d.recordTaskDiff(tx, id, todo.TaskEventDeleted, task, nil); err != nil {
+			return fmt.Errorf("recording task purge: %w", err)
+		}
+		if err := d.exec(tx, "DELETE FROM task WHERE id = $1;", id); err != nil {
+			return fmt.Errorf("deleting task: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("running purge task transaction: %w", err)
+	}
+	return nil
+}
+
+// PurgeTrashedTasks permanently deletes every task that was moved to the trash
+// before the given time, returning how many were deleted. Each task is purged
+// in its own transaction, unless tx is already a transaction.
+func (d *DB) PurgeTrashedTasks(tx db.Tx, before time.Time) (int, error) {
+	ids, err := d.taskIDs(tx, "SELECT id FROM task WHERE deleted_at < $1 ORDER BY deleted_at, id;", before)
+	if err != nil {
+		return 0, fmt.Errorf("reading expired tasks: %w", err)
+	}
+	for i, id := range ids {
+		if err := d.PurgeTask(tx, id); err != nil {
+			return i, fmt.Errorf("purging task %q: %w", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+func (d *DB) taskIncludingTrashed(tx db.Tx, id todo.TaskID) (*todo.Task, error) {
+	row := d.queryRow(tx, `
+		SELECT `+taskColumns+`
+		FROM task
+		WHERE id = $1;
+		`, id)
+	task, err := rowToTask(row)
+	if err := ifNoRows(err, db.NotFound(id, "task"), "reading task"); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// taskIDs runs a query that returns a single column of task IDs.
+func (d *DB) taskIDs(tx db.Tx, sql string, args ...interface{}) ([]todo.TaskID, error) {
+	rows, err := d.query(tx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying task IDs: %w", err)
+	}
+	defer rows.Close()
+	var ids []todo.TaskID
+	for rows.Next() {
+		var id todo.TaskID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scanning into task ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing task ID rows: %w", err)
+	}
+	return ids, nil
+}
+
+// TrashPurger periodically purges tasks that have been in the trash for longer
+// than the retention period.
+//
+// Run must be called for anything to be purged.
+type TrashPurger struct {
+	db        *DB
+	retention time.Duration
+	interval  time.Duration
+	logger    *zap.Logger
+}
+
+func NewTrashPurger(db *DB, retention, interval time.Duration, logger *zap.Logger) *TrashPurger {
+	return &TrashPurger{
+		db:        db,
+		retention: retention,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Run purges expired tasks immediately, and then once per interval, until the
+// context is done. It always returns a non-nil error, which is ctx.Err() on a
+// clean shutdown.
+func (p *TrashPurger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.purge(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *TrashPurger) purge(ctx context.Context) {
+	n, err := p.db.PurgeTrashedTasks(p.db.NoTxn(ctx), time.Now().Add(-p.retention))
+	if err != nil && ctx.Err() == nil {
+		p.logger.Error("failed to purge trashed tasks", zap.Int("purged", n), zap.Error(err))
+		return
+	}
+	if n > 0 {
+		p.logger.Info("purged trashed tasks", zap.Int("purged", n))
+	}
+}
@@ -0,0 +1,102 @@
+package sqldb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTrashAndRestoreTask(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	keptID, err1 := tdb.CreateTask(tx, userID)
+	trashedID, err2 := tdb.CreateTask(tx, userID)
+	err3 := tdb.UpdateTask(tx, trashedID, db.AddTaskTag("tag"))
+	err4 := tdb.DeleteTask(tx, trashedID)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+	if _, err := tdb.Task(tx, trashedID); err == nil {
+		t.Error("expected an error reading a trashed task, but got none")
+	}
+	if err := tdb.UpdateTask(tx, trashedID, db.SetTaskName("Name")); !db.IsNotFound(err) {
+		t.Errorf("updating a trashed task returned %v, want not found", err)
+	}
+	if err := tdb.DeleteTask(tx, trashedID); !db.IsNotFound(err) {
+		t.Errorf("deleting a trashed task returned %v, want not found", err)
+	}
+	page, err := tdb.TasksByCreator(tx, userID, nil)
+	if err != nil {
+		t.Fatalf("listing tasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{keptID}, taskIDs(page.Tasks)); diff != "" {
+		t.Errorf("unexpected tasks (-want +got)\n%s", diff)
+	}
+	tags, err := tdb.TagsForUser(tx, userID)
+	if err != nil {
+		t.Fatalf("listing tags: %v", err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("expected no tags from trashed tasks, got %d", len(tags))
+	}
+	trashed, err := tdb.TrashedTasks(tx, userID)
+	if err != nil {
+		t.Fatalf("listing trashed tasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{trashedID}, taskIDs(trashed)); diff != "" {
+		t.Errorf("unexpected trashed tasks (-want +got)\n%s", diff)
+	}
+
+	if err := tdb.RestoreTask(tx, trashedID); err != nil {
+		t.Fatalf("restoring task: %v", err)
+	}
+	if err := tdb.RestoreTask(tx, trashedID); !db.IsNotFound(err) {
+		t.Errorf("restoring a task that isn't trashed returned %v, want not found", err)
+	}
+	if err := tdb.PurgeTask(tx, trashedID); !db.IsNotFound(err) {
+		t.Errorf("purging a task that isn't trashed returned %v, want not found", err)
+	}
+	restored, err := tdb.Task(tx, trashedID)
+	if err != nil {
+		t.Fatalf("reading restored task: %v", err)
+	}
+	if restored.IsTrashed() {
+		t.Errorf("restored task was still trashed at %v", restored.DeletedAt)
+	}
+}
+
+func TestPurgeTrashedTasks(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	oldID, err1 := tdb.CreateTask(tx, userID)
+	err2 := tdb.DeleteTask(tx, oldID)
+	noErrDuringSetup(t, err0, err1, err2)
+	cutoff := time.Now()
+	newID, err0 := tdb.CreateTask(tx, userID)
+	err1 = tdb.DeleteTask(tx, newID)
+	noErrDuringSetup(t, err0, err1)
+
+	n, err := tdb.PurgeTrashedTasks(tx, cutoff)
+	if err != nil {
+		t.Fatalf("purging trashed tasks: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("purged %d tasks, want 1", n)
+	}
+	if _, err := tdb.TrashedTask(tx, oldID); !db.IsNotFound(err) {
+		t.Errorf("reading purged task returned %v, want not found", err)
+	}
+	if _, err := tdb.TrashedTask(tx, newID); err != nil {
+		t.Errorf("reading task trashed after the cutoff: %v", err)
+	}
+}
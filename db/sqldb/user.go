@@ -2,6 +2,7 @@ package sqldb
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Silicon-Ally/silicon-starter/authn"
@@ -10,26 +11,52 @@ import (
 	"github.com/jackc/pgx/v4"
 )
 
-func (db *DB) User(tx db.Tx, id todo.UserID) (*todo.User, error) {
-	row := db.queryRow(tx, `
+func (d *DB) User(tx db.Tx, id todo.UserID) (*todo.User, error) {
+	row := d.queryRow(tx, `
 		SELECT 
-			id, name, email, created_at, auth_provider_type, auth_provider_id	
+			id, name, email, created_at, auth_provider_type, auth_provider_id, is_admin, version
 		FROM user_account
 		WHERE id = $1;
 		`, id)
 	user, err := rowToUser(row)
-	if err != nil {
-		return nil, fmt.Errorf("reading user: %w", err)
+	if err := ifNoRows(err, db.NotFound(id, "user"), "reading user"); err != nil {
+		return nil, err
 	}
 	return user, nil
 }
 
+// UsersByID returns the users with the given IDs, keyed by ID. Users that don't
+// exist are left out, rather than being an error.
+func (d *DB) UsersByID(tx db.Tx, ids []todo.UserID) (map[todo.UserID]*todo.User, error) {
+	rows, err := d.query(tx, `
+		SELECT 
+			id, name, email, created_at, auth_provider_type, auth_provider_id, is_admin, version
+		FROM user_account
+		WHERE id = ANY($1);
+		`, idsToStrings(ids))
+	if err != nil {
+		return nil, fmt.Errorf("querying users: %w", err)
+	}
+	users, err := rowsToUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading users: %w", err)
+	}
+	out := make(map[todo.UserID]*todo.User, len(users))
+	for _, u := range users {
+		out[u.ID] = u
+	}
+	return out, nil
+}
+
+// UserByAuthnProvider returns the user that the given identity is linked to.
 func (d *DB) UserByAuthnProvider(tx db.Tx, authnProvider authn.Provider, authnProvidedUserID authn.UserID) (*todo.User, error) {
 	rows, err := d.query(tx, `
 		SELECT 
-			id, name, email, created_at, auth_provider_type, auth_provider_id	
+			user_account.id, user_account.name, user_account.email, user_account.created_at,
+			auth_provider_type, auth_provider_id, is_admin, version
 		FROM user_account
-		WHERE auth_provider_type = $1 AND auth_provider_id = $2;
+		JOIN auth_identity ON auth_identity.user_id = user_account.id
+		WHERE provider = $1 AND provider_user_id = $2;
 		`, authnProvider, authnProvidedUserID)
 	if err != nil {
 		return nil, fmt.Errorf("reading user by auth: %w", err)
@@ -50,7 +77,7 @@ func (d *DB) UserByAuthnProvider(tx db.Tx, authnProvider authn.Provider, authnPr
 func (db *DB) Users(tx db.Tx) ([]*todo.User, error) {
 	rows, err := db.query(tx, `
 		SELECT 
-			id, name, email, created_at, auth_provider_type, auth_provider_id	
+			id, name, email, created_at, auth_provider_type, auth_provider_id, is_admin, version
 		FROM user_account;`)
 	if err != nil {
 		return nil, fmt.Errorf("querying users: %w", err)
@@ -62,26 +89,125 @@ func (db *DB) Users(tx db.Tx) ([]*todo.User, error) {
 	return users, nil
 }
 
+// ListUsers returns a page of all users, sorted by name.
+func (d *DB) ListUsers(tx db.Tx, q *db.UserQuery) (*db.UserPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid user query: %w", err)
+	}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conds := []string{"TRUE"}
+	if q.Search != "" {
+		pattern := arg("%" + likeEscaper.Replace(q.Search) + "%")
+		conds = append(conds, "(name ILIKE "+pattern+" OR email ILIKE "+pattern+")")
+	}
+	if q.After != "" {
+		k, err := db.DecodeUserCursor(q.After)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		name, id := arg(k.Name), arg(k.ID)
+		conds = append(conds, fmt.Sprintf(`(name COLLATE "C" > %s OR (name = %s AND id COLLATE "C" > %s))`, name, name, id))
+	}
+	sql := `
+		SELECT 
+			id, name, email, created_at, auth_provider_type, auth_provider_id, is_admin, version
+		FROM user_account
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY name COLLATE "C", id COLLATE "C"`
+	if q.Limit > 0 {
+		// We fetch one extra row to determine if there's another page.
+		sql += " LIMIT " + arg(q.Limit+1)
+	}
+	rows, err := d.query(tx, sql+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying users: %w", err)
+	}
+	users, err := rowsToUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading users: %w", err)
+	}
+	page := &db.UserPage{Users: users}
+	if q.Limit > 0 && len(users) > q.Limit {
+		page.Users = users[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
+}
+
+// likeEscaper escapes the characters that are special in LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// TaskCountsByCreator returns how many tasks each of the given users has
+// created, not counting tasks in the trash. Users without any tasks are left
+// out.
+func (d *DB) TaskCountsByCreator(tx db.Tx, ids []todo.UserID) (map[todo.UserID]int, error) {
+	rows, err := d.query(tx, `
+		SELECT created_by, COUNT(*)
+		FROM task
+		WHERE created_by = ANY($1) AND deleted_at IS NULL
+		GROUP BY created_by;
+		`, idsToStrings(ids))
+	if err != nil {
+		return nil, fmt.Errorf("querying task counts: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[todo.UserID]int)
+	for rows.Next() {
+		var (
+			id todo.UserID
+			n  int
+		)
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("scanning task count: %w", err)
+		}
+		out[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("while processing task count rows: %w", err)
+	}
+	return out, nil
+}
+
 const userIDNamespace = "user"
 
 const defaultUserName = "Unnamed User"
 
-func (db *DB) CreateUser(
+// CreateUser creates a user who signs in with the given identity.
+func (d *DB) CreateUser(
 	tx db.Tx,
 	authProviderType authn.Provider,
 	authProviderId authn.UserID,
 	name string,
 	email string) (todo.UserID, error) {
-	id := todo.UserID(db.randomID(userIDNamespace))
+	id := todo.UserID(d.randomID(userIDNamespace))
 	createdAt := time.Now()
-	err := db.exec(tx, `
-		INSERT INTO user_account
-			(id, name, email, created_at, auth_provider_type, auth_provider_id)
-			VALUES
-			($1, $2, $3, $4, $5, $6);
-		`, id, name, email, createdAt, authProviderType, authProviderId)
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		err := d.exec(tx, `
+			INSERT INTO user_account
+				(id, name, email, created_at, auth_provider_type, auth_provider_id)
+				VALUES
+				($1, $2, $3, $4, $5, $6);
+			`, id, name, email, createdAt, authProviderType, authProviderId)
+		if err != nil {
+			return fmt.Errorf("creating user_account row for %s: %w", id, err)
+		}
+		err = d.exec(tx, `
+			INSERT INTO auth_identity
+				(provider, provider_user_id, user_id, email, created_at)
+				VALUES
+				($1, $2, $3, $4, $5);
+			`, authProviderType, authProviderId, id, email, createdAt)
+		if err != nil {
+			return fmt.Errorf("creating auth_identity row for %s: %w", id, err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("creating user_account row for %s: %w", id, err)
+		return "", fmt.Errorf("running create user txn: %w", err)
 	}
 	return id, nil
 }
@@ -113,19 +239,106 @@ func (d *DB) UpdateUser(
 	return nil
 }
 
-func (db *DB) putUser(tx db.Tx, user *todo.User) error {
-	err := db.exec(tx, `
-		UPDATE user_account SET
-			name = $2,
-			email = $3
-		WHERE id = $1;
-		`, user.ID, user.Name, user.Email)
+// DeleteUser permanently deletes the user along with everything they own: the
+// tasks they created, including their history, and their lists. Subtasks and
+// dependencies that other users' tasks have on the deleted tasks are removed,
+// the user is removed from tasks shared with them, and they're no longer named
+// as the actor in the history of other users' tasks.
+func (d *DB) DeleteUser(tx db.Tx, id todo.UserID) error {
+	err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		if _, err := d.User(tx, id); err != nil {
+			return fmt.Errorf("reading user: %w", err)
+		}
+		owned, err := d.taskIDs(tx, "SELECT id FROM task WHERE created_by = $1;", id)
+		if err != nil {
+			return fmt.Errorf("reading owned tasks: %w", err)
+		}
+		ownedIDs := idsToStrings(owned)
+		// Like PurgeTask, we unlink other users' tasks ourselves so that the
+		// changes show up in their history.
+		subtaskIDs, err := d.taskIDs(tx, "SELECT id FROM task WHERE parent_id = ANY($1) AND created_by <> $2;", ownedIDs, id)
+		if err != nil {
+			return fmt.Errorf("reading subtasks: %w", err)
+		}
+		for _, subtaskID := range subtaskIDs {
+			s, err := d.taskIncludingTrashed(tx, subtaskID)
+			if err != nil {
+				return fmt.Errorf("reading subtask %q: %w", subtaskID, err)
+			}
+			if err := d.updateTaskParent(tx, s, ""); err != nil {
+				return fmt.Errorf("promoting subtask %q: %w", subtaskID, err)
+			}
+		}
+		rows, err := d.query(tx, `
+			SELECT task_id, blocked_by_id FROM task_dependency
+			WHERE blocked_by_id = ANY($1) AND NOT task_id = ANY($1);
+			`, ownedIDs)
+		if err != nil {
+			return fmt.Errorf("querying blocked tasks: %w", err)
+		}
+		var deps []*todo.TaskDependency
+		for rows.Next() {
+			var dep todo.TaskDependency
+			if err := rows.Scan(&dep.TaskID, &dep.BlockedByID); err != nil {
+				rows.Close()
+				return fmt.Errorf("scanning dependency: %w", err)
+			}
+			deps = append(deps, &dep)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("while processing dependency rows: %w", err)
+		}
+		for _, dep := range deps {
+			if err := d.RemoveTaskDependency(tx, dep.TaskID, dep.BlockedByID); err != nil {
+				return fmt.Errorf("unblocking task %q: %w", dep.TaskID, err)
+			}
+		}
+
+		// Deleting the tasks cascades to their tags, collaborators and
+		// dependencies.
+		stmts := []struct {
+			desc string
+			sql  string
+			arg  interface{}
+		}{
+			{"deleting history of owned tasks", "DELETE FROM task_event WHERE task_id = ANY($1);", ownedIDs},
+			{"deleting owned tasks", "DELETE FROM task WHERE created_by = $1;", id},
+			{"deleting owned lists", "DELETE FROM list WHERE created_by = $1;", id},
+			{"removing user from shared tasks", "DELETE FROM task_collaborator WHERE user_id = $1;", id},
+			{"anonymizing history", "UPDATE task_event SET actor_id = NULL WHERE actor_id = $1;", id},
+			{"deleting user", "DELETE FROM user_account WHERE id = $1;", id},
+		}
+		for _, stmt := range stmts {
+			if err := d.exec(tx, stmt.sql, stmt.arg); err != nil {
+				return fmt.Errorf("%s: %w", stmt.desc, err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("updating user_account writable fields: %w", err)
+		return fmt.Errorf("running delete user txn: %w", err)
 	}
 	return nil
 }
 
+// putUser writes the user, returning a conflict error if the row is no longer
+// at the version the user was read at. On success, user.Version is the new
+// version.
+func (d *DB) putUser(tx db.Tx, user *todo.User) error {
+	row := d.queryRow(tx, `
+		UPDATE user_account SET
+			name = $2,
+			email = $3,
+			is_admin = $4,
+			version = version + 1
+		WHERE id = $1 AND version = $5
+		RETURNING version;
+		`, user.ID, user.Name, user.Email, user.Admin, user.Version)
+	err := row.Scan(&user.Version)
+	return ifNoRows(err, db.Conflict(user.ID, "user"), "updating user_account writable fields")
+}
+
 func rowToUser(s rowScanner) (*todo.User, error) {
 	u := &todo.User{}
 	err := s.Scan(
@@ -134,7 +347,9 @@ func rowToUser(s rowScanner) (*todo.User, error) {
 		&u.Email,
 		&u.CreatedAt,
 		&u.AuthnProviderType,
-		&u.AuthnProviderID)
+		&u.AuthnProviderID,
+		&u.Admin,
+		&u.Version)
 	if err != nil {
 		return nil, fmt.Errorf("scanning into user: %w", err)
 	}
@@ -33,6 +33,7 @@ func TestCreateUser(t *testing.T) {
 		AuthnProviderType: authn.EmailAndPass,
 		AuthnProviderID:   authn.UserID(email),
 		Email:             email,
+		Version:           1,
 	}
 	if diff := cmp.Diff(expected, actual, userCmpOpts()); diff != "" {
 		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
@@ -73,12 +74,37 @@ func TestUpdateUser(t *testing.T) {
 		AuthnProviderType: authn.EmailAndPass,
 		AuthnProviderID:   authn.UserID(emailA),
 		Email:             emailB,
+		Version:           3,
 	}
 	if diff := cmp.Diff(expected, actual, userCmpOpts()); diff != "" {
 		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
 	}
 }
 
+func TestUpdateUserVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	tdb := createDBForTesting(t)
+	tx := tdb.NoTxn(ctx)
+	email := "user@example.com"
+	userID, err := tdb.CreateUser(tx, authn.EmailAndPass, authn.UserID(email), "User's Name", email)
+	noErrDuringSetup(t, err)
+
+	if err := tdb.UpdateUser(tx, userID, db.ExpectUserVersion(1), db.SetUserName("First")); err != nil {
+		t.Fatalf("updating user at the current version: %v", err)
+	}
+	if err := tdb.UpdateUser(tx, userID, db.ExpectUserVersion(1), db.SetUserName("Second")); !db.IsConflict(err) {
+		t.Errorf("updating user at a stale version returned %v, want conflict", err)
+	}
+
+	actual, err := tdb.User(tx, userID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	if actual.Name != "First" || actual.Version != 2 {
+		t.Errorf("got user %q at version %d, want %q at version 2", actual.Name, actual.Version, "First")
+	}
+}
+
 func TestListUsers(t *testing.T) {
 	ctx := context.Background()
 	tdb := createDBForTesting(t)
@@ -108,6 +134,7 @@ func TestListUsers(t *testing.T) {
 		AuthnProviderType: authn.EmailAndPass,
 		AuthnProviderID:   authn.UserID(emailA),
 		Email:             emailA,
+		Version:           2,
 	}, {
 		ID:                userIDB,
 		Name:              nameB,
@@ -115,6 +142,7 @@ func TestListUsers(t *testing.T) {
 		AuthnProviderType: authn.Facebook,
 		AuthnProviderID:   authn.UserID(fbIDB),
 		Email:             emailB,
+		Version:           2,
 	}, {
 		ID:                userIDC,
 		Name:              "User C",
@@ -122,6 +150,7 @@ func TestListUsers(t *testing.T) {
 		AuthnProviderType: authn.Google,
 		AuthnProviderID:   authn.UserID(googleIDC),
 		Email:             emailC,
+		Version:           1,
 	}}
 	if diff := cmp.Diff(expected, actual, userCmpOpts()); diff != "" {
 		t.Fatalf("unexpected diff (-want +got)\n%s", diff)
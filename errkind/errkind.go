@@ -0,0 +1,96 @@
+// Package errkind categorizes errors by what the caller did wrong, if anything,
+// so that a failure is reported the same way whether it came from the
+// database, an authorization check, or the resolver itself. Errors get a kind
+// either by having a Kind method, or by being wrapped with Wrap or created with
+// New, and keep it when they're wrapped further with fmt.Errorf and %w.
+package errkind
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is the category of an error. The values match the codes reported to
+// GraphQL clients in an error's "code" extension.
+type Kind string
+
+const (
+	// Internal is the kind of every error that isn't the caller's fault, and of
+	// any error that doesn't have a kind.
+	Internal = Kind("INTERNAL")
+	// NotFound means that an entity the caller referred to doesn't exist, or
+	// isn't visible to them.
+	NotFound = Kind("NOT_FOUND")
+	// PermissionDenied means that the caller isn't allowed to do what they
+	// asked.
+	PermissionDenied = Kind("PERMISSION_DENIED")
+	// InvalidArgument means that the request can never succeed as given,
+	// regardless of the state of the system.
+	InvalidArgument = Kind("INVALID_ARGUMENT")
+	// Conflict means that the request conflicts with the current state of the
+	// system, e.g. because an entity changed since the caller read it, or
+	// because something it would create already exists.
+	Conflict = Kind("CONFLICT")
+	// Unauthenticated means that the caller isn't logged in.
+	Unauthenticated = Kind("UNAUTHENTICATED")
+)
+
+// kinded is implemented by errors that know their own kind.
+type kinded interface {
+	Kind() Kind
+}
+
+// Of returns the kind of the outermost error in err's chain that has one, so
+// that wrapping an error can change its kind. It returns Internal if no error
+// in the chain has a kind, and the empty kind if err is nil.
+func Of(err error) Kind {
+	if err == nil {
+		return ""
+	}
+	var k kinded
+	if errors.As(err, &k) {
+		return k.Kind()
+	}
+	return Internal
+}
+
+// Is reports whether err is of the given kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && Of(err) == kind
+}
+
+type kindError struct {
+	kind Kind
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Kind() Kind {
+	return e.kind
+}
+
+// Wrap returns an error of the given kind, with the same message as err, that
+// wraps err. It returns nil if err is nil.
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// New returns an error of the given kind with the given message.
+func New(kind Kind, msg string) error {
+	return Wrap(kind, errors.New(msg))
+}
+
+// Errorf returns an error of the given kind, formatted like fmt.Errorf.
+func Errorf(kind Kind, format string, args ...interface{}) error {
+	return Wrap(kind, fmt.Errorf(format, args...))
+}
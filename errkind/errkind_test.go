@@ -0,0 +1,81 @@
+package errkind
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type notFoundErr struct{}
+
+func (notFoundErr) Error() string { return "not found" }
+func (notFoundErr) Kind() Kind    { return NotFound }
+
+func TestOf(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	tests := []struct {
+		desc string
+		err  error
+		want Kind
+	}{
+		{
+			desc: "nil",
+			err:  nil,
+			want: "",
+		},
+		{
+			desc: "no kind",
+			err:  sentinel,
+			want: Internal,
+		},
+		{
+			desc: "own kind",
+			err:  notFoundErr{},
+			want: NotFound,
+		},
+		{
+			desc: "wrapped kind",
+			err:  fmt.Errorf("reading: %w", notFoundErr{}),
+			want: NotFound,
+		},
+		{
+			desc: "new",
+			err:  New(InvalidArgument, "bad"),
+			want: InvalidArgument,
+		},
+		{
+			desc: "errorf",
+			err:  fmt.Errorf("outer: %w", Errorf(Conflict, "inner: %w", sentinel)),
+			want: Conflict,
+		},
+		{
+			desc: "outermost kind wins",
+			err:  Wrap(PermissionDenied, fmt.Errorf("reading: %w", notFoundErr{})),
+			want: PermissionDenied,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := Of(test.err); got != test.want {
+				t.Errorf("Of(%v) = %q, want %q", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestWrapKeepsChain(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	err := fmt.Errorf("outer: %w", Wrap(Conflict, sentinel))
+	if !errors.Is(err, sentinel) {
+		t.Errorf("expected %v to wrap the sentinel error", err)
+	}
+	if got, want := err.Error(), "outer: sentinel"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+	if Wrap(Conflict, nil) != nil {
+		t.Error("expected wrapping a nil error to return nil")
+	}
+	if !Is(err, Conflict) || Is(err, NotFound) || Is(nil, "") {
+		t.Errorf("unexpected result from Is for error of kind %q", Of(err))
+	}
+}
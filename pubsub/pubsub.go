@@ -0,0 +1,93 @@
+// Package pubsub notifies interested parties about changes to tasks. The
+// InProcess implementation only delivers events published from within the
+// same process, implementations that span multiple server instances (e.g.
+// backed by Postgres LISTEN/NOTIFY) should satisfy the same methods.
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+type TaskEventKind string
+
+const (
+	TaskCreated = TaskEventKind("CREATED")
+	TaskUpdated = TaskEventKind("UPDATED")
+	TaskDeleted = TaskEventKind("DELETED")
+)
+
+// TaskEvent describes a change to a task that has already been committed.
+type TaskEvent struct {
+	Kind   TaskEventKind
+	TaskID todo.TaskID
+	// UserID is the owner of the task, events are delivered to subscribers of
+	// this user.
+	UserID todo.UserID
+}
+
+// subscriberBufferSize is the number of events that can be queued for a
+// subscriber before further events are dropped.
+const subscriberBufferSize = 64
+
+type subscription struct {
+	ch chan *TaskEvent
+}
+
+// InProcess is an in-memory broker for task events. The zero value isn't
+// usable, use NewInProcess.
+type InProcess struct {
+	mu   sync.Mutex
+	subs map[todo.UserID]map[*subscription]struct{}
+}
+
+func NewInProcess() *InProcess {
+	return &InProcess{
+		subs: make(map[todo.UserID]map[*subscription]struct{}),
+	}
+}
+
+// PublishTaskEvent delivers the event to every current subscriber for the
+// task's owner. It never blocks, if a subscriber isn't keeping up with events,
+// the event is dropped for that subscriber.
+func (p *InProcess) PublishTaskEvent(_ context.Context, e *TaskEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for sub := range p.subs[e.UserID] {
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+	return nil
+}
+
+// SubscribeToTaskEvents returns a channel that receives events for tasks owned
+// by the given user. The channel is closed once the context is done.
+func (p *InProcess) SubscribeToTaskEvents(ctx context.Context, userID todo.UserID) (<-chan *TaskEvent, error) {
+	sub := &subscription{ch: make(chan *TaskEvent, subscriberBufferSize)}
+
+	p.mu.Lock()
+	if _, ok := p.subs[userID]; !ok {
+		p.subs[userID] = make(map[*subscription]struct{})
+	}
+	p.subs[userID][sub] = struct{}{}
+	p.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.subs[userID], sub)
+		if len(p.subs[userID]) == 0 {
+			delete(p.subs, userID)
+		}
+		// Closing while holding the lock guarantees PublishTaskEvent won't send
+		// on the closed channel.
+		close(sub.ch)
+	}()
+
+	return sub.ch, nil
+}
@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPublishAndSubscribe(t *testing.T) {
+	ps := NewInProcess()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userA, userB := todo.UserID("user.a"), todo.UserID("user.b")
+	chA, err := ps.SubscribeToTaskEvents(ctx, userA)
+	if err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+
+	events := []*TaskEvent{
+		{Kind: TaskCreated, TaskID: "task.1", UserID: userA},
+		{Kind: TaskCreated, TaskID: "task.2", UserID: userB},
+		{Kind: TaskDeleted, TaskID: "task.1", UserID: userA},
+	}
+	for _, e := range events {
+		if err := ps.PublishTaskEvent(ctx, e); err != nil {
+			t.Fatalf("publishing event: %v", err)
+		}
+	}
+
+	expected := []*TaskEvent{events[0], events[2]}
+	var actual []*TaskEvent
+	for range expected {
+		actual = append(actual, receive(t, chA))
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
+func TestSubscriptionClosedWhenContextDone(t *testing.T) {
+	ps := NewInProcess()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := ps.SubscribeToTaskEvents(ctx, "user.a")
+	if err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected channel to be closed, but received an event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the channel to be closed")
+	}
+
+	// Publishing after the subscription is gone shouldn't block or panic.
+	if err := ps.PublishTaskEvent(context.Background(), &TaskEvent{Kind: TaskUpdated, TaskID: "task.1", UserID: "user.a"}); err != nil {
+		t.Fatalf("publishing event: %v", err)
+	}
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	ps := NewInProcess()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := ps.SubscribeToTaskEvents(ctx, "user.a"); err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+
+	// Nobody is reading, so all of these past the buffer size get dropped.
+	for i := 0; i < subscriberBufferSize*2; i++ {
+		if err := ps.PublishTaskEvent(ctx, &TaskEvent{Kind: TaskUpdated, TaskID: "task.1", UserID: "user.a"}); err != nil {
+			t.Fatalf("publishing event: %v", err)
+		}
+	}
+}
+
+func receive(t *testing.T, ch <-chan *TaskEvent) *TaskEvent {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("channel was closed before receiving an event")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
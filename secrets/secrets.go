@@ -23,10 +23,20 @@ const (
 
 type TodoSecretsConfig struct {
 	Postgres *pgxpool.Config
+	// OIDCSessionKey signs session cookies when signing in with an OpenID
+	// Connect issuer, and is nil if the config has no 'oidc' section.
+	OIDCSessionKey []byte
 }
 
 type connectPlatformConfig struct {
 	PostgresConfig *postgresConfig `json:"postgres"`
+	OIDCConfig     *oidcConfig     `json:"oidc"`
+}
+
+type oidcConfig struct {
+	// SessionKey is base64-encoded, which is how encoding/json decodes a
+	// []byte.
+	SessionKey []byte `json:"session_key"`
 }
 
 func LoadTodoSecrets(name string) (*TodoSecretsConfig, error) {
@@ -40,8 +50,14 @@ func LoadTodoSecrets(name string) (*TodoSecretsConfig, error) {
 		return nil, fmt.Errorf("failed to load 'postgres' config: %w", err)
 	}
 
+	var sessionKey []byte
+	if cfg.OIDCConfig != nil {
+		sessionKey = cfg.OIDCConfig.SessionKey
+	}
+
 	return &TodoSecretsConfig{
-		Postgres: pgxCfg,
+		Postgres:       pgxCfg,
+		OIDCSessionKey: sessionKey,
 	}, nil
 }
 
@@ -131,6 +131,47 @@ func TestLoadMigratorConfig(t *testing.T) {
 	}
 }
 
+func TestLoadTodoSecretsOIDCSessionKey(t *testing.T) {
+	tests := []struct {
+		desc     string
+		contents string
+		want     []byte
+	}{
+		{
+			desc: "with session key",
+			contents: `{
+  "postgres": {"host": "test-host"},
+  "oidc": {"session_key": "c2Vzc2lvbi1rZXk="}
+}`,
+			want: []byte("session-key"),
+		},
+		{
+			desc:     "without oidc section",
+			contents: `{"postgres": {"host": "test-host"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			sopsPath, ok := bazel.FindBinary("cmd/sops", "sops")
+			if !ok {
+				t.Fatal("'sops' binary not found in runfiles")
+			}
+			sopsCfg := testsops.EncryptJSON(t, test.contents, testsops.WithSOPSBinary(sopsPath))
+
+			t.Setenv("SOPS_AGE_KEY_FILE", sopsCfg.KeyPath)
+			got, err := LoadTodoSecrets(sopsCfg.EncryptedContentsPath)
+			if err != nil {
+				t.Fatalf("failed to load todo secrets: %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, got.OIDCSessionKey); diff != "" {
+				t.Errorf("unexpected OIDC session key (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
 func compareMigratorConfigs() cmp.Option {
 	// We add a custom comparer for *pgx.ConnConfig because it contains lots of
 	// fields we don't actually care about.
@@ -0,0 +1,1347 @@
+// Package dbtest is a conformance suite for implementations of the database,
+// which checks that they behave alike, so that tests written against one of
+// them, like the in-memory testdb, hold for the others.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// DB is everything that the server and the session handler need from a
+// database.
+type DB interface {
+	Begin(context.Context) (db.Tx, error)
+	NoTxn(context.Context) db.Tx
+	Transactional(context.Context, func(tx db.Tx) error) error
+	RunOrContinueTransaction(db.Tx, func(tx db.Tx) error) error
+
+	User(db.Tx, todo.UserID) (*todo.User, error)
+	UsersByID(db.Tx, []todo.UserID) (map[todo.UserID]*todo.User, error)
+	Users(db.Tx) ([]*todo.User, error)
+	ListUsers(db.Tx, *db.UserQuery) (*db.UserPage, error)
+	UserByAuthnProvider(db.Tx, authn.Provider, authn.UserID) (*todo.User, error)
+	CreateUser(db.Tx, authn.Provider, authn.UserID, string, string) (todo.UserID, error)
+	UpdateUser(db.Tx, todo.UserID, ...db.UpdateUserFn) error
+	DeleteUser(db.Tx, todo.UserID) error
+
+	AuthIdentities(db.Tx, todo.UserID) ([]*todo.AuthIdentity, error)
+	LinkAuthIdentity(db.Tx, *todo.AuthIdentity) error
+	UnlinkAuthIdentity(db.Tx, todo.UserID, authn.Provider, authn.UserID) error
+	UsersByVerifiedEmail(db.Tx, string) ([]*todo.User, error)
+
+	RevokeSessions(db.Tx, authn.Provider, authn.UserID, time.Time) error
+	SessionsRevokedAt(db.Tx, authn.Provider, authn.UserID) (time.Time, error)
+
+	Task(db.Tx, todo.TaskID) (*todo.Task, error)
+	TasksByID(db.Tx, []todo.TaskID) (map[todo.TaskID]*todo.Task, error)
+	TasksByCreator(db.Tx, todo.UserID, *db.TaskQuery) (*db.TaskPage, error)
+	TasksForUser(db.Tx, todo.UserID, *db.TaskQuery) (*db.TaskPage, error)
+	SearchTasks(db.Tx, todo.UserID, *db.TaskSearchQuery) (*db.TaskSearchPage, error)
+	TagsForUser(db.Tx, todo.UserID) ([]*todo.TagUsage, error)
+	TaskCountsByCreator(db.Tx, []todo.UserID) (map[todo.UserID]int, error)
+	CreateTask(db.Tx, todo.UserID) (todo.TaskID, error)
+	UpdateTask(db.Tx, todo.TaskID, ...db.UpdateTaskFn) error
+	DeleteTask(db.Tx, todo.TaskID) error
+
+	TaskCollaborators(db.Tx, todo.TaskID) ([]*todo.TaskCollaborator, error)
+	CollaboratorsByTaskID(db.Tx, []todo.TaskID) (map[todo.TaskID][]*todo.TaskCollaborator, error)
+	ShareTask(db.Tx, todo.TaskID, todo.UserID, todo.TaskRole) error
+	UnshareTask(db.Tx, todo.TaskID, todo.UserID) error
+
+	List(db.Tx, todo.ListID) (*todo.List, error)
+	ListsByCreator(db.Tx, todo.UserID) ([]*todo.List, error)
+	CreateList(db.Tx, todo.UserID, string) (todo.ListID, error)
+	UpdateList(db.Tx, todo.ListID, ...db.UpdateListFn) error
+	TasksInList(db.Tx, todo.ListID) ([]*todo.Task, error)
+	DeleteList(db.Tx, todo.ListID, db.ListTaskDisposition, todo.ListID) error
+
+	Subtasks(db.Tx, todo.TaskID) ([]*todo.Task, error)
+	SetTaskParent(db.Tx, todo.TaskID, todo.TaskID) error
+	BlockingTasks(db.Tx, todo.TaskID) ([]*todo.Task, error)
+	BlockedTasks(db.Tx, todo.TaskID) ([]*todo.Task, error)
+	AddTaskDependency(db.Tx, todo.TaskID, todo.TaskID) error
+	RemoveTaskDependency(db.Tx, todo.TaskID, todo.TaskID) error
+
+	TaskHistory(db.Tx, todo.TaskID, *db.TaskEventQuery) (*db.TaskEventPage, error)
+
+	TrashedTask(db.Tx, todo.TaskID) (*todo.Task, error)
+	TrashedTasks(db.Tx, todo.UserID) ([]*todo.Task, error)
+	RestoreTask(db.Tx, todo.TaskID) error
+	PurgeTask(db.Tx, todo.TaskID) error
+	PurgeTrashedTasks(db.Tx, time.Time) (int, error)
+}
+
+// Run runs the suite, calling newDB for a new, empty database for each test.
+//
+// Implementations are free to pick their own IDs and default task contents, so
+// the suite doesn't check them.
+func Run(t *testing.T, newDB func(t *testing.T) DB) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, d DB)
+	}{
+		{"Users", testUsers},
+		{"UserDirectory", testUserDirectory},
+		{"DeleteUser", testDeleteUser},
+		{"AuthIdentities", testAuthIdentities},
+		{"SessionRevocations", testSessionRevocations},
+		{"NotFound", testNotFound},
+		{"Tasks", testTasks},
+		{"TaskListings", testTaskListings},
+		{"BatchLookups", testBatchLookups},
+		{"Search", testSearch},
+		{"Trash", testTrash},
+		{"Collaborators", testCollaborators},
+		{"Lists", testLists},
+		{"Hierarchy", testHierarchy},
+		{"History", testHistory},
+		{"Transactions", testTransactions},
+		{"NestedTransactions", testNestedTransactions},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newDB(t))
+		})
+	}
+}
+
+const (
+	missingUserID = todo.UserID("user.missing")
+	missingTaskID = todo.TaskID("task.missing")
+	missingListID = todo.ListID("list.missing")
+)
+
+func noErrDuringSetup(t testing.TB, errs ...error) {
+	t.Helper()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("error during setup at index %d: %v", i, err)
+		}
+	}
+}
+
+func createUser(t *testing.T, d DB, name string) todo.UserID {
+	t.Helper()
+	email := name + "@example.com"
+	id, err := d.CreateUser(d.NoTxn(context.Background()), authn.EmailAndPass, authn.UserID(email), name, email)
+	if err != nil {
+		t.Fatalf("creating user %q: %v", name, err)
+	}
+	return id
+}
+
+// createTask creates a task with the given name, so that the task's contents
+// don't depend on the implementation's defaults.
+func createTask(t *testing.T, d DB, userID todo.UserID, name string) todo.TaskID {
+	t.Helper()
+	tx := d.NoTxn(context.Background())
+	id, err := d.CreateTask(tx, userID)
+	if err != nil {
+		t.Fatalf("creating task %q: %v", name, err)
+	}
+	if err := d.UpdateTask(tx, id, db.SetTaskName(name), db.SetTaskBody("")); err != nil {
+		t.Fatalf("naming task %q: %v", name, err)
+	}
+	return id
+}
+
+func taskIDs(tasks []*todo.Task) []todo.TaskID {
+	var ids []todo.TaskID
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func testUsers(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	aliceID := createUser(t, d, "alice")
+	bobID := createUser(t, d, "bob")
+
+	alice, err := d.User(tx, aliceID)
+	if err != nil {
+		t.Fatalf("reading user: %v", err)
+	}
+	want := &todo.User{
+		ID:                aliceID,
+		Name:              "alice",
+		Email:             "alice@example.com",
+		AuthnProviderType: authn.EmailAndPass,
+		AuthnProviderID:   "alice@example.com",
+		Version:           1,
+	}
+	if diff := cmp.Diff(want, alice, cmpopts.IgnoreFields(todo.User{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected user (-want +got)\n%s", diff)
+	}
+	if alice.CreatedAt.IsZero() {
+		t.Error("user had no creation time")
+	}
+
+	bob, err := d.UserByAuthnProvider(tx, authn.EmailAndPass, "bob@example.com")
+	if err != nil {
+		t.Fatalf("reading user by authn provider: %v", err)
+	}
+	if bob.ID != bobID {
+		t.Errorf("read user %q by authn provider, want %q", bob.ID, bobID)
+	}
+
+	users, err := d.Users(tx)
+	if err != nil {
+		t.Fatalf("reading users: %v", err)
+	}
+	var gotIDs []todo.UserID
+	for _, u := range users {
+		gotIDs = append(gotIDs, u.ID)
+	}
+	sortIDs := cmpopts.SortSlices(func(a, b todo.UserID) bool { return a < b })
+	if diff := cmp.Diff([]todo.UserID{aliceID, bobID}, gotIDs, sortIDs); diff != "" {
+		t.Errorf("unexpected users (-want +got)\n%s", diff)
+	}
+
+	if err := d.UpdateUser(tx, aliceID, db.ExpectUserVersion(1), db.SetUserName("Alice"), db.SetUserEmail("alice@example.org")); err != nil {
+		t.Fatalf("updating user: %v", err)
+	}
+	if err := d.UpdateUser(tx, aliceID, db.ExpectUserVersion(1), db.SetUserName("Stale")); !db.IsConflict(err) {
+		t.Errorf("updating user at a stale version returned %v, want a conflict", err)
+	}
+	alice, err = d.User(tx, aliceID)
+	if err != nil {
+		t.Fatalf("reading updated user: %v", err)
+	}
+	if alice.Name != "Alice" || alice.Email != "alice@example.org" || alice.Version != 2 {
+		t.Errorf("got user with name %q, email %q and version %d, want %q, %q and 2", alice.Name, alice.Email, alice.Version, "Alice", "alice@example.org")
+	}
+}
+
+func testUserDirectory(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	carol := createUser(t, d, "carol")
+	alice := createUser(t, d, "alice")
+	bob := createUser(t, d, "bob")
+	_ = createTask(t, d, alice, "kept")
+	trashed := createTask(t, d, alice, "trashed")
+	_ = createTask(t, d, bob, "bob's")
+	err0 := d.DeleteTask(tx, trashed)
+	err1 := d.UpdateUser(tx, carol, db.SetUserEmail("carol@Example.org"), db.SetUserAdmin(true))
+	noErrDuringSetup(t, err0, err1)
+
+	u, err := d.User(tx, carol)
+	if err != nil {
+		t.Fatalf("reading admin user: %v", err)
+	}
+	if !u.Admin {
+		t.Error("user wasn't an admin after making them one")
+	}
+
+	userIDs := func(us []*todo.User) []todo.UserID {
+		var ids []todo.UserID
+		for _, u := range us {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		desc string
+		q    *db.UserQuery
+		want []todo.UserID
+	}{
+		{"everyone", &db.UserQuery{}, []todo.UserID{alice, bob, carol}},
+		{"name", &db.UserQuery{Search: "LIC"}, []todo.UserID{alice}},
+		{"email", &db.UserQuery{Search: "example.ORG"}, []todo.UserID{carol}},
+		{"wildcards are literal", &db.UserQuery{Search: "%"}, nil},
+	}
+	for _, test := range tests {
+		page, err := d.ListUsers(tx, test.q)
+		if err != nil {
+			t.Fatalf("%s: listing users: %v", test.desc, err)
+		}
+		if diff := cmp.Diff(test.want, userIDs(page.Users)); diff != "" {
+			t.Errorf("%s: unexpected users (-want +got)\n%s", test.desc, diff)
+		}
+	}
+
+	var paged []todo.UserID
+	q := &db.UserQuery{Limit: 2}
+	for i := 0; ; i++ {
+		if i > 3 {
+			t.Fatal("got more pages than users")
+		}
+		page, err := d.ListUsers(tx, q)
+		if err != nil {
+			t.Fatalf("listing page %d of users: %v", i, err)
+		}
+		paged = append(paged, userIDs(page.Users)...)
+		if !page.HasNextPage {
+			break
+		}
+		q.After = db.UserCursor(page.Users[len(page.Users)-1])
+	}
+	if diff := cmp.Diff([]todo.UserID{alice, bob, carol}, paged); diff != "" {
+		t.Errorf("unexpected users when paging (-want +got)\n%s", diff)
+	}
+
+	counts, err := d.TaskCountsByCreator(tx, []todo.UserID{alice, bob, carol, missingUserID})
+	if err != nil {
+		t.Fatalf("counting tasks: %v", err)
+	}
+	want := map[todo.UserID]int{alice: 1, bob: 1}
+	if diff := cmp.Diff(want, counts); diff != "" {
+		t.Errorf("unexpected task counts, trashed tasks shouldn't count (-want +got)\n%s", diff)
+	}
+}
+
+func testDeleteUser(t *testing.T, d DB) {
+	alice := createUser(t, d, "alice")
+	bob := createUser(t, d, "bob")
+	aliceTx := d.NoTxn(todo.WithUserID(context.Background(), alice))
+	tx := d.NoTxn(context.Background())
+	owned := createTask(t, d, alice, "owned")
+	trashed := createTask(t, d, alice, "trashed")
+	others := createTask(t, d, bob, "bob's")
+	listID, err0 := d.CreateList(tx, alice, "list")
+	err1 := d.UpdateTask(tx, owned, db.SetTaskList(listID), db.AddTaskTag("x"))
+	err2 := d.DeleteTask(tx, trashed)
+	err3 := d.ShareTask(tx, owned, bob, todo.TaskRoleEditor)
+	err4 := d.ShareTask(tx, others, alice, todo.TaskRoleEditor)
+	err5 := d.SetTaskParent(tx, others, owned)
+	err6 := d.AddTaskDependency(tx, others, owned)
+	err7 := d.UpdateTask(aliceTx, others, db.SetTaskBody("edited by alice"))
+	noErrDuringSetup(t, err0, err1, err2, err3, err4, err5, err6, err7)
+
+	if err := d.DeleteUser(tx, alice); err != nil {
+		t.Fatalf("deleting user: %v", err)
+	}
+
+	if _, err := d.User(tx, alice); !db.IsNotFound(err) {
+		t.Errorf("reading deleted user returned %v, want not found", err)
+	}
+	if _, err := d.User(tx, bob); err != nil {
+		t.Errorf("reading other user: %v", err)
+	}
+	if _, err := d.Task(tx, owned); !db.IsNotFound(err) {
+		t.Errorf("reading deleted user's task returned %v, want not found", err)
+	}
+	if _, err := d.TrashedTask(tx, trashed); !db.IsNotFound(err) {
+		t.Errorf("reading deleted user's trashed task returned %v, want not found", err)
+	}
+	if _, err := d.List(tx, listID); !db.IsNotFound(err) {
+		t.Errorf("reading deleted user's list returned %v, want not found", err)
+	}
+
+	task, err := d.Task(tx, others)
+	if err != nil {
+		t.Fatalf("reading other user's task: %v", err)
+	}
+	if task.ParentID != "" || task.Body != "edited by alice" {
+		t.Errorf("other user's task had parent %q and body %q, want no parent and the body unchanged", task.ParentID, task.Body)
+	}
+	blocking, err := d.BlockingTasks(tx, others)
+	if err != nil {
+		t.Fatalf("reading blocking tasks: %v", err)
+	}
+	if len(blocking) != 0 {
+		t.Errorf("other user's task was still blocked by %d tasks", len(blocking))
+	}
+	collaborators, err := d.TaskCollaborators(tx, others)
+	if err != nil {
+		t.Fatalf("reading collaborators: %v", err)
+	}
+	if len(collaborators) != 0 {
+		t.Errorf("other user's task still had %d collaborators", len(collaborators))
+	}
+	history, err := d.TaskHistory(tx, others, &db.TaskEventQuery{})
+	if err != nil {
+		t.Fatalf("reading history: %v", err)
+	}
+	for _, e := range history.Events {
+		if e.ActorID == alice {
+			t.Errorf("event %q still named the deleted user as its actor", e.ID)
+		}
+	}
+
+	if err := d.DeleteUser(tx, missingUserID); !db.IsNotFound(err) {
+		t.Errorf("deleting missing user returned %v, want not found", err)
+	}
+}
+
+func testAuthIdentities(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	alice := createUser(t, d, "alice")
+	bob := createUser(t, d, "bob")
+
+	type identity struct {
+		Provider authn.Provider
+		ID       authn.UserID
+		Email    string
+		Verified bool
+	}
+	identities := func(userID todo.UserID) []identity {
+		t.Helper()
+		as, err := d.AuthIdentities(tx, userID)
+		if err != nil {
+			t.Fatalf("reading auth identities: %v", err)
+		}
+		var out []identity
+		for _, a := range as {
+			if a.UserID != userID || a.CreatedAt.IsZero() {
+				t.Errorf("identity %s:%s had user %q and creation time %v, want %q and a creation time", a.Provider, a.ProviderUserID, a.UserID, a.CreatedAt, userID)
+			}
+			out = append(out, identity{a.Provider, a.ProviderUserID, a.Email, a.EmailVerified})
+		}
+		return out
+	}
+	verifiedUsers := func(email string) []todo.UserID {
+		t.Helper()
+		us, err := d.UsersByVerifiedEmail(tx, email)
+		if err != nil {
+			t.Fatalf("reading users by email: %v", err)
+		}
+		var ids []todo.UserID
+		for _, u := range us {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+
+	want := []identity{{authn.EmailAndPass, "alice@example.com", "alice@example.com", false}}
+	if diff := cmp.Diff(want, identities(alice)); diff != "" {
+		t.Errorf("unexpected identities for new user (-want +got)\n%s", diff)
+	}
+	if got := verifiedUsers("alice@example.com"); len(got) != 0 {
+		t.Errorf("found users %q by an unverified email, want none", got)
+	}
+
+	google := &todo.AuthIdentity{
+		UserID:         alice,
+		Provider:       authn.Google,
+		ProviderUserID: "google-alice",
+		Email:          "Alice@Example.com",
+		EmailVerified:  true,
+	}
+	if err := d.LinkAuthIdentity(tx, google); err != nil {
+		t.Fatalf("linking identity: %v", err)
+	}
+	// Linking again updates the email, rather than failing.
+	google.Email = "alice@example.com"
+	if err := d.LinkAuthIdentity(tx, google); err != nil {
+		t.Fatalf("relinking identity: %v", err)
+	}
+	want = append(want, identity{authn.Google, "google-alice", "alice@example.com", true})
+	if diff := cmp.Diff(want, identities(alice)); diff != "" {
+		t.Errorf("unexpected identities after linking (-want +got)\n%s", diff)
+	}
+
+	u, err := d.UserByAuthnProvider(tx, authn.Google, "google-alice")
+	if err != nil {
+		t.Fatalf("reading user by linked identity: %v", err)
+	}
+	if u.ID != alice {
+		t.Errorf("read user %q by linked identity, want %q", u.ID, alice)
+	}
+	if diff := cmp.Diff([]todo.UserID{alice}, verifiedUsers("ALICE@example.com")); diff != "" {
+		t.Errorf("unexpected users by verified email (-want +got)\n%s", diff)
+	}
+
+	// Alice has a task, so linking her identity to Bob would strand it.
+	createTask(t, d, alice, "Alice's task")
+	stolen := google.Clone()
+	stolen.UserID = bob
+	if err := d.LinkAuthIdentity(tx, stolen); !errkind.Is(err, errkind.Conflict) {
+		t.Errorf("linking the identity of another user with tasks returned %v, want a conflict", err)
+	}
+
+	// Users with nothing to lose are merged into the user linking their
+	// identity, and deleted once they have no identities left. Moved
+	// identities keep when they were created.
+	carol := createUser(t, d, "carol")
+	carolAlt := &todo.AuthIdentity{UserID: carol, Provider: authn.Facebook, ProviderUserID: "facebook-carol", Email: "carol@example.com"}
+	noErrDuringSetup(t, d.LinkAuthIdentity(tx, carolAlt))
+	for _, a := range []*todo.AuthIdentity{
+		{UserID: bob, Provider: authn.Facebook, ProviderUserID: "facebook-carol", Email: "carol@example.com"},
+		{UserID: bob, Provider: authn.EmailAndPass, ProviderUserID: "carol@example.com", Email: "carol@example.com", EmailVerified: true},
+	} {
+		if err := d.LinkAuthIdentity(tx, a); err != nil {
+			t.Fatalf("linking identity %s:%s of an empty user: %v", a.Provider, a.ProviderUserID, err)
+		}
+		if a.Provider == authn.Facebook {
+			if _, err := d.User(tx, carol); err != nil {
+				t.Errorf("reading a merged user who still has an identity: %v", err)
+			}
+		}
+	}
+	wantBob := []identity{
+		{authn.EmailAndPass, "bob@example.com", "bob@example.com", false},
+		{authn.EmailAndPass, "carol@example.com", "carol@example.com", true},
+		{authn.Facebook, "facebook-carol", "carol@example.com", false},
+	}
+	if diff := cmp.Diff(wantBob, identities(bob)); diff != "" {
+		t.Errorf("unexpected identities after merging (-want +got)\n%s", diff)
+	}
+	if _, err := d.User(tx, carol); !db.IsNotFound(err) {
+		t.Errorf("reading a merged user with no identities left returned %v, want not found", err)
+	}
+	missing := google.Clone()
+	missing.UserID = missingUserID
+	missing.ProviderUserID = "google-missing"
+	if err := d.LinkAuthIdentity(tx, missing); !errkind.Is(err, errkind.NotFound) {
+		t.Errorf("linking an identity to a missing user returned %v, want not found", err)
+	}
+
+	if err := d.UnlinkAuthIdentity(tx, bob, authn.Google, "google-alice"); !db.IsNotFound(err) {
+		t.Errorf("unlinking another user's identity returned %v, want not found", err)
+	}
+	if err := d.UnlinkAuthIdentity(tx, alice, authn.EmailAndPass, "alice@example.com"); err != nil {
+		t.Fatalf("unlinking identity: %v", err)
+	}
+	if err := d.UnlinkAuthIdentity(tx, alice, authn.Google, "google-alice"); !errkind.Is(err, errkind.Conflict) {
+		t.Errorf("unlinking the last identity returned %v, want a conflict", err)
+	}
+	if diff := cmp.Diff(want[1:], identities(alice)); diff != "" {
+		t.Errorf("unexpected identities after unlinking (-want +got)\n%s", diff)
+	}
+	if _, err := d.UserByAuthnProvider(tx, authn.EmailAndPass, "alice@example.com"); !db.IsNotFound(err) {
+		t.Errorf("reading user by unlinked identity returned %v, want not found", err)
+	}
+
+	if err := d.DeleteUser(tx, alice); err != nil {
+		t.Fatalf("deleting user: %v", err)
+	}
+	if got := identities(alice); len(got) != 0 {
+		t.Errorf("deleted user still had identities %v", got)
+	}
+	// The identity can be used for a new account once its user is deleted.
+	if _, err := d.CreateUser(tx, authn.Google, "google-alice", "alice", "alice@example.com"); err != nil {
+		t.Errorf("creating user with a deleted user's identity: %v", err)
+	}
+}
+
+func testSessionRevocations(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	revokedAt := func(provider authn.Provider, id authn.UserID) time.Time {
+		t.Helper()
+		at, err := d.SessionsRevokedAt(tx, provider, id)
+		if err != nil {
+			t.Fatalf("reading session revocation: %v", err)
+		}
+		return at
+	}
+
+	if at := revokedAt(authn.OIDC, "alice"); !at.IsZero() {
+		t.Errorf("sessions that were never revoked were revoked at %v, want the zero time", at)
+	}
+	first := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := d.RevokeSessions(tx, authn.OIDC, "alice", first); err != nil {
+		t.Fatalf("revoking sessions: %v", err)
+	}
+	if at := revokedAt(authn.OIDC, "alice"); !at.Equal(first) {
+		t.Errorf("sessions were revoked at %v, want %v", at, first)
+	}
+	// Revocations are per identity, and don't need a user.
+	if at := revokedAt(authn.Google, "alice"); !at.IsZero() {
+		t.Errorf("another provider's sessions were revoked at %v, want the zero time", at)
+	}
+
+	// Revoking again moves the revocation forward, but never back.
+	later := first.Add(time.Hour)
+	err0 := d.RevokeSessions(tx, authn.OIDC, "alice", later)
+	err1 := d.RevokeSessions(tx, authn.OIDC, "alice", first)
+	noErrDuringSetup(t, err0, err1)
+	if at := revokedAt(authn.OIDC, "alice"); !at.Equal(later) {
+		t.Errorf("sessions were revoked at %v, want %v", at, later)
+	}
+}
+
+func testNotFound(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	userID := createUser(t, d, "user")
+	taskID := createTask(t, d, userID, "Task")
+	listID, err := d.CreateList(tx, userID, "List")
+	noErrDuringSetup(t, err)
+
+	errOf := func(_ interface{}, err error) error { return err }
+	tests := []struct {
+		desc string
+		err  error
+	}{
+		{"User", errOf(d.User(tx, missingUserID))},
+		{"UserByAuthnProvider", errOf(d.UserByAuthnProvider(tx, authn.EmailAndPass, "missing@example.com"))},
+		{"UnlinkAuthIdentity missing user", d.UnlinkAuthIdentity(tx, missingUserID, authn.EmailAndPass, "user@example.com")},
+		{"UnlinkAuthIdentity not linked", d.UnlinkAuthIdentity(tx, userID, authn.Google, "missing")},
+		{"UpdateUser", d.UpdateUser(tx, missingUserID, db.SetUserName("Name"))},
+		{"Task", errOf(d.Task(tx, missingTaskID))},
+		{"UpdateTask", d.UpdateTask(tx, missingTaskID, db.SetTaskName("Name"))},
+		{"DeleteTask", d.DeleteTask(tx, missingTaskID)},
+		{"TrashedTask", errOf(d.TrashedTask(tx, missingTaskID))},
+		{"TrashedTask not in trash", errOf(d.TrashedTask(tx, taskID))},
+		{"RestoreTask", d.RestoreTask(tx, missingTaskID)},
+		{"PurgeTask", d.PurgeTask(tx, missingTaskID)},
+		{"ShareTask missing task", d.ShareTask(tx, missingTaskID, userID, todo.TaskRoleViewer)},
+		{"ShareTask missing user", d.ShareTask(tx, taskID, missingUserID, todo.TaskRoleViewer)},
+		{"UnshareTask", d.UnshareTask(tx, taskID, userID)},
+		{"List", errOf(d.List(tx, missingListID))},
+		{"UpdateList", d.UpdateList(tx, missingListID, db.SetListName("Name"))},
+		{"DeleteList", d.DeleteList(tx, missingListID, db.DeleteListTasks, "")},
+		{"DeleteList missing destination", d.DeleteList(tx, listID, db.MoveListTasks, missingListID)},
+		{"SetTaskParent missing task", d.SetTaskParent(tx, missingTaskID, taskID)},
+		{"SetTaskParent missing parent", d.SetTaskParent(tx, taskID, missingTaskID)},
+		{"AddTaskDependency missing task", d.AddTaskDependency(tx, missingTaskID, taskID)},
+		{"AddTaskDependency missing blocker", d.AddTaskDependency(tx, taskID, missingTaskID)},
+		{"RemoveTaskDependency", d.RemoveTaskDependency(tx, taskID, missingTaskID)},
+	}
+	for _, test := range tests {
+		if !db.IsNotFound(test.err) {
+			t.Errorf("%s returned %v, want not found", test.desc, test.err)
+		}
+	}
+}
+
+func testTasks(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	userID := createUser(t, d, "user")
+	taskID, err := d.CreateTask(tx, userID)
+	noErrDuringSetup(t, err)
+
+	task, err := d.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	if task.ID != taskID || task.CreatedBy != userID || task.Version != 1 {
+		t.Errorf("got task %q created by %q at version %d, want %q created by %q at version 1", task.ID, task.CreatedBy, task.Version, taskID, userID)
+	}
+	if task.CreatedAt.IsZero() || task.IsCompleted() || task.IsTrashed() || !task.DueAt.IsZero() {
+		t.Errorf("got a new task with unexpected times %+v", task)
+	}
+
+	due := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	completed := time.Date(2029, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = d.UpdateTask(tx, taskID,
+		db.ExpectTaskVersion(1),
+		db.SetTaskName("Name"),
+		db.SetTaskBody("Body"),
+		db.AddTaskTag("b"),
+		db.AddTaskTag("a"),
+		db.AddTaskTag("c"),
+		db.RemoveTaskTag("c"),
+		db.SetTaskDueAt(due),
+		db.SetTaskCompleted(true, completed))
+	if err != nil {
+		t.Fatalf("updating task: %v", err)
+	}
+	if err := d.UpdateTask(tx, taskID, db.ExpectTaskVersion(1), db.SetTaskName("Stale")); !db.IsConflict(err) {
+		t.Errorf("updating task at a stale version returned %v, want a conflict", err)
+	}
+
+	got, err := d.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("reading updated task: %v", err)
+	}
+	want := &todo.Task{
+		ID:          taskID,
+		Name:        "Name",
+		Body:        "Body",
+		Tags:        todo.Tags{"b", "a"},
+		CreatedBy:   userID,
+		CreatedAt:   task.CreatedAt,
+		CompletedAt: completed,
+		DueAt:       due,
+		Version:     2,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(todo.Task{}, "UpdatedAt")); diff != "" {
+		t.Errorf("unexpected task (-want +got)\n%s", diff)
+	}
+	if got.UpdatedAt.Before(task.UpdatedAt) {
+		t.Errorf("task was updated at %v, before it was created at %v", got.UpdatedAt, task.UpdatedAt)
+	}
+}
+
+func testTaskListings(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	userID := createUser(t, d, "user")
+	otherID := createUser(t, d, "other")
+	taskB := createTask(t, d, userID, "b")
+	taskC := createTask(t, d, userID, "c")
+	taskA := createTask(t, d, userID, "a")
+	trashed := createTask(t, d, userID, "trashed")
+	shared := createTask(t, d, otherID, "shared")
+	createTask(t, d, otherID, "unshared")
+	err0 := d.UpdateTask(tx, taskB, db.AddTaskTag("x"), db.AddTaskTag("y"))
+	err1 := d.UpdateTask(tx, taskA, db.AddTaskTag("x"))
+	err2 := d.UpdateTask(tx, trashed, db.AddTaskTag("x"))
+	err3 := d.DeleteTask(tx, trashed)
+	err4 := d.ShareTask(tx, shared, userID, todo.TaskRoleViewer)
+	noErrDuringSetup(t, err0, err1, err2, err3, err4)
+
+	byName := db.TaskSort{Field: db.TaskSortByName}
+	tests := []struct {
+		desc string
+		q    *db.TaskQuery
+		want []todo.TaskID
+	}{
+		{"default", nil, []todo.TaskID{taskB, taskC, taskA}},
+		{"by name", &db.TaskQuery{Sort: byName}, []todo.TaskID{taskA, taskB, taskC}},
+		{"newest first", &db.TaskQuery{Sort: db.TaskSort{Field: db.TaskSortByCreatedAt, Descending: true}}, []todo.TaskID{taskA, taskC, taskB}},
+		{"by tag", &db.TaskQuery{Sort: byName, Filter: db.TaskFilter{Tag: "x"}}, []todo.TaskID{taskA, taskB}},
+	}
+	for _, test := range tests {
+		page, err := d.TasksByCreator(tx, userID, test.q)
+		if err != nil {
+			t.Errorf("%s: listing tasks: %v", test.desc, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, taskIDs(page.Tasks)); diff != "" {
+			t.Errorf("%s: unexpected tasks (-want +got)\n%s", test.desc, diff)
+		}
+	}
+
+	page, err := d.TasksByCreator(tx, userID, &db.TaskQuery{Sort: byName, Limit: 2})
+	if err != nil {
+		t.Fatalf("listing first page: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{taskA, taskB}, taskIDs(page.Tasks)); diff != "" || !page.HasNextPage {
+		t.Errorf("unexpected first page with next page %t (-want +got)\n%s", page.HasNextPage, diff)
+	}
+	after := db.TaskCursor(page.Tasks[len(page.Tasks)-1], db.TaskSortByName)
+	page, err = d.TasksByCreator(tx, userID, &db.TaskQuery{Sort: byName, Limit: 2, After: after})
+	if err != nil {
+		t.Fatalf("listing second page: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{taskC}, taskIDs(page.Tasks)); diff != "" || page.HasNextPage {
+		t.Errorf("unexpected last page with next page %t (-want +got)\n%s", page.HasNextPage, diff)
+	}
+
+	page, err = d.TasksForUser(tx, userID, nil)
+	if err != nil {
+		t.Fatalf("listing tasks for user: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{taskB, taskC, taskA, shared}, taskIDs(page.Tasks)); diff != "" {
+		t.Errorf("unexpected tasks for user (-want +got)\n%s", diff)
+	}
+
+	tags, err := d.TagsForUser(tx, userID)
+	if err != nil {
+		t.Fatalf("listing tags: %v", err)
+	}
+	wantTags := []*todo.TagUsage{{Tag: "x", TaskCount: 2}, {Tag: "y", TaskCount: 1}}
+	if diff := cmp.Diff(wantTags, tags); diff != "" {
+		t.Errorf("unexpected tags (-want +got)\n%s", diff)
+	}
+}
+
+func testBatchLookups(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	alice := createUser(t, d, "alice")
+	bob := createUser(t, d, "bob")
+	first := createTask(t, d, alice, "first")
+	second := createTask(t, d, bob, "second")
+	trashed := createTask(t, d, alice, "trashed")
+	err0 := d.UpdateTask(tx, first, db.AddTaskTag("x"))
+	err1 := d.DeleteTask(tx, trashed)
+	noErrDuringSetup(t, err0, err1)
+
+	users, err := d.UsersByID(tx, []todo.UserID{alice, missingUserID, bob, alice})
+	if err != nil {
+		t.Fatalf("reading users by ID: %v", err)
+	}
+	gotUsers := make(map[todo.UserID]string)
+	for id, u := range users {
+		gotUsers[id] = u.Name
+	}
+	if diff := cmp.Diff(map[todo.UserID]string{alice: "alice", bob: "bob"}, gotUsers); diff != "" {
+		t.Errorf("unexpected users, missing ones should be left out (-want +got)\n%s", diff)
+	}
+
+	tasks, err := d.TasksByID(tx, []todo.TaskID{first, second, trashed, missingTaskID})
+	if err != nil {
+		t.Fatalf("reading tasks by ID: %v", err)
+	}
+	for _, id := range []todo.TaskID{first, second} {
+		want, err := d.Task(tx, id)
+		if err != nil {
+			t.Fatalf("reading task %q: %v", id, err)
+		}
+		if diff := cmp.Diff(want, tasks[id]); diff != "" {
+			t.Errorf("task %q differs from reading it alone (-want +got)\n%s", id, diff)
+		}
+	}
+	if len(tasks) != 2 {
+		t.Errorf("got %d tasks, want only the 2 that exist and aren't trashed", len(tasks))
+	}
+
+	none, err := d.TasksByID(tx, nil)
+	if err != nil {
+		t.Fatalf("reading no tasks by ID: %v", err)
+	}
+	if len(none) != 0 {
+		t.Errorf("got %d tasks when reading none", len(none))
+	}
+}
+
+func testSearch(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	alice := createUser(t, d, "alice")
+	bob := createUser(t, d, "bob")
+	walkName := createTask(t, d, alice, "Walk the dog")
+	walkBody := createTask(t, d, alice, "Chores")
+	milk := createTask(t, d, alice, "Buy milk")
+	trashed := createTask(t, d, alice, "Walk in the park")
+	shared := createTask(t, d, bob, "Walking shoes")
+	_ = createTask(t, d, bob, "Walk to work")
+	err0 := d.UpdateTask(tx, walkBody, db.SetTaskBody("Remember to walk the dog before dinner"), db.AddTaskTag("outdoors"))
+	err1 := d.DeleteTask(tx, trashed)
+	err2 := d.ShareTask(tx, shared, alice, todo.TaskRoleViewer)
+	noErrDuringSetup(t, err0, err1, err2)
+
+	search := func(q *db.TaskSearchQuery) []*db.TaskSearchResult {
+		t.Helper()
+		page, err := d.SearchTasks(tx, alice, q)
+		if err != nil {
+			t.Fatalf("searching for %q: %v", q.Text, err)
+		}
+		return page.Results
+	}
+	resultIDs := func(rs []*db.TaskSearchResult) []todo.TaskID {
+		var ids []todo.TaskID
+		for _, r := range rs {
+			ids = append(ids, r.Task.ID)
+		}
+		return ids
+	}
+	sortIDs := cmpopts.SortSlices(func(a, b todo.TaskID) bool { return a < b })
+
+	walk := search(&db.TaskSearchQuery{Text: "walk"})
+	if diff := cmp.Diff([]todo.TaskID{walkName, shared, walkBody}, resultIDs(walk), sortIDs); diff != "" {
+		t.Errorf("unexpected results for a word, trashed and unreadable tasks should be left out (-want +got)\n%s", diff)
+	}
+	if len(walk) == 3 && walk[2].Task.ID != walkBody {
+		t.Errorf("last result was %q, want %q as matches in the name rank higher than ones in the body", walk[2].Task.ID, walkBody)
+	}
+	for _, r := range walk {
+		if r.Task.ID != walkName {
+			continue
+		}
+		want := []db.TextSpan{{Text: "Walk", Match: true}, {Text: " the dog"}}
+		if diff := cmp.Diff(want, r.Name); diff != "" {
+			t.Errorf("unexpected name highlights (-want +got)\n%s", diff)
+		}
+	}
+
+	tests := []struct {
+		desc string
+		q    *db.TaskSearchQuery
+		want []todo.TaskID
+	}{
+		{"tag filter", &db.TaskSearchQuery{Text: "walk", Tag: "outdoors"}, []todo.TaskID{walkBody}},
+		{"excluded word", &db.TaskSearchQuery{Text: "walk -dog"}, []todo.TaskID{shared}},
+		{"phrase", &db.TaskSearchQuery{Text: `"walk the dog"`}, []todo.TaskID{walkName, walkBody}},
+		{"either word", &db.TaskSearchQuery{Text: "shoes or milk"}, []todo.TaskID{shared, milk}},
+		{"no matches", &db.TaskSearchQuery{Text: "cat"}, nil},
+	}
+	for _, test := range tests {
+		if diff := cmp.Diff(test.want, resultIDs(search(test.q)), sortIDs); diff != "" {
+			t.Errorf("%s: unexpected results (-want +got)\n%s", test.desc, diff)
+		}
+	}
+
+	body := search(&db.TaskSearchQuery{Text: "dinner"})
+	if len(body) != 1 {
+		t.Fatalf("got %d results for a word in a body, want 1", len(body))
+	}
+	var matched []string
+	for _, span := range body[0].BodySnippet {
+		if span.Match {
+			matched = append(matched, span.Text)
+		}
+	}
+	if diff := cmp.Diff([]string{"dinner"}, matched); diff != "" {
+		t.Errorf("unexpected highlights in body snippet (-want +got)\n%s", diff)
+	}
+
+	// Paging through the results one at a time gives the same results in the
+	// same order.
+	var paged []*db.TaskSearchResult
+	q := &db.TaskSearchQuery{Text: "walk", Limit: 1}
+	for i := 0; ; i++ {
+		if i > len(walk) {
+			t.Fatalf("got more than %d pages", len(walk))
+		}
+		page, err := d.SearchTasks(tx, alice, q)
+		if err != nil {
+			t.Fatalf("searching for page %d: %v", i, err)
+		}
+		paged = append(paged, page.Results...)
+		if !page.HasNextPage {
+			break
+		}
+		q.After = db.TaskSearchCursor(page.Results[len(page.Results)-1])
+	}
+	if diff := cmp.Diff(resultIDs(walk), resultIDs(paged)); diff != "" {
+		t.Errorf("paged results differ from unpaged ones (-want +got)\n%s", diff)
+	}
+
+	if _, err := d.SearchTasks(tx, alice, &db.TaskSearchQuery{Text: "  "}); err == nil {
+		t.Error("searching for blank text succeeded, want an error")
+	}
+}
+
+func testTrash(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	userID := createUser(t, d, "user")
+	first := createTask(t, d, userID, "first")
+	second := createTask(t, d, userID, "second")
+	kept := createTask(t, d, userID, "kept")
+	err0 := d.DeleteTask(tx, first)
+	err1 := d.DeleteTask(tx, second)
+	noErrDuringSetup(t, err0, err1)
+
+	if _, err := d.Task(tx, first); !db.IsNotFound(err) {
+		t.Errorf("reading a trashed task returned %v, want not found", err)
+	}
+	if err := d.UpdateTask(tx, first, db.SetTaskName("Name")); !db.IsNotFound(err) {
+		t.Errorf("updating a trashed task returned %v, want not found", err)
+	}
+	if err := d.DeleteTask(tx, first); !db.IsNotFound(err) {
+		t.Errorf("deleting a trashed task returned %v, want not found", err)
+	}
+	task, err := d.TrashedTask(tx, first)
+	if err != nil {
+		t.Fatalf("reading trashed task: %v", err)
+	}
+	if !task.IsTrashed() {
+		t.Error("trashed task had no deletion time")
+	}
+	trashed, err := d.TrashedTasks(tx, userID)
+	if err != nil {
+		t.Fatalf("listing trashed tasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{second, first}, taskIDs(trashed)); diff != "" {
+		t.Errorf("unexpected trashed tasks, want most recently deleted first (-want +got)\n%s", diff)
+	}
+
+	if err := d.RestoreTask(tx, first); err != nil {
+		t.Fatalf("restoring task: %v", err)
+	}
+	if err := d.RestoreTask(tx, first); !db.IsNotFound(err) {
+		t.Errorf("restoring a task that isn't trashed returned %v, want not found", err)
+	}
+	if err := d.PurgeTask(tx, kept); !db.IsNotFound(err) {
+		t.Errorf("purging a task that isn't trashed returned %v, want not found", err)
+	}
+	if _, err := d.Task(tx, first); err != nil {
+		t.Errorf("reading restored task: %v", err)
+	}
+
+	if err := d.PurgeTask(tx, second); err != nil {
+		t.Fatalf("purging task: %v", err)
+	}
+	if _, err := d.TrashedTask(tx, second); !db.IsNotFound(err) {
+		t.Errorf("reading a purged task returned %v, want not found", err)
+	}
+	if err := d.DeleteTask(tx, kept); err != nil {
+		t.Fatalf("deleting task: %v", err)
+	}
+	n, err := d.PurgeTrashedTasks(tx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("purging trashed tasks: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("purged %d tasks, want 1", n)
+	}
+}
+
+func testCollaborators(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	ownerID := createUser(t, d, "owner")
+	viewerID := createUser(t, d, "viewer")
+	editorID := createUser(t, d, "editor")
+	taskID := createTask(t, d, ownerID, "Task")
+
+	err0 := d.ShareTask(tx, taskID, viewerID, todo.TaskRoleEditor)
+	err1 := d.ShareTask(tx, taskID, editorID, todo.TaskRoleEditor)
+	// Sharing again replaces the role.
+	err2 := d.ShareTask(tx, taskID, viewerID, todo.TaskRoleViewer)
+	noErrDuringSetup(t, err0, err1, err2)
+	if err := d.ShareTask(tx, taskID, viewerID, todo.TaskRole("ADMIN")); err == nil {
+		t.Error("expected an error sharing with an invalid role, but got none")
+	}
+
+	got, err := d.TaskCollaborators(tx, taskID)
+	if err != nil {
+		t.Fatalf("reading collaborators: %v", err)
+	}
+	want := []*todo.TaskCollaborator{
+		{TaskID: taskID, UserID: viewerID, Role: todo.TaskRoleViewer},
+		{TaskID: taskID, UserID: editorID, Role: todo.TaskRoleEditor},
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].UserID < want[j].UserID })
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected collaborators, want them ordered by user ID (-want +got)\n%s", diff)
+	}
+
+	unshared := createTask(t, d, ownerID, "Unshared")
+	byTask, err := d.CollaboratorsByTaskID(tx, []todo.TaskID{taskID, unshared, missingTaskID})
+	if err != nil {
+		t.Fatalf("reading collaborators by task ID: %v", err)
+	}
+	wantByTask := map[todo.TaskID][]*todo.TaskCollaborator{taskID: want}
+	if diff := cmp.Diff(wantByTask, byTask); diff != "" {
+		t.Errorf("unexpected collaborators by task, tasks without any should be left out (-want +got)\n%s", diff)
+	}
+
+	if err := d.UnshareTask(tx, taskID, viewerID); err != nil {
+		t.Fatalf("unsharing task: %v", err)
+	}
+	if err := d.UnshareTask(tx, taskID, viewerID); !db.IsNotFound(err) {
+		t.Errorf("unsharing a task twice returned %v, want not found", err)
+	}
+	page, err := d.TasksForUser(tx, viewerID, nil)
+	if err != nil {
+		t.Fatalf("listing tasks for user: %v", err)
+	}
+	if len(page.Tasks) != 0 {
+		t.Errorf("got %d tasks for a user the task was unshared with, want none", len(page.Tasks))
+	}
+}
+
+func testLists(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	userID := createUser(t, d, "user")
+	firstID, err0 := d.CreateList(tx, userID, "First")
+	secondID, err1 := d.CreateList(tx, userID, "Second")
+	movedID := createTask(t, d, userID, "moved")
+	deletedID := createTask(t, d, userID, "deleted")
+	err2 := d.UpdateTask(tx, movedID, db.SetTaskList(firstID))
+	err3 := d.UpdateTask(tx, deletedID, db.SetTaskList(secondID))
+	noErrDuringSetup(t, err0, err1, err2, err3)
+
+	list, err := d.List(tx, firstID)
+	if err != nil {
+		t.Fatalf("reading list: %v", err)
+	}
+	want := &todo.List{ID: firstID, Name: "First", CreatedBy: userID, CreatedAt: list.CreatedAt}
+	if diff := cmp.Diff(want, list); diff != "" || list.CreatedAt.IsZero() {
+		t.Errorf("unexpected list created at %v (-want +got)\n%s", list.CreatedAt, diff)
+	}
+
+	archivedAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := d.UpdateList(tx, firstID, db.SetListName("Renamed"), db.SetListArchived(true, archivedAt)); err != nil {
+		t.Fatalf("updating list: %v", err)
+	}
+	lists, err := d.ListsByCreator(tx, userID)
+	if err != nil {
+		t.Fatalf("listing lists: %v", err)
+	}
+	wantLists := []*todo.List{
+		{ID: firstID, Name: "Renamed", CreatedBy: userID, ArchivedAt: archivedAt},
+		{ID: secondID, Name: "Second", CreatedBy: userID},
+	}
+	if diff := cmp.Diff(wantLists, lists, cmpopts.IgnoreFields(todo.List{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected lists, want them oldest first (-want +got)\n%s", diff)
+	}
+
+	if _, err := d.CreateList(tx, userID, "Bell\x07"); !errkind.Is(err, errkind.InvalidArgument) {
+		t.Errorf("creating a list with a control character in its name returned %v, want invalid argument", err)
+	}
+	if err := d.UpdateList(tx, secondID, db.SetListName(strings.Repeat("a", 201))); !errkind.Is(err, errkind.InvalidArgument) {
+		t.Errorf("renaming a list to a name that's too long returned %v, want invalid argument", err)
+	}
+	if err := d.UpdateList(tx, secondID, db.SetListName("  Second   list ")); err != nil {
+		t.Fatalf("renaming list: %v", err)
+	}
+	if list, err := d.List(tx, secondID); err != nil {
+		t.Errorf("reading renamed list: %v", err)
+	} else if list.Name != "Second list" {
+		t.Errorf("list was renamed to %q, want the name trimmed to %q", list.Name, "Second list")
+	}
+
+	inList, err := d.TasksInList(tx, firstID)
+	if err != nil {
+		t.Fatalf("listing tasks in list: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{movedID}, taskIDs(inList)); diff != "" {
+		t.Errorf("unexpected tasks in list (-want +got)\n%s", diff)
+	}
+
+	if err := d.DeleteList(tx, firstID, db.MoveListTasks, secondID); err != nil {
+		t.Fatalf("deleting list and moving its tasks: %v", err)
+	}
+	moved, err := d.Task(tx, movedID)
+	if err != nil {
+		t.Fatalf("reading moved task: %v", err)
+	}
+	if moved.ListID != secondID {
+		t.Errorf("moved task is in list %q, want %q", moved.ListID, secondID)
+	}
+
+	if err := d.DeleteList(tx, secondID, db.DeleteListTasks, ""); err != nil {
+		t.Fatalf("deleting list and its tasks: %v", err)
+	}
+	for _, id := range []todo.TaskID{movedID, deletedID} {
+		task, err := d.TrashedTask(tx, id)
+		if err != nil {
+			t.Errorf("reading trashed task %q: %v", id, err)
+			continue
+		}
+		if task.ListID != "" {
+			t.Errorf("trashed task %q is still in list %q", id, task.ListID)
+		}
+	}
+	if _, err := d.List(tx, secondID); !db.IsNotFound(err) {
+		t.Errorf("reading a deleted list returned %v, want not found", err)
+	}
+}
+
+func testHierarchy(t *testing.T, d DB) {
+	tx := d.NoTxn(context.Background())
+	userID := createUser(t, d, "user")
+	parent := createTask(t, d, userID, "parent")
+	child := createTask(t, d, userID, "child")
+	grandchild := createTask(t, d, userID, "grandchild")
+	err0 := d.SetTaskParent(tx, child, parent)
+	err1 := d.SetTaskParent(tx, grandchild, child)
+	noErrDuringSetup(t, err0, err1)
+
+	subtasks, err := d.Subtasks(tx, parent)
+	if err != nil {
+		t.Fatalf("reading subtasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{child}, taskIDs(subtasks)); diff != "" {
+		t.Errorf("unexpected subtasks (-want +got)\n%s", diff)
+	}
+	if err := d.SetTaskParent(tx, parent, grandchild); !errors.Is(err, todo.ErrTaskCycle) {
+		t.Errorf("making a task a subtask of its own subtask returned %v, want a cycle error", err)
+	}
+
+	err0 = d.AddTaskDependency(tx, parent, child)
+	err1 = d.AddTaskDependency(tx, parent, grandchild)
+	// Adding a dependency twice is a no-op.
+	err2 := d.AddTaskDependency(tx, parent, child)
+	noErrDuringSetup(t, err0, err1, err2)
+	if err := d.AddTaskDependency(tx, child, parent); !errors.Is(err, todo.ErrTaskCycle) {
+		t.Errorf("adding a circular dependency returned %v, want a cycle error", err)
+	}
+	blocking, err := d.BlockingTasks(tx, parent)
+	if err != nil {
+		t.Fatalf("reading blocking tasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{child, grandchild}, taskIDs(blocking)); diff != "" {
+		t.Errorf("unexpected blocking tasks, want them oldest first (-want +got)\n%s", diff)
+	}
+	blocked, err := d.BlockedTasks(tx, child)
+	if err != nil {
+		t.Fatalf("reading blocked tasks: %v", err)
+	}
+	if diff := cmp.Diff([]todo.TaskID{parent}, taskIDs(blocked)); diff != "" {
+		t.Errorf("unexpected blocked tasks (-want +got)\n%s", diff)
+	}
+	if err := d.RemoveTaskDependency(tx, parent, grandchild); err != nil {
+		t.Fatalf("removing dependency: %v", err)
+	}
+	if err := d.RemoveTaskDependency(tx, parent, grandchild); !db.IsNotFound(err) {
+		t.Errorf("removing a dependency twice returned %v, want not found", err)
+	}
+
+	// Purging a task promotes its subtasks and unblocks the tasks it blocked.
+	err0 = d.DeleteTask(tx, child)
+	err1 = d.PurgeTask(tx, child)
+	noErrDuringSetup(t, err0, err1)
+	task, err := d.Task(tx, grandchild)
+	if err != nil {
+		t.Fatalf("reading promoted task: %v", err)
+	}
+	if task.ParentID != "" {
+		t.Errorf("subtask of a purged task still has parent %q", task.ParentID)
+	}
+	blocking, err = d.BlockingTasks(tx, parent)
+	if err != nil {
+		t.Fatalf("reading blocking tasks after purge: %v", err)
+	}
+	if len(blocking) != 0 {
+		t.Errorf("got %d blocking tasks after purging the blocker, want none", len(blocking))
+	}
+}
+
+func testHistory(t *testing.T, d DB) {
+	userID := createUser(t, d, "user")
+	tx := d.NoTxn(todo.WithUserID(context.Background(), userID))
+	taskID, err0 := d.CreateTask(tx, userID)
+	err1 := d.UpdateTask(tx, taskID, db.SetTaskName("New Name"))
+	// An update that doesn't change anything isn't recorded.
+	err2 := d.UpdateTask(tx, taskID, db.SetTaskName("New Name"))
+	err3 := d.DeleteTask(tx, taskID)
+	noErrDuringSetup(t, err0, err1, err2, err3)
+
+	page, err := d.TaskHistory(tx, taskID, &db.TaskEventQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("reading history: %v", err)
+	}
+	if !page.HasNextPage {
+		t.Error("expected a next page of history, but there wasn't one")
+	}
+	rest, err := d.TaskHistory(tx, taskID, &db.TaskEventQuery{After: db.TaskEventCursor(page.Events[len(page.Events)-1])})
+	if err != nil {
+		t.Fatalf("reading next page of history: %v", err)
+	}
+	if rest.HasNextPage {
+		t.Error("expected no more history, but there was another page")
+	}
+
+	var got []todo.TaskEventKind
+	for _, e := range append(page.Events, rest.Events...) {
+		got = append(got, e.Kind)
+		if e.TaskID != taskID || e.ActorID != userID {
+			t.Errorf("event %q was for task %q by %q, want task %q by %q", e.ID, e.TaskID, e.ActorID, taskID, userID)
+		}
+	}
+	want := []todo.TaskEventKind{todo.TaskEventDeleted, todo.TaskEventUpdated, todo.TaskEventCreated}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected history, want it newest first (-want +got)\n%s", diff)
+	}
+}
+
+func testTransactions(t *testing.T, d DB) {
+	ctx := context.Background()
+	noTxn := d.NoTxn(ctx)
+	userID := createUser(t, d, "user")
+	taskID := createTask(t, d, userID, "Name")
+	taskName := func(tx db.Tx) string {
+		t.Helper()
+		task, err := d.Task(tx, taskID)
+		if err != nil {
+			t.Fatalf("reading task: %v", err)
+		}
+		return task.Name
+	}
+
+	errFail := errors.New("failure")
+	var createdID todo.TaskID
+	err := d.Transactional(ctx, func(tx db.Tx) error {
+		id, err := d.CreateTask(tx, userID)
+		if err != nil {
+			return err
+		}
+		createdID = id
+		if err := d.UpdateTask(tx, taskID, db.SetTaskName("Rolled Back")); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("expected the failure from the transaction, got %v", err)
+	}
+	if _, err := d.Task(noTxn, createdID); !db.IsNotFound(err) {
+		t.Errorf("reading a task created in a failed transaction returned %v, want not found", err)
+	}
+	if got := taskName(noTxn); got != "Name" {
+		t.Errorf("got task name %q after a failed transaction, want %q", got, "Name")
+	}
+
+	tx, err := d.Begin(ctx)
+	if err != nil {
+		t.Fatalf("beginning txn: %v", err)
+	}
+	if err := d.UpdateTask(tx, taskID, db.SetTaskName("Committed")); err != nil {
+		t.Fatalf("updating task: %v", err)
+	}
+	if got := taskName(tx); got != "Committed" {
+		t.Errorf("txn read task name %q, want its own write %q", got, "Committed")
+	}
+	if got := taskName(noTxn); got != "Name" {
+		t.Errorf("read uncommitted task name %q from outside the txn, want %q", got, "Name")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing txn: %v", err)
+	}
+	if got := taskName(noTxn); got != "Committed" {
+		t.Errorf("got task name %q after commit, want %q", got, "Committed")
+	}
+
+	tx, err = d.Begin(ctx)
+	if err != nil {
+		t.Fatalf("beginning txn: %v", err)
+	}
+	if err := d.UpdateTask(tx, taskID, db.SetTaskName("Rolled Back")); err != nil {
+		t.Fatalf("updating task: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rolling back txn: %v", err)
+	}
+	if got := taskName(noTxn); got != "Committed" {
+		t.Errorf("got task name %q after rollback, want %q", got, "Committed")
+	}
+}
+
+func testNestedTransactions(t *testing.T, d DB) {
+	ctx := context.Background()
+	noTxn := d.NoTxn(ctx)
+	userID := createUser(t, d, "user")
+	viewerID := createUser(t, d, "viewer")
+	taskID := createTask(t, d, userID, "Name")
+	noErrDuringSetup(t, d.ShareTask(noTxn, taskID, viewerID, todo.TaskRoleViewer))
+
+	errInner := errors.New("inner failure")
+	err := d.Transactional(ctx, func(tx db.Tx) error {
+		if err := d.UpdateTask(tx, taskID, db.SetTaskName("Outer Name")); err != nil {
+			return err
+		}
+		err := d.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+			if err := d.UpdateTask(tx, taskID, db.SetTaskBody("Inner Body")); err != nil {
+				return err
+			}
+			if err := d.UnshareTask(tx, taskID, viewerID); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("expected the inner error from the nested transaction, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("running outer transaction: %v", err)
+	}
+	task, err := d.Task(noTxn, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	if task.Name != "Outer Name" || task.Body != "" {
+		t.Errorf("got task with name %q and body %q, want only the outer transaction's changes", task.Name, task.Body)
+	}
+	collaborators, err := d.TaskCollaborators(noTxn, taskID)
+	if err != nil {
+		t.Fatalf("reading collaborators: %v", err)
+	}
+	if len(collaborators) != 1 {
+		t.Errorf("got %d collaborators, want the one removed by the failed nested transaction", len(collaborators))
+	}
+
+	// Outside of a transaction, everything fn changed is undone if it fails.
+	err = d.RunOrContinueTransaction(noTxn, func(tx db.Tx) error {
+		if err := d.UpdateTask(tx, taskID, db.SetTaskName("Rolled Back")); err != nil {
+			return err
+		}
+		return errInner
+	})
+	if !errors.Is(err, errInner) {
+		t.Errorf("expected the error from the transaction, got %v", err)
+	}
+	task, err = d.Task(noTxn, taskID)
+	if err != nil {
+		t.Fatalf("reading task: %v", err)
+	}
+	if task.Name != "Outer Name" {
+		t.Errorf("got task name %q after a failed transaction, want %q", task.Name, "Outer Name")
+	}
+}
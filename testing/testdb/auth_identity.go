@@ -0,0 +1,144 @@
+package testdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+func (tdb *DB) AuthIdentities(tx db.Tx, userID todo.UserID) ([]*todo.AuthIdentity, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.authIdentities(userID), nil
+}
+
+func (s *state) authIdentities(userID todo.UserID) []*todo.AuthIdentity {
+	var r []*todo.AuthIdentity
+	for _, a := range s.identities {
+		if a.UserID == userID {
+			r = append(r, a.Clone())
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if !r[i].CreatedAt.Equal(r[j].CreatedAt) {
+			return r[i].CreatedAt.Before(r[j].CreatedAt)
+		}
+		if r[i].Provider != r[j].Provider {
+			return r[i].Provider < r[j].Provider
+		}
+		return r[i].ProviderUserID < r[j].ProviderUserID
+	})
+	return r
+}
+
+func (tdb *DB) LinkAuthIdentity(tx db.Tx, a *todo.AuthIdentity) error {
+	return tdb.write(tx, func(w *writer) error {
+		if _, err := w.user(a.UserID); err != nil {
+			return err
+		}
+		for i, existing := range w.identities {
+			if existing.Provider != a.Provider || existing.ProviderUserID != a.ProviderUserID {
+				continue
+			}
+			ownerID := existing.UserID
+			if ownerID != a.UserID && w.hasData(ownerID) {
+				return errkind.New(errkind.Conflict, fmt.Sprintf("%s identity %q is linked to another user who has tasks or lists", a.Provider, a.ProviderUserID))
+			}
+			aa := existing.Clone()
+			aa.UserID = a.UserID
+			aa.Email = a.Email
+			aa.EmailVerified = a.EmailVerified
+			w.identities[i] = aa
+			if ownerID != a.UserID && len(w.authIdentities(ownerID)) == 0 {
+				if err := w.deleteUser(ownerID); err != nil {
+					return fmt.Errorf("deleting merged user: %w", err)
+				}
+			}
+			return nil
+		}
+		aa := a.Clone()
+		aa.CreatedAt = time.Now()
+		w.identities = append(w.identities, aa)
+		return nil
+	})
+}
+
+// hasData returns true if the user has anything that would be lost by
+// deleting them.
+func (s *state) hasData(userID todo.UserID) bool {
+	for _, t := range s.tasks {
+		if t.CreatedBy == userID {
+			return true
+		}
+	}
+	for _, l := range s.lists {
+		if l.CreatedBy == userID {
+			return true
+		}
+	}
+	for _, c := range s.collaborators {
+		if c.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (tdb *DB) UnlinkAuthIdentity(tx db.Tx, userID todo.UserID, provider authn.Provider, providerUserID authn.UserID) error {
+	return tdb.write(tx, func(w *writer) error {
+		if _, err := w.user(userID); err != nil {
+			return err
+		}
+		ids := w.authIdentities(userID)
+		found := false
+		for _, a := range ids {
+			if a.Provider == provider && a.ProviderUserID == providerUserID {
+				found = true
+			}
+		}
+		if !found {
+			return db.NotFound(string(provider)+":"+string(providerUserID), "auth identity")
+		}
+		if len(ids) == 1 {
+			return errkind.New(errkind.Conflict, "the only way a user can sign in can't be unlinked")
+		}
+		w.identities = filter(w.identities, func(a *todo.AuthIdentity) bool {
+			return a.Provider != provider || a.ProviderUserID != providerUserID
+		})
+		return nil
+	})
+}
+
+func (tdb *DB) UsersByVerifiedEmail(tx db.Tx, email string) ([]*todo.User, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	matches := make(map[todo.UserID]bool)
+	for _, a := range s.identities {
+		if a.EmailVerified && strings.EqualFold(a.Email, email) {
+			matches[a.UserID] = true
+		}
+	}
+	var r []*todo.User
+	for _, u := range s.users {
+		if matches[u.ID] {
+			r = append(r, u.Clone())
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if !r[i].CreatedAt.Equal(r[j].CreatedAt) {
+			return r[i].CreatedAt.Before(r[j].CreatedAt)
+		}
+		return r[i].ID < r[j].ID
+	})
+	return r, nil
+}
@@ -0,0 +1,348 @@
+package testdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+// The in-memory search is a much simplified version of Postgres' full-text
+// search, which sqldb uses. It parses queries the way websearch_to_tsquery
+// does, ignores a short list of common words, and reduces words to a stem with
+// a few suffix rules rather than a real stemmer, which is close enough for the
+// small, hand-written tasks in tests. Ranks are comparable to each other but
+// not to the ranks sqldb returns.
+
+const (
+	// nameWeight and bodyWeight are how much a match in each field adds to a
+	// task's rank, like the 'A' and 'B' weights in sqldb.
+	nameWeight = 1.0
+	bodyWeight = 0.4
+	// snippetMinWords and snippetMaxWords bound the length of a body snippet,
+	// like the MinWords and MaxWords options that sqldb passes to ts_headline.
+	snippetMinWords = 15
+	snippetMaxWords = 35
+)
+
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be but by for from has have he
+		her his i if in into is it its me my no not of on or our she so than that the their
+		them then there these they this to was we were what when which who will with you your`) {
+		stopWords[w] = true
+	}
+}
+
+func (tdb *DB) SearchTasks(tx db.Tx, userID todo.UserID, q *db.TaskSearchQuery) (*db.TaskSearchPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid search query: %w", err)
+	}
+	var after *db.TaskSearchCursorKey
+	if q.After != "" {
+		k, err := db.DecodeTaskSearchCursor(q.After)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		after = k
+	}
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := parseSearchQuery(q.Text)
+	r := make([]*db.TaskSearchResult, 0)
+	for _, t := range s.tasks {
+		if t.IsTrashed() || !(t.CreatedBy == userID || s.collaboratorIndex(t.ID, userID) >= 0) {
+			continue
+		}
+		if q.Tag != "" && !containsTag(t.Tags, q.Tag) {
+			continue
+		}
+		res, ok := query.match(t)
+		if !ok {
+			continue
+		}
+		if after != nil && !after.Before(db.TaskSearchCursorKeyFor(res)) {
+			continue
+		}
+		r = append(r, res)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return db.TaskSearchCursorKeyFor(r[i]).Before(db.TaskSearchCursorKeyFor(r[j]))
+	})
+
+	page := &db.TaskSearchPage{Results: r}
+	if q.Limit > 0 && len(r) > q.Limit {
+		page.Results = r[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
+}
+
+// searchQuery matches a document if every one of its groups does.
+type searchQuery struct {
+	groups [][]searchTerm
+}
+
+// searchTerm is a word or phrase, as a list of stems. A group matches if any
+// of its terms match, and a negated term matches if its phrase doesn't appear.
+type searchTerm struct {
+	stems   []string
+	negated bool
+}
+
+func parseSearchQuery(text string) *searchQuery {
+	q := &searchQuery{}
+	// joinNext is set by an "or", so that the next term joins the last group.
+	joinNext := false
+	add := func(words string, negated bool) {
+		var stems []string
+		for _, w := range tokenize(words) {
+			if w.stem != "" {
+				stems = append(stems, w.stem)
+			}
+		}
+		if len(stems) == 0 {
+			return
+		}
+		term := searchTerm{stems: stems, negated: negated}
+		if joinNext && len(q.groups) > 0 {
+			last := len(q.groups) - 1
+			q.groups[last] = append(q.groups[last], term)
+		} else {
+			q.groups = append(q.groups, []searchTerm{term})
+		}
+		joinNext = false
+	}
+
+	for text != "" {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		negated := false
+		if strings.HasPrefix(text, "-") {
+			negated = true
+			text = text[1:]
+		}
+		if strings.HasPrefix(text, `"`) {
+			phrase := text[1:]
+			end := strings.Index(phrase, `"`)
+			if end < 0 {
+				end = len(phrase)
+				text = ""
+			} else {
+				text = phrase[end+1:]
+			}
+			add(phrase[:end], negated)
+			continue
+		}
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		word := text[:end]
+		text = text[end:]
+		if strings.EqualFold(word, "or") && !negated {
+			joinNext = len(q.groups) > 0
+			continue
+		}
+		add(word, negated)
+	}
+	return q
+}
+
+// match returns the search result for the task, and whether it matches.
+func (q *searchQuery) match(t *todo.Task) (*db.TaskSearchResult, bool) {
+	name, body := tokenize(t.Name), tokenize(t.Body)
+	stems := func(words []searchWord) []string {
+		var out []string
+		for _, w := range words {
+			if w.stem != "" {
+				out = append(out, w.stem)
+			}
+		}
+		return out
+	}
+	nameStems, bodyStems := stems(name), stems(body)
+
+	positive := false
+	for _, g := range q.groups {
+		matched := false
+		for _, term := range g {
+			found := containsPhrase(nameStems, term.stems) || containsPhrase(bodyStems, term.stems)
+			if found != term.negated {
+				matched = true
+			}
+			positive = positive || !term.negated
+		}
+		if !matched {
+			return nil, false
+		}
+	}
+	// Like Postgres, a query of only negated terms doesn't match anything.
+	if !positive {
+		return nil, false
+	}
+
+	highlight := make(map[string]bool)
+	for _, g := range q.groups {
+		for _, term := range g {
+			if term.negated {
+				continue
+			}
+			for _, s := range term.stems {
+				highlight[s] = true
+			}
+		}
+	}
+	var nameHits, bodyHits int
+	for _, s := range nameStems {
+		if highlight[s] {
+			nameHits++
+		}
+	}
+	for _, s := range bodyStems {
+		if highlight[s] {
+			bodyHits++
+		}
+	}
+	return &db.TaskSearchResult{
+		Task:        t.Clone(),
+		Rank:        float32(nameWeight*float64(nameHits) + bodyWeight*float64(bodyHits)),
+		Name:        highlightSpans(t.Name, name, highlight),
+		BodySnippet: snippet(t.Body, body, highlight),
+	}, true
+}
+
+func containsPhrase(stems, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(stems); i++ {
+		matched := true
+		for j, s := range phrase {
+			if stems[i+j] != s {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet returns the window of the body with the most matching words, or the
+// start of the body if none of it matches.
+func snippet(body string, words []searchWord, highlight map[string]bool) []db.TextSpan {
+	if len(words) == 0 {
+		return nil
+	}
+	start, end, best := 0, minInt(len(words), snippetMinWords), 0
+	for i := range words {
+		n := 0
+		for j := i; j < len(words) && j < i+snippetMaxWords; j++ {
+			if highlight[words[j].stem] {
+				n++
+			}
+		}
+		if n > best {
+			start, end, best = i, minInt(len(words), i+snippetMaxWords), n
+		}
+	}
+	window := words[start:end]
+	from, to := window[0].start, window[len(window)-1].end
+	shifted := make([]searchWord, len(window))
+	for i, w := range window {
+		shifted[i] = searchWord{stem: w.stem, start: w.start - from, end: w.end - from}
+	}
+	return highlightSpans(body[from:to], shifted, highlight)
+}
+
+// highlightSpans splits text into spans, marking each of the words with a stem
+// in highlight as a match.
+func highlightSpans(text string, words []searchWord, highlight map[string]bool) []db.TextSpan {
+	var spans []db.TextSpan
+	last := 0
+	for _, w := range words {
+		if !highlight[w.stem] {
+			continue
+		}
+		if w.start > last {
+			spans = append(spans, db.TextSpan{Text: text[last:w.start]})
+		}
+		spans = append(spans, db.TextSpan{Text: text[w.start:w.end], Match: true})
+		last = w.end
+	}
+	if last < len(text) {
+		spans = append(spans, db.TextSpan{Text: text[last:]})
+	}
+	return spans
+}
+
+// searchWord is a word in some text, with its byte offsets. stem is empty for
+// stop words.
+type searchWord struct {
+	stem       string
+	start, end int
+}
+
+func tokenize(text string) []searchWord {
+	var (
+		out   []searchWord
+		start = -1
+	)
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }
+	flush := func(end int) {
+		if start >= 0 {
+			out = append(out, searchWord{stem: stem(text[start:end]), start: start, end: end})
+			start = -1
+		}
+	}
+	for i, r := range text {
+		if isWord(r) {
+			if start < 0 {
+				start = i
+			}
+		} else {
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return out
+}
+
+// stem lower-cases a word and strips common English suffixes from it, so that
+// e.g. "walk", "walks", "walked" and "walking" have the same stem.
+func stem(word string) string {
+	w := strings.ToLower(word)
+	if stopWords[w] {
+		return ""
+	}
+	if strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") && len(w) > 3 {
+		w = strings.TrimSuffix(w, "s")
+	}
+	for _, suffix := range []string{"ing", "ed"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 {
+			w = strings.TrimSuffix(w, suffix)
+			// "running" becomes "run", not "runn".
+			if n := len(w); w[n-1] == w[n-2] && !strings.ContainsRune("aeiouls", rune(w[n-1])) {
+				w = w[:n-1]
+			}
+			break
+		}
+	}
+	if strings.HasSuffix(w, "e") && len(w) > 3 {
+		w = strings.TrimSuffix(w, "e")
+	}
+	return w
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
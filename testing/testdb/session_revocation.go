@@ -0,0 +1,43 @@
+package testdb
+
+import (
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+)
+
+type sessionRevocation struct {
+	provider       authn.Provider
+	providerUserID authn.UserID
+	revokedAt      time.Time
+}
+
+func (tdb *DB) RevokeSessions(tx db.Tx, provider authn.Provider, providerUserID authn.UserID, at time.Time) error {
+	return tdb.write(tx, func(w *writer) error {
+		for i, r := range w.revocations {
+			if r.provider != provider || r.providerUserID != providerUserID {
+				continue
+			}
+			if at.After(r.revokedAt) {
+				w.revocations[i] = &sessionRevocation{provider: provider, providerUserID: providerUserID, revokedAt: at}
+			}
+			return nil
+		}
+		w.revocations = append(w.revocations, &sessionRevocation{provider: provider, providerUserID: providerUserID, revokedAt: at})
+		return nil
+	})
+}
+
+func (tdb *DB) SessionsRevokedAt(tx db.Tx, provider authn.Provider, providerUserID authn.UserID) (time.Time, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, r := range s.revocations {
+		if r.provider == provider && r.providerUserID == providerUserID {
+			return r.revokedAt, nil
+		}
+	}
+	return time.Time{}, nil
+}
@@ -1,86 +1,364 @@
 // Package testdb implements an in-memory database for use in tests.
+//
+// It behaves like the real database in the ways that tests are likely to
+// notice: a transaction sees its own writes but not anyone else's uncommitted
+// ones, rolling back undoes all of its writes, and concurrent use is safe.
+// Writers take turns, so a transaction that's never finished blocks every
+// other writer, which eventually fails with an error saying where the leaked
+// transaction was begun.
 package testdb
 
 import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Silicon-Ally/silicon-starter/authn"
 	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
 	"github.com/Silicon-Ally/silicon-starter/todo"
+	"github.com/hashicorp/go-multierror"
 )
 
+// defaultLockTimeout is how long a write waits for another transaction to
+// finish, which is far longer than any transaction in a test should take.
+const defaultLockTimeout = 5 * time.Second
+
 type DB struct {
-	users []*todo.User
-	tasks []*todo.Task
+	// writeLock is held by a transaction from its first write until it's
+	// committed or rolled back.
+	writeLock   chan struct{}
+	lockTimeout time.Duration
 
-	pendingTxns map[*Op]bool
+	mu sync.Mutex
+	// committed is never modified, only replaced when a transaction commits.
+	committed *state
+	lockedBy  *Op
+	// pendingTxns maps each unfinished transaction to where it was begun.
+	pendingTxns map[*Op]string
 	nextIDs     map[string]int
 }
 
 func New() *DB {
 	return &DB{
+		writeLock:   make(chan struct{}, 1),
+		lockTimeout: defaultLockTimeout,
+		committed:   &state{},
+		pendingTxns: make(map[*Op]string),
 		nextIDs:     make(map[string]int),
-		pendingTxns: make(map[*Op]bool),
 	}
 }
 
-func (db *DB) Begin(_ context.Context) (db.Tx, error) {
-	tx := &Op{db: db}
-	db.pendingTxns[tx] = true
-	return &Op{}, nil
+func (tdb *DB) Begin(ctx context.Context) (db.Tx, error) {
+	return tdb.begin(ctx), nil
+}
+
+func (tdb *DB) begin(ctx context.Context) *Op {
+	op := &Op{db: tdb, ctx: ctx, txn: true}
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+	tdb.pendingTxns[op] = caller()
+	return op
+}
+
+func (tdb *DB) CheckAllTransactionsCommitted(t *testing.T) {
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+	if len(tdb.pendingTxns) > 0 {
+		var begunAt []string
+		for _, loc := range tdb.pendingTxns {
+			begunAt = append(begunAt, loc)
+		}
+		sort.Strings(begunAt)
+		t.Fatalf("had %d txns that were begun but never committed or rolled back, begun at:\n%s", len(begunAt), strings.Join(begunAt, "\n"))
+	}
 }
 
-func (db *DB) CheckAllTransactionsCommitted(t *testing.T) {
-	if len(db.pendingTxns) > 0 {
-		t.Fatalf("had %d txns that were begun but not committed", len(db.pendingTxns))
+func (tdb *DB) Transactional(ctx context.Context, fn func(_ db.Tx) error) error {
+	if err := tdb.transact(ctx, fn); err != nil {
+		return fmt.Errorf("while running testdb txn: %w", err)
 	}
+	return nil
 }
 
+// TransactionalWithOptions ignores the options, as testdb's transactions run
+// one at a time, so they're always serializable and never conflict.
+func (tdb *DB) TransactionalWithOptions(ctx context.Context, _ *db.TxOptions, fn func(_ db.Tx) error) error {
+	return tdb.Transactional(ctx, fn)
+}
+
+func (tdb *DB) transact(ctx context.Context, fn func(db.Tx) error) error {
+	op := tdb.begin(ctx)
+	if err := fn(op); err != nil {
+		if rollbackErr := op.Rollback(); rollbackErr != nil {
+			err = multierror.Append(err, rollbackErr)
+		}
+		return err
+	}
+	if err := op.Commit(); err != nil {
+		return fmt.Errorf("committing txn: %w", err)
+	}
+	return nil
+}
+
+// RunOrContinueTransaction runs fn in a new transaction, or if tx is already a
+// transaction, undoes everything fn changed if it fails, which emulates the
+// savepoint that the real database runs it in.
 func (tdb *DB) RunOrContinueTransaction(tx db.Tx, fn func(tx db.Tx) error) error {
-	return fn(tx)
+	op, err := tdb.op(tx)
+	if err != nil {
+		return err
+	}
+	if !op.txn {
+		if err := tdb.transact(op.ctx, fn); err != nil {
+			return fmt.Errorf("err in txn: %w", err)
+		}
+		return nil
+	}
+	// Writes never modify the working state in place, so holding onto it is
+	// all a savepoint takes.
+	saved := op.working
+	if err := fn(op); err != nil {
+		op.working = saved
+		return err
+	}
+	return nil
 }
 
-func (db *DB) NoTxn(_ context.Context) db.Tx {
-	return &Op{}
+func (tdb *DB) NoTxn(ctx context.Context) db.Tx {
+	return &Op{db: tdb, ctx: ctx}
 }
 
-func (db *DB) nextID(ns string) string {
-	idx := db.nextIDs[ns]
-	db.nextIDs[ns]++
+func (tdb *DB) nextID(ns string) string {
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+	idx := tdb.nextIDs[ns]
+	tdb.nextIDs[ns]++
 	return fmt.Sprintf("%s.%d", ns, idx)
 }
 
+// op returns tx as an Op, if it's one that can still be used with this
+// database.
+func (tdb *DB) op(tx db.Tx) (*Op, error) {
+	op, ok := tx.(*Op)
+	if !ok || op == nil {
+		return nil, fmt.Errorf("unexpected type for transaction: %T", tx)
+	}
+	if op.db != tdb {
+		return nil, errors.New("transaction belongs to a different testdb")
+	}
+	if op.done {
+		return nil, errTxnDone
+	}
+	return op, nil
+}
+
+// read returns the state that tx sees, which is its own writes if it has made
+// any, and otherwise whatever was most recently committed.
+func (tdb *DB) read(tx db.Tx) (*state, error) {
+	op, err := tdb.op(tx)
+	if err != nil {
+		return nil, err
+	}
+	if op.working != nil {
+		return op.working, nil
+	}
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+	return tdb.committed, nil
+}
+
+// write runs fn against a copy of the state that tx sees, which only replaces
+// it if fn succeeds, so a failed write changes nothing. Outside of a
+// transaction, the write is committed right away.
+func (tdb *DB) write(tx db.Tx, fn func(w *writer) error) error {
+	op, err := tdb.op(tx)
+	if err != nil {
+		return err
+	}
+	if !op.txn {
+		return tdb.transact(op.ctx, func(tx db.Tx) error {
+			return tdb.write(tx, fn)
+		})
+	}
+	if err := op.lock(); err != nil {
+		return err
+	}
+	// Nothing else can commit while we hold the lock, so if the transaction
+	// hasn't written yet, the committed state is what it would have read.
+	base := op.working
+	if base == nil {
+		tdb.mu.Lock()
+		base = tdb.committed
+		tdb.mu.Unlock()
+	}
+	w := &writer{state: base.clone(), db: tdb}
+	if op.ctx != nil {
+		w.actor, _ = todo.UserIDFromContext(op.ctx)
+	}
+	if err := fn(w); err != nil {
+		return err
+	}
+	op.working = w.state
+	return nil
+}
+
+var pkgPath = reflect.TypeOf(DB{}).PkgPath()
+
+// caller returns the location of the code that called into the database,
+// skipping over the database's own methods.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, pkgPath+".(*DB)") && !strings.HasPrefix(f.Function, pkgPath+".(*Op)") {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if !more {
+			return "unknown location"
+		}
+	}
+}
+
+var errTxnDone = errors.New("txn has already been committed or rolled back")
+
+// Op is a transaction, or when it's returned from NoTxn, a handle that runs
+// each write in a transaction of its own.
 type Op struct {
-	db *DB
+	db  *DB
+	ctx context.Context
+	txn bool
+
+	// working holds the transaction's writes, and is nil until it makes one.
+	working *state
+	locked  bool
+	done    bool
 }
 
 func (tx *Op) Commit() error {
-	_, ok := tx.db.pendingTxns[tx]
-	if !ok {
+	if !tx.txn {
 		return errors.New("attempting to commit txn prior to beginning it")
 	}
-	delete(tx.db.pendingTxns, tx)
-	return nil
+	return tx.finish(true)
 }
 
 func (tx *Op) Rollback() error {
+	if !tx.txn {
+		return errors.New("attempting to roll back txn prior to beginning it")
+	}
+	return tx.finish(false)
+}
+
+func (tx *Op) finish(commit bool) error {
+	if tx.done {
+		return errTxnDone
+	}
+	tdb := tx.db
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+	if commit && tx.working != nil {
+		tdb.committed = tx.working
+	}
+	delete(tdb.pendingTxns, tx)
+	if tx.locked {
+		tdb.lockedBy = nil
+		<-tdb.writeLock
+	}
+	tx.working, tx.locked, tx.done = nil, false, true
 	return nil
 }
 
-func (db *DB) Transactional(_ context.Context, fn func(_ db.Tx) error) error {
-	if err := fn(nil); err != nil {
-		return fmt.Errorf("while running testdb txn: %w", err)
+// lock takes the write lock for the rest of the transaction, waiting for the
+// transaction that holds it, if any, to finish.
+func (tx *Op) lock() error {
+	if tx.locked {
+		return nil
 	}
+	tdb := tx.db
+	timer := time.NewTimer(tdb.lockTimeout)
+	defer timer.Stop()
+	select {
+	case tdb.writeLock <- struct{}{}:
+	case <-tx.ctx.Done():
+		return fmt.Errorf("waiting to write: %w", tx.ctx.Err())
+	case <-timer.C:
+		tdb.mu.Lock()
+		defer tdb.mu.Unlock()
+		begunAt, ok := tdb.pendingTxns[tdb.lockedBy]
+		if !ok {
+			begunAt = "an unknown location"
+		}
+		return fmt.Errorf("timed out after %v waiting to write, as the txn begun at %s is still writing and may have been leaked", tdb.lockTimeout, begunAt)
+	}
+	tdb.mu.Lock()
+	tdb.lockedBy = tx
+	tdb.mu.Unlock()
+	tx.locked = true
 	return nil
 }
 
+// state is a snapshot of the contents of the database. It isn't modified once
+// it's visible outside of the write that created it, and the entities in it
+// are cloned rather than modified in place, so snapshots can share them.
+type state struct {
+	users         []*todo.User
+	identities    []*todo.AuthIdentity
+	tasks         []*todo.Task
+	collaborators []*todo.TaskCollaborator
+	lists         []*todo.List
+	dependencies  []*todo.TaskDependency
+	events        []*todo.TaskEvent
+	revocations   []*sessionRevocation
+}
+
+func (s *state) clone() *state {
+	return &state{
+		users:         copySlice(s.users),
+		identities:    copySlice(s.identities),
+		tasks:         copySlice(s.tasks),
+		collaborators: copySlice(s.collaborators),
+		lists:         copySlice(s.lists),
+		dependencies:  copySlice(s.dependencies),
+		events:        copySlice(s.events),
+		revocations:   copySlice(s.revocations),
+	}
+}
+
+// copySlice copies into a new backing array, as some changes modify the
+// backing array in place, e.g. removing an element with append.
+func copySlice[T any](in []T) []T {
+	if in == nil {
+		return nil
+	}
+	out := make([]T, len(in))
+	copy(out, in)
+	return out
+}
+
+// writer makes the changes for a single write to its own copy of the state.
+type writer struct {
+	*state
+	db *DB
+	// actor is the user that changes to tasks are attributed to.
+	actor todo.UserID
+}
+
 func (tdb *DB) UserByAuthnProvider(tx db.Tx, authProvider authn.Provider, authID authn.UserID) (*todo.User, error) {
-	for _, u := range tdb.users {
-		if u.AuthnProviderType == authProvider && u.AuthnProviderID == authID {
-			return u.Clone(), nil
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range s.identities {
+		if a.Provider == authProvider && a.ProviderUserID == authID {
+			return s.user(a.UserID)
 		}
 	}
 
@@ -89,33 +367,134 @@ func (tdb *DB) UserByAuthnProvider(tx db.Tx, authProvider authn.Provider, authID
 
 func (tdb *DB) CreateUser(tx db.Tx, provider authn.Provider, authID authn.UserID, name string, email string) (todo.UserID, error) {
 	id := todo.UserID(tdb.nextID("user"))
-	u := &todo.User{
-		ID:                id,
-		Name:              name,
-		Email:             email,
-		AuthnProviderType: provider,
-		AuthnProviderID:   authID,
-	}
-	tdb.users = append(tdb.users, u)
+	err := tdb.write(tx, func(w *writer) error {
+		for _, a := range w.identities {
+			if a.Provider == provider && a.ProviderUserID == authID {
+				return errkind.New(errkind.Conflict, fmt.Sprintf("%s identity %q is already linked to a user", provider, authID))
+			}
+		}
+		now := time.Now()
+		w.users = append(w.users, &todo.User{
+			ID:                id,
+			Name:              name,
+			Email:             email,
+			CreatedAt:         now,
+			AuthnProviderType: provider,
+			AuthnProviderID:   authID,
+			Version:           1,
+		})
+		w.identities = append(w.identities, &todo.AuthIdentity{
+			UserID:         id,
+			Provider:       provider,
+			ProviderUserID: authID,
+			Email:          email,
+			CreatedAt:      now,
+		})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
 	return id, nil
 }
 
-func (tdb *DB) UpdateUser(_ db.Tx, id todo.UserID, ms ...db.UpdateUserFn) error {
-	for i, u := range tdb.users {
-		if u.ID == id {
-			uu := u.Clone()
-			for _, m := range ms {
-				m(uu)
+func (tdb *DB) UpdateUser(tx db.Tx, id todo.UserID, ms ...db.UpdateUserFn) error {
+	return tdb.write(tx, func(w *writer) error {
+		for i, u := range w.users {
+			if u.ID == id {
+				uu := u.Clone()
+				for _, m := range ms {
+					if err := m(uu); err != nil {
+						return fmt.Errorf("running mutation: %w", err)
+					}
+				}
+				uu.Version++
+				w.users[i] = uu
+				return nil
 			}
-			tdb.users[i] = uu
-			return nil
 		}
+		return db.NotFound(id, "user")
+	})
+}
+
+func (tdb *DB) DeleteUser(tx db.Tx, id todo.UserID) error {
+	return tdb.write(tx, func(w *writer) error {
+		return w.deleteUser(id)
+	})
+}
+
+func (w *writer) deleteUser(id todo.UserID) error {
+	if _, err := w.user(id); err != nil {
+		return err
 	}
-	return db.NotFound(id, "user")
+	owned := make(map[todo.TaskID]bool)
+	for _, t := range w.tasks {
+		if t.CreatedBy == id {
+			owned[t.ID] = true
+		}
+	}
+	for i, t := range w.tasks {
+		if !owned[t.ID] && owned[t.ParentID] {
+			if err := w.updateTaskParent(i, ""); err != nil {
+				return fmt.Errorf("promoting subtask %q: %w", t.ID, err)
+			}
+		}
+	}
+	var blocked []*todo.TaskDependency
+	for _, d := range w.dependencies {
+		if !owned[d.TaskID] && owned[d.BlockedByID] {
+			blocked = append(blocked, d)
+		}
+	}
+	for _, d := range blocked {
+		if err := w.removeTaskDependency(d.TaskID, d.BlockedByID); err != nil {
+			return fmt.Errorf("unblocking task %q: %w", d.TaskID, err)
+		}
+	}
+
+	w.tasks = filter(w.tasks, func(t *todo.Task) bool { return !owned[t.ID] })
+	w.lists = filter(w.lists, func(l *todo.List) bool { return l.CreatedBy != id })
+	w.collaborators = filter(w.collaborators, func(c *todo.TaskCollaborator) bool {
+		return !owned[c.TaskID] && c.UserID != id
+	})
+	w.dependencies = filter(w.dependencies, func(d *todo.TaskDependency) bool {
+		return !owned[d.TaskID] && !owned[d.BlockedByID]
+	})
+	w.events = filter(w.events, func(e *todo.TaskEvent) bool { return !owned[e.TaskID] })
+	for i, e := range w.events {
+		if e.ActorID == id {
+			ee := *e
+			ee.ActorID = ""
+			w.events[i] = &ee
+		}
+	}
+	w.identities = filter(w.identities, func(a *todo.AuthIdentity) bool { return a.UserID != id })
+	w.users = filter(w.users, func(u *todo.User) bool { return u.ID != id })
+	return nil
+}
+
+// filter returns the elements of in that keep returns true for, in a new
+// backing array.
+func filter[T any](in []T, keep func(T) bool) []T {
+	var out []T
+	for _, v := range in {
+		if keep(v) {
+			out = append(out, v)
+		}
+	}
+	return out
 }
 
-func (tdb *DB) User(_ db.Tx, id todo.UserID) (*todo.User, error) {
-	for _, u := range tdb.users {
+func (tdb *DB) User(tx db.Tx, id todo.UserID) (*todo.User, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.user(id)
+}
+
+func (s *state) user(id todo.UserID) (*todo.User, error) {
+	for _, u := range s.users {
 		if u.ID == id {
 			return u.Clone(), nil
 		}
@@ -123,62 +502,899 @@ func (tdb *DB) User(_ db.Tx, id todo.UserID) (*todo.User, error) {
 	return nil, db.NotFound(id, "user")
 }
 
-func (tdb *DB) Users(_ db.Tx) ([]*todo.User, error) {
+func (tdb *DB) UsersByID(tx db.Tx, ids []todo.UserID) (map[todo.UserID]*todo.User, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[todo.UserID]*todo.User)
+	for _, id := range ids {
+		u, err := s.user(id)
+		if db.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		out[id] = u
+	}
+	return out, nil
+}
+
+func (tdb *DB) Users(tx db.Tx) ([]*todo.User, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
 	var r []*todo.User
-	for _, u := range tdb.users {
+	for _, u := range s.users {
 		r = append(r, u.Clone())
 	}
 	return r, nil
 }
 
-func (tdb *DB) Task(_ db.Tx, id todo.TaskID) (*todo.Task, error) {
-	for _, t := range tdb.tasks {
-		if t.ID == id {
+func (tdb *DB) ListUsers(tx db.Tx, q *db.UserQuery) (*db.UserPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid user query: %w", err)
+	}
+	var after *db.UserCursorKey
+	if q.After != "" {
+		k, err := db.DecodeUserCursor(q.After)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		after = k
+	}
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	search := strings.ToLower(q.Search)
+	r := make([]*todo.User, 0)
+	for _, u := range s.users {
+		if search != "" && !strings.Contains(strings.ToLower(u.Name), search) && !strings.Contains(strings.ToLower(u.Email), search) {
+			continue
+		}
+		if after != nil && !after.Before(db.UserCursorKeyFor(u)) {
+			continue
+		}
+		r = append(r, u.Clone())
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return db.UserCursorKeyFor(r[i]).Before(db.UserCursorKeyFor(r[j]))
+	})
+
+	page := &db.UserPage{Users: r}
+	if q.Limit > 0 && len(r) > q.Limit {
+		page.Users = r[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
+}
+
+func (tdb *DB) TaskCountsByCreator(tx db.Tx, ids []todo.UserID) (map[todo.UserID]int, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[todo.UserID]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	out := make(map[todo.UserID]int)
+	for _, t := range s.tasks {
+		if wanted[t.CreatedBy] && !t.IsTrashed() {
+			out[t.CreatedBy]++
+		}
+	}
+	return out, nil
+}
+
+func (tdb *DB) Task(tx db.Tx, id todo.TaskID) (*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.task(id)
+}
+
+func (tdb *DB) TasksByID(tx db.Tx, ids []todo.TaskID) (map[todo.TaskID]*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[todo.TaskID]*todo.Task)
+	for _, id := range ids {
+		t, err := s.task(id)
+		if db.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		out[id] = t
+	}
+	return out, nil
+}
+
+func (s *state) task(id todo.TaskID) (*todo.Task, error) {
+	for _, t := range s.tasks {
+		if t.ID == id && !t.IsTrashed() {
 			return t.Clone(), nil
 		}
 	}
 	return nil, db.NotFound(id, "task")
 }
 
-func (tdb *DB) TasksByCreator(_ db.Tx, userID todo.UserID) ([]*todo.Task, error) {
+func (s *state) taskIndex(id todo.TaskID) int {
+	for i, t := range s.tasks {
+		if t.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tdb *DB) TasksByCreator(tx db.Tx, userID todo.UserID, q *db.TaskQuery) (*db.TaskPage, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.listTasks(q, func(t *todo.Task) bool {
+		return t.CreatedBy == userID
+	})
+}
+
+func (tdb *DB) TasksForUser(tx db.Tx, userID todo.UserID, q *db.TaskQuery) (*db.TaskPage, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.listTasks(q, func(t *todo.Task) bool {
+		return t.CreatedBy == userID || s.collaboratorIndex(t.ID, userID) >= 0
+	})
+}
+
+func (s *state) listTasks(q *db.TaskQuery, inScope func(*todo.Task) bool) (*db.TaskPage, error) {
+	if q == nil {
+		q = db.DefaultTaskQuery()
+	}
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid task query: %w", err)
+	}
+	var after *db.TaskCursorKey
+	if q.After != "" {
+		k, err := db.DecodeTaskCursor(q.After, q.Sort.Field)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		after = k
+	}
+	// less reports whether key a comes before key b in the requested order.
+	less := func(a, b *db.TaskCursorKey) bool {
+		if q.Sort.Descending {
+			return a.Compare(b) > 0
+		}
+		return a.Compare(b) < 0
+	}
+
 	r := make([]*todo.Task, 0)
-	for _, t := range tdb.tasks {
-		if t.CreatedBy == userID {
+	for _, t := range s.tasks {
+		if t.IsTrashed() || !inScope(t) || !matchesTaskFilter(t, &q.Filter) {
+			continue
+		}
+		if after != nil && !less(after, db.TaskCursorKeyFor(t, q.Sort.Field)) {
+			continue
+		}
+		r = append(r, t.Clone())
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return less(db.TaskCursorKeyFor(r[i], q.Sort.Field), db.TaskCursorKeyFor(r[j], q.Sort.Field))
+	})
+
+	page := &db.TaskPage{Tasks: r}
+	if q.Limit > 0 && len(r) > q.Limit {
+		page.Tasks = r[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
+}
+
+func (tdb *DB) TagsForUser(tx db.Tx, userID todo.UserID) ([]*todo.TagUsage, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, t := range s.tasks {
+		if t.CreatedBy != userID || t.IsTrashed() {
+			continue
+		}
+		for _, tag := range t.Tags {
+			counts[tag]++
+		}
+	}
+	var r []*todo.TagUsage
+	for tag, n := range counts {
+		r = append(r, &todo.TagUsage{Tag: tag, TaskCount: n})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].TaskCount != r[j].TaskCount {
+			return r[i].TaskCount > r[j].TaskCount
+		}
+		return r[i].Tag < r[j].Tag
+	})
+	return r, nil
+}
+
+func matchesTaskFilter(t *todo.Task, f *db.TaskFilter) bool {
+	if f.Tag != "" && !containsTag(t.Tags, f.Tag) {
+		return false
+	}
+	if f.ListID != "" && t.ListID != f.ListID {
+		return false
+	}
+	if f.Completed != nil && *f.Completed != t.IsCompleted() {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && t.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !t.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func containsTag(tags todo.Tags, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (tdb *DB) CreateTask(tx db.Tx, userID todo.UserID) (todo.TaskID, error) {
+	id := todo.TaskID(tdb.nextID("task"))
+	err := tdb.write(tx, func(w *writer) error {
+		now := time.Now()
+		t := &todo.Task{
+			ID:        id,
+			CreatedBy: userID,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Version:   1,
+		}
+		w.tasks = append(w.tasks, t)
+		if err := w.recordTaskDiff(t.ID, todo.TaskEventCreated, nil, t); err != nil {
+			return fmt.Errorf("recording task creation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (tdb *DB) UpdateTask(tx db.Tx, id todo.TaskID, ms ...db.UpdateTaskFn) error {
+	ms = append([]db.UpdateTaskFn{requireTrashed(false)}, ms...)
+	return tdb.write(tx, func(w *writer) error {
+		return w.updateTask(id, todo.TaskEventUpdated, ms...)
+	})
+}
+
+// updateTask applies the mutations to the task, whether or not it's in the
+// trash, and records the change as an event of the given kind.
+func (w *writer) updateTask(id todo.TaskID, kind todo.TaskEventKind, ms ...db.UpdateTaskFn) error {
+	i := w.taskIndex(id)
+	if i < 0 {
+		return db.NotFound(id, "task")
+	}
+	before := w.tasks[i]
+	t := before.Clone()
+	for _, m := range ms {
+		if err := m(t); err != nil {
+			return fmt.Errorf("running mutation: %w", err)
+		}
+	}
+	t.UpdatedAt = time.Now()
+	t.Version++
+	w.tasks[i] = t
+	if err := w.recordTaskDiff(id, kind, before, t); err != nil {
+		return fmt.Errorf("recording task change: %w", err)
+	}
+	return nil
+}
+
+func (tdb *DB) DeleteTask(tx db.Tx, id todo.TaskID) error {
+	return tdb.write(tx, func(w *writer) error {
+		return w.deleteTask(id)
+	})
+}
+
+func (w *writer) deleteTask(id todo.TaskID) error {
+	now := time.Now()
+	return w.updateTask(id, todo.TaskEventDeleted, requireTrashed(false), func(t *todo.Task) error {
+		t.DeletedAt = now
+		return nil
+	})
+}
+
+func requireTrashed(trashed bool) db.UpdateTaskFn {
+	return func(t *todo.Task) error {
+		if t.IsTrashed() != trashed {
+			if trashed {
+				return db.NotFound(t.ID, "trashed task")
+			}
+			return db.NotFound(t.ID, "task")
+		}
+		return nil
+	}
+}
+
+func (tdb *DB) TrashedTask(tx db.Tx, id todo.TaskID) (*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.trashedTask(id)
+}
+
+func (s *state) trashedTask(id todo.TaskID) (*todo.Task, error) {
+	if i := s.taskIndex(id); i >= 0 && s.tasks[i].IsTrashed() {
+		return s.tasks[i].Clone(), nil
+	}
+	return nil, db.NotFound(id, "trashed task")
+}
+
+func (tdb *DB) TrashedTasks(tx db.Tx, userID todo.UserID) ([]*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	var r []*todo.Task
+	for _, t := range s.tasks {
+		if t.CreatedBy == userID && t.IsTrashed() {
 			r = append(r, t.Clone())
 		}
 	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].DeletedAt.After(r[j].DeletedAt)
+	})
 	return r, nil
 }
 
-func (tdb *DB) CreateTask(_ db.Tx, userID todo.UserID) (todo.TaskID, error) {
-	t := &todo.Task{
-		ID:        todo.TaskID(tdb.nextID("task")),
-		CreatedBy: userID,
+func (tdb *DB) RestoreTask(tx db.Tx, id todo.TaskID) error {
+	return tdb.write(tx, func(w *writer) error {
+		return w.updateTask(id, todo.TaskEventUpdated, requireTrashed(true), func(t *todo.Task) error {
+			t.DeletedAt = time.Time{}
+			return nil
+		})
+	})
+}
+
+func (tdb *DB) PurgeTask(tx db.Tx, id todo.TaskID) error {
+	return tdb.write(tx, func(w *writer) error {
+		t, err := w.trashedTask(id)
+		if err != nil {
+			return err
+		}
+		if err := w.deleteTaskLinks(id); err != nil {
+			return fmt.Errorf("removing links to task: %w", err)
+		}
+		if err := w.recordTaskDiff(id, todo.TaskEventDeleted, t, nil); err != nil {
+			return fmt.Errorf("recording task purge: %w", err)
+		}
+		i := w.taskIndex(id)
+		w.tasks = append(w.tasks[:i], w.tasks[i+1:]...)
+		return nil
+	})
+}
+
+// PurgeTrashedTasks purges each task in a transaction of its own, unless tx is
+// already a transaction, like the real database.
+func (tdb *DB) PurgeTrashedTasks(tx db.Tx, before time.Time) (int, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return 0, err
 	}
-	tdb.tasks = append(tdb.tasks, t)
-	return t.ID, nil
+	var ids []todo.TaskID
+	for _, t := range s.tasks {
+		if t.IsTrashed() && t.DeletedAt.Before(before) {
+			ids = append(ids, t.ID)
+		}
+	}
+	for i, id := range ids {
+		if err := tdb.PurgeTask(tx, id); err != nil {
+			return i, fmt.Errorf("purging task %q: %w", id, err)
+		}
+	}
+	return len(ids), nil
 }
 
-func (tdb *DB) UpdateTask(_ db.Tx, id todo.TaskID, ms ...db.UpdateTaskFn) error {
-	for i, t := range tdb.tasks {
-		if t.ID == id {
-			t := t.Clone()
-			for _, m := range ms {
-				m(t)
+func (tdb *DB) TaskCollaborators(tx db.Tx, taskID todo.TaskID) ([]*todo.TaskCollaborator, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.taskCollaborators(taskID), nil
+}
+
+func (tdb *DB) CollaboratorsByTaskID(tx db.Tx, ids []todo.TaskID) (map[todo.TaskID][]*todo.TaskCollaborator, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[todo.TaskID][]*todo.TaskCollaborator)
+	for _, id := range ids {
+		if cs := s.taskCollaborators(id); len(cs) > 0 {
+			out[id] = cs
+		}
+	}
+	return out, nil
+}
+
+func (s *state) taskCollaborators(taskID todo.TaskID) []*todo.TaskCollaborator {
+	var r []*todo.TaskCollaborator
+	for _, c := range s.collaborators {
+		if c.TaskID == taskID {
+			cc := *c
+			r = append(r, &cc)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].UserID < r[j].UserID
+	})
+	return r
+}
+
+func (tdb *DB) ShareTask(tx db.Tx, taskID todo.TaskID, userID todo.UserID, role todo.TaskRole) error {
+	if !role.IsValid() {
+		return fmt.Errorf("invalid task role %q", role)
+	}
+	return tdb.write(tx, func(w *writer) error {
+		if _, err := w.task(taskID); err != nil {
+			return fmt.Errorf("sharing task: %w", err)
+		}
+		if _, err := w.user(userID); err != nil {
+			return fmt.Errorf("sharing task: %w", err)
+		}
+		return w.changeCollaborators(taskID, func() error {
+			c := &todo.TaskCollaborator{TaskID: taskID, UserID: userID, Role: role}
+			if i := w.collaboratorIndex(taskID, userID); i >= 0 {
+				w.collaborators[i] = c
+				return nil
 			}
-			tdb.tasks[i] = t
+			w.collaborators = append(w.collaborators, c)
 			return nil
+		})
+	})
+}
+
+func (tdb *DB) UnshareTask(tx db.Tx, taskID todo.TaskID, userID todo.UserID) error {
+	return tdb.write(tx, func(w *writer) error {
+		return w.changeCollaborators(taskID, func() error {
+			i := w.collaboratorIndex(taskID, userID)
+			if i < 0 {
+				return db.NotFound(string(taskID)+":"+string(userID), "task collaborator")
+			}
+			w.collaborators = append(w.collaborators[:i], w.collaborators[i+1:]...)
+			return nil
+		})
+	})
+}
+
+func (w *writer) changeCollaborators(taskID todo.TaskID, fn func() error) error {
+	before := w.taskCollaborators(taskID)
+	if err := fn(); err != nil {
+		return err
+	}
+	changes, err := todo.DiffTaskCollaborators(before, w.taskCollaborators(taskID))
+	if err != nil {
+		return fmt.Errorf("diffing collaborators: %w", err)
+	}
+	return w.recordTaskEvent(taskID, todo.TaskEventUpdated, changes)
+}
+
+func (s *state) collaboratorIndex(taskID todo.TaskID, userID todo.UserID) int {
+	for i, c := range s.collaborators {
+		if c.TaskID == taskID && c.UserID == userID {
+			return i
 		}
 	}
-	return db.NotFound(id, "task")
+	return -1
 }
 
-func (tdb *DB) DeleteTask(_ db.Tx, id todo.TaskID) error {
-	for i, t := range tdb.tasks {
-		if t.ID == id {
-			tdb.tasks = append(tdb.tasks[:i], tdb.tasks[i+1:]...)
+// deleteTaskLinks removes everything that refers to a task that's about to be
+// purged, mirroring the real database, including the history it records for
+// the other tasks.
+func (w *writer) deleteTaskLinks(taskID todo.TaskID) error {
+	var keptCollaborators []*todo.TaskCollaborator
+	for _, c := range w.collaborators {
+		if c.TaskID != taskID {
+			keptCollaborators = append(keptCollaborators, c)
+		}
+	}
+	w.collaborators = keptCollaborators
+
+	var keptDependencies []*todo.TaskDependency
+	for _, d := range w.dependencies {
+		if d.TaskID != taskID {
+			keptDependencies = append(keptDependencies, d)
+		}
+	}
+	w.dependencies = keptDependencies
+
+	var blocked []todo.TaskID
+	for _, d := range w.dependencies {
+		if d.BlockedByID == taskID {
+			blocked = append(blocked, d.TaskID)
+		}
+	}
+	for _, id := range blocked {
+		if err := w.removeTaskDependency(id, taskID); err != nil {
+			return fmt.Errorf("unblocking task %q: %w", id, err)
+		}
+	}
+	for i, t := range w.tasks {
+		if t.ParentID == taskID {
+			if err := w.updateTaskParent(i, ""); err != nil {
+				return fmt.Errorf("promoting subtask %q: %w", t.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (tdb *DB) List(tx db.Tx, id todo.ListID) (*todo.List, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(id)
+}
+
+func (s *state) list(id todo.ListID) (*todo.List, error) {
+	for _, l := range s.lists {
+		if l.ID == id {
+			return l.Clone(), nil
+		}
+	}
+	return nil, db.NotFound(id, "list")
+}
+
+func (tdb *DB) ListsByCreator(tx db.Tx, userID todo.UserID) ([]*todo.List, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	var r []*todo.List
+	for _, l := range s.lists {
+		if l.CreatedBy == userID {
+			r = append(r, l.Clone())
+		}
+	}
+	return r, nil
+}
+
+func (tdb *DB) CreateList(tx db.Tx, userID todo.UserID, name string) (todo.ListID, error) {
+	name, err := todo.ListNameRule.Apply(name)
+	if err != nil {
+		return "", err
+	}
+	id := todo.ListID(tdb.nextID("list"))
+	err = tdb.write(tx, func(w *writer) error {
+		w.lists = append(w.lists, &todo.List{
+			ID:        id,
+			Name:      name,
+			CreatedBy: userID,
+			CreatedAt: time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (tdb *DB) UpdateList(tx db.Tx, id todo.ListID, ms ...db.UpdateListFn) error {
+	return tdb.write(tx, func(w *writer) error {
+		for i, l := range w.lists {
+			if l.ID == id {
+				l := l.Clone()
+				for _, m := range ms {
+					if err := m(l); err != nil {
+						return fmt.Errorf("running mutation: %w", err)
+					}
+				}
+				w.lists[i] = l
+				return nil
+			}
+		}
+		return db.NotFound(id, "list")
+	})
+}
+
+func (tdb *DB) TasksInList(tx db.Tx, id todo.ListID) ([]*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.tasksOldestFirst(func(t *todo.Task) bool {
+		return t.ListID == id
+	}), nil
+}
+
+func (tdb *DB) DeleteList(tx db.Tx, id todo.ListID, disposition db.ListTaskDisposition, moveTo todo.ListID) error {
+	switch disposition {
+	case db.DeleteListTasks:
+		if moveTo != "" {
+			return fmt.Errorf("can't move tasks to list %q when deleting them", moveTo)
+		}
+	case db.MoveListTasks:
+		if moveTo == id {
+			return fmt.Errorf("can't move tasks to list %q while deleting it", moveTo)
+		}
+	default:
+		return fmt.Errorf("unknown list task disposition %q", disposition)
+	}
+	return tdb.write(tx, func(w *writer) error {
+		if moveTo != "" {
+			if _, err := w.list(moveTo); err != nil {
+				return fmt.Errorf("reading destination list: %w", err)
+			}
+		}
+		idx := -1
+		for i, l := range w.lists {
+			if l.ID == id {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			return db.NotFound(id, "list")
+		}
+
+		// Tasks that are already in the trash are moved out of the list too, as
+		// the list won't exist when they're restored.
+		inList := w.tasksOldestFirst(func(t *todo.Task) bool {
+			return t.ListID == id
+		})
+		for _, t := range inList {
+			if disposition == db.DeleteListTasks {
+				if err := w.updateTask(t.ID, todo.TaskEventUpdated, db.SetTaskList("")); err != nil {
+					return fmt.Errorf("removing task %q from list: %w", t.ID, err)
+				}
+				if !t.IsTrashed() {
+					if err := w.deleteTask(t.ID); err != nil {
+						return fmt.Errorf("deleting task %q in list: %w", t.ID, err)
+					}
+				}
+				continue
+			}
+			if err := w.updateTask(t.ID, todo.TaskEventUpdated, db.SetTaskList(moveTo)); err != nil {
+				return fmt.Errorf("moving task %q out of list: %w", t.ID, err)
+			}
+		}
+		w.lists = append(w.lists[:idx], w.lists[idx+1:]...)
+		return nil
+	})
+}
+
+func (tdb *DB) Subtasks(tx db.Tx, parentID todo.TaskID) ([]*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.tasksOldestFirst(func(t *todo.Task) bool {
+		return t.ParentID == parentID && !t.IsTrashed()
+	}), nil
+}
+
+func (tdb *DB) SetTaskParent(tx db.Tx, taskID, parentID todo.TaskID) error {
+	return tdb.write(tx, func(w *writer) error {
+		if _, err := w.task(taskID); err != nil {
+			return fmt.Errorf("reading task: %w", err)
+		}
+		if parentID != "" {
+			if _, err := w.task(parentID); err != nil {
+				return fmt.Errorf("reading parent: %w", err)
+			}
+		}
+		// Trashed tasks can be restored, so they're included when looking for
+		// cycles.
+		err := todo.ValidateParent(taskID, parentID, func(id todo.TaskID) (todo.TaskID, error) {
+			i := w.taskIndex(id)
+			if i < 0 {
+				return "", db.NotFound(id, "task")
+			}
+			return w.tasks[i].ParentID, nil
+		})
+		if err != nil {
+			return fmt.Errorf("validating parent: %w", err)
+		}
+		return w.updateTaskParent(w.taskIndex(taskID), parentID)
+	})
+}
+
+func (w *writer) updateTaskParent(idx int, parentID todo.TaskID) error {
+	before := w.tasks[idx]
+	t := before.Clone()
+	t.ParentID = parentID
+	t.UpdatedAt = time.Now()
+	t.Version++
+	w.tasks[idx] = t
+	return w.recordTaskDiff(t.ID, todo.TaskEventUpdated, before, t)
+}
+
+func (tdb *DB) BlockingTasks(tx db.Tx, taskID todo.TaskID) ([]*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.tasksOldestFirst(func(t *todo.Task) bool {
+		return s.dependencyIndex(taskID, t.ID) >= 0 && !t.IsTrashed()
+	}), nil
+}
+
+func (tdb *DB) BlockedTasks(tx db.Tx, taskID todo.TaskID) ([]*todo.Task, error) {
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	return s.tasksOldestFirst(func(t *todo.Task) bool {
+		return s.dependencyIndex(t.ID, taskID) >= 0 && !t.IsTrashed()
+	}), nil
+}
+
+func (tdb *DB) AddTaskDependency(tx db.Tx, taskID, blockedByID todo.TaskID) error {
+	return tdb.write(tx, func(w *writer) error {
+		if _, err := w.task(taskID); err != nil {
+			return fmt.Errorf("reading task: %w", err)
+		}
+		if _, err := w.task(blockedByID); err != nil {
+			return fmt.Errorf("reading blocking task: %w", err)
+		}
+		err := todo.ValidateBlockedBy(taskID, blockedByID, func(id todo.TaskID) ([]todo.TaskID, error) {
+			return w.blockerIDs(id), nil
+		})
+		if err != nil {
+			return fmt.Errorf("validating dependency: %w", err)
+		}
+		return w.changeBlockers(taskID, func() error {
+			if w.dependencyIndex(taskID, blockedByID) >= 0 {
+				return nil
+			}
+			w.dependencies = append(w.dependencies, &todo.TaskDependency{TaskID: taskID, BlockedByID: blockedByID})
 			return nil
+		})
+	})
+}
+
+func (tdb *DB) RemoveTaskDependency(tx db.Tx, taskID, blockedByID todo.TaskID) error {
+	return tdb.write(tx, func(w *writer) error {
+		return w.removeTaskDependency(taskID, blockedByID)
+	})
+}
+
+func (w *writer) removeTaskDependency(taskID, blockedByID todo.TaskID) error {
+	return w.changeBlockers(taskID, func() error {
+		i := w.dependencyIndex(taskID, blockedByID)
+		if i < 0 {
+			return db.NotFound(string(taskID)+":"+string(blockedByID), "task dependency")
 		}
+		w.dependencies = append(w.dependencies[:i], w.dependencies[i+1:]...)
+		return nil
+	})
+}
+
+func (w *writer) changeBlockers(taskID todo.TaskID, fn func() error) error {
+	before := w.blockerIDs(taskID)
+	if err := fn(); err != nil {
+		return err
 	}
-	return db.NotFound(id, "task")
+	changes, err := todo.DiffTaskBlockers(before, w.blockerIDs(taskID))
+	if err != nil {
+		return fmt.Errorf("diffing blockers: %w", err)
+	}
+	return w.recordTaskEvent(taskID, todo.TaskEventUpdated, changes)
+}
+
+func (s *state) blockerIDs(taskID todo.TaskID) []todo.TaskID {
+	var ids []todo.TaskID
+	for _, d := range s.dependencies {
+		if d.TaskID == taskID {
+			ids = append(ids, d.BlockedByID)
+		}
+	}
+	return ids
+}
+
+func (s *state) dependencyIndex(taskID, blockedByID todo.TaskID) int {
+	for i, d := range s.dependencies {
+		if d.TaskID == taskID && d.BlockedByID == blockedByID {
+			return i
+		}
+	}
+	return -1
+}
+
+// tasksOldestFirst returns copies of the matching tasks, ordered by creation
+// time.
+func (s *state) tasksOldestFirst(match func(*todo.Task) bool) []*todo.Task {
+	var r []*todo.Task
+	for _, t := range s.tasks {
+		if match(t) {
+			r = append(r, t.Clone())
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].CreatedAt.Before(r[j].CreatedAt)
+	})
+	return r
+}
+
+func (tdb *DB) TaskHistory(tx db.Tx, taskID todo.TaskID, q *db.TaskEventQuery) (*db.TaskEventPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid task event query: %w", err)
+	}
+	s, err := tdb.read(tx)
+	if err != nil {
+		return nil, err
+	}
+	// Events are stored oldest first, and IDs aren't ordered, so resume after
+	// the cursor's event rather than comparing keys.
+	var r []*todo.TaskEvent
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if e := s.events[i]; e.TaskID == taskID {
+			r = append(r, e.Clone())
+		}
+	}
+	if q.After != "" {
+		k, err := db.DecodeTaskEventCursor(q.After)
+		if err != nil {
+			return nil, fmt.Errorf("decoding cursor: %w", err)
+		}
+		idx := -1
+		for i, e := range r {
+			if e.ID == k.ID {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			return nil, db.NotFound(k.ID, "task event")
+		}
+		r = r[idx+1:]
+	}
+	page := &db.TaskEventPage{Events: r}
+	if q.Limit > 0 && len(r) > q.Limit {
+		page.Events = r[:q.Limit]
+		page.HasNextPage = true
+	}
+	return page, nil
+}
+
+func (w *writer) recordTaskDiff(taskID todo.TaskID, kind todo.TaskEventKind, before, after *todo.Task) error {
+	changes, err := todo.DiffTasks(before, after)
+	if err != nil {
+		return fmt.Errorf("diffing task: %w", err)
+	}
+	return w.recordTaskEvent(taskID, kind, changes)
+}
+
+// recordTaskEvent mirrors the real database, attributing the event to the user
+// in the transaction's context and skipping updates that changed nothing.
+func (w *writer) recordTaskEvent(taskID todo.TaskID, kind todo.TaskEventKind, changes []*todo.TaskFieldChange) error {
+	if kind == todo.TaskEventUpdated && len(changes) == 0 {
+		return nil
+	}
+	w.events = append(w.events, &todo.TaskEvent{
+		ID:        todo.TaskEventID(w.db.nextID("taskevent")),
+		TaskID:    taskID,
+		ActorID:   w.actor,
+		Kind:      kind,
+		CreatedAt: time.Now(),
+		Changes:   changes,
+	})
+	return nil
 }
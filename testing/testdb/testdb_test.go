@@ -0,0 +1,265 @@
+package testdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/db"
+	"github.com/Silicon-Ally/silicon-starter/testing/dbtest"
+	"github.com/Silicon-Ally/silicon-starter/todo"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) dbtest.DB {
+		tdb := New()
+		t.Cleanup(func() { tdb.CheckAllTransactionsCommitted(t) })
+		return tdb
+	})
+}
+
+func TestNestedTransactionRollsBack(t *testing.T) {
+	ctx := context.Background()
+	tdb := New()
+	tx := tdb.NoTxn(ctx)
+	userID, err0 := tdb.CreateUser(tx, authn.EmailAndPass, "user@example.com", "User", "user@example.com")
+	viewerID, err1 := tdb.CreateUser(tx, authn.EmailAndPass, "viewer@example.com", "Viewer", "viewer@example.com")
+	taskID, err2 := tdb.CreateTask(tx, userID)
+	err3 := tdb.ShareTask(tx, taskID, viewerID, todo.TaskRoleViewer)
+	for i, err := range []error{err0, err1, err2, err3} {
+		if err != nil {
+			t.Fatalf("error during setup at index %d: %v", i, err)
+		}
+	}
+
+	errInner := errors.New("inner failure")
+	err := tdb.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+		if err := tdb.UpdateTask(tx, taskID, db.SetTaskName("Outer Name")); err != nil {
+			return err
+		}
+		err := tdb.RunOrContinueTransaction(tx, func(tx db.Tx) error {
+			if err := tdb.UpdateTask(tx, taskID, db.SetTaskBody("Inner Body")); err != nil {
+				return err
+			}
+			if err := tdb.UnshareTask(tx, taskID, viewerID); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("expected the inner error from the nested transaction, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("running outer transaction: %v", err)
+	}
+
+	task, err := tdb.Task(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting task: %v", err)
+	}
+	if task.Name != "Outer Name" || task.Body != "" {
+		t.Errorf("got task with name %q and body %q, want only the outer transaction's changes", task.Name, task.Body)
+	}
+	collaborators, err := tdb.TaskCollaborators(tx, taskID)
+	if err != nil {
+		t.Fatalf("getting collaborators: %v", err)
+	}
+	if len(collaborators) != 1 {
+		t.Errorf("got %d collaborators, want the one removed by the failed nested transaction", len(collaborators))
+	}
+}
+
+func TestRollbackUndoesWrites(t *testing.T) {
+	ctx := context.Background()
+	tdb := New()
+	userID, err := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, "user@example.com", "User", "user@example.com")
+	if err != nil {
+		t.Fatalf("error during setup: %v", err)
+	}
+
+	var taskID todo.TaskID
+	errFail := errors.New("failure")
+	err = tdb.Transactional(ctx, func(tx db.Tx) error {
+		id, err := tdb.CreateTask(tx, userID)
+		if err != nil {
+			return err
+		}
+		taskID = id
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("expected the failure from the transaction, got %v", err)
+	}
+	if _, err := tdb.Task(tdb.NoTxn(ctx), taskID); !db.IsNotFound(err) {
+		t.Errorf("reading task created in a failed transaction returned %v, want not found", err)
+	}
+
+	tx, err := tdb.Begin(ctx)
+	if err != nil {
+		t.Fatalf("beginning txn: %v", err)
+	}
+	if err := tdb.UpdateUser(tx, userID, db.SetUserName("New Name")); err != nil {
+		t.Fatalf("updating user: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rolling back: %v", err)
+	}
+	user, err := tdb.User(tdb.NoTxn(ctx), userID)
+	if err != nil {
+		t.Fatalf("reading user: %v", err)
+	}
+	if user.Name != "User" {
+		t.Errorf("got user name %q after rolling back, want %q", user.Name, "User")
+	}
+	tdb.CheckAllTransactionsCommitted(t)
+}
+
+func TestUncommittedWritesAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	tdb := New()
+	userID, err0 := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, "user@example.com", "User", "user@example.com")
+	taskID, err1 := tdb.CreateTask(tdb.NoTxn(ctx), userID)
+	for i, err := range []error{err0, err1} {
+		if err != nil {
+			t.Fatalf("error during setup at index %d: %v", i, err)
+		}
+	}
+
+	tx, err := tdb.Begin(ctx)
+	if err != nil {
+		t.Fatalf("beginning txn: %v", err)
+	}
+	if err := tdb.UpdateTask(tx, taskID, db.SetTaskName("New Name")); err != nil {
+		t.Fatalf("updating task: %v", err)
+	}
+	// A failed write doesn't undo the transaction's earlier writes.
+	if err := tdb.UpdateTask(tx, "missing", db.SetTaskName("Other Name")); !db.IsNotFound(err) {
+		t.Errorf("updating missing task returned %v, want not found", err)
+	}
+	taskName := func(tx db.Tx) string {
+		task, err := tdb.Task(tx, taskID)
+		if err != nil {
+			t.Fatalf("reading task: %v", err)
+		}
+		return task.Name
+	}
+	if got := taskName(tx); got != "New Name" {
+		t.Errorf("txn read task name %q, want its own write %q", got, "New Name")
+	}
+	if got := taskName(tdb.NoTxn(ctx)); got != "" {
+		t.Errorf("read task name %q from outside the txn, want the committed name %q", got, "")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing txn: %v", err)
+	}
+	if got := taskName(tdb.NoTxn(ctx)); got != "New Name" {
+		t.Errorf("read task name %q after commit, want %q", got, "New Name")
+	}
+}
+
+func TestFinishedTransactionCantBeUsed(t *testing.T) {
+	ctx := context.Background()
+	tdb := New()
+	tx, err := tdb.Begin(ctx)
+	if err != nil {
+		t.Fatalf("beginning txn: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing txn: %v", err)
+	}
+
+	if _, err := tdb.CreateUser(tx, authn.EmailAndPass, "user@example.com", "User", "user@example.com"); err == nil {
+		t.Error("expected an error writing with a committed txn, but got none")
+	}
+	if _, err := tdb.Users(tx); err == nil {
+		t.Error("expected an error reading with a committed txn, but got none")
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("expected an error committing a txn twice, but got none")
+	}
+	if err := tx.Rollback(); err == nil {
+		t.Error("expected an error rolling back a committed txn, but got none")
+	}
+	if err := tdb.NoTxn(ctx).Commit(); err == nil {
+		t.Error("expected an error committing outside of a txn, but got none")
+	}
+}
+
+func TestLeakedTransactionBlocksWriters(t *testing.T) {
+	ctx := context.Background()
+	tdb := New()
+	tdb.lockTimeout = 10 * time.Millisecond
+
+	leaked, err := tdb.Begin(ctx)
+	if err != nil {
+		t.Fatalf("beginning txn: %v", err)
+	}
+	if _, err := tdb.CreateUser(leaked, authn.EmailAndPass, "user@example.com", "User", "user@example.com"); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	_, err = tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, "other@example.com", "Other", "other@example.com")
+	if err == nil {
+		t.Fatal("expected an error writing while another txn holds the lock, but got none")
+	}
+	if !strings.Contains(err.Error(), "testdb_test.go") {
+		t.Errorf("expected the error to say where the leaked txn was begun, got %v", err)
+	}
+
+	if err := leaked.Rollback(); err != nil {
+		t.Fatalf("rolling back: %v", err)
+	}
+	if _, err := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, "other@example.com", "Other", "other@example.com"); err != nil {
+		t.Errorf("creating user after the txn was finished: %v", err)
+	}
+}
+
+func TestConcurrentTransactions(t *testing.T) {
+	ctx := context.Background()
+	tdb := New()
+	userID, err := tdb.CreateUser(tdb.NoTxn(ctx), authn.EmailAndPass, "user@example.com", "User", "user@example.com")
+	if err != nil {
+		t.Fatalf("error during setup: %v", err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = tdb.Transactional(ctx, func(tx db.Tx) error {
+				taskID, err := tdb.CreateTask(tx, userID)
+				if err != nil {
+					return err
+				}
+				if _, err := tdb.TasksByCreator(tdb.NoTxn(ctx), userID, nil); err != nil {
+					return err
+				}
+				return tdb.UpdateTask(tx, taskID, db.AddTaskTag("tag"))
+			})
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("txn %d failed: %v", i, err)
+		}
+	}
+
+	tags, err := tdb.TagsForUser(tdb.NoTxn(ctx), userID)
+	if err != nil {
+		t.Fatalf("reading tags: %v", err)
+	}
+	if len(tags) != 1 || tags[0].TaskCount != n {
+		t.Errorf("got tags %+v, want one tag on all %d tasks", tags, n)
+	}
+	tdb.CheckAllTransactionsCommitted(t)
+}
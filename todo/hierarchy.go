@@ -0,0 +1,67 @@
+package todo
+
+import (
+	"fmt"
+
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+)
+
+// ErrTaskCycle is returned when linking two tasks would make a task its own
+// ancestor, or leave it (transitively) blocked by itself.
+var ErrTaskCycle = errkind.New(errkind.InvalidArgument, "tasks can't be linked in a cycle")
+
+// ValidateParent returns an error if the task can't be made a subtask of
+// parentID, which is the case when the parent is the task itself or one of its
+// subtasks. parentOf returns the parent of the given task, or the empty ID if
+// it doesn't have one. The empty parentID, which removes the task from its
+// parent, is always valid.
+func ValidateParent(taskID, parentID TaskID, parentOf func(TaskID) (TaskID, error)) error {
+	seen := make(map[TaskID]bool)
+	for id := parentID; id != ""; {
+		if id == taskID {
+			return fmt.Errorf("making %q a subtask of %q: %w", taskID, parentID, ErrTaskCycle)
+		}
+		// The hierarchy should never already contain a cycle, but we don't
+		// want to loop forever if it does.
+		if seen[id] {
+			return fmt.Errorf("existing ancestors of %q contain a cycle at %q: %w", parentID, id, ErrTaskCycle)
+		}
+		seen[id] = true
+		next, err := parentOf(id)
+		if err != nil {
+			return fmt.Errorf("reading parent of %q: %w", id, err)
+		}
+		id = next
+	}
+	return nil
+}
+
+// ValidateBlockedBy returns an error if the task can't be blocked by
+// blockerID, which is the case when the blocker is the task itself or is
+// already (transitively) blocked by the task. blockersOf returns the tasks
+// directly blocking the given task.
+func ValidateBlockedBy(taskID, blockerID TaskID, blockersOf func(TaskID) ([]TaskID, error)) error {
+	if blockerID == "" {
+		return errkind.New(errkind.InvalidArgument, "no blocking task was given")
+	}
+	seen := map[TaskID]bool{blockerID: true}
+	stack := []TaskID{blockerID}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == taskID {
+			return fmt.Errorf("making %q blocked by %q: %w", taskID, blockerID, ErrTaskCycle)
+		}
+		blockers, err := blockersOf(id)
+		if err != nil {
+			return fmt.Errorf("reading blockers of %q: %w", id, err)
+		}
+		for _, b := range blockers {
+			if !seen[b] {
+				seen[b] = true
+				stack = append(stack, b)
+			}
+		}
+	}
+	return nil
+}
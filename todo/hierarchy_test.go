@@ -0,0 +1,96 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestValidateParent(t *testing.T) {
+	// task.1 <- task.2 <- task.3, i.e. task.3 is a subtask of task.2.
+	parents := map[TaskID]TaskID{
+		"task.2": "task.1",
+		"task.3": "task.2",
+	}
+	parentOf := func(id TaskID) (TaskID, error) {
+		return parents[id], nil
+	}
+	tests := []struct {
+		desc      string
+		taskID    TaskID
+		parentID  TaskID
+		wantCycle bool
+	}{
+		{desc: "no parent", taskID: "task.1", parentID: ""},
+		{desc: "unrelated task", taskID: "task.4", parentID: "task.3"},
+		{desc: "moving to a sibling", taskID: "task.3", parentID: "task.1"},
+		{desc: "self", taskID: "task.1", parentID: "task.1", wantCycle: true},
+		{desc: "direct subtask", taskID: "task.2", parentID: "task.3", wantCycle: true},
+		{desc: "indirect subtask", taskID: "task.1", parentID: "task.3", wantCycle: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := ValidateParent(test.taskID, test.parentID, parentOf)
+			if got := errors.Is(err, ErrTaskCycle); got != test.wantCycle {
+				t.Errorf("ValidateParent(%q, %q) = %v, want cycle %t", test.taskID, test.parentID, err, test.wantCycle)
+			}
+			if !test.wantCycle && err != nil {
+				t.Errorf("ValidateParent: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateParentPropagatesErrors(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+	err := ValidateParent("task.1", "task.2", func(TaskID) (TaskID, error) {
+		return "", errLookup
+	})
+	if !errors.Is(err, errLookup) {
+		t.Errorf("ValidateParent returned %v, want %v", err, errLookup)
+	}
+}
+
+func TestValidateBlockedBy(t *testing.T) {
+	// task.1 is blocked by task.2 and task.3, which are both blocked by task.4.
+	blockers := map[TaskID][]TaskID{
+		"task.1": {"task.2", "task.3"},
+		"task.2": {"task.4"},
+		"task.3": {"task.4"},
+	}
+	blockersOf := func(id TaskID) ([]TaskID, error) {
+		return blockers[id], nil
+	}
+	tests := []struct {
+		desc      string
+		taskID    TaskID
+		blockerID TaskID
+		wantCycle bool
+	}{
+		{desc: "unrelated task", taskID: "task.4", blockerID: "task.5"},
+		{desc: "shared blocker", taskID: "task.3", blockerID: "task.2"},
+		{desc: "self", taskID: "task.1", blockerID: "task.1", wantCycle: true},
+		{desc: "direct cycle", taskID: "task.2", blockerID: "task.1", wantCycle: true},
+		{desc: "indirect cycle", taskID: "task.4", blockerID: "task.1", wantCycle: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := ValidateBlockedBy(test.taskID, test.blockerID, blockersOf)
+			if got := errors.Is(err, ErrTaskCycle); got != test.wantCycle {
+				t.Errorf("ValidateBlockedBy(%q, %q) = %v, want cycle %t", test.taskID, test.blockerID, err, test.wantCycle)
+			}
+			if !test.wantCycle && err != nil {
+				t.Errorf("ValidateBlockedBy: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateBlockedByPropagatesErrors(t *testing.T) {
+	err := ValidateBlockedBy("task.1", "task.2", func(id TaskID) ([]TaskID, error) {
+		return nil, fmt.Errorf("no blockers for %q", id)
+	})
+	if err == nil || errors.Is(err, ErrTaskCycle) {
+		t.Errorf("ValidateBlockedBy returned %v, want a lookup error", err)
+	}
+}
@@ -0,0 +1,170 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type TaskEventKind string
+
+const (
+	TaskEventCreated = TaskEventKind("CREATED")
+	TaskEventUpdated = TaskEventKind("UPDATED")
+	TaskEventDeleted = TaskEventKind("DELETED")
+)
+
+// TaskEvent is an entry in the history of a task, recording a single change to
+// it. Events are never modified once recorded, and outlive the task itself.
+type TaskEvent struct {
+	ID     TaskEventID
+	TaskID TaskID
+	// ActorID is the user that made the change, or empty if it wasn't made on
+	// behalf of a user.
+	ActorID   UserID
+	Kind      TaskEventKind
+	CreatedAt time.Time
+	Changes   []*TaskFieldChange
+}
+
+func (e *TaskEvent) Clone() *TaskEvent {
+	if e == nil {
+		return nil
+	}
+	changes := make([]*TaskFieldChange, len(e.Changes))
+	for i, c := range e.Changes {
+		cc := *c
+		changes[i] = &cc
+	}
+	return &TaskEvent{
+		ID:        e.ID,
+		TaskID:    e.TaskID,
+		ActorID:   e.ActorID,
+		Kind:      e.Kind,
+		CreatedAt: e.CreatedAt,
+		Changes:   changes,
+	}
+}
+
+// TaskFieldChange is the before and after value of one field of a task.
+// Values are JSON encoded, and nil when the field had no value.
+type TaskFieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// taskFields are the fields of a task that are recorded in its history, in
+// the order they're reported. UpdatedAt is deliberately missing, as it changes
+// on every update.
+var taskFields = []struct {
+	name  string
+	value func(*Task) interface{}
+}{
+	{"name", func(t *Task) interface{} { return t.Name }},
+	{"body", func(t *Task) interface{} { return t.Body }},
+	{"tags", func(t *Task) interface{} { return []string(t.Tags) }},
+	{"listId", func(t *Task) interface{} { return t.ListID }},
+	{"parentId", func(t *Task) interface{} { return t.ParentID }},
+	{"completedAt", func(t *Task) interface{} { return nullableTime(t.CompletedAt) }},
+	{"dueAt", func(t *Task) interface{} { return nullableTime(t.DueAt) }},
+	{"deletedAt", func(t *Task) interface{} { return nullableTime(t.DeletedAt) }},
+}
+
+// DiffTasks returns the fields that differ between two versions of a task.
+// Either may be nil, to diff a task being created or deleted.
+func DiffTasks(before, after *Task) ([]*TaskFieldChange, error) {
+	var out []*TaskFieldChange
+	for _, f := range taskFields {
+		var b, a interface{}
+		if before != nil {
+			b = f.value(before)
+		}
+		if after != nil {
+			a = f.value(after)
+		}
+		c, err := fieldChange(f.name, b, a)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// DiffTaskCollaborators returns the change in who a task is shared with, or
+// nil if nothing changed.
+func DiffTaskCollaborators(before, after []*TaskCollaborator) ([]*TaskFieldChange, error) {
+	roles := func(cs []*TaskCollaborator) map[UserID]TaskRole {
+		m := make(map[UserID]TaskRole, len(cs))
+		for _, c := range cs {
+			m[c.UserID] = c.Role
+		}
+		return m
+	}
+	return singleChange("collaborators", roles(before), roles(after))
+}
+
+// DiffTaskBlockers returns the change in which tasks a task is blocked by, or
+// nil if nothing changed.
+func DiffTaskBlockers(before, after []TaskID) ([]*TaskFieldChange, error) {
+	sorted := func(ids []TaskID) []TaskID {
+		out := append([]TaskID{}, ids...)
+		sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+		return out
+	}
+	return singleChange("blockedBy", sorted(before), sorted(after))
+}
+
+func singleChange(field string, before, after interface{}) ([]*TaskFieldChange, error) {
+	c, err := fieldChange(field, before, after)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return []*TaskFieldChange{c}, nil
+}
+
+// fieldChange returns the change to the given field, or nil if the encoded
+// values are the same.
+func fieldChange(field string, before, after interface{}) (*TaskFieldChange, error) {
+	b, err := encodeFieldValue(before)
+	if err != nil {
+		return nil, fmt.Errorf("encoding previous value of %q: %w", field, err)
+	}
+	a, err := encodeFieldValue(after)
+	if err != nil {
+		return nil, fmt.Errorf("encoding new value of %q: %w", field, err)
+	}
+	if bytes.Equal(b, a) {
+		return nil, nil
+	}
+	return &TaskFieldChange{Field: field, Before: b, After: a}, nil
+}
+
+// encodeFieldValue JSON encodes the value, returning nil for empty values so
+// that e.g. an empty name and a missing task are recorded the same way.
+func encodeFieldValue(v interface{}) (json.RawMessage, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	switch string(buf) {
+	case "null", `""`, "[]", "{}":
+		return nil, nil
+	}
+	return buf, nil
+}
+
+// nullableTime normalizes times to UTC, so that the same instant read back from
+// the database isn't reported as a change.
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,128 @@
+package todo
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffTasks(t *testing.T) {
+	dueAt := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	before := &Task{
+		ID:    "task.1",
+		Name:  "Old Name",
+		Body:  "Body",
+		Tags:  Tags{"a"},
+		DueAt: dueAt,
+	}
+	after := before.Clone()
+	after.Name = "New Name"
+	after.Tags = Tags{"a", "b"}
+	after.DueAt = time.Time{}
+	// Neither the update time, nor the time zone of an unchanged time, is a
+	// change.
+	after.UpdatedAt = time.Now()
+	before.CompletedAt = dueAt
+	after.CompletedAt = dueAt.In(time.FixedZone("UTC+1", 60*60))
+
+	tests := []struct {
+		desc          string
+		before, after *Task
+		want          []*TaskFieldChange
+	}{
+		{
+			desc:   "update",
+			before: before,
+			after:  after,
+			want: []*TaskFieldChange{
+				{Field: "name", Before: raw(`"Old Name"`), After: raw(`"New Name"`)},
+				{Field: "tags", Before: raw(`["a"]`), After: raw(`["a","b"]`)},
+				{Field: "dueAt", Before: raw(`"2023-04-01T00:00:00Z"`)},
+			},
+		},
+		{
+			desc:  "create",
+			after: &Task{ID: "task.1", Name: "Name"},
+			want: []*TaskFieldChange{
+				{Field: "name", After: raw(`"Name"`)},
+			},
+		},
+		{
+			desc:   "delete",
+			before: &Task{ID: "task.1", Body: "Body", ListID: "list.1"},
+			want: []*TaskFieldChange{
+				{Field: "body", Before: raw(`"Body"`)},
+				{Field: "listId", Before: raw(`"list.1"`)},
+			},
+		},
+		{
+			desc:   "trash",
+			before: &Task{ID: "task.1"},
+			after:  &Task{ID: "task.1", DeletedAt: dueAt},
+			want: []*TaskFieldChange{
+				{Field: "deletedAt", After: raw(`"2023-04-01T00:00:00Z"`)},
+			},
+		},
+		{
+			desc:   "no change",
+			before: before,
+			after:  before.Clone(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := DiffTasks(test.before, test.after)
+			if err != nil {
+				t.Fatalf("DiffTasks: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected diff (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffTaskCollaborators(t *testing.T) {
+	before := []*TaskCollaborator{{TaskID: "task.1", UserID: "user.1", Role: TaskRoleViewer}}
+	after := []*TaskCollaborator{
+		{TaskID: "task.1", UserID: "user.1", Role: TaskRoleEditor},
+		{TaskID: "task.1", UserID: "user.2", Role: TaskRoleViewer},
+	}
+	got, err := DiffTaskCollaborators(before, after)
+	if err != nil {
+		t.Fatalf("DiffTaskCollaborators: %v", err)
+	}
+	want := []*TaskFieldChange{{
+		Field:  "collaborators",
+		Before: raw(`{"user.1":"VIEWER"}`),
+		After:  raw(`{"user.1":"EDITOR","user.2":"VIEWER"}`),
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected diff (-want +got)\n%s", diff)
+	}
+
+	if got, err := DiffTaskCollaborators(before, before); err != nil || got != nil {
+		t.Errorf("DiffTaskCollaborators with no change = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestDiffTaskBlockers(t *testing.T) {
+	got, err := DiffTaskBlockers([]TaskID{"task.3", "task.2"}, []TaskID{"task.2"})
+	if err != nil {
+		t.Fatalf("DiffTaskBlockers: %v", err)
+	}
+	want := []*TaskFieldChange{{
+		Field:  "blockedBy",
+		Before: raw(`["task.2","task.3"]`),
+		After:  raw(`["task.2"]`),
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected diff (-want +got)\n%s", diff)
+	}
+}
+
+func raw(s string) json.RawMessage {
+	return json.RawMessage(s)
+}
@@ -4,12 +4,11 @@ package todo
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/Silicon-Ally/silicon-starter/authn"
+	"github.com/Silicon-Ally/silicon-starter/errkind"
 )
 
 // This block contains typed IDs used in the ecosystem, each one representing a
@@ -18,8 +17,10 @@ import (
 //
 // Keep this block sorted alphabetically to minimize merge conflicts.
 type (
-	TaskID string
-	UserID string
+	ListID      string
+	TaskEventID string
+	TaskID      string
+	UserID      string
 )
 
 type Task struct {
@@ -28,6 +29,34 @@ type Task struct {
 	Body      string
 	Tags      Tags
 	CreatedBy UserID
+	// ListID is the list that the task belongs to, or empty if the task isn't
+	// in a list.
+	ListID ListID
+	// ParentID is the task that this is a subtask of, or empty if it's a
+	// top-level task.
+	ParentID  TaskID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// CompletedAt is when the task was marked as done, or the zero value if
+	// the task hasn't been completed.
+	CompletedAt time.Time
+	// DueAt is when the task should be completed by, or the zero value if the
+	// task has no due date.
+	DueAt time.Time
+	// DeletedAt is when the task was moved to the trash, or the zero value if
+	// it hasn't been deleted.
+	DeletedAt time.Time
+	// Version is incremented every time the task is written, so that writers
+	// can tell whether it changed since they read it.
+	Version int
+}
+
+func (t *Task) IsCompleted() bool {
+	return !t.CompletedAt.IsZero()
+}
+
+func (t *Task) IsTrashed() bool {
+	return !t.DeletedAt.IsZero()
 }
 
 func (t *Task) Clone() *Task {
@@ -35,11 +64,19 @@ func (t *Task) Clone() *Task {
 		return nil
 	}
 	return &Task{
-		ID:        t.ID,
-		Name:      t.Name,
-		Body:      t.Body,
-		Tags:      t.Tags.Clone(),
-		CreatedBy: t.CreatedBy,
+		ID:          t.ID,
+		Name:        t.Name,
+		Body:        t.Body,
+		Tags:        t.Tags.Clone(),
+		CreatedBy:   t.CreatedBy,
+		ListID:      t.ListID,
+		ParentID:    t.ParentID,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+		CompletedAt: t.CompletedAt,
+		DueAt:       t.DueAt,
+		DeletedAt:   t.DeletedAt,
+		Version:     t.Version,
 	}
 }
 
@@ -69,12 +106,79 @@ func (in Tags) Clone() Tags {
 	return o
 }
 
-func (tags Tags) ToStored() string {
-	return strings.Join(tags, ",")
+// List is a named group of tasks, like a project.
+type List struct {
+	ID        ListID
+	Name      string
+	CreatedBy UserID
+	CreatedAt time.Time
+	// ArchivedAt is when the list was archived, or the zero value if the list
+	// hasn't been archived.
+	ArchivedAt time.Time
 }
 
-func TagsFromStored(in string) Tags {
-	return Tags(strings.Split(in, ","))
+func (l *List) IsArchived() bool {
+	return !l.ArchivedAt.IsZero()
+}
+
+func (l *List) Clone() *List {
+	if l == nil {
+		return nil
+	}
+	return &List{
+		ID:         l.ID,
+		Name:       l.Name,
+		CreatedBy:  l.CreatedBy,
+		CreatedAt:  l.CreatedAt,
+		ArchivedAt: l.ArchivedAt,
+	}
+}
+
+// TaskRole is the level of access a collaborator has to a task. The creator of
+// a task is always an owner of it.
+type TaskRole string
+
+const (
+	TaskRoleViewer = TaskRole("VIEWER")
+	TaskRoleEditor = TaskRole("EDITOR")
+	TaskRoleOwner  = TaskRole("OWNER")
+)
+
+var taskRoleRanks = map[TaskRole]int{
+	TaskRoleViewer: 1,
+	TaskRoleEditor: 2,
+	TaskRoleOwner:  3,
+}
+
+func (r TaskRole) IsValid() bool {
+	_, ok := taskRoleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether r grants everything that other does, e.g. an editor
+// is at least a viewer. The empty role isn't at least anything.
+func (r TaskRole) AtLeast(other TaskRole) bool {
+	rank, ok := taskRoleRanks[r]
+	return ok && rank >= taskRoleRanks[other]
+}
+
+// TaskCollaborator is a user that a task has been shared with.
+type TaskCollaborator struct {
+	TaskID TaskID
+	UserID UserID
+	Role   TaskRole
+}
+
+// TaskDependency records that a task can't be done until another task is.
+type TaskDependency struct {
+	TaskID      TaskID
+	BlockedByID TaskID
+}
+
+// TagUsage is how many of a user's tasks use a given tag.
+type TagUsage struct {
+	Tag       string
+	TaskCount int
 }
 
 type User struct {
@@ -84,6 +188,11 @@ type User struct {
 	CreatedAt         time.Time
 	AuthnProviderType authn.Provider
 	AuthnProviderID   authn.UserID
+	// Admin grants access to administrative features, like listing every user.
+	Admin bool
+	// Version is incremented every time the user is written, so that writers
+	// can tell whether it changed since they read it.
+	Version int
 }
 
 func (u *User) Clone() *User {
@@ -98,6 +207,35 @@ func (u *User) Clone() *User {
 		CreatedAt:         u.CreatedAt,
 		AuthnProviderType: u.AuthnProviderType,
 		AuthnProviderID:   u.AuthnProviderID,
+		Admin:             u.Admin,
+		Version:           u.Version,
+	}
+}
+
+// AuthIdentity is one way a user can sign in, like a Google account or an
+// email and password. A user can have several.
+type AuthIdentity struct {
+	UserID         UserID
+	Provider       authn.Provider
+	ProviderUserID authn.UserID
+	Email          string
+	// EmailVerified is whether the provider vouched for Email the last time
+	// the user signed in with this identity.
+	EmailVerified bool
+	CreatedAt     time.Time
+}
+
+func (a *AuthIdentity) Clone() *AuthIdentity {
+	if a == nil {
+		return nil
+	}
+	return &AuthIdentity{
+		UserID:         a.UserID,
+		Provider:       a.Provider,
+		ProviderUserID: a.ProviderUserID,
+		Email:          a.Email,
+		EmailVerified:  a.EmailVerified,
+		CreatedAt:      a.CreatedAt,
 	}
 }
 
@@ -110,7 +248,7 @@ func WithUserID(ctx context.Context, id UserID) context.Context {
 func UserIDFromContext(ctx context.Context) (UserID, error) {
 	u := ctx.Value(userIDContextKey{})
 	if u == nil {
-		return "", errors.New("tried to request a user_id from an anonymous context - check the user is logged in")
+		return "", errkind.New(errkind.Unauthenticated, "tried to request a user_id from an anonymous context - check the user is logged in")
 	}
 	userID, ok := u.(UserID)
 	if !ok {
@@ -0,0 +1,148 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+)
+
+// This block contains the rules for the free-form text fields of the domain
+// types. Values are normalized before they're checked, so callers should store
+// the value returned by Apply, not the one they were given.
+var (
+	TaskNameRule = TextRule{
+		Field:     "task.name",
+		Trim:      true,
+		MinLength: 1,
+		MaxLength: 200,
+	}
+	TaskBodyRule = TextRule{
+		Field:          "task.body",
+		MaxLength:      10000,
+		AllowMultiline: true,
+	}
+	TagRule = TextRule{
+		Field:       "task.tags",
+		Trim:        true,
+		Fold:        true,
+		MinLength:   1,
+		MaxLength:   50,
+		Allowed:     isTagRune,
+		AllowedDesc: "letters, numbers, spaces and any of " + tagPunctuation,
+	}
+	ListNameRule = TextRule{
+		Field:     "list.name",
+		Trim:      true,
+		MinLength: 1,
+		MaxLength: 200,
+	}
+	UserNameRule = TextRule{
+		Field:     "user.name",
+		Trim:      true,
+		MinLength: 1,
+		MaxLength: 100,
+	}
+)
+
+const tagPunctuation = "-_.:/&+#'"
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) || r == ' ' || strings.ContainsRune(tagPunctuation, r)
+}
+
+// TextRule describes which values a text field accepts, and how they're
+// normalized. Control characters are never allowed, except for newlines and
+// tabs in multiline fields.
+type TextRule struct {
+	// Field names the field in errors, like "task.name".
+	Field string
+	// Trim removes leading and trailing whitespace, and collapses runs of
+	// whitespace inside the value into a single space.
+	Trim bool
+	// Fold lower-cases the value, so that values that differ only in case are
+	// the same.
+	Fold bool
+	// MinLength and MaxLength are the bounds on the length of the normalized
+	// value in characters. A MaxLength of zero means there's no limit.
+	MinLength, MaxLength int
+	// AllowMultiline allows newlines and tabs. Windows line endings are
+	// normalized to '\n'.
+	AllowMultiline bool
+	// Allowed, if set, reports whether a character may appear in the value,
+	// and AllowedDesc describes the allowed characters for error messages.
+	Allowed     func(rune) bool
+	AllowedDesc string
+}
+
+// Normalize returns the value as it would be stored, without checking whether
+// it's valid.
+func (r TextRule) Normalize(value string) string {
+	if r.AllowMultiline {
+		value = strings.ReplaceAll(value, "\r\n", "\n")
+	}
+	if r.Trim {
+		value = strings.Join(strings.Fields(value), " ")
+	}
+	if r.Fold {
+		value = strings.ToLower(value)
+	}
+	return value
+}
+
+// Apply returns the normalized value, or an InvalidArgument error naming the
+// field if the normalized value breaks the rule.
+func (r TextRule) Apply(value string) (string, error) {
+	if !utf8.ValidString(value) {
+		return "", r.invalid("must be valid UTF-8")
+	}
+	value = r.Normalize(value)
+	n := utf8.RuneCountInString(value)
+	switch {
+	case n == 0 && r.MinLength > 0:
+		return "", r.invalid("must not be empty")
+	case n < r.MinLength:
+		return "", r.invalid(fmt.Sprintf("must be at least %d characters", r.MinLength))
+	case r.MaxLength > 0 && n > r.MaxLength:
+		return "", r.invalid(fmt.Sprintf("must be at most %d characters", r.MaxLength))
+	}
+	for _, c := range value {
+		if unicode.IsControl(c) && !(r.AllowMultiline && (c == '\n' || c == '\t')) {
+			return "", r.invalid(fmt.Sprintf("must not contain control character %U", c))
+		}
+		if r.Allowed != nil && !r.Allowed(c) {
+			return "", r.invalid(fmt.Sprintf("must only contain %s, not %q", r.AllowedDesc, c))
+		}
+	}
+	return value, nil
+}
+
+func (r TextRule) invalid(reason string) error {
+	return &errInvalidField{field: r.Field, reason: reason}
+}
+
+type errInvalidField struct {
+	field  string
+	reason string
+}
+
+func (e *errInvalidField) Error() string {
+	return fmt.Sprintf("%s %s", e.field, e.reason)
+}
+
+func (e *errInvalidField) Kind() errkind.Kind {
+	return errkind.InvalidArgument
+}
+
+// InvalidField returns the name of the field that err is about, and what's
+// wrong with its value, if err is (or wraps) an error from a TextRule.
+func InvalidField(err error) (field, reason string, ok bool) {
+	var e *errInvalidField
+	if !errors.As(err, &e) {
+		return "", "", false
+	}
+	return e.field, e.reason, true
+}
@@ -0,0 +1,111 @@
+package todo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Silicon-Ally/silicon-starter/errkind"
+)
+
+func TestTextRules(t *testing.T) {
+	tests := []struct {
+		desc      string
+		rule      TextRule
+		in        string
+		want      string
+		wantError bool
+	}{
+		{
+			desc: "name is trimmed",
+			rule: TaskNameRule,
+			in:   " \tBuy   milk\n",
+			want: "Buy milk",
+		},
+		{
+			desc:      "whitespace-only name",
+			rule:      TaskNameRule,
+			in:        " \n ",
+			wantError: true,
+		},
+		{
+			desc:      "name with control character",
+			rule:      UserNameRule,
+			in:        "Alice\x07",
+			wantError: true,
+		},
+		{
+			desc:      "name too long",
+			rule:      TaskNameRule,
+			in:        strings.Repeat("ä", 201),
+			wantError: true,
+		},
+		{
+			desc: "name at length limit",
+			rule: TaskNameRule,
+			in:   strings.Repeat("ä", 200),
+			want: strings.Repeat("ä", 200),
+		},
+		{
+			desc:      "list name too long",
+			rule:      ListNameRule,
+			in:        strings.Repeat("a", 201),
+			wantError: true,
+		},
+		{
+			desc: "empty body",
+			rule: TaskBodyRule,
+			in:   "",
+			want: "",
+		},
+		{
+			desc: "multiline body",
+			rule: TaskBodyRule,
+			in:   "  - one\r\n\t- two\n",
+			want: "  - one\n\t- two\n",
+		},
+		{
+			desc:      "body with control character",
+			rule:      TaskBodyRule,
+			in:        "a\x1bb",
+			wantError: true,
+		},
+		{
+			desc: "tag is folded",
+			rule: TagRule,
+			in:   "  Home  Repairs ",
+			want: "home repairs",
+		},
+		{
+			desc:      "tag with disallowed character",
+			rule:      TagRule,
+			in:        "a,b",
+			wantError: true,
+		},
+		{
+			desc:      "invalid UTF-8",
+			rule:      TagRule,
+			in:        "a\xffb",
+			wantError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := test.rule.Apply(test.in)
+			if test.wantError {
+				if !errkind.Is(err, errkind.InvalidArgument) {
+					t.Fatalf("expected an invalid argument error, got %q, %v", got, err)
+				}
+				if field, _, ok := InvalidField(err); !ok || field != test.rule.Field {
+					t.Errorf("error was for field %q, want %q", field, test.rule.Field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applying rule: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}